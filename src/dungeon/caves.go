@@ -0,0 +1,83 @@
+package dungeon
+
+import (
+	"world"
+)
+
+// growCaves fills the grid with rock at random, then lets a cellular
+// automaton smooth it into caves: a cell turns to rock when most of its eight
+// neighbors are rock.  Only the largest cave is kept, so that it is all
+// connected.  The grid is drawn again when that cave is too small, up to
+// maxCaveAttempts times; it returns false when all attempts fail.
+func growCaves(rng world.Rng, options Options) (world.Rng, grid, world.Location, bool) {
+	width, height := options.width(), options.height()
+	for attempt := 0; attempt < maxCaveAttempts; attempt++ {
+		plan := makeGrid(width, height)
+		// The outer ring stays rock, so that caves do not look cut.
+		for y := 1; y < height-1; y++ {
+			for x := 1; x < width-1; x++ {
+				var percent int
+				rng, percent = rng.Intn(100)
+				plan.set(x, y, percent >= options.fill())
+			}
+		}
+		for step := 0; step < options.steps(); step++ {
+			plan = smooth(plan)
+		}
+		cave := largestRegion(plan)
+		if len(cave) < width*height/minCaveFraction {
+			continue
+		}
+		kept := makeGrid(width, height)
+		for _, location := range cave {
+			kept.set(int(location.X), int(location.Y), true)
+		}
+		return rng, kept, cave[0], true
+	}
+	return rng, grid{}, world.Location{}, false
+}
+
+const (
+	maxCaveAttempts = 16
+	minCaveFraction = 8 // Caves smaller than 1/8 of the grid are not kept.
+)
+
+// smooth runs one step of the automaton.
+func smooth(plan grid) grid {
+	result := plan.copy()
+	for y := 0; y < plan.height; y++ {
+		for x := 0; x < plan.width; x++ {
+			rock := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if (dx != 0 || dy != 0) && !plan.get(x+dx, y+dy) {
+						rock++
+					}
+				}
+			}
+			solid := rock >= 5 || (!plan.get(x, y) && rock >= 4)
+			result.set(x, y, !solid)
+		}
+	}
+	return result
+}
+
+// largestRegion returns the largest set of connected floor cells.  Among
+// regions of the same size, the first one found row by row wins.
+func largestRegion(plan grid) []world.Location {
+	seen := makeGrid(plan.width, plan.height)
+	var largest []world.Location
+	for _, location := range plan.floors() {
+		if seen.get(int(location.X), int(location.Y)) {
+			continue
+		}
+		region := plan.region(location)
+		for _, cell := range region {
+			seen.set(int(cell.X), int(cell.Y), true)
+		}
+		if len(region) > len(largest) {
+			largest = region
+		}
+	}
+	return largest
+}
@@ -0,0 +1,16 @@
+// dungeon project doc.go
+
+/*
+dungeon generates whole levels from a seed.
+
+Generate draws the plan of a level in one of two styles: rooms joined by
+corridors, or caves grown by a cellular automaton.  It then builds the
+world.Level: floors with a ceiling above each of them, and walls wherever a
+floor meets the rock, on all four sides.  Every floor can be reached from
+every other one; this is checked with Level.IsPassable before the level is
+returned.  Monsters can be spawned on the way.
+
+Everything random is drawn from a world.Rng seeded with the given seed, in
+a fixed order, so the same seed and options always give the same level.
+*/
+package dungeon
@@ -0,0 +1,230 @@
+package dungeon
+
+import (
+	"world"
+)
+
+type Style int
+
+const (
+	STYLE_ROOMS = Style(iota) // Rectangular rooms joined by corridors.
+	STYLE_CAVES               // Caves grown by a cellular automaton.
+)
+
+var styleText = map[Style]string{
+	STYLE_ROOMS: "rooms",
+	STYLE_CAVES: "caves",
+}
+
+func (self Style) String() string {
+	return styleText[self]
+}
+
+type GenerateError int
+
+const (
+	GENERATE_BAD_OPTIONS = GenerateError(iota)
+	GENERATE_NO_SPACE
+	GENERATE_DISCONNECTED
+)
+
+var generateErrorText = map[GenerateError]string{
+	GENERATE_BAD_OPTIONS:  "the options make no sense",
+	GENERATE_NO_SPACE:     "no room or cave fits in the level",
+	GENERATE_DISCONNECTED: "the level is not all connected",
+}
+
+func (self GenerateError) Error() string {
+	return generateErrorText[self]
+}
+
+// The models the buildings of generated levels are drawn with.
+type Models struct {
+	Floor   world.ModelId
+	Ceiling world.ModelId
+	Wall    world.ModelId
+}
+
+// Options tune the generation.  The zero value makes a level of rooms with
+// the default sizes, and no monster.
+type Options struct {
+	Style    Style
+	Width    int // Of the level in tiles, DEFAULT_WIDTH when 0.
+	Height   int // Of the level in tiles, DEFAULT_HEIGHT when 0.
+	Rooms    int // Rooms tried by STYLE_ROOMS, DEFAULT_ROOMS when 0.
+	RoomMin  int // Shortest side of rooms, DEFAULT_ROOM_MIN when 0.
+	RoomMax  int // Longest side of rooms, DEFAULT_ROOM_MAX when 0.
+	Fill     int // Percent of rock before STYLE_CAVES grows, DEFAULT_FILL when 0.
+	Steps    int // Steps of the automaton of STYLE_CAVES, DEFAULT_STEPS when 0.
+	Monsters int // Monsters spawned, fewer when there is no more room.
+	Models   Models
+}
+
+const (
+	DEFAULT_WIDTH    = 40
+	DEFAULT_HEIGHT   = 30
+	DEFAULT_ROOMS    = 12
+	DEFAULT_ROOM_MIN = 3
+	DEFAULT_ROOM_MAX = 8
+	DEFAULT_FILL     = 45
+	DEFAULT_STEPS    = 4
+)
+
+func orDefault(value, defaultValue int) int {
+	if value == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func (self Options) width() int {
+	return orDefault(self.Width, DEFAULT_WIDTH)
+}
+
+func (self Options) height() int {
+	return orDefault(self.Height, DEFAULT_HEIGHT)
+}
+
+func (self Options) rooms() int {
+	return orDefault(self.Rooms, DEFAULT_ROOMS)
+}
+
+func (self Options) roomSides() (int, int) {
+	return orDefault(self.RoomMin, DEFAULT_ROOM_MIN), orDefault(self.RoomMax, DEFAULT_ROOM_MAX)
+}
+
+func (self Options) fill() int {
+	return orDefault(self.Fill, DEFAULT_FILL)
+}
+
+func (self Options) steps() int {
+	return orDefault(self.Steps, DEFAULT_STEPS)
+}
+
+func (self Options) valid() bool {
+	low, high := self.roomSides()
+	return self.width() >= 3 && self.height() >= 3 &&
+		self.rooms() > 0 && low > 0 && high >= low &&
+		self.fill() > 0 && self.fill() < 100 &&
+		self.steps() >= 0 && self.Monsters >= 0 &&
+		(self.Style == STYLE_ROOMS || self.Style == STYLE_CAVES)
+}
+
+// The four directions, in the order in which they are always tried.
+var directions = [...]world.AbsoluteDirection{
+	world.EAST(),
+	world.NORTH(),
+	world.WEST(),
+	world.SOUTH(),
+}
+
+// Generate makes a level from a seed.  The level spans from (0, 0) to
+// (width-1, height-1).  It also returns the entrance of the level: a floor
+// where no monster stands, ready for the player.
+func Generate(seed uint64, options Options, levelID world.LevelId) (world.Level, world.Location, error) {
+	if !options.valid() {
+		return world.Level{}, world.Location{}, GENERATE_BAD_OPTIONS
+	}
+	rng := world.MakeRng(seed)
+	var plan grid
+	var entrance world.Location
+	var ok bool
+	switch options.Style {
+	case STYLE_ROOMS:
+		rng, plan, entrance, ok = carveRooms(rng, options)
+	case STYLE_CAVES:
+		rng, plan, entrance, ok = growCaves(rng, options)
+	}
+	if !ok {
+		return world.Level{}, world.Location{}, GENERATE_NO_SPACE
+	}
+	level := build(plan, options.Models, levelID)
+	if !isConnected(level, entrance) {
+		return world.Level{}, world.Location{}, GENERATE_DISCONNECTED
+	}
+	level, err := spawnMonsters(rng, level, plan, entrance, options.Monsters)
+	if err != nil {
+		return world.Level{}, world.Location{}, err
+	}
+	return level, entrance, nil
+}
+
+// build turns the plan into a level.  Floors get a ceiling, and a wall on
+// each side that faces the rock.  Walls face into the tile of their floor.
+func build(plan grid, models Models, levelID world.LevelId) world.Level {
+	level := world.MakeLevel(levelID)
+	for _, location := range plan.floors() {
+		x, y := location.X, location.Y
+		level.Floors = level.Floors.Set(x, y, world.MakeFloor(models.Floor, world.EAST(), true))
+		level.Ceilings = level.Ceilings.Set(x, y, world.MakeOrientedBuilding(models.Ceiling, world.EAST()))
+		for _, direction := range directions {
+			dx, dy := direction.DxDy()
+			if plan.get(int(x+dx), int(y+dy)) {
+				continue
+			}
+			facing := direction.Add(world.BACK()).Value()
+			level.Walls[facing] = level.Walls[facing].Set(x, y, world.MakeWall(models.Wall, false))
+		}
+	}
+	return level
+}
+
+// isConnected tells whether all the floors of the level can be walked to
+// from the given location.
+func isConnected(level world.Level, start world.Location) bool {
+	if _, ok := level.Floors.Get(start.X, start.Y); !ok {
+		return false
+	}
+	reached := map[world.Location]bool{start: true}
+	queue := []world.Location{start}
+	for len(queue) > 0 {
+		location := queue[0]
+		queue = queue[1:]
+		for _, direction := range directions {
+			next := location.MoveAbsolute(direction, 1)
+			if reached[next] || !level.IsPassable(location, direction) {
+				continue
+			}
+			reached[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return len(reached) == level.Floors.Len()
+}
+
+// spawnMonsters adds monsters, each with its actor, on free floors chosen at
+// random.  The entrance stays free.
+func spawnMonsters(rng world.Rng, level world.Level, plan grid, entrance world.Location, count int) (world.Level, error) {
+	var free []world.Location
+	for _, location := range plan.floors() {
+		if location != entrance {
+			free = append(free, location)
+		}
+	}
+	for i := 0; i < count && len(free) > 0; i++ {
+		var index, facing int
+		rng, index = rng.Intn(len(free))
+		rng, facing = rng.Intn(len(directions))
+		location := free[index]
+		free = append(free[:index], free[index+1:]...)
+
+		creature := world.MakeCreature()
+		creature.F = directions[facing]
+		creature.Faction = world.FACTION_MONSTERS
+		creatures, creatureID := level.Creatures.Add(creature)
+		actors, actorID := level.Actors.Add(world.MakeActor())
+		creatureActor, err := level.CreatureActor.Add(creatureID, actorID)
+		if err != nil {
+			return level, err
+		}
+		creatureLocation, err := level.CreatureLocation.Add(creatureID, location)
+		if err != nil {
+			return level, err
+		}
+		level.Creatures = creatures
+		level.Actors = actors
+		level.CreatureActor = creatureActor
+		level.CreatureLocation = creatureLocation
+	}
+	return level, nil
+}
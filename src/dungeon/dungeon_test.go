@@ -0,0 +1,93 @@
+package dungeon
+
+import (
+	"bytes"
+	"testing"
+	"world"
+)
+
+var styles = [...]Style{STYLE_ROOMS, STYLE_CAVES}
+
+func encode(test *testing.T, level world.Level) string {
+	var text bytes.Buffer
+	if err := world.EncodeLevel(&text, level); err != nil {
+		test.Fatal(err)
+	}
+	return text.String()
+}
+
+func TestSameSeedSameLevel(test *testing.T) {
+	for _, style := range styles {
+		options := Options{Style: style, Monsters: 5}
+		a, entranceA, err := Generate(42, options, 0)
+		if err != nil {
+			test.Fatal(style, err)
+		}
+		b, entranceB, err := Generate(42, options, 0)
+		if err != nil {
+			test.Fatal(style, err)
+		}
+		if encode(test, a) != encode(test, b) || entranceA != entranceB {
+			test.Error(style, "two levels from the same seed differ")
+		}
+		c, _, err := Generate(43, options, 0)
+		if err != nil {
+			test.Fatal(style, err)
+		}
+		if encode(test, a) == encode(test, c) {
+			test.Error(style, "two levels from different seeds are the same")
+		}
+	}
+}
+
+func TestLevelsAreWhole(test *testing.T) {
+	for _, style := range styles {
+		for seed := uint64(0); seed < 20; seed++ {
+			level, entrance, err := Generate(seed, Options{Style: style, Monsters: 8}, 0)
+			if err != nil {
+				test.Fatal(style, seed, err)
+			}
+			if problems := level.Validate(); len(problems) != 0 {
+				test.Fatal(style, seed, problems)
+			}
+			if !isConnected(level, entrance) {
+				test.Fatal(style, seed, "not connected")
+			}
+			if _, ok := level.CreatureLocation.GetCreature(entrance); ok {
+				test.Error(style, seed, "a monster stands at the entrance")
+			}
+			if level.Creatures.Len() != 8 || level.Actors.Len() != 8 {
+				test.Error(style, seed, "monsters:", level.Creatures.Len(), level.Actors.Len())
+			}
+			level.Floors.ForEach(func(location world.Location, _ world.Building) {
+				if _, ok := level.Ceilings.Get(location.X, location.Y); !ok {
+					test.Error(style, seed, location, "has no ceiling")
+				}
+				for _, direction := range directions {
+					next := location.MoveAbsolute(direction, 1)
+					_, floor := level.Floors.Get(next.X, next.Y)
+					facing := direction.Add(world.BACK()).Value()
+					_, wall := level.Walls[facing].Get(location.X, location.Y)
+					if floor == wall {
+						test.Error(style, seed, location, direction, "floor", floor, "wall", wall)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestBadOptions(test *testing.T) {
+	bad := []Options{
+		{Width: 2},
+		{RoomMin: 5, RoomMax: 4},
+		{Style: STYLE_CAVES, Fill: 100},
+		{Monsters: -1},
+		{Style: Style(7)},
+	}
+	for _, options := range bad {
+		if _, _, err := Generate(0, options, 0); err != GENERATE_BAD_OPTIONS {
+			test.Error(options, err)
+		}
+	}
+}
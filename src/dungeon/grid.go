@@ -0,0 +1,73 @@
+package dungeon
+
+import (
+	"world"
+)
+
+// A grid is the plan of a level: true where there is floor, false where
+// there is rock.  The cell (x, y) becomes the tile at Location{x, y}.
+// Everything outside the grid is rock.
+type grid struct {
+	width, height int
+	cells         []bool
+}
+
+func makeGrid(width, height int) grid {
+	return grid{width, height, make([]bool, width*height)}
+}
+
+func (self grid) inside(x, y int) bool {
+	return x >= 0 && y >= 0 && x < self.width && y < self.height
+}
+
+func (self grid) get(x, y int) bool {
+	return self.inside(x, y) && self.cells[y*self.width+x]
+}
+
+// set changes the grid in place.  Cells outside the grid stay rock.
+func (self grid) set(x, y int, floor bool) {
+	if self.inside(x, y) {
+		self.cells[y*self.width+x] = floor
+	}
+}
+
+func (self grid) copy() grid {
+	result := makeGrid(self.width, self.height)
+	copy(result.cells, self.cells)
+	return result
+}
+
+// floors returns the floor cells, row by row from the south.
+func (self grid) floors() []world.Location {
+	var result []world.Location
+	for y := 0; y < self.height; y++ {
+		for x := 0; x < self.width; x++ {
+			if self.get(x, y) {
+				result = append(result, world.Location{X: world.Coord(x), Y: world.Coord(y)})
+			}
+		}
+	}
+	return result
+}
+
+// region returns the floor cells connected to the given one by steps along
+// x and y, in the order they were reached.
+func (self grid) region(start world.Location) []world.Location {
+	if !self.get(int(start.X), int(start.Y)) {
+		return nil
+	}
+	reached := makeGrid(self.width, self.height)
+	reached.set(int(start.X), int(start.Y), true)
+	result := []world.Location{start}
+	for i := 0; i < len(result); i++ {
+		for _, direction := range directions {
+			next := result[i].MoveAbsolute(direction, 1)
+			x, y := int(next.X), int(next.Y)
+			if self.get(x, y) && !reached.get(x, y) {
+				reached.set(x, y, true)
+				result = append(result, next)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+package dungeon
+
+import (
+	"world"
+)
+
+// A room is a rectangle of floor, bounds included.
+type room struct {
+	x0, y0, x1, y1 int
+}
+
+func (self room) center() (int, int) {
+	return (self.x0 + self.x1) / 2, (self.y0 + self.y1) / 2
+}
+
+// touches tells whether the rooms overlap, or are not separated by at least
+// one tile of rock.
+func (self room) touches(other room) bool {
+	return self.x0 <= other.x1+1 && other.x0 <= self.x1+1 &&
+		self.y0 <= other.y1+1 && other.y0 <= self.y1+1
+}
+
+// between returns a number in [low, high].
+func between(rng world.Rng, low, high int) (world.Rng, int) {
+	value := 0
+	rng, value = rng.Intn(high - low + 1)
+	return rng, low + value
+}
+
+// carveRooms draws rooms at random places of the grid, and joins each new
+// room to the previous one with a corridor.  Rooms that do not fit are
+// skipped.  The first room is the entrance.  It returns false when no room
+// fits.
+func carveRooms(rng world.Rng, options Options) (world.Rng, grid, world.Location, bool) {
+	plan := makeGrid(options.width(), options.height())
+	// Rooms keep one tile of rock between them and the sides of the grid.
+	low, high := options.roomSides()
+	if high > plan.width-2 {
+		high = plan.width - 2
+	}
+	if high > plan.height-2 {
+		high = plan.height - 2
+	}
+	if low > high {
+		return rng, plan, world.Location{}, false
+	}
+	var rooms []room
+	for i := 0; i < options.rooms(); i++ {
+		var width, height, x, y int
+		rng, width = between(rng, low, high)
+		rng, height = between(rng, low, high)
+		rng, x = between(rng, 1, plan.width-1-width)
+		rng, y = between(rng, 1, plan.height-1-height)
+		candidate := room{x, y, x + width - 1, y + height - 1}
+		fits := true
+		for _, other := range rooms {
+			fits = fits && !candidate.touches(other)
+		}
+		if !fits {
+			continue
+		}
+		for y := candidate.y0; y <= candidate.y1; y++ {
+			for x := candidate.x0; x <= candidate.x1; x++ {
+				plan.set(x, y, true)
+			}
+		}
+		if len(rooms) > 0 {
+			x0, y0 := rooms[len(rooms)-1].center()
+			x1, y1 := candidate.center()
+			rng = carveCorridor(rng, plan, x0, y0, x1, y1)
+		}
+		rooms = append(rooms, candidate)
+	}
+	if len(rooms) == 0 {
+		return rng, plan, world.Location{}, false
+	}
+	x, y := rooms[0].center()
+	return rng, plan, world.Location{X: world.Coord(x), Y: world.Coord(y)}, true
+}
+
+// carveCorridor draws a corridor with a single bend between two cells.  Which
+// way it goes first is drawn at random.
+func carveCorridor(rng world.Rng, plan grid, x0, y0, x1, y1 int) world.Rng {
+	var alongXFirst int
+	rng, alongXFirst = rng.Intn(2)
+	bendX, bendY := x1, y0
+	if alongXFirst == 0 {
+		bendX, bendY = x0, y1
+	}
+	carveLine(plan, x0, y0, bendX, bendY)
+	carveLine(plan, bendX, bendY, x1, y1)
+	return rng
+}
+
+// carveLine draws a straight line of floor, along x or along y.
+func carveLine(plan grid, x0, y0, x1, y1 int) {
+	dx, dy := sign(x1-x0), sign(y1-y0)
+	for x, y := x0, y0; ; x, y = x+dx, y+dy {
+		plan.set(x, y, true)
+		if x == x1 && y == y1 {
+			return
+		}
+	}
+}
+
+func sign(value int) int {
+	switch {
+	case value < 0:
+		return -1
+	case value > 0:
+		return 1
+	}
+	return 0
+}
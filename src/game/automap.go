@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/go-gl/gl"
+	"glm"
+	"glw"
+	"sort"
+	"world"
+)
+
+// automapViewMatrix is viewMatrix for the automap: the eye looks down on the
+// position from high above, with north up.
+func automapViewMatrix(pos world.Position) (glm.Matrix4, glm.Matrix4) {
+	const eyeZ = 10
+	Rd := glm.RotY(-90).Mult(glm.RotZ(-90))
+	Td := glm.Vector3{float64(-pos.X), float64(-pos.Y), -eyeZ}.Translation()
+	Ri := glm.RotZ(90).Mult(glm.RotY(90))
+	Ti := glm.Vector3{float64(pos.X), float64(pos.Y), eyeZ}.Translation()
+	Vd := Rd.Mult(Td) // Direct.
+	Vi := Ti.Mult(Ri) // Inverse.
+	return Vd, Vi
+}
+
+// renderAutomap draws, seen from above, the part of the level of the player
+// that the player explored, with an arrow where the player stands.
+func renderAutomap(programState programState) {
+	w := programState.World
+	levelPosition, ok := w.ActorPosition(w.Player_id)
+	if !ok {
+		panic("Could not find player's character position.")
+	}
+	level := w.Levels[levelPosition.Level].Explored(levelPosition.Level, w.Automap)
+	worldToEye, eyeToWorld := automapViewMatrix(levelPosition.Position)
+	programState.Gl.context.SetEyeToWld(eyeToWorld)
+	programState.Gl.context.UpdateCamera()
+
+	// A map is not lit by the torches of the level, it is all in plain sight.
+	programState.Gl.context.SetLights([]glw.Light{{
+		Color:  glm.Vector4{4, 4, 4, 0},
+		Origin: glm.Vector4{-1, 0, 0, 0}, // Toward the eye.
+	}})
+	programState.Gl.context.UpdateLights()
+
+	verticalPositions := make(map[world.ModelId]Positions)
+	horizontalPositions := make(map[world.ModelId]Positions)
+	// No ceilings, they would hide everything.
+	gatherBuildingsPositions(
+		horizontalPositions,
+		level.Floors,
+		0, 0,
+		nil,
+		worldToEye,
+	)
+	for i := 0; i < 4; i++ {
+		rot := glm.RotZ(180 + 90*float64(i))
+		gatherBuildingsPositions(
+			verticalPositions,
+			level.Walls[i],
+			0, 0,
+			&rot,
+			worldToEye,
+		)
+	}
+	gatherDoorsPositions(verticalPositions, level.Doors, worldToEye)
+	{
+		position := glm.Vector3{
+			float64(levelPosition.X),
+			float64(levelPosition.Y),
+			0,
+		}.Translation()
+		position = position.Mult(glm.RotZ(float64(90 * levelPosition.F.Value())))
+		horizontalPositions[arrowID] = Positions{worldToEye.Mult(position)}
+	}
+	gl.ClearColor(0.0, 0.0, 0.0, 0.0)
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	for rendererID, pos := range verticalPositions {
+		sort.Sort(pos)
+		programState.Gl.Shapes[rendererID].Render(pos)
+	}
+	for rendererID, pos := range horizontalPositions {
+		sort.Sort(pos)
+		programState.Gl.Shapes[rendererID].Render(pos)
+	}
+}
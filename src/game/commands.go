@@ -4,6 +4,7 @@ import (
 	"fmt"
 	glfw "github.com/go-gl/glfw3"
 	"ia"
+	"os"
 	"world"
 )
 
@@ -65,10 +66,154 @@ const (
 	commandRotateColumnRetrograde
 	commandPlaceMonster
 	commandRemoveMonster
+	commandPlaceDoor
+	commandRemoveDoor
+	commandPlaceCenterDoor
+	commandRemoveCenterDoor
+	commandPlaceItem
+	commandRemoveItem
+	commandPlaceMechanism
+	commandRemoveMechanism
+	commandPlaceTrigger
+	commandRemoveTrigger
+	commandWire
+	commandUnwire
+	commandPlaceLight
+	commandRemoveLight
+	commandPlaceProp
+	commandRemoveProp
+	commandPlaceSpinner
+	commandRemoveEffect
+	commandRemovePit
+	commandPlaceStairs
+	commandMarkDestination
+	commandPlaceTeleporter
+	commandPlacePit
+	commandClimb
+	commandOpenDoor
+	commandCloseDoor
+	commandLockDoor
+	commandUnlockDoor
+	commandUse
+	commandPickUp
+	commandDrop
+	commandThrow
+	commandEquip
+	commandAttack
 	commandSave
 	commandLoad
+	commandExportLevel
+	commandImportLevel
+	commandUndo
+	commandRedo
+	commandToggleAutomap
+	commandRecord
+	commandReplay
 )
 
+// The names of the commands, for the recordings.  They must never change, or
+// the recordings made before could not be read anymore.
+var commandNames = map[command]string{
+	commandForward:                 "forward",
+	commandBackward:                "backward",
+	commandStrafeLeft:              "strafe-left",
+	commandStrafeRight:             "strafe-right",
+	commandTurnLeft:                "turn-left",
+	commandTurnRight:               "turn-right",
+	commandPlaceFloor:              "place-floor",
+	commandPlaceCeiling:            "place-ceiling",
+	commandPlaceWall:               "place-wall",
+	commandPlaceColumn:             "place-column",
+	commandRemoveFloor:             "remove-floor",
+	commandRemoveCeiling:           "remove-ceiling",
+	commandRemoveWall:              "remove-wall",
+	commandRemoveColumn:            "remove-column",
+	commandRotateFloorDirect:       "rotate-floor-direct",
+	commandRotateFloorRetrograde:   "rotate-floor-retrograde",
+	commandRotateCeilingDirect:     "rotate-ceiling-direct",
+	commandRotateCeilingRetrograde: "rotate-ceiling-retrograde",
+	commandRotateColumnDirect:      "rotate-column-direct",
+	commandRotateColumnRetrograde:  "rotate-column-retrograde",
+	commandPlaceMonster:            "place-monster",
+	commandRemoveMonster:           "remove-monster",
+	commandPlaceDoor:               "place-door",
+	commandRemoveDoor:              "remove-door",
+	commandPlaceCenterDoor:         "place-center-door",
+	commandRemoveCenterDoor:        "remove-center-door",
+	commandPlaceItem:               "place-item",
+	commandRemoveItem:              "remove-item",
+	commandPlaceMechanism:          "place-mechanism",
+	commandRemoveMechanism:         "remove-mechanism",
+	commandPlaceTrigger:            "place-trigger",
+	commandRemoveTrigger:           "remove-trigger",
+	commandWire:                    "wire",
+	commandUnwire:                  "unwire",
+	commandPlaceLight:              "place-light",
+	commandRemoveLight:             "remove-light",
+	commandPlaceProp:               "place-prop",
+	commandRemoveProp:              "remove-prop",
+	commandPlaceSpinner:            "place-spinner",
+	commandRemoveEffect:            "remove-effect",
+	commandRemovePit:               "remove-pit",
+	commandPlaceStairs:             "place-stairs",
+	commandMarkDestination:         "mark-destination",
+	commandPlaceTeleporter:         "place-teleporter",
+	commandPlacePit:                "place-pit",
+	commandClimb:                   "climb",
+	commandOpenDoor:                "open-door",
+	commandCloseDoor:               "close-door",
+	commandLockDoor:                "lock-door",
+	commandUnlockDoor:              "unlock-door",
+	commandUse:                     "use",
+	commandPickUp:                  "pick-up",
+	commandDrop:                    "drop",
+	commandThrow:                   "throw",
+	commandEquip:                   "equip",
+	commandAttack:                  "attack",
+	commandSave:                    "save",
+	commandLoad:                    "load",
+	commandExportLevel:             "export-level",
+	commandImportLevel:             "import-level",
+	commandUndo:                    "undo",
+	commandRedo:                    "redo",
+	commandToggleAutomap:           "toggle-automap",
+	commandRecord:                  "record",
+	commandReplay:                  "replay",
+}
+
+var commandsByName = make(map[string]command, len(commandNames))
+
+func init() {
+	for command, name := range commandNames {
+		commandsByName[name] = command
+	}
+}
+
+func (self command) String() string {
+	if name, ok := commandNames[self]; ok {
+		return name
+	}
+	return fmt.Sprintf("command %d", int(self))
+}
+
+// Commands are encoded by name, their values change when commands are added.
+func (self command) GobEncode() ([]byte, error) {
+	name, ok := commandNames[self]
+	if !ok {
+		return nil, fmt.Errorf("%v has no name", self)
+	}
+	return []byte(name), nil
+}
+
+func (self *command) GobDecode(data []byte) error {
+	command, ok := commandsByName[string(data)]
+	if !ok {
+		return fmt.Errorf("unknown command %q", data)
+	}
+	*self = command
+	return nil
+}
+
 func commands(events []glfwKeyEvent) []command {
 	if len(events) == 0 {
 		return nil
@@ -119,6 +264,102 @@ func commands(events []glfwKeyEvent) []command {
 				} else {
 					result = append(result, commandRemoveMonster)
 				}
+			case glfw.KeyG:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandPlaceDoor)
+				} else {
+					result = append(result, commandRemoveDoor)
+				}
+			case glfw.KeyH:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandPlaceCenterDoor)
+				} else {
+					result = append(result, commandRemoveCenterDoor)
+				}
+			case glfw.KeyO:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandOpenDoor)
+				} else {
+					result = append(result, commandCloseDoor)
+				}
+			case glfw.KeyL:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandLockDoor)
+				} else {
+					result = append(result, commandUnlockDoor)
+				}
+			case glfw.KeyI:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandPlaceItem)
+				} else {
+					result = append(result, commandRemoveItem)
+				}
+			case glfw.KeyN:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandPlaceMechanism)
+				} else {
+					result = append(result, commandRemoveMechanism)
+				}
+			case glfw.KeyV:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandPlaceTrigger)
+				} else {
+					result = append(result, commandRemoveTrigger)
+				}
+			case glfw.KeyB:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandWire)
+				} else {
+					result = append(result, commandUnwire)
+				}
+			case glfw.KeyY:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandPlaceLight)
+				} else {
+					result = append(result, commandRemoveLight)
+				}
+			case glfw.KeyComma:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandPlaceProp)
+				} else {
+					result = append(result, commandRemoveProp)
+				}
+			case glfw.KeyMinus:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandPlaceSpinner)
+				} else {
+					result = append(result, commandRemoveEffect)
+				}
+			case glfw.KeyEqual:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandMarkDestination)
+				} else {
+					result = append(result, commandPlaceTeleporter)
+				}
+			case glfw.KeyBackslash:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandPlacePit)
+				} else {
+					result = append(result, commandRemovePit)
+				}
+			case glfw.KeyP:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandPickUp)
+				} else {
+					result = append(result, commandDrop)
+				}
+			case glfw.KeyJ:
+				result = append(result, commandThrow)
+			case glfw.KeyU:
+				result = append(result, commandEquip)
+			case glfw.KeySpace:
+				result = append(result, commandAttack)
+			case glfw.KeyEnter:
+				result = append(result, commandUse)
+			case glfw.KeyX:
+				result = append(result, commandPlaceStairs)
+			case glfw.KeyT:
+				result = append(result, commandClimb)
 			case glfw.KeyLeftBracket:
 				result = append(result, commandRotateCeilingDirect)
 			case glfw.KeyRightBracket:
@@ -135,6 +376,22 @@ func commands(events []glfwKeyEvent) []command {
 				result = append(result, commandSave)
 			case glfw.KeyF5:
 				result = append(result, commandLoad)
+			case glfw.KeyF6:
+				result = append(result, commandExportLevel)
+			case glfw.KeyF7:
+				result = append(result, commandImportLevel)
+			case glfw.KeyTab:
+				result = append(result, commandToggleAutomap)
+			case glfw.KeyF8:
+				result = append(result, commandRecord)
+			case glfw.KeyF9:
+				result = append(result, commandReplay)
+			case glfw.KeyZ:
+				if event.mods&glfw.ModShift == 0 {
+					result = append(result, commandUndo)
+				} else {
+					result = append(result, commandRedo)
+				}
 			}
 		}
 	}
@@ -164,24 +421,73 @@ func commandToAction(command command, subjectID world.ActorID) ia.Action {
 			SubjectID: subjectID,
 			Direction: world.FRONT(),
 			Steps:     1,
+			Attack:    true,
 		}
 	case commandStrafeLeft:
 		action = ia.ActionMoveRelative{
 			SubjectID: subjectID,
 			Direction: world.LEFT(),
 			Steps:     1,
+			Attack:    true,
 		}
 	case commandBackward:
 		action = ia.ActionMoveRelative{
 			SubjectID: subjectID,
 			Direction: world.BACK(),
 			Steps:     1,
+			Attack:    true,
 		}
 	case commandStrafeRight:
 		action = ia.ActionMoveRelative{
 			SubjectID: subjectID,
 			Direction: world.RIGHT(),
 			Steps:     1,
+			Attack:    true,
+		}
+	case commandClimb:
+		action = ia.ActionClimb{
+			SubjectID: subjectID,
+		}
+	case commandOpenDoor:
+		action = ia.ActionOpenDoor{
+			SubjectID: subjectID,
+		}
+	case commandCloseDoor:
+		action = ia.ActionCloseDoor{
+			SubjectID: subjectID,
+		}
+	case commandLockDoor:
+		action = ia.ActionLockDoor{
+			SubjectID: subjectID,
+		}
+	case commandUnlockDoor:
+		action = ia.ActionUnlockDoor{
+			SubjectID: subjectID,
+		}
+	case commandUse:
+		action = ia.ActionUse{
+			SubjectID: subjectID,
+		}
+	// The item actions below work on the item picked up last.
+	case commandPickUp:
+		action = ia.ActionPickUp{
+			SubjectID: subjectID,
+		}
+	case commandDrop:
+		action = ia.ActionDrop{
+			SubjectID: subjectID,
+		}
+	case commandThrow:
+		action = ia.ActionThrow{
+			SubjectID: subjectID,
+		}
+	case commandEquip:
+		action = ia.ActionEquip{
+			SubjectID: subjectID,
+		}
+	case commandAttack:
+		action = ia.ActionAttack{
+			SubjectID: subjectID,
 		}
 	}
 	return action
@@ -208,7 +514,32 @@ func commandsToAction(commands []command, subjectID world.ActorID) (ia.Action, [
 	return actionResult, commandsResult
 }
 
-func levelCommand(level world.Level, position world.Position, command command) world.Level {
+// isLevelCommand tells whether a command edits the level around the player,
+// see levelCommand.
+func isLevelCommand(command command) bool {
+	switch command {
+	case commandPlaceFloor, commandPlaceCeiling, commandPlaceWall, commandPlaceColumn,
+		commandRemoveFloor, commandRemoveCeiling, commandRemoveWall, commandRemoveColumn,
+		commandRotateFloorDirect, commandRotateFloorRetrograde,
+		commandRotateCeilingDirect, commandRotateCeilingRetrograde,
+		commandRotateColumnDirect, commandRotateColumnRetrograde,
+		commandPlaceMonster, commandRemoveMonster,
+		commandPlaceDoor, commandRemoveDoor, commandPlaceCenterDoor, commandRemoveCenterDoor,
+		commandPlaceItem, commandRemoveItem,
+		commandPlaceMechanism, commandRemoveMechanism,
+		commandPlaceTrigger, commandRemoveTrigger, commandWire, commandUnwire,
+		commandPlaceLight, commandRemoveLight, commandPlaceProp, commandRemoveProp,
+		commandPlaceSpinner, commandRemoveEffect, commandRemovePit:
+		return true
+	}
+	return false
+}
+
+// levelCommand returns the edit a command makes in the level of the player.
+// Commands that only change buildings compute the level after the edit, the
+// Deltas come from comparing the buildings around the player.
+func levelCommand(level world.Level, levelID world.LevelId, position world.Position, command command) world.Delta {
+	before := level
 	hereX, hereY := position.X, position.Y
 	there := position.MoveForward(1)
 	thereX, thereY := there.X, there.Y
@@ -225,6 +556,12 @@ func levelCommand(level world.Level, position world.Position, command command) w
 			// to face the player.
 			facing := position.F.Add(world.BACK())
 			index := facing.Value()
+			// A wall replaces both sides of a door.
+			level = level.RemoveDoor(world.DoorSlot{
+				Location: position.Location,
+				In_wall:  true,
+				Facing:   facing,
+			})
 			wall := world.MakeWall(wallID, false)
 			level.Walls[index] = level.Walls[index].Set(hereX, hereY, wall)
 		}
@@ -232,7 +569,7 @@ func levelCommand(level world.Level, position world.Position, command command) w
 		level.Columns = level.Columns.Set(thereX, thereY, world.MakeOrientedBuilding(columnID, world.EAST()))
 	case commandRotateFloorDirect, commandRotateFloorRetrograde:
 		{
-			building := level.Floors[world.Location{X: thereX, Y: thereY}]
+			building, _ := level.Floors.Get(thereX, thereY)
 			floor, ok := building.(world.Floor)
 			if ok {
 				var relDir world.RelativeDirection
@@ -255,7 +592,7 @@ func levelCommand(level world.Level, position world.Position, command command) w
 			} else {
 				relDir = world.RIGHT()
 			}
-			column := level.Columns[world.Location{X: thereX, Y: thereY}]
+			column, _ := level.Columns.Get(thereX, thereY)
 			orientable, ok := column.(world.OrientedBuilding)
 			if ok {
 				orientable.F = orientable.F.Add(relDir)
@@ -272,7 +609,7 @@ func levelCommand(level world.Level, position world.Position, command command) w
 			} else {
 				relDir = world.RIGHT()
 			}
-			ceiling := level.Ceilings[world.Location{X: thereX, Y: thereY}]
+			ceiling, _ := level.Ceilings.Get(thereX, thereY)
 			orientable, ok := ceiling.(world.OrientedBuilding)
 			if ok {
 				orientable.F = orientable.F.Add(relDir)
@@ -293,6 +630,11 @@ func levelCommand(level world.Level, position world.Position, command command) w
 			// to face the player.
 			facing := position.F.Add(world.BACK())
 			index := facing.Value()
+			level = level.RemoveDoor(world.DoorSlot{
+				Location: position.Location,
+				In_wall:  true,
+				Facing:   facing,
+			})
 			level.Walls[index] = level.Walls[index].Delete(hereX, hereY)
 		}
 
@@ -300,50 +642,566 @@ func levelCommand(level world.Level, position world.Position, command command) w
 		{
 			creature := world.MakeCreature()
 			creature.F = position.F
-			creatures, creatureID := level.Creatures.Add(creature)
-			actors, actorID := level.Actors.Add(world.MakeActor())
-			creatureActors, err := level.CreatureActor.Add(creatureID, actorID)
-			if err != nil {
-				fmt.Println(err)
+			creature.Faction = world.FACTION_MONSTERS
+			_, creatureID := level.Creatures.Add(creature)
+			_, actorID := level.Actors.Add(world.MakeActor())
+			return world.DeltaCreaturePlaced{
+				Level:    levelID,
+				Creature: creatureID,
+				Actor:    actorID,
+				Location: there.Location,
+				Value:    creature,
+				Placed:   true,
+			}
+		}
+	case commandRemoveMonster:
+		{
+			// The monster drops what it carries before it goes.
+			creatureID, ok := level.CreatureLocation.GetCreature(there.Location)
+			if !ok {
 				break
 			}
-			creatureLocations, err := level.CreatureLocation.Add(creatureID, there.ToLocation())
-			if err != nil {
-				fmt.Println(err)
+			deltas := world.Deltas{}
+			for _, itemID := range level.Inventories.Get(creatureID).Items() {
+				from, _ := level.ItemPlace(itemID)
+				deltas = append(deltas, world.DeltaItemMoved{
+					Level: levelID,
+					Item:  itemID,
+					From:  from,
+					To:    world.OnGround(there.Location),
+				})
+			}
+			creature, _ := level.Creatures.Get(creatureID)
+			actorID, _ := level.CreatureActor.GetActor(creatureID)
+			return append(deltas, world.DeltaCreaturePlaced{
+				Level:    levelID,
+				Creature: creatureID,
+				Actor:    actorID,
+				Location: there.Location,
+				Value:    creature,
+			})
+		}
+	case commandPlaceDoor, commandRemoveDoor:
+		{
+			// Doors in walls are placed like walls, on both sides at once.
+			facing := position.F.Add(world.BACK())
+			slot := world.DoorSlot{
+				Location: position.Location,
+				In_wall:  true,
+				Facing:   facing,
+			}
+			if command == commandPlaceDoor {
+				door := world.MakeDoor(doorID, world.DOOR_CLOSED, facing)
+				level = level.SetDoor(slot, door)
+			} else {
+				level = level.RemoveDoor(slot)
+			}
+		}
+	case commandPlaceCenterDoor:
+		{
+			slot := world.DoorSlot{Location: there.Location}
+			door := world.MakeDoor(doorCenterID, world.DOOR_CLOSED, position.F)
+			level = level.SetDoor(slot, door)
+		}
+	case commandRemoveCenterDoor:
+		level = level.RemoveDoor(world.DoorSlot{Location: there.Location})
+	case commandPlaceItem:
+		{
+			// No item editor yet, all the items are swords.
+			sword := world.MakeItem(itemID, "sword", world.EQUIP_HAND)
+			sword.Weapon = world.Weapon{Dice: 1, Sides: 6, Type: world.DAMAGE_SLASH}
+			_, newItemID := level.Items.Add(sword)
+			return world.DeltaItemPlaced{
+				Level:    levelID,
+				Item:     newItemID,
+				Location: there.Location,
+				Value:    sword,
+				Placed:   true,
+			}
+		}
+	case commandRemoveItem:
+		{
+			topID, ok := level.ItemLocation.Top(there.Location)
+			if !ok {
 				break
 			}
-			level.Creatures = creatures
-			level.Actors = actors
-			level.CreatureActor = creatureActors
-			level.CreatureLocation = creatureLocations
+			item, _ := level.Items.Get(topID)
+			return world.DeltaItemPlaced{Level: levelID, Item: topID, Location: there.Location, Value: item}
 		}
-	case commandRemoveMonster:
+	case commandPlaceMechanism:
+		{
+			kind, anchor := frontMechanism(level, position)
+			mechanism := world.MakeMechanism(kind, anchor)
+			_, actorID := level.AddMechanism(mechanism)
+			return world.DeltaMechanismPlaced{Level: levelID, Actor: actorID, Value: mechanism, Placed: true}
+		}
+	case commandRemoveMechanism:
+		{
+			// The wires leading to the mechanism go first.
+			_, anchor := frontMechanism(level, position)
+			deltas := world.Deltas{}
+			for _, actorID := range level.Actors.Ids() {
+				mechanism, ok := level.Mechanisms.Get(actorID)
+				if !ok || mechanism.Anchor != anchor {
+					continue
+				}
+				var wires world.Deltas
+				level, wires = unwire(level, levelID, world.MechanismTarget(actorID))
+				deltas = append(deltas, wires...)
+				deltas = append(deltas, world.DeltaMechanismPlaced{Level: levelID, Actor: actorID, Value: mechanism})
+			}
+			return deltas
+		}
+	case commandPlaceTrigger:
 		{
-			fmt.Printf("Not implemented.")
+			kind, anchor := frontTrigger(level, position)
+			if _, _, ok := level.Triggers.At(anchor); ok {
+				break
+			}
+			trigger := world.MakeTrigger(kind, anchor)
+			_, triggerID := level.Triggers.Add(trigger)
+			return world.DeltaTriggerPlaced{Level: levelID, Trigger: triggerID, Value: trigger, Placed: true}
+		}
+	case commandRemoveTrigger:
+		{
+			_, anchor := frontTrigger(level, position)
+			if triggerID, trigger, ok := level.Triggers.At(anchor); ok {
+				return world.DeltaTriggerPlaced{Level: levelID, Trigger: triggerID, Value: trigger}
+			}
+		}
+	case commandWire, commandUnwire:
+		{
+			target, ok := frontTarget(level, position)
+			if !ok {
+				fmt.Println("Nothing to wire there.")
+				break
+			}
+			if command == commandUnwire {
+				_, deltas := unwire(level, levelID, target)
+				return deltas
+			}
+			// The trigger placed last gets the wire.
+			ids := level.Triggers.Ids()
+			if len(ids) == 0 {
+				fmt.Println("No trigger to wire.")
+				break
+			}
+			triggerID := ids[len(ids)-1]
+			trigger, _ := level.Triggers.Get(triggerID)
+			return world.DeltaTriggerWired{
+				Level:   levelID,
+				Trigger: triggerID,
+				Before:  trigger.Wires,
+				After:   trigger.Connect(target, world.WIRE_FOLLOW).Wires,
+			}
+		}
+	case commandPlaceLight:
+		{
+			anchor := frontLight(level, position)
+			if _, _, ok := level.Lights.At(anchor); ok {
+				break
+			}
+			light := world.LightSource{Light: world.MakeTorch(), Anchor: anchor}
+			_, lightID := level.Lights.Add(light)
+			return world.DeltaLightPlaced{Level: levelID, Light: lightID, Value: light, Placed: true}
+		}
+	case commandRemoveLight:
+		if lightID, light, ok := level.Lights.At(frontLight(level, position)); ok {
+			return world.DeltaLightPlaced{Level: levelID, Light: lightID, Value: light}
+		}
+	case commandPlaceProp:
+		{
+			// Placing a prop where there is one already changes the way it moves.
+			deltas := world.Deltas{}
+			animation := world.ANIMATION_SPIN
+			existingID, prop, ok := level.Props.At(there.Location)
+			if ok {
+				animation = (prop.Animation + 1) % world.ANIMATION_KINDS
+				deltas = append(deltas, world.DeltaPropPlaced{Level: levelID, Prop: existingID, Value: prop})
+			}
+			prop = world.MakeProp(propID, there.Location, animation)
+			fmt.Println("Prop:", animation)
+			_, newPropID := level.Props.Add(prop)
+			return append(deltas, world.DeltaPropPlaced{Level: levelID, Prop: newPropID, Value: prop, Placed: true})
+		}
+	case commandRemoveProp:
+		if existingID, prop, ok := level.Props.At(there.Location); ok {
+			return world.DeltaPropPlaced{Level: levelID, Prop: existingID, Value: prop}
+		}
+	case commandPlaceSpinner:
+		{
+			// Placing a spinner where there is one already turns it a bit more.
+			turns := 1
+			if _, effect, ok := level.Effects.At(there.Location); ok && effect.Kind == world.EFFECT_SPINNER {
+				turns = effect.Turns%3 + 1
+			}
+			fmt.Println("Spinner:", turns, "quarter turns to the left")
+			return placeEffect(level, levelID, world.MakeSpinner(there.Location, turns))
+		}
+	case commandRemoveEffect:
+		if effectID, effect, ok := level.Effects.At(there.Location); ok {
+			return world.DeltaFloorEffectPlaced{Level: levelID, Effect: effectID, Value: effect}
+		}
+	case commandRemovePit:
+		if pit, ok := level.Floors.Get(thereX, thereY); ok {
+			if _, ok := pit.(world.Pit); ok {
+				level.Floors = level.Floors.Set(thereX, thereY, world.MakeFloor(floorID, world.EAST(), true))
+			}
+		}
+	}
+	return world.BuildingDeltas(levelID, before, level, position.Location, there.Location)
+}
+
+// unwire returns the Deltas that disconnect the triggers of a level from a
+// target, along with the level once disconnected.
+func unwire(level world.Level, levelID world.LevelId, target world.Target) (world.Level, world.Deltas) {
+	deltas := world.Deltas{}
+	for _, triggerID := range level.Triggers.Ids() {
+		trigger, _ := level.Triggers.Get(triggerID)
+		disconnected := trigger.Disconnect(target)
+		if len(disconnected.Wires) != len(trigger.Wires) {
+			level.Triggers = level.Triggers.Set(triggerID, disconnected)
+			deltas = append(deltas, world.DeltaTriggerWired{
+				Level:   levelID,
+				Trigger: triggerID,
+				Before:  trigger.Wires,
+				After:   disconnected.Wires,
+			})
 		}
 	}
-	return level
+	return level, deltas
+}
+
+// placeEffect returns the Deltas that put a floor effect in a level, in place
+// of the one that was there.
+func placeEffect(level world.Level, levelID world.LevelId, effect world.FloorEffect) world.Delta {
+	deltas := world.Deltas{}
+	if existingID, existing, ok := level.Effects.At(effect.Location); ok {
+		deltas = append(deltas, world.DeltaFloorEffectPlaced{Level: levelID, Effect: existingID, Value: existing})
+	}
+	_, effectID := level.Effects.Add(effect)
+	return append(deltas, world.DeltaFloorEffectPlaced{Level: levelID, Effect: effectID, Value: effect, Placed: true})
+}
+
+// frontTrigger tells which trigger the editor puts in front of the player: a
+// lever on the wall facing the player, or else a pressure plate on the next
+// tile.
+func frontTrigger(level world.Level, position world.Position) (world.TriggerKind, world.Anchor) {
+	facing := position.F.Add(world.BACK())
+	if _, ok := level.Walls[facing.Value()].Get(position.X, position.Y); ok {
+		return world.TRIGGER_LEVER, world.Anchor{
+			Location: position.Location,
+			On_wall:  true,
+			Facing:   facing,
+		}
+	}
+	return world.TRIGGER_PLATE, world.Anchor{
+		Location: position.MoveForward(1).Location,
+		Facing:   position.F,
+	}
+}
+
+// frontLight tells where the editor puts a light in front of the player: a
+// torch on the wall facing the player, or else a brazier on the next tile.
+func frontLight(level world.Level, position world.Position) world.Anchor {
+	_, anchor := frontTrigger(level, position)
+	return anchor
+}
+
+// frontTarget tells what the editor wires in front of the player: the door,
+// the light, the floor effect, the pit, or else the mechanism the editor would
+// place there.
+func frontTarget(level world.Level, position world.Position) (world.Target, bool) {
+	if slot, _, ok := level.FrontDoor(position); ok {
+		return world.DoorTarget(slot), true
+	}
+	if lightID, _, ok := level.Lights.At(frontLight(level, position)); ok {
+		return world.LightTarget(lightID), true
+	}
+	there := position.MoveForward(1)
+	if effectID, _, ok := level.Effects.At(there.Location); ok {
+		return world.FloorEffectTarget(effectID), true
+	}
+	if floor, ok := level.Floors.Get(there.X, there.Y); ok {
+		if _, ok := floor.(world.Pit); ok {
+			return world.PitTarget(there.Location), true
+		}
+	}
+	_, anchor := frontMechanism(level, position)
+	var target world.Target
+	found := false
+	level.Mechanisms.ForEach(func(actorID world.ActorID, mechanism world.Mechanism) {
+		if mechanism.Anchor == anchor {
+			target, found = world.MechanismTarget(actorID), true
+		}
+	})
+	return target, found
+}
+
+// frontMechanism tells which mechanism the editor puts in front of the player:
+// a timed gate on a door, an arrow launcher in a wall shooting at the player,
+// or else a crusher on the next tile.
+func frontMechanism(level world.Level, position world.Position) (world.MechanismKind, world.Anchor) {
+	if slot, _, ok := level.FrontDoor(position); ok {
+		return world.MECHANISM_TIMED_GATE, world.Anchor{
+			Location: slot.Location,
+			On_wall:  slot.In_wall,
+			Facing:   slot.Facing,
+		}
+	}
+	facing := position.F.Add(world.BACK())
+	if _, ok := level.Walls[facing.Value()].Get(position.X, position.Y); ok {
+		return world.MECHANISM_ARROW_LAUNCHER, world.Anchor{
+			Location: position.Location,
+			On_wall:  true,
+			Facing:   facing,
+		}
+	}
+	return world.MECHANISM_CRUSHER, world.Anchor{
+		Location: position.MoveForward(1).Location,
+		Facing:   position.F,
+	}
+}
+
+// placeStairs digs stairs in front of the player, leading to a brand new
+// level.  Stairs leading back are placed in the new level, so that whoever
+// arrives there can climb back.
+func placeStairs(w world.World, position world.LevelPosition) world.Delta {
+	there := position.MoveForward(1)
+	_, newLevelID := w.AddLevel()
+	// No mesh for stairs yet, they look like floors.
+	down := world.MakeStairs(
+		floorID,
+		world.EAST(),
+		there.ToLevelPosition(newLevelID),
+	)
+	up := world.MakeStairs(
+		floorID,
+		world.EAST(),
+		there.ToLevelPosition(position.Level),
+	)
+	floor, _ := w.Levels[position.Level].Floors.Get(there.X, there.Y)
+	return world.Deltas{
+		world.DeltaLevelAdded{Level: newLevelID, Added: true},
+		world.DeltaBuildingChanged{
+			Level:    position.Level,
+			Layer:    world.LAYER_FLOORS,
+			Location: there.Location,
+			Before:   floor,
+			After:    down,
+		},
+		world.DeltaBuildingChanged{
+			Level:    newLevelID,
+			Layer:    world.LAYER_FLOORS,
+			Location: there.Location,
+			After:    up,
+		},
+	}
+}
+
+// placeTeleporter puts a teleporter in front of the player, leading to the
+// destination.  It replaces the floor effect that was there.
+func placeTeleporter(level world.Level, levelID world.LevelId, position world.Position, destination world.LevelPosition) world.Delta {
+	there := position.MoveForward(1)
+	return placeEffect(level, levelID, world.MakeTeleporter(there.Location, destination, false))
+}
+
+// placePit digs a pit in front of the player, leading to the destination.
+// Digging where there is a pit already hides it if it was open, closes it if
+// it was hidden, and opens it if it was closed.
+func placePit(level world.Level, levelID world.LevelId, position world.Position, destination world.LevelPosition) world.Delta {
+	there := position.MoveForward(1)
+	building, _ := level.Floors.Get(there.X, there.Y)
+	pit, ok := building.(world.Pit)
+	switch {
+	case !ok:
+		pit = world.MakePit(floorID, world.EAST(), true, destination.ToLevelLocation())
+	case pit.IsGaping():
+		pit.Hidden = true
+	case pit.Open:
+		pit.Open, pit.Hidden = false, false
+	default:
+		pit.Open = true
+	}
+	fmt.Printf("Pit: open %v, hidden %v.\n", pit.Open, pit.Hidden)
+	return world.DeltaBuildingChanged{
+		Level:    levelID,
+		Layer:    world.LAYER_FLOORS,
+		Location: there.Location,
+		Before:   building,
+		After:    pit,
+	}
+}
+
+// levelFileName returns the name of the text file a level is exported to and
+// imported from.
+func levelFileName(levelID world.LevelId) string {
+	return fmt.Sprintf("level%v.txt", levelID)
+}
+
+// exportLevel writes the level of the player as text.  The player is not part
+// of the level, it is not exported.
+func exportLevel(w world.World) error {
+	levelID, ok := w.PlayerLevel()
+	if !ok {
+		return fmt.Errorf("player is in no level")
+	}
+	creatureID, _ := w.Levels[levelID].CreatureActor.GetCreature(w.Player_id)
+	level, _, err := w.Levels[levelID].TakeCreature(creatureID)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(levelFileName(levelID))
+	if err != nil {
+		return err
+	}
+	err = world.EncodeLevel(f, level)
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// importLevel replaces the level of the player with the one read from text.
+// The player is kept where it stands.
+func importLevel(w world.World) (world.World, error) {
+	levelID, ok := w.PlayerLevel()
+	if !ok {
+		return w, fmt.Errorf("player is in no level")
+	}
+	position, _ := w.Levels[levelID].ActorPosition(w.Player_id)
+	f, err := os.Open(levelFileName(levelID))
+	if err != nil {
+		return w, err
+	}
+	defer f.Close()
+	level, err := world.DecodeLevel(f, levelID)
+	if err != nil {
+		return w, err
+	}
+	creatureID, _ := w.Levels[levelID].CreatureActor.GetCreature(w.Player_id)
+	_, player, err := w.Levels[levelID].TakeCreature(creatureID)
+	if err != nil {
+		return w, err
+	}
+	level, err = level.PutCreature(player, position)
+	if err != nil {
+		return w, err
+	}
+	return w.ReplaceLevel(levelID, level), nil
+}
+
+// applyEdit applies an edit of the level editor to the World, and records it
+// in the history.
+func applyEdit(programState programState, delta world.Delta) programState {
+	edited, err := delta.Apply(programState.World)
+	if err != nil {
+		fmt.Println("Edit:", err)
+		return programState
+	}
+	programState.World = edited
+	programState.History = programState.History.record(delta)
+	return programState
 }
 
 func executeCommands(programState programState, commands []command) programState {
 	for _, command := range commands {
 		switch {
-		case command < commandSave:
-			position, ok := programState.World.Level.ActorPosition(programState.World.Player_id)
+		case isLevelCommand(command):
+			position, ok := programState.World.ActorPosition(programState.World.Player_id)
 			if !ok {
 				break
 			}
 			// Modify the world around the player character.
-			programState.World.Level = levelCommand(programState.World.Level, position, command)
+			level := programState.World.Levels[position.Level]
+			programState = applyEdit(programState, levelCommand(level, position.Level, position.Position, command))
+		case command == commandPlaceStairs:
+			position, ok := programState.World.ActorPosition(programState.World.Player_id)
+			if !ok {
+				break
+			}
+			programState = applyEdit(programState, placeStairs(programState.World, position))
+		case command == commandMarkDestination:
+			position, ok := programState.World.ActorPosition(programState.World.Player_id)
+			if !ok {
+				break
+			}
+			programState.Destination = position
+			programState.Marked = true
+			fmt.Printf("Teleporters and pits now lead to level %v %v.\n", position.Level, position.Location)
+		case command == commandPlaceTeleporter:
+			position, ok := programState.World.ActorPosition(programState.World.Player_id)
+			if !ok {
+				break
+			}
+			if !programState.Marked {
+				fmt.Println("Mark the destination of the teleporter first.")
+				break
+			}
+			level := programState.World.Levels[position.Level]
+			programState = applyEdit(programState, placeTeleporter(level, position.Level, position.Position, programState.Destination))
+		case command == commandPlacePit:
+			position, ok := programState.World.ActorPosition(programState.World.Player_id)
+			if !ok {
+				break
+			}
+			level := programState.World.Levels[position.Level]
+			there := position.MoveForward(1)
+			floor, _ := level.Floors.Get(there.X, there.Y)
+			if _, isPit := floor.(world.Pit); !isPit && !programState.Marked {
+				fmt.Println("Mark where the pit leads first.")
+				break
+			}
+			programState = applyEdit(programState, placePit(level, position.Level, position.Position, programState.Destination))
 		case command == commandSave:
-			err := programState.World.Save()
+			err := programState.World.SaveSlot(world.QUICKSAVE_SLOT)
 			fmt.Println("Save:", err)
 		case command == commandLoad:
-			world, err := world.Load()
-			fmt.Println("Load:", err)
+			loaded, header, err := world.LoadSlot(world.QUICKSAVE_SLOT)
+			if err != nil {
+				saveErr, ok := err.(world.SaveError)
+				switch {
+				case ok && saveErr.Kind == world.SAVE_MISSING:
+					fmt.Println("Load: nothing to load.")
+				case ok && saveErr.Kind == world.SAVE_INVALID:
+					fmt.Printf("Load: the saved world is inconsistent:\n%v\n", saveErr.Err)
+				default:
+					fmt.Println("Load:", err)
+				}
+				break
+			}
+			fmt.Printf(
+				"Load: version %v, level %q, saved %v.\n",
+				header.Version,
+				header.Level_name,
+				header.Timestamp.Format("2006-01-02 15:04:05"),
+			)
+			programState.World = loaded
+			programState.History = editHistory{}
+		case command == commandExportLevel:
+			err := exportLevel(programState.World)
+			fmt.Println("Export level:", err)
+		case command == commandImportLevel:
+			imported, err := importLevel(programState.World)
+			fmt.Println("Import level:", err)
 			if err == nil {
-				programState.World = *world
+				programState.World = imported
+				programState.History = editHistory{}
+			}
+		case command == commandUndo:
+			var err error
+			programState.History, programState.World, err = programState.History.Undo(programState.World)
+			if err != nil {
+				fmt.Println("Undo:", err)
+			}
+		case command == commandRedo:
+			var err error
+			programState.History, programState.World, err = programState.History.Redo(programState.World)
+			if err != nil {
+				fmt.Println("Redo:", err)
 			}
+		case command == commandToggleAutomap:
+			programState.Automap = !programState.Automap
 		}
 	}
 	return programState
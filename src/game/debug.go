@@ -0,0 +1,8 @@
+//go:build debug
+// +build debug
+
+package main
+
+// Build with `-tags debug` to check the consistency of the world after each
+// action.  It is slow.
+const debug = true
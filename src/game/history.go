@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"world"
+)
+
+// The level editor keeps a history of its edits so that they can be undone
+// and redone.  An edit is the Delta the editor applied to the World, so
+// undoing it only touches what the edit changed: the buildings, monsters,
+// items and so on it placed or removed.  The rest of the World, the player
+// first, stays as it is.  An edit that the game changed since, like a monster
+// that walked away from where it was placed, cannot be undone anymore; it is
+// forgotten.  The history is bounded by the size of its edits, the oldest are
+// forgotten first.
+
+// How many bytes the edits of the history can take, once encoded.
+const historyBudget = 1 << 20
+
+// An edit is a change the editor made to the World.
+type edit struct {
+	delta world.Delta
+	size  int // Of the Delta, encoded.
+}
+
+var (
+	errNothingToUndo = errors.New("nothing to undo")
+	errNothingToRedo = errors.New("nothing to redo")
+	errIrreversible  = errors.New("the edit cannot be reversed")
+)
+
+type editHistory struct {
+	undo []edit // Most recent last.
+	redo []edit // Most recently undone last.
+	size int    // Of all the edits, undone or not.
+}
+
+// byteCounter is a writer that only counts what is written to it.
+type byteCounter int
+
+func (counter *byteCounter) Write(p []byte) (int, error) {
+	*counter += byteCounter(len(p))
+	return len(p), nil
+}
+
+// deltaSize returns the size of a Delta once encoded, an estimate of the
+// memory it takes.
+func deltaSize(delta world.Delta) int {
+	var counter byteCounter
+	world.WriteDelta(&counter, delta)
+	return int(counter)
+}
+
+// record adds an edit to the history.  Edits that change nothing are
+// ignored.  A new edit cannot be redone after, so the redo history is dropped.
+func (history editHistory) record(delta world.Delta) editHistory {
+	if deltas, ok := delta.(world.Deltas); ok && len(deltas) == 0 {
+		return history
+	}
+	last := edit{delta, deltaSize(delta)}
+	for _, undone := range history.redo {
+		history.size -= undone.size
+	}
+	history.redo = nil
+	undo := history.undo
+	for len(undo) > 0 && history.size+last.size > historyBudget {
+		history.size -= undo[0].size
+		undo = undo[1:]
+	}
+	// Never append in place, other copies of the history share the array.
+	history.undo = append(undo[:len(undo):len(undo)], last)
+	history.size += last.size
+	return history
+}
+
+// Undo reverses the last edit.
+func (history editHistory) Undo(w world.World) (editHistory, world.World, error) {
+	if len(history.undo) == 0 {
+		return history, w, errNothingToUndo
+	}
+	last := history.undo[len(history.undo)-1]
+	history.undo = history.undo[:len(history.undo)-1]
+	restored, err := w, errIrreversible
+	if reverse, ok := world.Reverse(last.delta); ok {
+		restored, err = reverse.Apply(w)
+	}
+	if err != nil {
+		history.size -= last.size
+		return history, w, fmt.Errorf("%v, the edit is forgotten", err)
+	}
+	history.redo = append(history.redo[:len(history.redo):len(history.redo)], last)
+	return history, restored, nil
+}
+
+// Redo applies again the last edit undone.
+func (history editHistory) Redo(w world.World) (editHistory, world.World, error) {
+	if len(history.redo) == 0 {
+		return history, w, errNothingToRedo
+	}
+	last := history.redo[len(history.redo)-1]
+	history.redo = history.redo[:len(history.redo)-1]
+	restored, err := last.delta.Apply(w)
+	if err != nil {
+		history.size -= last.size
+		return history, w, fmt.Errorf("%v, the edit is forgotten", err)
+	}
+	history.undo = append(history.undo[:len(history.undo):len(history.undo)], last)
+	return history, restored, nil
+}
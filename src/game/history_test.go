@@ -0,0 +1,144 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"world"
+)
+
+// moveCreature moves the creature of an actor of level 0 to another tile, as
+// the game would.
+func moveCreature(test *testing.T, w world.World, actorID world.ActorID, location world.Location) world.World {
+	creatureID, _ := w.Levels[0].CreatureActor.GetCreature(actorID)
+	position := world.LevelPosition{Level: 0, Position: world.Position{Location: location, F: world.NORTH()}}
+	w, err := w.MoveCreature(creatureID, position)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return w
+}
+
+// Undoing an edit leaves alone what the game did since.
+func TestUndoKeepsTheGame(test *testing.T) {
+	programState := programState{World: testWorld()}
+	programState = executeCommands(programState, []command{commandPlaceWall, commandPlaceMonster})
+	monsterID, _ := programState.World.Levels[0].CreatureLocation.GetCreature(world.Location{X: 1})
+	programState.World = moveCreature(test, programState.World, programState.World.Player_id, world.Location{X: -2, Y: 2})
+	programState.World.Time = 1000
+	programState = executeCommands(programState, []command{commandUndo})
+
+	level := programState.World.Levels[0]
+	if _, ok := level.CreatureLocation.GetLocation(monsterID); ok {
+		test.Error("The monster is still there.")
+	}
+	if _, ok := level.Walls[world.WEST().Value()].Get(0, 0); !ok {
+		test.Error("The wall was removed too.")
+	}
+	position, _ := programState.World.ActorPosition(programState.World.Player_id)
+	if position.Location != (world.Location{X: -2, Y: 2}) || programState.World.Time != 1000 {
+		test.Error("The player went back in time:", position, programState.World.Time)
+	}
+
+	programState = executeCommands(programState, []command{commandUndo, commandUndo})
+	if _, ok := programState.World.Levels[0].Walls[world.WEST().Value()].Get(0, 0); ok {
+		test.Error("The wall is still there.")
+	}
+	programState = executeCommands(programState, []command{commandRedo, commandRedo})
+	if programState.World.Levels[0].CreatureLocation.Len() != 2 {
+		test.Error("The monster did not come back.")
+	}
+}
+
+// Edits that the game changed since are forgotten.
+func TestUndoForgetsChangedEdits(test *testing.T) {
+	programState := programState{World: testWorld()}
+	programState = executeCommands(programState, []command{commandPlaceMonster})
+	monsterID, _ := programState.World.Levels[0].CreatureLocation.GetCreature(world.Location{X: 1})
+	actorID, _ := programState.World.Levels[0].CreatureActor.GetActor(monsterID)
+	programState.World = moveCreature(test, programState.World, actorID, world.Location{X: 2})
+	history, w, err := programState.History.Undo(programState.World)
+	if err == nil {
+		test.Fatal("Undid the placement of a monster that moved.")
+	}
+	if w.Levels[0].CreatureLocation.Len() != 2 {
+		test.Error("The monster was removed anyway.")
+	}
+	if len(history.undo) != 0 || len(history.redo) != 0 || history.size != 0 {
+		test.Error("The edit was not forgotten:", history)
+	}
+}
+
+func TestUndoStairs(test *testing.T) {
+	programState := programState{World: testWorld()}
+	programState = executeCommands(programState, []command{commandPlaceStairs})
+	if len(programState.World.Levels) != 2 {
+		test.Fatal("No level was added.")
+	}
+	programState = executeCommands(programState, []command{commandUndo})
+	if len(programState.World.Levels) != 1 {
+		test.Error("The level was not removed.")
+	}
+	floor, _ := programState.World.Levels[0].Floors.Get(1, 0)
+	if _, ok := floor.(world.Stairs); ok {
+		test.Error("The stairs are still there.")
+	}
+	programState = executeCommands(programState, []command{commandRedo})
+	if _, ok := programState.World.Levels[1].Floors.Get(1, 0); !ok {
+		test.Error("The stairs did not come back.")
+	}
+}
+
+// The history forgets the oldest edits once its edits take too much memory.
+func TestHistoryBudget(test *testing.T) {
+	delta := world.DeltaBuildingChanged{
+		Layer: world.LAYER_COLUMNS,
+		After: world.MakeOrientedBuilding(columnID, world.EAST()),
+	}
+	count := historyBudget/deltaSize(delta) + 10
+	var history editHistory
+	for i := 0; i < count; i++ {
+		delta.Location.X = world.Coord(i)
+		history = history.record(delta)
+	}
+	if history.size > historyBudget || len(history.undo) >= count {
+		test.Errorf("%v edits take %v bytes.", len(history.undo), history.size)
+	}
+	last := history.undo[len(history.undo)-1].delta.(world.DeltaBuildingChanged)
+	if last.Location.X != world.Coord(count-1) {
+		test.Error("The last edit was forgotten.")
+	}
+}
+
+// Removing a monster drops what it carries, and undoing it gives it back.
+func TestRemoveMonster(test *testing.T) {
+	programState := programState{World: testWorld()}
+	programState = executeCommands(programState, []command{commandPlaceMonster})
+	level := programState.World.Levels[0]
+	monsterID, _ := level.CreatureLocation.GetCreature(world.Location{X: 1})
+	var swordID, shieldID world.ItemId
+	level.Items, swordID = level.Items.Add(world.MakeItem(itemID, "sword", world.EQUIP_HAND))
+	level.Items, shieldID = level.Items.Add(world.MakeItem(itemID, "shield", world.EQUIP_HAND))
+	inventory, _ := world.MakeInventory().Carry(swordID).Carry(shieldID).Equip(swordID, world.EQUIP_HAND)
+	level.Inventories = level.Inventories.Set(monsterID, inventory)
+	programState.World = programState.World.SetLevel(0, level)
+
+	programState = executeCommands(programState, []command{commandRemoveMonster})
+	level = programState.World.Levels[0]
+	if _, ok := level.Creatures.Get(monsterID); ok || len(level.Actors.Ids()) != 1 {
+		test.Fatal("The monster is still there.")
+	}
+	for _, id := range []world.ItemId{swordID, shieldID} {
+		if place, _ := level.ItemPlace(id); place != world.OnGround(world.Location{X: 1}) {
+			test.Errorf("Item %v is at %v.", id, place)
+		}
+	}
+
+	programState = executeCommands(programState, []command{commandUndo})
+	level = programState.World.Levels[0]
+	if !reflect.DeepEqual(level.Inventories.Get(monsterID), inventory) || level.ItemLocation.Len() != 0 {
+		test.Error("The monster did not get its items back.")
+	}
+	if _, ok := level.CreatureActor.GetActor(monsterID); !ok {
+		test.Error("The monster did not come back.")
+	}
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github.com/go-gl/gl"
 	glfw "github.com/go-gl/glfw3"
@@ -9,6 +10,7 @@ import (
 	"glw"
 	"ia"
 	"math"
+	"os"
 	"runtime"
 	"sculpt"
 	"sort"
@@ -34,8 +36,16 @@ const (
 	columnID
 	ceilingID
 	monsterID
+	doorID
+	doorCenterID
+	itemID
+	propID
+	arrowID
 )
 
+// How many tiles ahead the player sees, and remembers on the automap.
+const sightRadius = 8
+
 func viewMatrix(pos world.Position) (glm.Matrix4, glm.Matrix4) {
 	const eyeZ = .5
 	Rd := glm.RotZ(float64(-90 * pos.F.Value()))
@@ -50,16 +60,28 @@ func viewMatrix(pos world.Position) (glm.Matrix4, glm.Matrix4) {
 type glState struct {
 	Window           *glfw.Window
 	glfwKeyEventList *glfwKeyEventList
-	Shapes           [7]glw.Renderer
+	Shapes           [12]glw.Renderer
 	context          *glw.GlContext
 }
 
 type programState struct {
-	Gl    glState     // Highly mutable, impure.
-	World world.World // Immutable, pure.
+	Gl          glState             // Highly mutable, impure.
+	World       world.World         // Immutable, pure.
+	History     editHistory         // Edits of the levels, for undo and redo.
+	Destination world.LevelPosition // Where the teleporters and pits placed next lead.
+	Marked      bool                // Whether Destination was chosen yet.
+	Automap     bool                // Whether the automap is shown instead of the view.
+	Recording   *recording          // Mutable, nil when not recording.
+	Replay      *replay             // Mutable, nil when not replaying.
 }
 
 func main() {
+	replayPath := flag.String("replay", "", "check a recording without opening a window, then quit")
+	flag.Parse()
+	if *replayPath != "" {
+		os.Exit(checkRecording(*replayPath))
+	}
+
 	var programState programState
 	var err error
 	glfw.SetErrorCallback(errorCallback)
@@ -112,6 +134,11 @@ func main() {
 	programState.Gl.Shapes[floorID] = sculpt.FloorInstNorm(programState.Gl.context.Programs)
 	programState.Gl.Shapes[ceilingID] = sculpt.CeilingInstNorm(programState.Gl.context.Programs)
 	programState.Gl.Shapes[wallID] = sculpt.WallInstNorm(programState.Gl.context.Programs)
+	programState.Gl.Shapes[doorID] = sculpt.DoorInstNorm(programState.Gl.context.Programs)
+	programState.Gl.Shapes[doorCenterID] = sculpt.DoorCenterInstNorm(programState.Gl.context.Programs)
+	programState.Gl.Shapes[itemID] = sculpt.ItemInstNorm(programState.Gl.context.Programs)
+	programState.Gl.Shapes[propID] = sculpt.PropInstNorm(programState.Gl.context.Programs)
+	programState.Gl.Shapes[arrowID] = sculpt.ArrowInstNorm(programState.Gl.context.Programs)
 
 	{
 		// I do not like the default reference frame of OpenGl.
@@ -138,6 +165,13 @@ func main() {
 	glw.LoadSkybox()
 
 	programState.World = world.MakeWorld()
+	{
+		// The player needs something to stand on.
+		level := programState.World.Levels[0]
+		level.Floors = level.Floors.Set(0, 0, world.MakeFloor(floorID, world.EAST(), true))
+		programState.World = programState.World.SetLevel(0, level)
+	}
+	programState.World = programState.World.Explore(programState.World.Player_id, sightRadius)
 	mainLoop(programState)
 }
 
@@ -173,65 +207,119 @@ func onTick(programState programState, dt uint64) (programState, bool) {
 		keys := programState.Gl.glfwKeyEventList.Freeze()
 		// Analyze the inputs, see what they mean.
 		commands := commands(keys)
-		// One of these commands may correspond to an action of the player's actor.
-		// We take it out so that we can process it in the IA phase.
-		// The remaining commands are kept for further processing.
-		playerAction, commands := commandsToAction(commands, programState.World.Player_id)
-		// Evolve the program one step.
-		programState.World.Time += dt // No side effect, we own a copy.
-		// $$$ THERE COULD BE SIDE EFFECTS HERE ACTUALLY:  IF I GAVE A POINTER
-		// TO THE WORLD OR PROGRAM STATE TO SOMETHING.  NEED TO CORRECT THAT.
-		programState = executeCommands(programState, commands)
-		//
-		programState.World = runAI(programState.World, playerAction)
+		programState, commands = recordingCommands(programState, commands, dt)
+		// Evolve the program one step, as the player or the replay says.
+		if programState.Replay != nil {
+			var more bool
+			var err error
+			programState, more, err = programState.Replay.playTick(programState)
+			if err != nil {
+				fmt.Println("Replay:", err)
+			} else if !more {
+				fmt.Println("Replay: the world matches the recording.")
+			}
+			if err != nil || !more {
+				programState.Replay = nil
+			}
+		} else {
+			programState = tick(programState, commands, dt)
+		}
+		if _, ok := programState.World.PlayerLevel(); !ok {
+			fmt.Println("You died.")
+			return finishRecording(programState), false
+		}
 		// render on screen.
 		render(programState)
 		programState.Gl.Window.SwapBuffers()
 	}
+	if !keepTicking {
+		programState = finishRecording(programState)
+	}
 	return programState, keepTicking
 }
 
+// tick evolves the program one step of dt nanoseconds, given the commands of
+// the player.  It reads no input and draws nothing, so that replays can run
+// it without a window.
+func tick(programState programState, commands []command, dt uint64) programState {
+	// One of these commands may correspond to an action of the player's actor.
+	// We take it out so that we can process it in the IA phase.
+	// The remaining commands are kept for further processing.
+	playerAction, edits := commandsToAction(commands, programState.World.Player_id)
+	programState.World.Time += dt // No side effect, we own a copy.
+	programState = executeCommands(programState, edits)
+	programState.Recording.record(commands, programState)
+	programState.World = runAI(programState.World, playerAction)
+	programState.Recording.endTick(programState.World)
+	return programState
+}
+
 func runAI(w world.World, playerAction ia.Action) world.World {
+	// All the levels live at the same time, not only the one of the player.
+	for _, levelID := range w.Levels.Ids() {
+		w = runLevelAI(w, levelID, playerAction)
+	}
+	return w
+}
+
+func runLevelAI(w world.World, levelID world.LevelId, playerAction ia.Action) world.World {
 	var action ia.Action
 	// It's like on a board game.  Every one plays when it is their turn.
 	// This function is called every frame.
 
 	// Temporary: Any creature that is not scheduled yet is added to the
 	// scheduler.
-	schedule := w.Level.ActorSchedule
-	for actorID := range w.Level.Actors.Content() {
+	// They are taken in order, replays schedule them the same way.
+	schedule := w.Levels[levelID].ActorSchedule
+	for _, actorID := range w.Levels[levelID].Actors.Ids() {
 		index := schedule.PosActorID(actorID)
 		if index == -1 {
 			fmt.Println("Force scheduling", actorID)
 			schedule = schedule.Add(actorID, w.Time)
 		}
 	}
-	w = w.SetActorSchedule(schedule)
+	w = w.SetActorSchedule(levelID, schedule)
 
 	for {
-		actorTime, ok := w.Level.ActorSchedule.Next(w.Time)
+		actorTime, ok := w.Levels[levelID].ActorSchedule.Next(w.Time)
 		if !ok {
 			// Actions can modify the list of actors, so I cannot loop over
 			// all the actors.  This is why I break the loop this way.
 			break // No more actors to process.
 		}
-		newSchedule, ok := w.Level.ActorSchedule.Remove(actorTime)
+		newSchedule, ok := w.Levels[levelID].ActorSchedule.Remove(actorTime)
 		if !ok {
 			panic("Could not find actor to remove from scheduler")
 		}
-		w = w.SetActorSchedule(newSchedule)
+		w = w.SetActorSchedule(levelID, newSchedule)
 		if actorTime.Actor_id == w.Player_id {
 			action = playerAction
 		} else {
-			action = ia.DecideAction(actorTime.Actor_id)
+			action = ia.DecideAction(w, actorTime.Actor_id)
 		}
 		if action != nil {
-			var err error
-			newSchedule = newSchedule.Add(actorTime.Actor_id, actorTime.Time+100000000)
-			w = w.SetActorSchedule(newSchedule)
-			w, err = action.Execute(w)
+			duration := ia.TurnDuration(w, actorTime.Actor_id)
+			newSchedule = newSchedule.Add(actorTime.Actor_id, actorTime.Time+duration)
+			w = w.SetActorSchedule(levelID, newSchedule)
+			delta, result, err := ia.Plan(action, w)
+			if err == nil {
+				if debug {
+					fmt.Println(delta)
+				}
+				w, err = delta.Apply(w)
+			}
+			if err == nil && actorTime.Actor_id == w.Player_id {
+				w = w.Explore(w.Player_id, sightRadius)
+			}
 			if err != nil {
 				fmt.Println(err)
+			} else if result != nil {
+				fmt.Println(result)
+			}
+			if debug {
+				if problems := w.Validate(); len(problems) != 0 {
+					fmt.Printf("After %#v:\n%v\n", action, problems)
+				}
 			}
 		} else {
 			// Nil actions should only happen for the player.  The player is the
@@ -240,7 +328,7 @@ func runAI(w world.World, playerAction ia.Action) world.World {
 			if actorTime.Actor_id == w.Player_id {
 				// Reschedule the player for next turn.
 				newSchedule = newSchedule.Add(actorTime.Actor_id, w.Time+1)
-				w = w.SetActorSchedule(newSchedule)
+				w = w.SetActorSchedule(levelID, newSchedule)
 			} else {
 				panic("Only the player is allowed to idle.")
 			}
@@ -275,33 +363,32 @@ func (positions Positions) Swap(i, j int) {
 }
 
 func render(programState programState) {
+	if programState.Automap {
+		renderAutomap(programState)
+		return
+	}
 	actorID := programState.World.Player_id
-	position, ok := programState.World.Level.ActorPosition(actorID)
+	levelPosition, ok := programState.World.ActorPosition(actorID)
 	if !ok {
 		panic("Could not find player's character position.")
 	}
-	worldToEye, eyeToWorld := viewMatrix(position)
+	// Only the level of the player is drawn.
+	level := programState.World.Levels[levelPosition.Level]
+	worldToEye, eyeToWorld := viewMatrix(levelPosition.Position)
 	programState.Gl.context.SetEyeToWld(eyeToWorld)
 	programState.Gl.context.UpdateCamera()
 
 	// Lights.
 	{
-		const T = 3000000000
-		t := programState.World.Time
-		phase := (2 * math.Pi) * float64(t) / T
-		lights := []glw.Light{
-			glw.Light{
-				Color: glm.Vector4{1, 0, 0, 0},
-				Origin: worldToEye.MultV(glm.Vector4{
-					3 + 2*math.Cos(phase),
-					0 + 1*math.Sin(phase),
-					.5 + .45*math.Cos(phase*6.321), 1,
-				}),
-			},
-			glw.Light{
-				Color:  glm.Vector4{0, .5, 0, 0},
-				Origin: worldToEye.MultV(glm.Vector4{0, 0, .1, 1}),
-			},
+		glows := level.Glows(programState.World.Time)
+		lights := make([]glw.Light, len(glows))
+		for i, glow := range glows {
+			x, y, z := glow.Point.Xyz()
+			r, g, b := glow.Color.Xyz()
+			lights[i] = glw.Light{
+				Color:  glm.Vector4{r, g, b, glow.Radius},
+				Origin: worldToEye.MultV(glm.Vector4{x, y, z, 1}),
+			}
 		}
 		programState.Gl.context.SetLights(lights)
 		programState.Gl.context.UpdateLights()
@@ -313,14 +400,14 @@ func render(programState programState) {
 
 	gatherBuildingsPositions(
 		horizontalPositions,
-		programState.World.Level.Floors,
+		level.Floors,
 		0, 0,
 		nil,
 		worldToEye,
 	)
 	gatherBuildingsPositions(
 		horizontalPositions,
-		programState.World.Level.Ceilings,
+		level.Ceilings,
 		0, 0,
 		nil,
 		worldToEye,
@@ -329,12 +416,16 @@ func render(programState programState) {
 		rot := glm.RotZ(180 + 90*float64(i))
 		gatherBuildingsPositions(
 			verticalPositions,
-			programState.World.Level.Walls[i],
+			level.Walls[i],
 			0, 0,
 			&rot,
 			worldToEye,
 		)
 	}
+	gatherDoorsPositions(verticalPositions, level.Doors, worldToEye)
+	gatherItemsPositions(horizontalPositions, level, worldToEye)
+	gatherProjectilesPositions(horizontalPositions, level, programState.World.Time, worldToEye)
+	gatherPropsPositions(verticalPositions, level, programState.World.Time, worldToEye)
 	// Finally render all the things.
 	// Reduce fill rate by drawing the closest objects first and making use of
 	// the depth test to cull fragments before expensive lightings computations.
@@ -357,7 +448,15 @@ func gatherBuildingsPositions(
 	defaultR *glm.Matrix4, // Can be nil.
 	worldToEye glm.Matrix4,
 ) {
-	for coords, building := range buildings {
+	buildings.ForEach(func(coords world.Location, building world.Building) {
+		// Open doors slide into the wall, and broken ones lie in pieces.
+		if door, ok := building.(world.Door); ok && door.IsPassable() {
+			return
+		}
+		// Open pits are holes, unless they hide.
+		if pit, ok := building.(world.Pit); ok && pit.IsGaping() {
+			return
+		}
 		position := glm.Vector3{
 			float64(coords.X) + offsetX,
 			float64(coords.Y) + offsetY,
@@ -378,5 +477,98 @@ func gatherBuildingsPositions(
 		positions := rendererPositions[rendererID]
 		positions = append(positions, position)
 		rendererPositions[rendererID] = positions
-	}
+	})
+}
+
+// gatherDoorsPositions is gatherBuildingsPositions for the doors standing in
+// the middle of tiles.  They are seen from both sides, so each is drawn twice.
+func gatherDoorsPositions(
+	rendererPositions map[world.ModelId]Positions,
+	doors world.Buildings,
+	worldToEye glm.Matrix4,
+) {
+	doors.ForEach(func(coords world.Location, building world.Building) {
+		door, ok := building.(world.Door)
+		if !ok || door.IsPassable() {
+			return
+		}
+		translation := glm.Vector3{float64(coords.X), float64(coords.Y), 0}.Translation()
+		rendererID := door.Model()
+		for _, angle := range [...]float64{0, 180} {
+			r := glm.RotZ(float64(90*door.Axis().Value()) + angle)
+			position := worldToEye.Mult(translation.Mult(r))
+			rendererPositions[rendererID] = append(rendererPositions[rendererID], position)
+		}
+	})
+}
+
+// gatherItemsPositions is gatherBuildingsPositions for the items lying on the
+// floors.  The items of a pile are spread a little so that they all show.
+func gatherItemsPositions(
+	rendererPositions map[world.ModelId]Positions,
+	level world.Level,
+	worldToEye glm.Matrix4,
+) {
+	level.ItemLocation.ForEachPile(func(coords world.Location, pile []world.ItemId) {
+		for i, itemID := range pile {
+			item, ok := level.Items.Get(itemID)
+			if !ok {
+				continue
+			}
+			angle := float64(i) * 2.4 // Radians, about the golden angle.
+			radius := .1 * math.Sqrt(float64(i))
+			position := glm.Vector3{
+				float64(coords.X) + radius*math.Cos(angle),
+				float64(coords.Y) + radius*math.Sin(angle),
+				.001 * float64(i),
+			}.Translation()
+			position = worldToEye.Mult(position)
+			rendererID := item.Model()
+			rendererPositions[rendererID] = append(rendererPositions[rendererID], position)
+		}
+	})
+}
+
+// gatherProjectilesPositions is gatherBuildingsPositions for the projectiles.
+// They are drawn between two tiles when they are between two turns.
+func gatherProjectilesPositions(
+	rendererPositions map[world.ModelId]Positions,
+	level world.Level,
+	t uint64,
+	worldToEye glm.Matrix4,
+) {
+	level.Projectiles.ForEach(func(actorID world.ActorID, projectile world.Projectile) {
+		x, y, ok := level.ProjectilePoint(actorID, t)
+		if !ok {
+			return
+		}
+		// No mesh for arrows yet, they look like items.
+		rendererID := world.ModelId(itemID)
+		if item, ok := level.Items.Get(projectile.Item); ok {
+			rendererID = item.Model()
+		}
+		position := glm.Vector3{x, y, .5}.Translation()
+		position = position.Mult(glm.RotZ(float64(90 * projectile.Direction.Value())))
+		position = worldToEye.Mult(position)
+		rendererPositions[rendererID] = append(rendererPositions[rendererID], position)
+	})
+}
+
+// gatherPropsPositions is gatherBuildingsPositions for the props.  Each prop
+// is drawn twice, back to back, so that it shows from both sides whichever
+// way it turns.
+func gatherPropsPositions(
+	rendererPositions map[world.ModelId]Positions,
+	level world.Level,
+	t uint64,
+	worldToEye glm.Matrix4,
+) {
+	backToBack := glm.RotZ(180)
+	level.Props.ForEach(func(_ world.PropId, prop world.Prop) {
+		modelToWorld := prop.ModelMat(t)
+		rendererID := prop.Model
+		for _, position := range [...]glm.Matrix4{modelToWorld, modelToWorld.Mult(backToBack)} {
+			rendererPositions[rendererID] = append(rendererPositions[rendererID], worldToEye.Mult(position))
+		}
+	})
 }
@@ -0,0 +1,6 @@
+//go:build !debug
+// +build !debug
+
+package main
+
+const debug = false
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"world"
+)
+
+// A session of play can be recorded, and replayed later to rebuild the same
+// Worlds.  The World only changes through the commands of the player and the
+// passing of time, and the AI draws its numbers from the World, so the
+// commands of each tick are all there is to record.  The exceptions are the
+// commands that read files: the file may be gone or different by the time of
+// the replay, so the World they left is recorded instead.  Checkpoints hold
+// the hash of the World every so often, replays compare with them.  This
+// turns bug reports into regression tests: record the bug, and replay the
+// recording without a window, with the -replay flag or from a test.
+
+// The file F8 records to, and F9 replays from.
+const recordingFileName = "replay.rec"
+
+// The version of the format of the recordings.  Recordings of other versions
+// cannot be replayed.
+const recordingVersion = 1
+
+// How many ticks between two checkpoints, one second.
+const checkpointPeriod = 60
+
+// What a recording starts from: the World, and the state of the editor that
+// commands depend on.  The history of the edits is not part of it, it starts
+// empty.
+type recordedStart struct {
+	World       world.World
+	Destination world.LevelPosition
+	Marked      bool
+}
+
+// A recordedTick is a tick during which the player gave commands.
+type recordedTick struct {
+	Tick     uint64    // Counted from the start of the recording.
+	Time     uint64    // Of the World, after the tick began.
+	Commands []command // All of them, actions included, encoded by name.
+	Replaced bool      // Whether a command read the World from a file.
+	World    world.World
+}
+
+// A checkpoint is the hash of the World at the end of a tick.
+type checkpoint struct {
+	Tick uint64
+	Time uint64
+	Hash uint64
+}
+
+type recording struct {
+	Version     int
+	Start       recordedStart
+	Dt          uint64         // Nanoseconds per tick.
+	Ticks       uint64         // How many ticks were recorded.
+	Events      []recordedTick // Sorted by tick.
+	Checkpoints []checkpoint   // Sorted by tick.
+}
+
+// isFileCommand tells whether a command reads or writes files.  Replays do
+// not run them.
+func isFileCommand(command command) bool {
+	switch command {
+	case commandSave, commandLoad, commandExportLevel, commandImportLevel:
+		return true
+	}
+	return false
+}
+
+// replacesWorld tells whether a command reads the World from a file.
+func replacesWorld(command command) bool {
+	return command == commandLoad || command == commandImportLevel
+}
+
+// startRecording records the ticks to come.  The history of the edits is
+// forgotten, since the recording cannot undo what happened before it.
+func startRecording(programState programState, dt uint64) programState {
+	programState.History = editHistory{}
+	programState.Recording = &recording{
+		Version: recordingVersion,
+		Start: recordedStart{
+			World:       programState.World,
+			Destination: programState.Destination,
+			Marked:      programState.Marked,
+		},
+		Dt: dt,
+	}
+	return programState
+}
+
+// record remembers the commands of the tick, once they were executed.  It
+// does nothing when not recording.
+func (self *recording) record(commands []command, programState programState) {
+	if self == nil || len(commands) == 0 {
+		return
+	}
+	event := recordedTick{
+		Tick:     self.Ticks,
+		Time:     programState.World.Time,
+		Commands: commands,
+	}
+	for _, command := range commands {
+		if replacesWorld(command) {
+			event.Replaced = true
+			event.World = programState.World
+		}
+	}
+	self.Events = append(self.Events, event)
+}
+
+// endTick counts the tick, and takes a checkpoint when it is time.  It does
+// nothing when not recording.
+func (self *recording) endTick(w world.World) {
+	if self == nil {
+		return
+	}
+	self.Ticks++
+	if self.Ticks%checkpointPeriod == 0 {
+		self.checkpoint(w)
+	}
+}
+
+func (self *recording) checkpoint(w world.World) {
+	self.Checkpoints = append(self.Checkpoints, checkpoint{self.Ticks - 1, w.Time, w.Hash()})
+}
+
+// stop ends the recording with a checkpoint of the last tick.
+func (self *recording) stop(w world.World) {
+	count := len(self.Checkpoints)
+	if self.Ticks > 0 && (count == 0 || self.Checkpoints[count-1].Tick != self.Ticks-1) {
+		self.checkpoint(w)
+	}
+}
+
+func (self recording) Write(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(self)
+}
+
+func readRecording(r io.Reader) (recording, error) {
+	var result recording
+	if err := gob.NewDecoder(r).Decode(&result); err != nil {
+		return result, err
+	}
+	if result.Version != recordingVersion {
+		return result, fmt.Errorf("recording of version %v, not %v", result.Version, recordingVersion)
+	}
+	return result, nil
+}
+
+func (self recording) WriteFile(path string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if errClose := f.Close(); err == nil {
+			err = errClose
+		}
+	}()
+	return self.Write(f)
+}
+
+func readRecordingFile(path string) (recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return recording{}, err
+	}
+	defer f.Close()
+	return readRecording(f)
+}
+
+// finishRecording stops the recording, if any, and writes it to its file.
+func finishRecording(programState programState) programState {
+	if programState.Recording == nil {
+		return programState
+	}
+	programState.Recording.stop(programState.World)
+	err := programState.Recording.WriteFile(recordingFileName)
+	fmt.Printf("Record: %v ticks to %v: %v\n", programState.Recording.Ticks, recordingFileName, err)
+	programState.Recording = nil
+	return programState
+}
+
+// A replayError tells at which checkpoint a replay left the recording.
+type replayError struct {
+	checkpoint checkpoint
+	hash       uint64 // Of the replayed World.
+}
+
+func (self replayError) Error() string {
+	return fmt.Sprintf(
+		"the world differs from the recording at tick %v, time %v: hash %x instead of %x",
+		self.checkpoint.Tick,
+		self.checkpoint.Time,
+		self.hash,
+		self.checkpoint.Hash,
+	)
+}
+
+// A replay plays a recording tick by tick.
+type replay struct {
+	recording  recording
+	tick       uint64 // The next one to play.
+	event      int    // The next one to play.
+	checkpoint int    // The next one to check.
+}
+
+// startReplay puts the program back where the recording started.
+func startReplay(programState programState, recording recording) (programState, *replay) {
+	programState.World = recording.Start.World
+	programState.Destination = recording.Start.Destination
+	programState.Marked = recording.Start.Marked
+	programState.History = editHistory{}
+	return programState, &replay{recording: recording}
+}
+
+// playTick plays the next tick of the replay.  It returns false once the
+// replay is over, and an error when the World differs from the one recorded
+// at a checkpoint.
+func (self *replay) playTick(programState programState) (programState, bool, error) {
+	recording := self.recording
+	if self.tick >= recording.Ticks {
+		return programState, false, nil
+	}
+	var commands []command
+	var event recordedTick
+	if self.event < len(recording.Events) && recording.Events[self.event].Tick == self.tick {
+		event = recording.Events[self.event]
+		commands = event.Commands
+		self.event++
+	}
+	if event.Replaced {
+		// The edits of the tick are part of the recorded World.
+		playerAction, _ := commandsToAction(commands, programState.World.Player_id)
+		programState.World = event.World
+		programState.History = editHistory{}
+		programState.World = runAI(programState.World, playerAction)
+	} else {
+		kept := make([]command, 0, len(commands))
+		for _, command := range commands {
+			if !isFileCommand(command) {
+				kept = append(kept, command)
+			}
+		}
+		programState = tick(programState, kept, recording.Dt)
+	}
+	var err error
+	if self.checkpoint < len(recording.Checkpoints) && recording.Checkpoints[self.checkpoint].Tick == self.tick {
+		checkpoint := recording.Checkpoints[self.checkpoint]
+		if hash := programState.World.Hash(); hash != checkpoint.Hash {
+			err = replayError{checkpoint, hash}
+		}
+		self.checkpoint++
+	}
+	self.tick++
+	return programState, err == nil, err
+}
+
+// replayAll plays a whole recording without a window.  It stops at the first
+// checkpoint the World differs from.
+func replayAll(recording recording) (programState, error) {
+	programState, replay := startReplay(programState{}, recording)
+	for {
+		var more bool
+		var err error
+		programState, more, err = replay.playTick(programState)
+		if err != nil || !more {
+			return programState, err
+		}
+	}
+}
+
+// recordingCommands starts and stops the recordings and the replays, and
+// returns the other commands.
+func recordingCommands(programState programState, commands []command, dt uint64) (programState, []command) {
+	others := make([]command, 0, len(commands))
+	for _, command := range commands {
+		switch command {
+		case commandRecord:
+			switch {
+			case programState.Replay != nil:
+				fmt.Println("Record: not while replaying.")
+			case programState.Recording != nil:
+				programState = finishRecording(programState)
+			default:
+				programState = startRecording(programState, dt)
+				fmt.Println("Record: started, the edits cannot be undone anymore.")
+			}
+		case commandReplay:
+			switch {
+			case programState.Recording != nil:
+				fmt.Println("Replay: not while recording.")
+			case programState.Replay != nil:
+				programState.Replay = nil
+				fmt.Println("Replay: stopped.")
+			default:
+				recording, err := readRecordingFile(recordingFileName)
+				if err != nil {
+					fmt.Println("Replay:", err)
+					break
+				}
+				programState, programState.Replay = startReplay(programState, recording)
+				fmt.Printf("Replay: %v ticks from %v.\n", recording.Ticks, recordingFileName)
+			}
+		default:
+			others = append(others, command)
+		}
+	}
+	return programState, others
+}
+
+// checkRecording replays a recording file without a window, for the -replay
+// flag.  It returns the exit status of the program.
+func checkRecording(path string) int {
+	recording, err := readRecordingFile(path)
+	if err != nil {
+		fmt.Println("Replay:", err)
+		return 2
+	}
+	if _, err := replayAll(recording); err != nil {
+		fmt.Println("Replay:", err)
+		return 1
+	}
+	fmt.Printf("Replay: %v ticks, %v checkpoints, the world matches the recording.\n",
+		recording.Ticks, len(recording.Checkpoints))
+	return 0
+}
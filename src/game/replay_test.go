@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"world"
+)
+
+const testDt = 1000000000 / 60
+
+// testWorld is a room of 7 by 7 tiles with the player in the middle.
+func testWorld() world.World {
+	w := world.MakeWorld()
+	level := w.Levels[0]
+	for x := world.Coord(-3); x <= 3; x++ {
+		for y := world.Coord(-3); y <= 3; y++ {
+			level.Floors = level.Floors.Set(x, y, world.MakeFloor(floorID, world.EAST(), true))
+		}
+	}
+	return w.SetLevel(0, level)
+}
+
+// The commands of a short session: some edits, a monster, walking about and
+// fighting.
+var testSession = map[uint64][]command{
+	0:   {commandPlaceMonster},
+	10:  {commandTurnLeft},
+	30:  {commandPlaceWall, commandPlaceColumn},
+	50:  {commandUndo},
+	70:  {commandTurnRight, commandPlaceItem},
+	90:  {commandForward},
+	130: {commandAttack},
+	170: {commandAttack},
+	200: {commandSave, commandStrafeLeft},
+	230: {commandMarkDestination},
+	260: {commandRedo},
+}
+
+// record plays the session, and returns its recording and the last World.
+func record(ticks uint64) (recording, world.World) {
+	programState := programState{World: testWorld()}
+	programState = startRecording(programState, testDt)
+	for i := uint64(0); i < ticks; i++ {
+		var commands []command
+		for _, command := range testSession[i] {
+			// Do not write saves from the tests.
+			if !isFileCommand(command) {
+				commands = append(commands, command)
+			}
+		}
+		programState = tick(programState, commands, testDt)
+	}
+	programState.Recording.stop(programState.World)
+	return *programState.Recording, programState.World
+}
+
+func TestReplayRebuildsTheWorld(test *testing.T) {
+	recorded, last := record(300)
+	if len(recorded.Checkpoints) != 5 {
+		test.Errorf("%v checkpoints for 300 ticks.", len(recorded.Checkpoints))
+	}
+	var file bytes.Buffer
+	if err := recorded.Write(&file); err != nil {
+		test.Fatal(err)
+	}
+	loaded, err := readRecording(&file)
+	if err != nil {
+		test.Fatal(err)
+	}
+	replayed, err := replayAll(loaded)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if replayed.World.Hash() != last.Hash() {
+		test.Error("The replay ended on another world.")
+	}
+	if replayed.World.Levels[0].Creatures.Len() != last.Levels[0].Creatures.Len() {
+		test.Error("The replay lost creatures.")
+	}
+}
+
+func TestReplayFindsDifferences(test *testing.T) {
+	recorded, _ := record(300)
+	// Forget the turn to the left: the wall goes elsewhere, and so on.
+	events := make([]recordedTick, 0, len(recorded.Events))
+	for _, event := range recorded.Events {
+		if event.Tick != 10 {
+			events = append(events, event)
+		}
+	}
+	recorded.Events = events
+	_, err := replayAll(recorded)
+	replayErr, ok := err.(replayError)
+	if !ok {
+		test.Fatal("The replay did not notice a missing command:", err)
+	}
+	if replayErr.checkpoint.Tick != checkpointPeriod-1 {
+		test.Error("The replay noticed too late:", err)
+	}
+}
+
+// Ticks that read the World from a file replay to the World they left.
+func TestReplayTakesLoadedWorlds(test *testing.T) {
+	recorded, _ := record(100)
+	loaded := testWorld()
+	loaded.Time = 12345
+	recorded.Events = append(recorded.Events, recordedTick{
+		Tick:     100,
+		Time:     loaded.Time,
+		Commands: []command{commandLoad},
+		Replaced: true,
+		World:    loaded,
+	})
+	recorded.Ticks = 101
+	replayed, err := replayAll(recorded)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if replayed.World.Time != loaded.Time || replayed.World.Levels[0].Creatures.Len() != 1 {
+		test.Error("The replay did not take the loaded world.")
+	}
+}
+
+// Recordings hold the names of the commands, not their values.
+func TestRecordingsNameCommands(test *testing.T) {
+	if len(commandsByName) != int(commandReplay)+1 {
+		test.Error("Some commands have no name, or the same name.")
+	}
+	recorded, _ := record(100)
+	var file bytes.Buffer
+	if err := recorded.Write(&file); err != nil {
+		test.Fatal(err)
+	}
+	if !bytes.Contains(file.Bytes(), []byte("place-monster")) {
+		test.Error("The recording does not name the commands.")
+	}
+	var bad bytes.Buffer
+	var unknown command = -1
+	recorded.Events[0].Commands = []command{unknown}
+	if err := recorded.Write(&bad); err == nil {
+		test.Error("Recorded a command without a name.")
+	}
+}
+
+func TestRecordingsOfOtherVersions(test *testing.T) {
+	recorded, _ := record(10)
+	recorded.Version = recordingVersion + 1
+	var file bytes.Buffer
+	if err := recorded.Write(&file); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := readRecording(&file); err == nil {
+		test.Error("Read a recording of another version.")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"testing"
+	"world"
+)
+
+// simulate lets the World live for a number of ticks while the player does
+// nothing.  It calls watch after each tick, with a World that must be sane.
+func simulate(test *testing.T, w world.World, ticks int, watch func(w world.World)) world.World {
+	programState := programState{World: w}
+	for i := 0; i < ticks; i++ {
+		programState = tick(programState, nil, testDt)
+		if problems := programState.World.Validate(); len(problems) != 0 {
+			test.Fatalf("Tick %v: %v", i, problems)
+		}
+		watch(programState.World)
+	}
+	return programState.World
+}
+
+// Launchers shoot when the schedule says, then once per period.
+func TestLauncherFiresOnSchedule(test *testing.T) {
+	const firstShot = 10 * testDt
+	for _, active := range []bool{true, false} {
+		w := testWorld()
+		launcher := world.MakeMechanism(
+			world.MECHANISM_ARROW_LAUNCHER,
+			world.Anchor{Location: world.Location{X: -3, Y: 3}, On_wall: true, Facing: world.EAST()},
+		)
+		launcher.Active = active
+		level, launcherID := w.Levels[0].AddMechanism(launcher)
+		level.ActorSchedule = level.ActorSchedule.Add(launcherID, firstShot)
+		w = w.SetLevel(0, level)
+		// Each arrow takes the next actor identifier.
+		var shots []uint64
+		nextID := level.Actors.NextIDprivate
+		simulate(test, w, 180, func(w world.World) {
+			if w.Levels[0].Actors.NextIDprivate != nextID {
+				nextID = w.Levels[0].Actors.NextIDprivate
+				shots = append(shots, w.Time)
+			}
+		})
+		if !active {
+			if len(shots) != 0 {
+				test.Error("An inactive launcher shot at", shots)
+			}
+			continue
+		}
+		if len(shots) != 3 {
+			test.Fatal("The launcher shot at", shots)
+		}
+		for i, shot := range shots {
+			scheduled := firstShot + uint64(i)*launcher.Period
+			if shot < scheduled || shot >= scheduled+testDt {
+				test.Errorf("Shot %v came at %v instead of %v.", i, shot, scheduled)
+			}
+		}
+	}
+}
+
+// launchArrow puts an arrow flying east from the location, and returns its
+// actor.
+func launchArrow(test *testing.T, w world.World, location world.Location) (world.World, world.ActorID) {
+	arrowID := w.Levels[0].Actors.NextIDprivate
+	w, err := world.DeltaProjectileLaunched{
+		Level:      0,
+		Actor:      arrowID,
+		Projectile: world.MakeProjectile(location, world.EAST(), testDt, 5, world.BARE_HANDS),
+		Time:       w.Time,
+	}.Apply(w)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return w, arrowID
+}
+
+// flight follows a projectile, and returns the World after the given ticks,
+// the last tile the projectile was seen in and whether it disappeared.
+func flight(test *testing.T, w world.World, arrowID world.ActorID, ticks int) (world.World, world.Location, bool) {
+	last, gone := world.Location{}, false
+	w = simulate(test, w, ticks, func(w world.World) {
+		if arrow, ok := w.Levels[0].Projectiles.Get(arrowID); ok {
+			last = arrow.Location
+		} else {
+			gone = true
+		}
+	})
+	return w, last, gone
+}
+
+// Projectiles stop in front of walls, and disappear.
+func TestProjectileHitsWall(test *testing.T) {
+	w := testWorld()
+	level := w.Levels[0]
+	level.Walls[world.WEST().Value()] = level.Walls[world.WEST().Value()].Set(0, 2, world.MakeWall(wallID, false))
+	w, arrowID := launchArrow(test, w.SetLevel(0, level), world.Location{X: -2, Y: 2})
+	_, last, gone := flight(test, w, arrowID, 20)
+	if !gone || last != (world.Location{X: 0, Y: 2}) {
+		test.Error("The arrow flew to", last, "and disappeared", gone)
+	}
+}
+
+// Projectiles strike the first creature in their way, and disappear.  They
+// enter the tile of the creature, strike and land in the same turn: they are
+// last seen on the tile before.
+func TestProjectileHitsCreature(test *testing.T) {
+	w := testWorld()
+	level := w.Levels[0]
+	monster := world.MakeCreature()
+	monster.Faction = world.FACTION_MONSTERS
+	creatures, monsterID := level.Creatures.Add(monster)
+	level.Creatures = creatures
+	level.CreatureLocation, _ = level.CreatureLocation.Add(monsterID, world.Location{X: 1, Y: -2})
+	w, arrowID := launchArrow(test, w.SetLevel(0, level), world.Location{X: -2, Y: -2})
+	rng := w.Rng(world.STREAM_COMBAT)
+	w, last, gone := flight(test, w, arrowID, 20)
+	if !gone || last != (world.Location{X: 0, Y: -2}) {
+		test.Error("The arrow flew to", last, "and disappeared", gone)
+	}
+	if w.Rng(world.STREAM_COMBAT) == rng {
+		test.Error("The arrow did not strike the monster.")
+	}
+}
+
+// Teleporters send the player to another level, facing the way the teleporter
+// says unless it keeps their own facing.  The player goes on playing there.
+func TestTeleportToAnotherLevel(test *testing.T) {
+	for keepFacing, facing := range map[bool]world.AbsoluteDirection{false: world.NORTH(), true: world.EAST()} {
+		w := testWorld()
+		there := world.MakeLevel(1)
+		for x := world.Coord(0); x < 5; x++ {
+			for y := world.Coord(0); y < 5; y++ {
+				there.Floors = there.Floors.Set(x, y, world.MakeFloor(floorID, world.EAST(), true))
+			}
+		}
+		level := w.Levels[0]
+		to := world.LevelPosition{Level: 1, Position: world.Position{Location: world.Location{X: 2, Y: 2}, F: world.NORTH()}}
+		level.Effects, _ = level.Effects.Add(world.MakeTeleporter(world.Location{X: 1, Y: 0}, to, keepFacing))
+		programState := programState{World: w.SetLevel(0, level).SetLevel(1, there)}
+		programState = tick(programState, []command{commandForward}, testDt)
+		landing := world.Position{Location: to.Location, F: facing}.ToLevelPosition(1)
+		position, ok := programState.World.ActorPosition(programState.World.Player_id)
+		if !ok || position != landing {
+			test.Fatalf("Keeping facing %v, the player lands at %v.", keepFacing, position)
+		}
+		if problems := programState.World.Validate(); len(problems) != 0 {
+			test.Fatal(problems)
+		}
+		for i := 0; i < 20 && position == landing; i++ {
+			programState = tick(programState, []command{commandForward}, testDt)
+			position, _ = programState.World.ActorPosition(programState.World.Player_id)
+		}
+		if position.Level != 1 || position.Location != to.Location.MoveAbsolute(facing, 1) {
+			test.Errorf("Keeping facing %v, the player walks to %v.", keepFacing, position)
+		}
+	}
+}
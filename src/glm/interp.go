@@ -46,6 +46,7 @@ func Slerp(q0, q1 Quat, t float64) Quat {
 	cos_angle := q0.Dot(q1)
 	if cos_angle < 0 {
 		q0 = q0.Neg() // Ensure shortest path.
+		cos_angle = -cos_angle
 	}
 	var k0, k1 float64
 	if cos_angle > .9999 {
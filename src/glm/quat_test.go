@@ -1,6 +1,7 @@
 package glm
 
 import (
+	"math"
 	"testing"
 )
 
@@ -24,3 +25,25 @@ func TestSlerp(test *testing.T) {
 		}
 	}
 }
+
+// Slerp takes the shortest way, even between quaternions of opposite signs.
+// Turning from 0° to 270° is turning by -90°: halfway is -45°, not 135°.
+func TestSlerpShortestPath(test *testing.T) {
+	axis := Vector3{0, 0, 1}
+	q0 := axis.Quat(0)
+	q1 := axis.Quat(270)
+	if q0.Dot(q1) >= 0 {
+		test.Fatal("The quaternions do not have opposite signs.")
+	}
+	halfway := Slerp(q0, q1, .5).Rotate3(Vector3{1, 0, 0})
+	expected := Vector3{math.Sqrt2 / 2, -math.Sqrt2 / 2, 0}
+	if distance := halfway.Sub(expected).Norm(); distance > 1e-12 {
+		test.Errorf("Halfway from 0° to 270°, x goes to %v.", halfway)
+	}
+	for i := 0; i <= 10; i++ {
+		q := Slerp(q0, q1, float64(i)/10)
+		if norm := q.Dot(q); math.Abs(norm-1) > 1e-12 {
+			test.Errorf("Slerp at %v is not a rotation: %v.", float64(i)/10, q)
+		}
+	}
+}
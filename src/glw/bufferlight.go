@@ -4,12 +4,13 @@ import (
 	//"fmt"
 	"github.com/go-gl/gl"
 	"glm"
+	"sort"
 )
 
 const nbLightsMax = 100
 
 type Light struct {
-	Color  glm.Vector4
+	Color  glm.Vector4 // w is the radius of a point light, 0 for no limit.
 	Origin glm.Vector4 // w=0 for directional light, 1 for point light.
 }
 
@@ -75,10 +76,42 @@ func (buffer *LightBuffer) SetNbLights(nbLights uint32) {
 	buffer.bufferdataClean = false
 }
 
+// SetLights sets all the lights at once.  When there are too many, only the
+// closest to the eye are kept.  Directional lights are kept first.
 func (buffer *LightBuffer) SetLights(lights []Light) {
+	if len(lights) > nbLightsMax {
+		closest := make(lightsByDistance, len(lights))
+		copy(closest, lights)
+		sort.Sort(closest)
+		lights = closest[:nbLightsMax]
+	}
 	buffer.SetNbLights(uint32(len(lights)))
 	for i, light := range lights {
 		buffer.SetLight(uint32(i), light)
 	}
 	// No need to set bufferdataClean to false, SetNbLight and SetLight did it.
 }
+
+// lightsByDistance sorts lights from the closest to the eye to the farthest.
+// Lights are in eye space, so the eye is at the origin.
+type lightsByDistance []Light
+
+func (lights lightsByDistance) distance(i int) float64 {
+	origin := lights[i].Origin
+	if origin[3] == 0 {
+		return 0 // Directional lights are everywhere.
+	}
+	return origin[0]*origin[0] + origin[1]*origin[1] + origin[2]*origin[2]
+}
+
+func (lights lightsByDistance) Len() int {
+	return len(lights)
+}
+
+func (lights lightsByDistance) Less(i, j int) bool {
+	return lights.distance(i) < lights.distance(j)
+}
+
+func (lights lightsByDistance) Swap(i, j int) {
+	lights[i], lights[j] = lights[j], lights[i]
+}
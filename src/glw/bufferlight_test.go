@@ -0,0 +1,55 @@
+package glw
+
+import (
+	"glm"
+	"testing"
+)
+
+// When there are too many lights, the buffer keeps the directional ones and
+// the point lights closest to the eye.
+func TestSetLightsKeepsTheClosest(test *testing.T) {
+	var lights []Light
+	// From the farthest to the closest, so that the order has to change.
+	for i := nbLightsMax + 20; i > 0; i-- {
+		lights = append(lights, Light{Origin: glm.Vector4{float64(i), 0, -1, 1}})
+	}
+	sun := Light{Origin: glm.Vector4{0, 0, -1000, 0}}
+	lights = append(lights, sun)
+	buffer := NewLightBuffer(0, 0)
+	buffer.SetLights(lights)
+	if buffer.data.nbLights != nbLightsMax {
+		test.Fatal("The buffer keeps", buffer.data.nbLights, "lights.")
+	}
+	kept := make(map[GlLight]bool)
+	for _, light := range buffer.data.lights {
+		kept[light] = true
+	}
+	if !kept[sun.ToGl()] {
+		test.Error("The directional light was dropped.")
+	}
+	for i, light := range lights[:len(lights)-1] {
+		closest := i >= 21 // The sun takes the place of one of them.
+		if kept[light.ToGl()] != closest {
+			test.Errorf("Light at %v kept: %v.", light.Origin, !closest)
+		}
+	}
+	// The lights passed in are left alone.
+	if lights[0].Origin[0] != nbLightsMax+20 {
+		test.Error("The lights were sorted in place.")
+	}
+}
+
+// A few lights are all kept, in order.
+func TestSetLightsKeepsFewLights(test *testing.T) {
+	lights := []Light{
+		{Origin: glm.Vector4{3, 0, 0, 1}},
+		{Origin: glm.Vector4{1, 0, 0, 1}},
+	}
+	buffer := NewLightBuffer(0, 0)
+	buffer.SetLights(lights)
+	if buffer.data.nbLights != 2 ||
+		buffer.data.lights[0] != lights[0].ToGl() ||
+		buffer.data.lights[1] != lights[1].ToGl() {
+		test.Error("The buffer holds", buffer.data.nbLights, buffer.data.lights[:2])
+	}
+}
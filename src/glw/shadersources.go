@@ -114,6 +114,12 @@ void main(){
             l_dir -= fpos_eye.xyz;
             float distsq = dot(l_dir, l_dir);
             att = 1/distsq;
+            // The alpha of a point light is its radius, it fades to nothing
+            // there.
+            float radius = lights[i].color.a;
+            if (radius > 0) {
+                att *= max(1 - distsq/(radius*radius), 0);
+            }
 		}
         vec3 l_col = lights[i].color.rgb;
         color += l_col * max(dot(l_dir, normal_eye), 0) * att;
@@ -30,26 +30,90 @@ import (
 //
 // Creating an action does not execute it.  It must be executed to have an effect.
 //
-// Note that the Execute method returns a World.  This is probably overkill.  It
-// may be more efficient to just return some 'deltas' instead.  These deltas would
-// then be combined and apply all at once to the world, instead of creating a new
-// world each time.  But this is easier, and I go for correctness before trying
-// to be smart.
+// Actions do not modify the world directly though.  Delta computes what the
+// action would change, as a world.Delta, and leaves the world alone.  The
+// Delta can then be inspected, combined with others, sent away or recorded,
+// and applied.  Execute is there for convenience: it computes the Delta and
+// applies it right away.
 type Action interface {
+	Delta(world.World) (world.Delta, error)
 	Execute(world.World) (world.World, error)
 }
 
+// execute is what the Execute method of all actions does.
+func execute(action Action, w world.World) (world.World, error) {
+	delta, _, err := Plan(action, w)
+	if err != nil {
+		return w, err
+	}
+	return delta.Apply(w)
+}
+
+// A Result tells what happened when an action was executed, in a way that can
+// be shown to the player.  "The goblin misses you" is a result.
+type Result interface {
+	String() string
+}
+
+// Actions whose outcome is worth telling also implement Resolver.  Resolve
+// does the same as Delta, and returns the Result on top of the Delta.  The
+// Result may be nil when there is nothing to tell.
+type Resolver interface {
+	Action
+	Resolve(world.World) (world.Delta, Result, error)
+}
+
+// Plan computes everything that happens when an action is carried out: the
+// Delta of the action itself, followed by the reactions of the triggers of the
+// world, like pressure plates under the feet of a creature.  The Result is
+// that of the action, when it is a Resolver.
+func Plan(action Action, w world.World) (world.Delta, Result, error) {
+	var delta world.Delta
+	var result Result
+	var err error
+	if resolver, ok := action.(Resolver); ok {
+		delta, result, err = resolver.Resolve(w)
+	} else {
+		delta, err = action.Delta(w)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	delta, err = w.React(delta)
+	if err != nil {
+		return nil, nil, err
+	}
+	return delta, result, nil
+}
+
 // This module deals with the behavior of creatures in the game.
 // Because most creatures are controlled by the computer, we can refer to this
 // module as AI (artificial intelligence).  However, the character controled by the
 // player uses the same concepts.
 
+// subjectLevel finds the Level in which the subject of an action is, since
+// actions are always carried out in the Level of their subject.
+func subjectLevel(w world.World, subjectID world.ActorID) (world.LevelId, world.Level, error) {
+	levelID, ok := w.ActorLevel(subjectID)
+	if !ok {
+		return 0, world.Level{}, fmt.Errorf(
+			"actor %v is not in any level",
+			subjectID,
+		)
+	}
+	return levelID, w.Levels[levelID], nil
+}
+
 // Wait: That action does nothing.
 // How is that different from a nil action?  Not much.  Except that nil could
 // indicate AI failure while Wait is a deliberate choice, for example.  Must think.
 type ActionWait struct{}
 
 // The Wait action does nothing at all, it does not even increment a time variable.
+func (action ActionWait) Delta(w world.World) (world.Delta, error) {
+	return world.Deltas{}, nil
+}
+
 func (action ActionWait) Execute(w world.World) (world.World, error) {
 	return w, nil
 }
@@ -59,50 +123,111 @@ type ActionMoveAbsolute struct {
 	SubjectID world.ActorID
 	Direction world.AbsoluteDirection
 	Steps     uint
+	Attack    bool // Attack hostile creatures in the way instead of stopping.
 }
 
 func (action ActionMoveAbsolute) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionMoveAbsolute) Delta(w world.World) (world.Delta, error) {
+	delta, _, err := action.Resolve(w)
+	return delta, err
+}
+
+func (action ActionMoveAbsolute) Resolve(w world.World) (world.Delta, Result, error) {
 	// Trivial case: no movement.
 	if action.Steps <= 0 {
-		return w, nil
+		return world.Deltas{}, nil, nil
+	}
+	levelID, level, err := subjectLevel(w, action.SubjectID)
+	if err != nil {
+		return nil, nil, err
 	}
 	// Only creatures can move.
-	creatureID, ok := w.Level.CreatureActor.GetCreature(action.SubjectID)
+	creatureID, ok := level.CreatureActor.GetCreature(action.SubjectID)
 	if !ok {
-		return w, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"actor %v does not have a corresponding creature",
 			action.SubjectID,
 		)
 	}
 	// We start computing the new location from the current one.
-	newLoc, ok := w.Level.CreatureLocation.GetLocation(creatureID)
+	oldLoc, ok := level.CreatureLocation.GetLocation(creatureID)
 	if !ok {
-		return w, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"actor %v creature %v does not have a corresponding position",
 			action.SubjectID,
 			creatureID,
 		)
 	}
+	if action.Attack && hostileAhead(level, creatureID, oldLoc, action.Direction) {
+		return ActionAttack{
+			SubjectID: action.SubjectID,
+			Direction: action.Direction,
+		}.Resolve(w)
+	}
+	newLoc := oldLoc
 	for stepID := uint(0); stepID < action.Steps; stepID++ {
-		if w.Level.IsPassable(newLoc, action.Direction) {
+		if level.IsPassable(newLoc, action.Direction) {
 			newLoc = newLoc.MoveAbsolute(action.Direction, 1)
 		} else {
-			return w, fmt.Errorf(
+			return nil, nil, fmt.Errorf(
 				"actor %v creature %v cannot pass %v",
 				action.SubjectID,
 				creatureID,
 				newLoc,
 			)
 		}
+		// Floor effects catch the creature, it goes no further.
+		if _, effect, ok := level.Effects.At(newLoc); ok && effect.Active {
+			break
+		}
 	}
 	// Move the creature.
-	locations, err := w.Level.CreatureLocation.Move(creatureID, newLoc)
+	delta, err := enter(w, levelID, creatureID, world.DeltaCreatureMoved{
+		Level:    levelID,
+		Creature: creatureID,
+		From:     oldLoc,
+		To:       newLoc,
+	})
+	return delta, nil, err
+}
+
+// enter adds to the Delta of a creature stepping into a tile what the floor
+// effect of that tile does to it: teleporters send it away, spinners turn it
+// around.
+func enter(
+	w world.World,
+	levelID world.LevelId,
+	creatureID world.CreatureId,
+	step world.Delta,
+) (world.Delta, error) {
+	after, err := step.Apply(w)
 	if err != nil {
-		return w, err
+		return nil, err
 	}
-	// World was passed by value, we can modify it.
-	w.Level.CreatureLocation = locations
-	return w, nil
+	level := after.Levels[levelID]
+	location, _ := level.CreatureLocation.GetLocation(creatureID)
+	creature, _ := level.Creatures.Get(creatureID)
+	from := location.ToPosition(creature.F)
+	to, ok := after.Landing(levelID, from)
+	if !ok {
+		return step, nil
+	}
+	if to.Level == levelID && to.Location == location {
+		return world.Combine(step, world.DeltaCreatureTurned{
+			Level:    levelID,
+			Creature: creatureID,
+			From:     from.F,
+			To:       to.F,
+		}), nil
+	}
+	return world.Combine(step, world.DeltaCreatureTravelled{
+		Creature: creatureID,
+		From:     from.ToLevelPosition(levelID),
+		To:       to,
+	}), nil
 }
 
 // Move: That action moves one actor to a neighboring tile.
@@ -110,56 +235,68 @@ type ActionMoveRelative struct {
 	SubjectID world.ActorID
 	Direction world.RelativeDirection
 	Steps     uint
+	Attack    bool // Attack hostile creatures in the way instead of stopping.
 }
 
 func (action ActionMoveRelative) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionMoveRelative) Delta(w world.World) (world.Delta, error) {
+	delta, _, err := action.Resolve(w)
+	return delta, err
+}
+
+func (action ActionMoveRelative) Resolve(w world.World) (world.Delta, Result, error) {
 	if action.Steps <= 0 {
-		return w, nil
+		return world.Deltas{}, nil, nil
 	}
-	creatureID, ok := w.Level.CreatureActor.GetCreature(action.SubjectID)
+	_, level, err := subjectLevel(w, action.SubjectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	creatureID, ok := level.CreatureActor.GetCreature(action.SubjectID)
 	if !ok {
-		return w, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"actor %v does not have a corresponding creature",
 			action.SubjectID,
 		)
 	}
-	creature, ok := w.Level.Creatures.Get(creatureID)
+	creature, ok := level.Creatures.Get(creatureID)
 	if !ok {
-		return w, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"actor %v creature %v does not have a corresponding creature",
 			action.SubjectID,
 			creatureID,
 		)
 	}
-	direction := creature.F.Add(action.Direction)
-	newLoc, ok := w.Level.CreatureLocation.GetLocation(creatureID)
-	if !ok {
-		return w, fmt.Errorf(
-			"actor %v creature %v does not have a corresponding position",
-			action.SubjectID,
-			creatureID,
-		)
-	}
-	for stepID := uint(0); stepID < action.Steps; stepID++ {
-		if w.Level.IsPassable(newLoc, direction) {
-			newLoc = newLoc.MoveAbsolute(direction, 1)
-		} else {
-			return w, fmt.Errorf(
-				"actor %v creature %v cannot pass %v",
-				action.SubjectID,
-				creatureID,
-				newLoc,
-			)
-		}
+	// Moving relatively is moving absolutely once the facing is known.
+	return ActionMoveAbsolute{
+		SubjectID: action.SubjectID,
+		Direction: creature.F.Add(action.Direction),
+		Steps:     action.Steps,
+		Attack:    action.Attack,
+	}.Resolve(w)
+}
+
+// hostileAhead tells whether a creature hostile to the given one stands right
+// next to the location, in the given direction, with nothing in between.
+func hostileAhead(
+	level world.Level,
+	creatureID world.CreatureId,
+	location world.Location,
+	direction world.AbsoluteDirection,
+) bool {
+	if !level.IsPassable(location, direction) {
+		return false
 	}
-	// Move the creature.
-	locations, err := w.Level.CreatureLocation.Move(creatureID, newLoc)
-	if err != nil {
-		return w, err
+	otherID, ok := level.CreatureLocation.GetCreature(location.MoveAbsolute(direction, 1))
+	if !ok {
+		return false
 	}
-	// World was passed by value, we can modify it.
-	w.Level.CreatureLocation = locations
-	return w, nil
+	creature, _ := level.Creatures.Get(creatureID)
+	other, _ := level.Creatures.Get(otherID)
+	return creature.Faction.IsHostile(other.Faction)
 }
 
 // Turn: That action rotates an actor.
@@ -172,19 +309,27 @@ type ActionTurn struct {
 }
 
 func (action ActionTurn) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionTurn) Delta(w world.World) (world.Delta, error) {
 	if action.Steps <= 0 {
-		return w, nil
+		return world.Deltas{}, nil
+	}
+	levelID, level, err := subjectLevel(w, action.SubjectID)
+	if err != nil {
+		return nil, err
 	}
-	creatureID, ok := w.Level.CreatureActor.GetCreature(action.SubjectID)
+	creatureID, ok := level.CreatureActor.GetCreature(action.SubjectID)
 	if !ok {
-		return w, fmt.Errorf(
+		return nil, fmt.Errorf(
 			"actor %v does not have a corresponding creature",
 			action.SubjectID,
 		)
 	}
-	creature, ok := w.Level.Creatures.Get(creatureID)
+	creature, ok := level.Creatures.Get(creatureID)
 	if !ok {
-		return w, fmt.Errorf(
+		return nil, fmt.Errorf(
 			"actor %v creature %v does not have a corresponding creature",
 			action.SubjectID,
 			creatureID,
@@ -195,16 +340,490 @@ func (action ActionTurn) Execute(w world.World) (world.World, error) {
 	for stepID := uint(0); stepID < action.Steps; stepID++ {
 		facing = facing.Add(action.Direction)
 	}
-	creature.F = facing
 	// /Payload.
-	w.Level.Creatures = w.Level.Creatures.Set(creatureID, creature)
-	return w, nil
+	return world.DeltaCreatureTurned{
+		Level:    levelID,
+		Creature: creatureID,
+		From:     creature.F,
+		To:       facing,
+	}, nil
+}
+
+// Climb: That action makes an actor take the stairs, ladder or any other
+// passage it is standing on.  This is how creatures go from one level to
+// another.
+type ActionClimb struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionClimb) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
 }
 
-func DecideAction(subjectID world.ActorID) Action {
+func (action ActionClimb) Delta(w world.World) (world.Delta, error) {
+	levelID, level, err := subjectLevel(w, action.SubjectID)
+	if err != nil {
+		return nil, err
+	}
+	creatureID, ok := level.CreatureActor.GetCreature(action.SubjectID)
+	if !ok {
+		return nil, fmt.Errorf(
+			"actor %v does not have a corresponding creature",
+			action.SubjectID,
+		)
+	}
+	position, ok := level.ActorPosition(action.SubjectID)
+	if !ok {
+		return nil, fmt.Errorf(
+			"actor %v creature %v does not have a corresponding position",
+			action.SubjectID,
+			creatureID,
+		)
+	}
+	building, ok := level.Floors.Get(position.X, position.Y)
+	if !ok {
+		return nil, fmt.Errorf(
+			"actor %v creature %v stands on nothing at %v",
+			action.SubjectID,
+			creatureID,
+			position.Location,
+		)
+	}
+	passage, ok := building.(world.Passage)
+	if !ok {
+		return nil, fmt.Errorf(
+			"actor %v creature %v has nothing to climb at %v in level %v",
+			action.SubjectID,
+			creatureID,
+			position.Location,
+			levelID,
+		)
+	}
+	return world.DeltaCreatureTravelled{
+		Creature: creatureID,
+		From:     position.ToLevelPosition(levelID),
+		To:       passage.Destination(position),
+	}, nil
+}
+
+// Attack: That action hits whoever stands in the next tile with the weapon the
+// actor holds.  Without Direction, the actor hits in front of itself.
+type ActionAttack struct {
+	SubjectID world.ActorID
+	Direction world.AbsoluteDirection // Can be nil.
+}
+
+func (action ActionAttack) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionAttack) Delta(w world.World) (world.Delta, error) {
+	delta, _, err := action.Resolve(w)
+	return delta, err
+}
+
+func (action ActionAttack) Resolve(w world.World) (world.Delta, Result, error) {
+	levelID, level, creatureID, position, err := subjectCreature(w, action.SubjectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	direction := action.Direction
+	if direction == nil {
+		direction = position.F
+	}
+	if !level.IsPassable(position.Location, direction) {
+		return nil, nil, fmt.Errorf(
+			"actor %v creature %v cannot reach beyond %v",
+			action.SubjectID,
+			creatureID,
+			position.Location,
+		)
+	}
+	target := position.Location.MoveAbsolute(direction, 1)
+	defenderID, ok := level.CreatureLocation.GetCreature(target)
+	if !ok {
+		return nil, nil, fmt.Errorf(
+			"actor %v creature %v has nobody to attack at %v",
+			action.SubjectID,
+			creatureID,
+			target,
+		)
+	}
+	attacker, _ := level.Creatures.Get(creatureID)
+	defender, _ := level.Creatures.Get(defenderID)
+	rng, result := world.ResolveMelee(
+		w.Rng(world.STREAM_COMBAT),
+		attacker,
+		level.Wielded(creatureID),
+		defender,
+	)
+	result.Attacker = creatureID
+	result.Defender = defenderID
+	var delta world.Delta
+	delta, result.Killed = world.Hurt(levelID, defenderID, defender, result.Damage)
+	return world.Combine(world.DeltaRng{Stream: world.STREAM_COMBAT, Before: w.Rng(world.STREAM_COMBAT), After: rng}, delta), result, nil
+}
+
+// doorDelta computes the change to the door in front of the subject of an
+// action.  Both sides of a door in a wall change together.
+func doorDelta(
+	w world.World,
+	subjectID world.ActorID,
+	change func(world.Door) (world.Door, error),
+) (world.Delta, error) {
+	levelID, level, err := subjectLevel(w, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	position, ok := level.ActorPosition(subjectID)
+	if !ok {
+		return nil, fmt.Errorf(
+			"actor %v does not have a corresponding position",
+			subjectID,
+		)
+	}
+	slot, _, ok := level.FrontDoor(position)
+	if !ok {
+		return nil, world.DOOR_NOT_FOUND
+	}
+	return slotDoorDelta(levelID, level, slot, change)
+}
+
+// slotDoorDelta computes the change to the door in the given slot.
+func slotDoorDelta(
+	levelID world.LevelId,
+	level world.Level,
+	slot world.DoorSlot,
+	change func(world.Door) (world.Door, error),
+) (world.Delta, error) {
+	door, ok := level.GetDoor(slot)
+	if !ok {
+		return nil, world.DOOR_NOT_FOUND
+	}
+	changed, err := change(door)
+	if err != nil {
+		return nil, err
+	}
+	// Closing a door on a creature would trap it in the door.
+	if !slot.In_wall && !changed.IsPassable() {
+		if _, ok := level.CreatureLocation.GetCreature(slot.Location); ok {
+			return nil, world.DOOR_OBSTRUCTED
+		}
+	}
+	return world.DeltaDoorChanged{
+		Level:  levelID,
+		Slot:   slot,
+		Before: door,
+		After:  changed,
+	}, nil
+}
+
+// OpenDoor: That action opens the door in front of an actor.
+type ActionOpenDoor struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionOpenDoor) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionOpenDoor) Delta(w world.World) (world.Delta, error) {
+	return doorDelta(w, action.SubjectID, world.Door.Open)
+}
+
+// CloseDoor: That action closes the door in front of an actor.
+type ActionCloseDoor struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionCloseDoor) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionCloseDoor) Delta(w world.World) (world.Delta, error) {
+	return doorDelta(w, action.SubjectID, world.Door.Close)
+}
+
+// LockDoor: That action locks the closed door in front of an actor.  There are
+// no keys yet, anyone can lock and unlock any door.
+type ActionLockDoor struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionLockDoor) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionLockDoor) Delta(w world.World) (world.Delta, error) {
+	return doorDelta(w, action.SubjectID, world.Door.Lock)
+}
+
+// UnlockDoor: That action unlocks the door in front of an actor.
+type ActionUnlockDoor struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionUnlockDoor) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionUnlockDoor) Delta(w world.World) (world.Delta, error) {
+	return doorDelta(w, action.SubjectID, world.Door.Unlock)
+}
+
+// Use: That action pulls the lever on the wall in front of an actor.
+type ActionUse struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionUse) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionUse) Delta(w world.World) (world.Delta, error) {
+	levelID, level, err := subjectLevel(w, action.SubjectID)
+	if err != nil {
+		return nil, err
+	}
+	position, ok := level.ActorPosition(action.SubjectID)
+	if !ok {
+		return nil, fmt.Errorf(
+			"actor %v does not have a corresponding position",
+			action.SubjectID,
+		)
+	}
+	triggerID, trigger, ok := level.FrontLever(position)
+	if !ok {
+		return nil, fmt.Errorf("nothing to use in front of actor %v", action.SubjectID)
+	}
+	return w.SwitchTrigger(levelID, triggerID, !trigger.On)
+}
+
+// subjectCreature finds the creature of the subject of an action, and where it
+// stands.
+func subjectCreature(w world.World, subjectID world.ActorID) (
+	world.LevelId, world.Level, world.CreatureId, world.Position, error,
+) {
+	levelID, level, err := subjectLevel(w, subjectID)
+	if err != nil {
+		return 0, level, 0, world.Position{}, err
+	}
+	creatureID, ok := level.CreatureActor.GetCreature(subjectID)
+	if !ok {
+		return 0, level, 0, world.Position{}, fmt.Errorf(
+			"actor %v does not have a corresponding creature",
+			subjectID,
+		)
+	}
+	position, ok := level.ActorPosition(subjectID)
+	if !ok {
+		return 0, level, 0, world.Position{}, fmt.Errorf(
+			"actor %v creature %v does not have a corresponding position",
+			subjectID,
+			creatureID,
+		)
+	}
+	return levelID, level, creatureID, position, nil
+}
+
+// chooseItem returns the item an action is about and where the creature keeps
+// it: the given one, or the one carried last when the action says NO_ITEM.
+func chooseItem(
+	level world.Level,
+	creatureID world.CreatureId,
+	itemID world.ItemId,
+) (world.ItemId, world.ItemPlace, error) {
+	inventory := level.Inventories.Get(creatureID)
+	if itemID == world.NO_ITEM {
+		var ok bool
+		itemID, ok = inventory.Last()
+		if !ok {
+			return itemID, world.ItemPlace{}, world.INV_NOT_CARRIED
+		}
+	}
+	slot, ok := inventory.Slot(itemID)
+	if !ok {
+		return itemID, world.ItemPlace{}, world.INV_NOT_CARRIED
+	}
+	return itemID, world.EquippedBy(creatureID, slot), nil
+}
+
+// PickUp: That action takes the item on top of the pile the actor stands on.
+type ActionPickUp struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionPickUp) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionPickUp) Delta(w world.World) (world.Delta, error) {
+	levelID, level, creatureID, position, err := subjectCreature(w, action.SubjectID)
+	if err != nil {
+		return nil, err
+	}
+	itemID, ok := level.ItemLocation.Top(position.Location)
+	if !ok {
+		return nil, fmt.Errorf(
+			"actor %v creature %v finds nothing to pick up at %v",
+			action.SubjectID,
+			creatureID,
+			position.Location,
+		)
+	}
+	return world.DeltaItemMoved{
+		Level: levelID,
+		Item:  itemID,
+		From:  world.OnGround(position.Location),
+		To:    world.InBackpack(creatureID),
+	}, nil
+}
+
+// Drop: That action puts an item carried by the actor on the ground, where it
+// stands.  Without ItemID, the item picked up last is dropped.
+type ActionDrop struct {
+	SubjectID world.ActorID
+	ItemID    world.ItemId
+}
+
+func (action ActionDrop) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionDrop) Delta(w world.World) (world.Delta, error) {
+	levelID, level, creatureID, position, err := subjectCreature(w, action.SubjectID)
+	if err != nil {
+		return nil, err
+	}
+	itemID, place, err := chooseItem(level, creatureID, action.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	return world.DeltaItemMoved{
+		Level: levelID,
+		Item:  itemID,
+		From:  place,
+		To:    world.OnGround(position.Location),
+	}, nil
+}
+
+// How many tiles a thrown item can fly.
+const throwRange = 3
+
+// Throw: That action sends an item carried by the actor flying in front of it,
+// see ActionFly.  The item hurts the creature it hits like a weapon would, and
+// lands on its tile.  Without ItemID, the item picked up last is thrown.
+type ActionThrow struct {
+	SubjectID world.ActorID
+	ItemID    world.ItemId
+}
+
+func (action ActionThrow) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionThrow) Delta(w world.World) (world.Delta, error) {
+	levelID, level, creatureID, position, err := subjectCreature(w, action.SubjectID)
+	if err != nil {
+		return nil, err
+	}
+	itemID, place, err := chooseItem(level, creatureID, action.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	item, _ := level.Items.Get(itemID)
+	projectile := world.MakeProjectile(
+		position.Location,
+		position.F,
+		throwPeriod,
+		throwRange,
+		item.Weapon,
+	)
+	return launch(w, levelID, level, projectile, itemID, place), nil
+}
+
+// Equip: That action moves an item from the backpack of the actor to the
+// equipment slot the item fits.  Whatever was in the slot goes to the
+// backpack.  Without ItemID, the item picked up last is equipped.
+type ActionEquip struct {
+	SubjectID world.ActorID
+	ItemID    world.ItemId
+}
+
+func (action ActionEquip) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionEquip) Delta(w world.World) (world.Delta, error) {
+	levelID, level, creatureID, _, err := subjectCreature(w, action.SubjectID)
+	if err != nil {
+		return nil, err
+	}
+	itemID, place, err := chooseItem(level, creatureID, action.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	item, ok := level.Items.Get(itemID)
+	if !ok {
+		return nil, fmt.Errorf("item %v does not exist", itemID)
+	}
+	if item.Slot == world.EQUIP_NONE {
+		return nil, world.INV_CANNOT_EQUIP
+	}
+	if place.Slot == item.Slot {
+		// Already equipped.
+		return world.Deltas{}, nil
+	}
+	slot := world.EquippedBy(creatureID, item.Slot)
+	var deltas []world.Delta
+	if previous := level.Inventories.Get(creatureID).Equipped[item.Slot]; previous != world.NO_ITEM {
+		deltas = append(deltas, world.DeltaItemMoved{
+			Level: levelID,
+			Item:  previous,
+			From:  slot,
+			To:    world.InBackpack(creatureID),
+		})
+	}
+	deltas = append(deltas, world.DeltaItemMoved{
+		Level: levelID,
+		Item:  itemID,
+		From:  place,
+		To:    slot,
+	})
+	return world.Combine(deltas...), nil
+}
+
+// How long creatures wait between two turns, in nanoseconds.
+const turnDuration = 100000000
+
+// DecideAction chooses what an actor does when its turn comes.  Mechanisms do
+// what they were built for, and monsters chase the player they see.
+func DecideAction(w world.World, subjectID world.ActorID) Action {
+	if _, _, mechanism, err := subjectMechanism(w, subjectID); err == nil {
+		return mechanismAction(mechanism, subjectID)
+	}
+	if _, _, _, err := subjectProjectile(w, subjectID); err == nil {
+		return ActionFly{SubjectID: subjectID}
+	}
+	if action, ok := chaseAction(w, subjectID); ok {
+		return action
+	}
+	// Look around.
 	return ActionTurn{
 		SubjectID: subjectID,
 		Direction: world.LEFT(),
 		Steps:     1,
 	}
 }
+
+// TurnDuration tells how long an actor waits between two turns, in
+// nanoseconds.
+func TurnDuration(w world.World, subjectID world.ActorID) uint64 {
+	if _, _, mechanism, err := subjectMechanism(w, subjectID); err == nil && mechanism.Period != 0 {
+		return mechanism.Period
+	}
+	if _, _, projectile, err := subjectProjectile(w, subjectID); err == nil && projectile.Period != 0 {
+		return projectile.Period
+	}
+	return turnDuration
+}
@@ -0,0 +1,77 @@
+package ia
+
+import (
+	"pathfind"
+	"world"
+)
+
+// Monsters that see the player chase them: they walk the shortest path to the
+// player, turning to face each step first, and attack once next to them.
+// Monsters that see nobody to chase look around.
+
+// How far monsters see the player.
+const chaseRadius = 8
+
+// How many locations a monster looks through for a path to the player.  Paths
+// that are longer than that are not worth it.
+const chaseBudget = 256
+
+// chaseAction returns the next step of a monster chasing the player, and
+// false when the monster does not see the player or finds no way to them.
+func chaseAction(w world.World, subjectID world.ActorID) (Action, bool) {
+	levelID, level, creatureID, position, err := subjectCreature(w, subjectID)
+	if err != nil || subjectID == w.Player_id {
+		return nil, false
+	}
+	target, ok := w.ActorLocation(w.Player_id)
+	if !ok || target.Level != levelID {
+		return nil, false
+	}
+	creature, _ := level.Creatures.Get(creatureID)
+	playerID, _ := level.CreatureActor.GetCreature(w.Player_id)
+	player, _ := level.Creatures.Get(playerID)
+	if !creature.Faction.IsHostile(player.Faction) || !sees(level, position, target.Location) {
+		return nil, false
+	}
+	options := pathfind.Options{
+		Cost:   pathfind.AvoidCreatures(pathfind.Walk, target.Location),
+		Budget: chaseBudget,
+	}
+	steps, ok := pathfind.FindPath(level, position.Location, target.Location, options)
+	if !ok || len(steps) == 0 {
+		return nil, false
+	}
+	if steps[0] != position.F {
+		return ActionTurn{
+			SubjectID: subjectID,
+			Direction: turnTowards(position.F, steps[0]),
+			Steps:     1,
+		}, true
+	}
+	return ActionMoveAbsolute{
+		SubjectID: subjectID,
+		Direction: steps[0],
+		Steps:     1,
+		Attack:    true,
+	}, true
+}
+
+// sees tells whether someone standing at the position sees the location.
+func sees(level world.Level, position world.Position, location world.Location) bool {
+	for _, visible := range level.FOV(position, chaseRadius) {
+		if visible == location {
+			return true
+		}
+	}
+	return false
+}
+
+// turnTowards returns the shortest turn from one direction to another.
+func turnTowards(from, to world.AbsoluteDirection) world.RelativeDirection {
+	for _, turn := range []world.RelativeDirection{world.LEFT(), world.RIGHT()} {
+		if from.Add(turn) == to {
+			return turn
+		}
+	}
+	return world.BACK()
+}
@@ -0,0 +1,113 @@
+package ia
+
+import (
+	"pathfind"
+	"testing"
+	"world"
+)
+
+// monsterWorld is a World where the player stands at the origin, with a
+// monster at the given position.  Both stand on floors, and so do the other
+// locations given.
+func monsterWorld(position world.Position, floors ...world.Location) (world.World, world.ActorID) {
+	w := world.MakeWorld()
+	level := w.Levels[0]
+	floors = append(floors, world.Location{}, position.Location)
+	for _, location := range floors {
+		level.Floors = level.Floors.Set(location.X, location.Y, world.MakeFloor(0, world.EAST(), true))
+	}
+	monster := world.MakeCreature()
+	monster.F = position.F
+	monster.Faction = world.FACTION_MONSTERS
+	creatures, creatureID := level.Creatures.Add(monster)
+	actors, actorID := level.Actors.Add(world.MakeActor())
+	level.Creatures, level.Actors = creatures, actors
+	level.CreatureActor, _ = level.CreatureActor.Add(creatureID, actorID)
+	level.CreatureLocation, _ = level.CreatureLocation.Add(creatureID, position.Location)
+	return w.SetLevel(0, level), actorID
+}
+
+// corridorWorld is a corridor going east from the player, with a monster at
+// the other end, facing the given way.
+func corridorWorld(facing world.AbsoluteDirection) (world.World, world.ActorID) {
+	return monsterWorld(
+		world.Position{Location: world.Location{X: 4}, F: facing},
+		world.Location{X: 1}, world.Location{X: 2}, world.Location{X: 3},
+	)
+}
+
+func TestChase(test *testing.T) {
+	w, monsterID := corridorWorld(world.WEST())
+	action := DecideAction(w, monsterID)
+	move, ok := action.(ActionMoveAbsolute)
+	if !ok || move.Direction != world.WEST() || !move.Attack {
+		test.Fatal("The monster does not walk to the player:", action)
+	}
+	for i := 0; i < 3; i++ {
+		var err error
+		if w, err = DecideAction(w, monsterID).Execute(w); err != nil {
+			test.Fatal(err)
+		}
+	}
+	location, _ := w.ActorLocation(monsterID)
+	if location.Location != (world.Location{X: 1}) {
+		test.Fatal("The monster stopped at", location)
+	}
+	if _, _, err := Plan(DecideAction(w, monsterID), w); err != nil {
+		test.Error("The monster does not attack the player:", err)
+	}
+}
+
+// Monsters turn to face the way they go.  This one sees the player on its
+// left, around the corner.
+func TestChaseTurns(test *testing.T) {
+	w, monsterID := monsterWorld(
+		world.Position{Location: world.Location{X: 1, Y: 1}, F: world.WEST()},
+		world.Location{X: 1},
+	)
+	action := DecideAction(w, monsterID)
+	if turn, ok := action.(ActionTurn); !ok || turn.Direction != world.LEFT() {
+		test.Fatal("The monster does not turn towards its path:", action)
+	}
+	w, _ = action.Execute(w)
+	action = DecideAction(w, monsterID)
+	if move, ok := action.(ActionMoveAbsolute); !ok || move.Direction != world.SOUTH() {
+		test.Error("The monster does not go round the corner:", action)
+	}
+}
+
+// Monsters do not see behind them.
+func TestChaseNeedsSight(test *testing.T) {
+	w, monsterID := corridorWorld(world.EAST())
+	action := DecideAction(w, monsterID)
+	if _, ok := action.(ActionMoveAbsolute); ok {
+		test.Error("The monster chases what it cannot see.")
+	}
+}
+
+// The steps found by pathfind must be usable as they are by the move action.
+func TestPathsAreMoves(test *testing.T) {
+	w := world.MakeWorld()
+	level := w.Levels[0]
+	for _, location := range []world.Location{
+		{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 1}, {X: 2, Y: 2}, {X: 3, Y: 2},
+	} {
+		level.Floors = level.Floors.Set(location.X, location.Y, world.MakeFloor(0, world.EAST(), true))
+	}
+	w = w.SetLevel(0, level)
+	goal := world.Location{X: 3, Y: 2}
+	steps, ok := pathfind.FindPath(level, world.Location{}, goal, pathfind.Options{})
+	if !ok {
+		test.Fatal("No path found.")
+	}
+	for _, direction := range steps {
+		var err error
+		w, err = ActionMoveAbsolute{SubjectID: w.Player_id, Direction: direction, Steps: 1}.Execute(w)
+		if err != nil {
+			test.Fatal(err)
+		}
+	}
+	if end, _ := w.ActorLocation(w.Player_id); end.Location != goal {
+		test.Errorf("The player ends at %v instead of %v.", end.Location, goal)
+	}
+}
@@ -0,0 +1,118 @@
+package ia
+
+import (
+	"testing"
+	"world"
+)
+
+// pileWorld is a World where the player stands on a pile of items, the last
+// one on top.  It returns the identifiers of the items.
+func pileWorld(items ...world.Item) (world.World, []world.ItemId) {
+	w := world.MakeWorld()
+	level := w.Levels[0]
+	level.Floors = level.Floors.Set(0, 0, world.MakeFloor(0, world.EAST(), true))
+	var itemIDs []world.ItemId
+	for _, item := range items {
+		var itemID world.ItemId
+		level.Items, itemID = level.Items.Add(item)
+		level.ItemLocation, _ = level.ItemLocation.Add(itemID, world.Location{})
+		itemIDs = append(itemIDs, itemID)
+	}
+	return w.SetLevel(0, level), itemIDs
+}
+
+// executeAll runs actions of the player, which must all succeed and leave the
+// World sane.
+func executeAll(test *testing.T, w world.World, actions ...Action) world.World {
+	for _, action := range actions {
+		var err error
+		if w, err = action.Execute(w); err != nil {
+			test.Fatalf("%#v: %v", action, err)
+		}
+		if problems := w.Validate(); len(problems) != 0 {
+			test.Fatalf("%#v: %v", action, problems)
+		}
+	}
+	return w
+}
+
+// itemPlace tells where an item of level 0 is.
+func itemPlace(w world.World, itemID world.ItemId) world.ItemPlace {
+	place, _ := w.Levels[0].ItemPlace(itemID)
+	return place
+}
+
+func playerCreature(w world.World) world.CreatureId {
+	creatureID, _ := w.Levels[0].CreatureActor.GetCreature(w.Player_id)
+	return creatureID
+}
+
+func TestPickUp(test *testing.T) {
+	w, items := pileWorld(
+		world.MakeItem(1, "sword", world.EQUIP_HAND),
+		world.MakeItem(2, "rock", world.EQUIP_NONE),
+	)
+	player := playerCreature(w)
+	w = executeAll(test, w, ActionPickUp{SubjectID: w.Player_id})
+	if itemPlace(w, items[1]) != world.InBackpack(player) || itemPlace(w, items[0]) != world.OnGround(world.Location{}) {
+		test.Error("The player did not pick up the top of the pile.")
+	}
+	w = executeAll(test, w, ActionPickUp{SubjectID: w.Player_id})
+	if last, _ := w.Levels[0].Inventories.Get(player).Last(); last != items[0] {
+		test.Error("The player picked up", last)
+	}
+	if _, err := (ActionPickUp{SubjectID: w.Player_id}).Execute(w); err == nil {
+		test.Error("The player picked up nothing.")
+	}
+}
+
+func TestDrop(test *testing.T) {
+	w, items := pileWorld(
+		world.MakeItem(1, "sword", world.EQUIP_HAND),
+		world.MakeItem(2, "rock", world.EQUIP_NONE),
+	)
+	pickUp := ActionPickUp{SubjectID: w.Player_id}
+	w = executeAll(test, w, pickUp, pickUp, ActionDrop{SubjectID: w.Player_id})
+	if top, _ := w.Levels[0].ItemLocation.Top(world.Location{}); top != items[0] {
+		test.Error("The player did not drop what they picked up last:", top)
+	}
+	w = executeAll(test, w, ActionDrop{SubjectID: w.Player_id, ItemID: items[1]})
+	if top, _ := w.Levels[0].ItemLocation.Top(world.Location{}); top != items[1] {
+		test.Error("The player did not drop the rock:", top)
+	}
+	if _, err := (ActionDrop{SubjectID: w.Player_id}).Execute(w); err == nil {
+		test.Error("The player dropped nothing.")
+	}
+}
+
+func TestEquip(test *testing.T) {
+	w, items := pileWorld(
+		world.MakeItem(1, "sword", world.EQUIP_HAND),
+		world.MakeItem(1, "axe", world.EQUIP_HAND),
+		world.MakeItem(2, "rock", world.EQUIP_NONE),
+	)
+	sword, axe, rock := items[0], items[1], items[2]
+	player := playerCreature(w)
+	pickUp := ActionPickUp{SubjectID: w.Player_id}
+	w = executeAll(test, w, pickUp, pickUp, pickUp, ActionEquip{SubjectID: w.Player_id})
+	if itemPlace(w, sword) != world.EquippedBy(player, world.EQUIP_HAND) {
+		test.Error("The sword is", itemPlace(w, sword))
+	}
+	// The axe takes the place of the sword, which goes back to the backpack.
+	w = executeAll(test, w, ActionEquip{SubjectID: w.Player_id, ItemID: axe})
+	if itemPlace(w, axe) != world.EquippedBy(player, world.EQUIP_HAND) || itemPlace(w, sword) != world.InBackpack(player) {
+		test.Error("The axe is", itemPlace(w, axe), "and the sword", itemPlace(w, sword))
+	}
+	delta, err := ActionEquip{SubjectID: w.Player_id, ItemID: axe}.Delta(w)
+	if deltas, ok := delta.(world.Deltas); err != nil || !ok || len(deltas) != 0 {
+		test.Error("Equipping the axe again does", delta, err)
+	}
+	if _, err := (ActionEquip{SubjectID: w.Player_id, ItemID: rock}).Execute(w); err != world.INV_CANNOT_EQUIP {
+		test.Error("Equipping a rock gives", err)
+	}
+	// Equipped items can be dropped too.
+	w = executeAll(test, w, ActionDrop{SubjectID: w.Player_id, ItemID: axe})
+	if itemPlace(w, axe) != world.OnGround(world.Location{}) {
+		test.Error("The axe is", itemPlace(w, axe))
+	}
+}
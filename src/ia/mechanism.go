@@ -0,0 +1,199 @@
+package ia
+
+import (
+	"fmt"
+	"world"
+)
+
+// Mechanisms are actors without a creature.  They cannot walk, turn or pick
+// things up; they have actions of their own.  Their actions never fail for
+// lack of a target: a launcher with nobody to shoot at shoots anyway, and has
+// no Result to tell.
+
+// subjectMechanism finds the mechanism of the subject of an action.
+func subjectMechanism(w world.World, subjectID world.ActorID) (
+	world.LevelId, world.Level, world.Mechanism, error,
+) {
+	levelID, level, err := subjectLevel(w, subjectID)
+	if err != nil {
+		return 0, level, world.Mechanism{}, err
+	}
+	mechanism, ok := level.Mechanisms.Get(subjectID)
+	if !ok {
+		return 0, level, world.Mechanism{}, fmt.Errorf(
+			"actor %v is not a mechanism",
+			subjectID,
+		)
+	}
+	return levelID, level, mechanism, nil
+}
+
+// mechanismAction returns what a mechanism does when its turn comes.
+func mechanismAction(mechanism world.Mechanism, subjectID world.ActorID) Action {
+	if !mechanism.Active {
+		return ActionWait{}
+	}
+	switch mechanism.Kind {
+	case world.MECHANISM_ARROW_LAUNCHER:
+		return ActionShootArrow{SubjectID: subjectID}
+	case world.MECHANISM_CRUSHER:
+		return ActionCrush{SubjectID: subjectID}
+	case world.MECHANISM_TIMED_GATE:
+		return ActionToggleGate{SubjectID: subjectID}
+	}
+	return ActionWait{}
+}
+
+// A TrapResult tells what a trap did to whoever was in the way.
+type TrapResult struct {
+	SubjectID world.ActorID
+	Kind      world.MechanismKind
+	Melee     world.MeleeResult
+}
+
+func (result TrapResult) String() string {
+	melee := result.Melee
+	if !melee.Hit {
+		return fmt.Sprintf(
+			"%v %v misses creature %v (%v against %v)",
+			result.Kind, result.SubjectID, melee.Defender, melee.Roll, melee.Target,
+		)
+	}
+	text := fmt.Sprintf(
+		"%v %v hits creature %v for %v %v damage",
+		result.Kind, result.SubjectID, melee.Defender, melee.Damage, melee.Type,
+	)
+	if melee.Killed {
+		text += ", killing it"
+	}
+	return text
+}
+
+// strike rolls an attack that comes from no creature against the creature at
+// the target location.  It returns false when there is nobody there.
+func strike(
+	w world.World,
+	levelID world.LevelId,
+	level world.Level,
+	weapon world.Weapon,
+	target world.Location,
+) (world.Delta, world.MeleeResult, bool) {
+	defenderID, ok := level.CreatureLocation.GetCreature(target)
+	if !ok {
+		return nil, world.MeleeResult{}, false
+	}
+	defender, _ := level.Creatures.Get(defenderID)
+	rng, melee := world.ResolveTrap(w.Rng(world.STREAM_COMBAT), weapon, defender)
+	melee.Defender = defenderID
+	var delta world.Delta
+	delta, melee.Killed = world.Hurt(levelID, defenderID, defender, melee.Damage)
+	return world.Combine(world.DeltaRng{Stream: world.STREAM_COMBAT, Before: w.Rng(world.STREAM_COMBAT), After: rng}, delta), melee, true
+}
+
+// trapAttack rolls the attack of a trap against the creature at the target
+// location.  There may be nobody there.
+func trapAttack(
+	w world.World,
+	subjectID world.ActorID,
+	levelID world.LevelId,
+	level world.Level,
+	mechanism world.Mechanism,
+	target world.Location,
+) (world.Delta, Result, error) {
+	delta, melee, ok := strike(w, levelID, level, mechanism.Weapon, target)
+	if !ok {
+		return world.Deltas{}, nil, nil
+	}
+	return delta, TrapResult{SubjectID: subjectID, Kind: mechanism.Kind, Melee: melee}, nil
+}
+
+// ShootArrow: That action makes an arrow launcher shoot in the direction it
+// faces.  A creature on the tile of the launcher is hit right away.  Otherwise,
+// the arrow flies from there, see ActionFly.
+type ActionShootArrow struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionShootArrow) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionShootArrow) Delta(w world.World) (world.Delta, error) {
+	delta, _, err := action.Resolve(w)
+	return delta, err
+}
+
+func (action ActionShootArrow) Resolve(w world.World) (world.Delta, Result, error) {
+	levelID, level, mechanism, err := subjectMechanism(w, action.SubjectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	location := mechanism.Anchor.Location
+	if _, ok := level.CreatureLocation.GetCreature(location); ok {
+		return trapAttack(w, action.SubjectID, levelID, level, mechanism, location)
+	}
+	arrow := world.MakeProjectile(
+		location,
+		mechanism.Anchor.Facing,
+		arrowPeriod,
+		mechanism.Range-1,
+		mechanism.Weapon,
+	)
+	return launch(w, levelID, level, arrow, world.NO_ITEM, world.ItemPlace{}), nil, nil
+}
+
+// Crush: That action makes a crusher hit whoever stands on its tile.
+type ActionCrush struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionCrush) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionCrush) Delta(w world.World) (world.Delta, error) {
+	delta, _, err := action.Resolve(w)
+	return delta, err
+}
+
+func (action ActionCrush) Resolve(w world.World) (world.Delta, Result, error) {
+	levelID, level, mechanism, err := subjectMechanism(w, action.SubjectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	location := mechanism.Anchor.Location
+	return trapAttack(w, action.SubjectID, levelID, level, mechanism, location)
+}
+
+// ToggleGate: That action makes a timed gate open its door if closed, and
+// close it if open.  Locked or broken doors do not move, and neither do doors
+// blocked by a creature.
+type ActionToggleGate struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionToggleGate) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionToggleGate) Delta(w world.World) (world.Delta, error) {
+	levelID, level, mechanism, err := subjectMechanism(w, action.SubjectID)
+	if err != nil {
+		return nil, err
+	}
+	slot := mechanism.Anchor.DoorSlot()
+	door, ok := level.GetDoor(slot)
+	if !ok {
+		return world.Deltas{}, nil
+	}
+	change := world.Door.Close
+	if door.State() == world.DOOR_CLOSED {
+		change = world.Door.Open
+	}
+	delta, err := slotDoorDelta(levelID, level, slot, change)
+	if err != nil {
+		// The gate is stuck, it will try again next time.
+		return world.Deltas{}, nil
+	}
+	return delta, nil
+}
@@ -0,0 +1,148 @@
+package ia
+
+import (
+	"fmt"
+	"world"
+)
+
+// Projectiles are actors too.  They have a single action: fly one tile
+// further, and hit whoever is there.  A projectile is launched from the middle
+// of a tile, and hits the creatures of the tiles it enters, so it never hurts
+// the one who launched it.
+
+// How long projectiles take to cross a tile, in nanoseconds.
+const (
+	arrowPeriod = 50000000
+	throwPeriod = 80000000
+)
+
+// subjectProjectile finds the projectile of the subject of an action.
+func subjectProjectile(w world.World, subjectID world.ActorID) (
+	world.LevelId, world.Level, world.Projectile, error,
+) {
+	levelID, level, err := subjectLevel(w, subjectID)
+	if err != nil {
+		return 0, level, world.Projectile{}, err
+	}
+	projectile, ok := level.Projectiles.Get(subjectID)
+	if !ok {
+		return 0, level, world.Projectile{}, fmt.Errorf(
+			"actor %v is not a projectile",
+			subjectID,
+		)
+	}
+	return levelID, level, projectile, nil
+}
+
+// launch computes the Delta of a projectile leaving the middle of its tile.
+// Its first turn comes after half a period, when it reaches the edge of the
+// tile.  The item, if any, goes from its place to the projectile.
+func launch(
+	w world.World,
+	levelID world.LevelId,
+	level world.Level,
+	projectile world.Projectile,
+	itemID world.ItemId,
+	from world.ItemPlace,
+) world.Delta {
+	actorID := level.Actors.NextIDprivate
+	deltas := []world.Delta{world.DeltaProjectileLaunched{
+		Level:      levelID,
+		Actor:      actorID,
+		Projectile: projectile,
+		Time:       w.Time + projectile.Period/2,
+	}}
+	if itemID != world.NO_ITEM {
+		deltas = append(deltas, world.DeltaItemMoved{
+			Level: levelID,
+			Item:  itemID,
+			From:  from,
+			To:    world.InFlight(actorID),
+		})
+	}
+	return world.Combine(deltas...)
+}
+
+// land computes the Delta of a projectile stopping where it is.  The item it
+// carries falls on the ground.
+func land(levelID world.LevelId, actorID world.ActorID, projectile world.Projectile) world.Delta {
+	var drop world.Delta
+	if projectile.Item != world.NO_ITEM {
+		drop = world.DeltaItemMoved{
+			Level: levelID,
+			Item:  projectile.Item,
+			From:  world.InFlight(actorID),
+			To:    world.OnGround(projectile.Location),
+		}
+		projectile.Item = world.NO_ITEM
+	}
+	return world.Combine(drop, world.DeltaProjectileGone{
+		Level:      levelID,
+		Actor:      actorID,
+		Projectile: projectile,
+	})
+}
+
+// A ProjectileResult tells what a projectile did to the creature it hit.
+type ProjectileResult struct {
+	SubjectID world.ActorID
+	Melee     world.MeleeResult
+}
+
+func (result ProjectileResult) String() string {
+	melee := result.Melee
+	if !melee.Hit {
+		return fmt.Sprintf(
+			"projectile %v misses creature %v (%v against %v)",
+			result.SubjectID, melee.Defender, melee.Roll, melee.Target,
+		)
+	}
+	text := fmt.Sprintf(
+		"projectile %v hits creature %v for %v %v damage",
+		result.SubjectID, melee.Defender, melee.Damage, melee.Type,
+	)
+	if melee.Killed {
+		text += ", killing it"
+	}
+	return text
+}
+
+// Fly: That action moves a projectile to the next tile.  It stops when it
+// runs out of range or meets an obstacle, and when it hits a creature.
+type ActionFly struct {
+	SubjectID world.ActorID
+}
+
+func (action ActionFly) Execute(w world.World) (world.World, error) {
+	return execute(action, w)
+}
+
+func (action ActionFly) Delta(w world.World) (world.Delta, error) {
+	delta, _, err := action.Resolve(w)
+	return delta, err
+}
+
+func (action ActionFly) Resolve(w world.World) (world.Delta, Result, error) {
+	levelID, level, projectile, err := subjectProjectile(w, action.SubjectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if projectile.Range <= 0 || !level.IsPassable(projectile.Location, projectile.Direction) {
+		return land(levelID, action.SubjectID, projectile), nil, nil
+	}
+	moved := projectile
+	moved.Location = projectile.Location.MoveAbsolute(projectile.Direction, 1)
+	moved.Range--
+	move := world.DeltaProjectileMoved{
+		Level:  levelID,
+		Actor:  action.SubjectID,
+		Before: projectile,
+		After:  moved,
+	}
+	hit, melee, ok := strike(w, levelID, level, moved.Weapon, moved.Location)
+	if !ok {
+		return move, nil, nil
+	}
+	result := ProjectileResult{SubjectID: action.SubjectID, Melee: melee}
+	return world.Combine(move, hit, land(levelID, action.SubjectID, moved)), result, nil
+}
@@ -0,0 +1,19 @@
+// levelmap project doc.go
+
+/*
+levelmap draws a level, seen from above, as a PNG image.  It needs no
+graphics card, which makes it handy for design reviews and bug reports.
+
+	levelmap [options] file
+
+The file is either a save, recognized by its extension, or a level text file
+as exported by the game.  For saves, -level chooses the level, the one of the
+player by default.
+
+North is up.  Floors, ceilings, columns, walls and doors, and creatures are
+drawn in that order; each layer can be left out, for example with
+-ceilings=false.  Creatures are arrows pointing where they face: green for the
+player, red for monsters.  -scale sets the size of tiles in pixels, and
+-region x0,y0,x1,y1 crops the map to the given tiles.
+*/
+package main
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"world"
+)
+
+// The layers of a level that can be drawn, in drawing order.
+type layers struct {
+	Floors    bool
+	Ceilings  bool
+	Columns   bool
+	Walls     bool // Doors included.
+	Creatures bool
+}
+
+// A region of a level, bounds included.
+type region struct {
+	Min, Max world.Location
+}
+
+// levelRegion returns the smallest region holding everything in the level.
+// Empty levels get a single tile.
+func levelRegion(level world.Level) region {
+	var r region
+	first := true
+	add := func(location world.Location) {
+		if first || location.X < r.Min.X {
+			r.Min.X = location.X
+		}
+		if first || location.Y < r.Min.Y {
+			r.Min.Y = location.Y
+		}
+		if first || location.X > r.Max.X {
+			r.Max.X = location.X
+		}
+		if first || location.Y > r.Max.Y {
+			r.Max.Y = location.Y
+		}
+		first = false
+	}
+	buildings := []world.Buildings{level.Floors, level.Ceilings, level.Columns, level.Doors}
+	buildings = append(buildings, level.Walls[:]...)
+	for _, layer := range buildings {
+		layer.ForEach(func(location world.Location, _ world.Building) {
+			add(location)
+		})
+	}
+	level.CreatureLocation.ForEach(func(_ world.CreatureId, location world.Location) {
+		add(location)
+	})
+	return r
+}
+
+var (
+	colorRock        = color.RGBA{32, 32, 32, 255}
+	colorFloor       = color.RGBA{160, 150, 130, 255}
+	colorSolidFloor  = color.RGBA{110, 100, 90, 255} // Floors nobody can walk on.
+	colorPassage     = color.RGBA{90, 140, 200, 255} // Stairs and ladders.
+	colorPit         = color.RGBA{0, 0, 0, 255}
+	colorCeiling     = color.RGBA{20, 30, 60, 80} // Drawn over the floors.
+	colorColumn      = color.RGBA{90, 90, 90, 255}
+	colorWall        = color.RGBA{230, 230, 230, 255}
+	colorFakeWall    = color.RGBA{230, 230, 120, 255}
+	colorDoor        = color.RGBA{160, 90, 40, 255}
+	colorLockedDoor  = color.RGBA{200, 40, 40, 255}
+	colorOpenDoor    = color.RGBA{210, 180, 130, 255}
+	colorPlayer      = color.RGBA{60, 200, 60, 255}
+	colorMonster     = color.RGBA{220, 50, 50, 255}
+	colorNeutral     = color.RGBA{220, 220, 60, 255}
+	colorUnknownTile = color.RGBA{255, 0, 255, 255} // Buildings this tool does not know.
+)
+
+// picture draws the tiles of a region of a level on an image, `scale` pixels
+// per tile.  North is up.
+type picture struct {
+	img    *image.RGBA
+	region region
+	scale  int
+}
+
+func makePicture(r region, scale int) picture {
+	width := int(r.Max.X-r.Min.X+1) * scale
+	height := int(r.Max.Y-r.Min.Y+1) * scale
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(colorRock), image.ZP, draw.Src)
+	return picture{img, r, scale}
+}
+
+// tile returns the pixels of the tile at the given location.
+func (p picture) tile(location world.Location) image.Rectangle {
+	x := int(location.X-p.region.Min.X) * p.scale
+	y := int(p.region.Max.Y-location.Y) * p.scale
+	return image.Rect(x, y, x+p.scale, y+p.scale)
+}
+
+func (p picture) fill(r image.Rectangle, c color.Color) {
+	draw.Draw(p.img, r.Intersect(p.img.Bounds()), image.NewUniform(c), image.ZP, draw.Over)
+}
+
+// edge returns the pixels of the side of the tile in the given direction.
+func (p picture) edge(location world.Location, direction world.AbsoluteDirection) image.Rectangle {
+	r := p.tile(location)
+	thickness := p.scale / 8
+	if thickness < 1 {
+		thickness = 1
+	}
+	switch direction.Value() {
+	case world.EAST().Value():
+		r.Min.X = r.Max.X - thickness
+	case world.NORTH().Value():
+		r.Max.Y = r.Min.Y + thickness
+	case world.WEST().Value():
+		r.Max.X = r.Min.X + thickness
+	case world.SOUTH().Value():
+		r.Min.Y = r.Max.Y - thickness
+	}
+	return r
+}
+
+// inset returns the pixels of the tile without a margin of `margin` tiles.
+func (p picture) inset(location world.Location, margin float64) image.Rectangle {
+	r := p.tile(location)
+	m := int(margin * float64(p.scale))
+	return image.Rect(r.Min.X+m, r.Min.Y+m, r.Max.X-m, r.Max.Y-m)
+}
+
+// arrow draws a triangle in the tile pointing in the given direction.
+func (p picture) arrow(location world.Location, direction world.AbsoluteDirection, c color.Color) {
+	r := p.tile(location)
+	s := float64(p.scale)
+	cx, cy := float64(r.Min.X)+s/2, float64(r.Min.Y)+s/2
+	dx, dy := direction.DxDy()
+	// Images grow downward, levels grow northward.
+	fx, fy := float64(dx), -float64(dy)
+	lx, ly := fy, -fx // To the left of the direction, on the image.
+	tip := [2]float64{cx + .4*s*fx, cy + .4*s*fy}
+	left := [2]float64{cx - .3*s*fx + .3*s*lx, cy - .3*s*fy + .3*s*ly}
+	right := [2]float64{cx - .3*s*fx - .3*s*lx, cy - .3*s*fy - .3*s*ly}
+	side := func(a, b [2]float64, x, y float64) float64 {
+		return (b[0]-a[0])*(y-a[1]) - (b[1]-a[1])*(x-a[0])
+	}
+	r = r.Intersect(p.img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			px, py := float64(x)+.5, float64(y)+.5
+			s0 := side(tip, left, px, py)
+			s1 := side(left, right, px, py)
+			s2 := side(right, tip, px, py)
+			if (s0 >= 0 && s1 >= 0 && s2 >= 0) || (s0 <= 0 && s1 <= 0 && s2 <= 0) {
+				p.img.Set(x, y, c)
+			}
+		}
+	}
+}
+
+func floorColor(building world.Building) color.Color {
+	switch floor := building.(type) {
+	case world.Stairs, world.Ladder:
+		return colorPassage
+	case world.Pit:
+		if floor.Open {
+			return colorPit
+		}
+		if !floor.IsPassable() {
+			return colorSolidFloor
+		}
+		return colorFloor
+	case world.Floor:
+		if !floor.IsPassable() {
+			return colorSolidFloor
+		}
+		return colorFloor
+	}
+	return colorUnknownTile
+}
+
+func wallColor(building world.Building) color.Color {
+	switch wall := building.(type) {
+	case world.Door:
+		return doorColor(wall)
+	case world.Wall:
+		if wall.IsPassable() {
+			return colorFakeWall
+		}
+		return colorWall
+	}
+	return colorUnknownTile
+}
+
+func doorColor(door world.Door) color.Color {
+	switch door.State() {
+	case world.DOOR_LOCKED:
+		return colorLockedDoor
+	case world.DOOR_OPEN, world.DOOR_BROKEN:
+		return colorOpenDoor
+	}
+	return colorDoor
+}
+
+func creatureColor(creature world.Creature) color.Color {
+	switch creature.Faction {
+	case world.FACTION_PLAYER:
+		return colorPlayer
+	case world.FACTION_MONSTERS:
+		return colorMonster
+	}
+	return colorNeutral
+}
+
+// drawLevel draws the given layers of a region of the level.
+func drawLevel(level world.Level, r region, scale int, show layers) *image.RGBA {
+	p := makePicture(r, scale)
+	if show.Floors {
+		level.Floors.ForEach(func(location world.Location, building world.Building) {
+			p.fill(p.tile(location), floorColor(building))
+		})
+	}
+	if show.Ceilings {
+		level.Ceilings.ForEach(func(location world.Location, _ world.Building) {
+			p.fill(p.tile(location), colorCeiling)
+		})
+	}
+	if show.Columns {
+		level.Columns.ForEach(func(location world.Location, _ world.Building) {
+			p.fill(p.inset(location, .25), colorColumn)
+		})
+	}
+	if show.Walls {
+		for _, facing := range [...]world.AbsoluteDirection{world.EAST(), world.NORTH(), world.WEST(), world.SOUTH()} {
+			// Walls face into their tile, they stand on its opposite side.
+			side := facing.Add(world.BACK())
+			level.Walls[facing.Value()].ForEach(func(location world.Location, building world.Building) {
+				p.fill(p.edge(location, side), wallColor(building))
+			})
+		}
+		level.Doors.ForEach(func(location world.Location, building world.Building) {
+			door, ok := building.(world.Door)
+			if !ok {
+				p.fill(p.inset(location, .4), colorUnknownTile)
+				return
+			}
+			// The panel stands across the axis.
+			r := p.inset(location, .1)
+			thickness := p.scale / 8
+			if thickness < 1 {
+				thickness = 1
+			}
+			center := r.Min.Add(r.Max).Div(2)
+			if door.Axis().Value()%2 == 0 {
+				r.Min.X, r.Max.X = center.X-thickness/2, center.X-thickness/2+thickness
+			} else {
+				r.Min.Y, r.Max.Y = center.Y-thickness/2, center.Y-thickness/2+thickness
+			}
+			p.fill(r, doorColor(door))
+		})
+	}
+	if show.Creatures {
+		level.CreatureLocation.ForEach(func(creatureID world.CreatureId, location world.Location) {
+			creature, ok := level.Creatures.Get(creatureID)
+			if !ok {
+				return
+			}
+			p.arrow(location, creature.F, creatureColor(creature))
+		})
+	}
+	return p.img
+}
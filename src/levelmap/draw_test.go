@@ -0,0 +1,94 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+	"world"
+)
+
+// testLevel is a room of 3 by 2 tiles with a wall, a locked door, an open pit
+// and a monster.
+//
+//	N  monster  pit    door
+//	   floor|   floor  floor
+func testLevel() world.Level {
+	level := world.MakeLevel(0)
+	for x := world.Coord(0); x < 3; x++ {
+		for y := world.Coord(0); y < 2; y++ {
+			level.Floors = level.Floors.Set(x, y, world.MakeFloor(1, world.EAST(), true))
+		}
+	}
+	level.Floors = level.Floors.Set(1, 1, world.MakePit(3, world.EAST(), true, world.LevelLocation{}))
+	level.Walls[world.WEST().Value()] = level.Walls[world.WEST().Value()].Set(0, 0, world.MakeWall(5, false))
+	level = level.SetDoor(world.DoorSlot{Location: world.Location{X: 2, Y: 1}}, world.MakeDoor(6, world.DOOR_LOCKED, world.NORTH()))
+	monster := world.MakeCreature()
+	monster.Faction = world.FACTION_MONSTERS
+	creatures, monsterID := level.Creatures.Add(monster)
+	level.Creatures = creatures
+	level.CreatureLocation, _ = level.CreatureLocation.Add(monsterID, world.Location{X: 0, Y: 1})
+	return level
+}
+
+var allLayers = layers{Floors: true, Ceilings: true, Columns: true, Walls: true, Creatures: true}
+
+func TestLevelRegion(test *testing.T) {
+	if r := levelRegion(testLevel()); r != (region{Max: world.Location{X: 2, Y: 1}}) {
+		test.Error("The level spans", r)
+	}
+	if r := levelRegion(world.MakeLevel(0)); r != (region{}) {
+		test.Error("An empty level spans", r)
+	}
+}
+
+// With 10 pixels per tile, the tile (x, y) covers the pixels from 10x to
+// 10x+9 from the left, and from 10(1-y) to 10(1-y)+9 from the top.
+func TestDrawLevel(test *testing.T) {
+	level := testLevel()
+	img := drawLevel(level, levelRegion(level), 10, allLayers)
+	if size := img.Bounds().Size(); size.X != 30 || size.Y != 20 {
+		test.Fatal("The map is", size)
+	}
+	for _, pixel := range []struct {
+		x, y  int
+		color color.RGBA
+		what  string
+	}{
+		{25, 15, colorFloor, "the floor"},
+		{8, 15, colorFloor, "the floor before the wall"},
+		{9, 15, colorWall, "the wall"},
+		{15, 5, colorPit, "the pit"},
+		{25, 5, colorLockedDoor, "the door"},
+		{25, 2, colorFloor, "the floor beside the door"},
+		{5, 5, colorMonster, "the monster"},
+		{0, 0, colorFloor, "the corner of the monster tile"},
+	} {
+		if actual := img.At(pixel.x, pixel.y); actual != pixel.color {
+			test.Errorf("(%v, %v) should be %v, it is %v.", pixel.x, pixel.y, pixel.what, actual)
+		}
+	}
+}
+
+func TestDrawLevelLayers(test *testing.T) {
+	level := testLevel()
+	img := drawLevel(level, levelRegion(level), 10, layers{Walls: true})
+	if img.At(25, 15) != colorRock || img.At(9, 15) != colorWall || img.At(5, 5) != colorRock {
+		test.Error("Left out layers are drawn.")
+	}
+	// Regions crop the map.
+	img = drawLevel(level, region{world.Location{X: 1, Y: 1}, world.Location{X: 1, Y: 1}}, 4, allLayers)
+	if size := img.Bounds().Size(); size.X != 4 || size.Y != 4 || img.At(2, 2) != colorPit {
+		test.Error("The cropped map is", size, "with", img.At(2, 2))
+	}
+}
+
+func TestParseRegion(test *testing.T) {
+	r, err := parseRegion("3, -1,0,2")
+	if err != nil || r != (region{world.Location{X: 0, Y: -1}, world.Location{X: 3, Y: 2}}) {
+		test.Error("Parsed", r, err)
+	}
+	for _, text := range []string{"", "1,2,3", "1,2,3,x"} {
+		if _, err := parseRegion(text); err == nil {
+			test.Errorf("Parsed %q.", text)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"world"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %v [options] file\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Draws a level of a save (%v) or a level text file as a PNG map.\n\n", world.SAVE_EXTENSION)
+	flag.PrintDefaults()
+}
+
+// parseRegion reads a region written "x0,y0,x1,y1", in any order of corners.
+func parseRegion(text string) (region, error) {
+	fields := strings.Split(text, ",")
+	if len(fields) != 4 {
+		return region{}, fmt.Errorf("region %q is not x0,y0,x1,y1", text)
+	}
+	var coords [4]world.Coord
+	for i, field := range fields {
+		value, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return region{}, fmt.Errorf("region %q: %v", text, err)
+		}
+		coords[i] = world.Coord(value)
+	}
+	r := region{
+		Min: world.Location{X: coords[0], Y: coords[1]},
+		Max: world.Location{X: coords[2], Y: coords[3]},
+	}
+	if r.Min.X > r.Max.X {
+		r.Min.X, r.Max.X = r.Max.X, r.Min.X
+	}
+	if r.Min.Y > r.Max.Y {
+		r.Min.Y, r.Max.Y = r.Max.Y, r.Min.Y
+	}
+	return r, nil
+}
+
+// loadLevel reads the level to draw.  Saves are recognized by their
+// extension, anything else is read as a level text file.  Inconsistent saves
+// are drawn anyway, they are what bug reports are made of.
+func loadLevel(path string, levelID int) (world.Level, error) {
+	if filepath.Ext(path) != world.SAVE_EXTENSION {
+		f, err := os.Open(path)
+		if err != nil {
+			return world.Level{}, err
+		}
+		defer f.Close()
+		return world.DecodeLevel(f, world.LevelId(0))
+	}
+	w, _, err := world.LoadFile(path)
+	if saveErr, ok := err.(world.SaveError); ok && saveErr.Kind == world.SAVE_INVALID {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", path, err)
+	} else if err != nil {
+		return world.Level{}, err
+	}
+	if levelID < 0 {
+		playerLevel, ok := w.PlayerLevel()
+		if !ok {
+			return world.Level{}, fmt.Errorf("the player is in no level, choose one")
+		}
+		levelID = int(playerLevel)
+	}
+	level, ok := w.Levels[world.LevelId(levelID)]
+	if !ok {
+		return world.Level{}, fmt.Errorf("no level %v", levelID)
+	}
+	return level, nil
+}
+
+func main() {
+	var show layers
+	output := flag.String("o", "level.png", "the PNG file to write")
+	scale := flag.Int("scale", 16, "pixels per tile")
+	regionText := flag.String("region", "", "the tiles to draw, as x0,y0,x1,y1; the whole level by default")
+	levelID := flag.Int("level", -1, "the level of the save to draw; that of the player by default")
+	flag.BoolVar(&show.Floors, "floors", true, "draw the floors")
+	flag.BoolVar(&show.Ceilings, "ceilings", true, "draw the ceilings")
+	flag.BoolVar(&show.Columns, "columns", true, "draw the columns")
+	flag.BoolVar(&show.Walls, "walls", true, "draw the walls and doors")
+	flag.BoolVar(&show.Creatures, "creatures", true, "draw the creatures")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 || *scale < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	level, err := loadLevel(flag.Arg(0), *levelID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	r := levelRegion(level)
+	if *regionText != "" {
+		if r, err = parseRegion(*regionText); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	img := drawLevel(level, r, *scale, show)
+
+	f, err := os.Create(*output)
+	if err == nil {
+		err = png.Encode(f, img)
+		if errClose := f.Close(); err == nil {
+			err = errClose
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,114 @@
+package pathfind
+
+import (
+	"container/heap"
+	"world"
+)
+
+// A node is a location waiting in the open set of a search.
+type node struct {
+	location world.Location
+	cost     int // Cost from the start.
+	priority int // Cost plus estimate to the goal, for A*.  Lower first.
+	order    int // Insertion order, to break ties the same way every time.
+}
+
+// nodeHeap is the open set of a search, a heap of nodes.
+type nodeHeap []node
+
+func (self nodeHeap) Len() int {
+	return len(self)
+}
+func (self nodeHeap) Less(i, j int) bool {
+	if self[i].priority != self[j].priority {
+		return self[i].priority < self[j].priority
+	}
+	return self[i].order < self[j].order
+}
+func (self nodeHeap) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+}
+func (self *nodeHeap) Push(x interface{}) {
+	*self = append(*self, x.(node))
+}
+func (self *nodeHeap) Pop() interface{} {
+	old := *self
+	last := old[len(old)-1]
+	*self = old[:len(old)-1]
+	return last
+}
+
+// manhattan is the heuristic of A*: no path on the grid is shorter than that,
+// as long as steps cost at least 1.
+func manhattan(a, b world.Location) int {
+	dx, dy := int(a.X-b.X), int(a.Y-b.Y)
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	return dx + dy
+}
+
+// FindPath returns the cheapest steps from one location to another, and true.
+// It returns false when there is no path, or when the budget runs out before
+// one is found.  Going from a location to itself takes no step.
+func FindPath(level world.Level, from, to world.Location, options Options) ([]world.AbsoluteDirection, bool) {
+	cost := options.cost()
+	budget := options.budget()
+	// How each reached location was reached: the direction of the last step.
+	came := map[world.Location]world.AbsoluteDirection{}
+	best := map[world.Location]int{from: 0}
+	open := &nodeHeap{{location: from, priority: manhattan(from, to)}}
+	order := 0
+	for open.Len() > 0 {
+		current := heap.Pop(open).(node)
+		if current.cost > best[current.location] {
+			continue // Outdated, a cheaper way was found since.
+		}
+		if current.location == to {
+			return unwind(came, from, to), true
+		}
+		if budget == 0 {
+			return nil, false
+		}
+		budget--
+		for _, direction := range directions {
+			step, ok := cost(level, current.location, direction)
+			if !ok {
+				continue
+			}
+			next := current.location.MoveAbsolute(direction, 1)
+			next_cost := current.cost + step
+			if known, ok := best[next]; ok && known <= next_cost {
+				continue
+			}
+			best[next] = next_cost
+			came[next] = direction
+			order++
+			heap.Push(open, node{
+				location: next,
+				cost:     next_cost,
+				priority: next_cost + manhattan(next, to),
+				order:    order,
+			})
+		}
+	}
+	return nil, false
+}
+
+// unwind follows the steps back from the goal to the start, and returns them
+// in the right order.
+func unwind(came map[world.Location]world.AbsoluteDirection, from, to world.Location) []world.AbsoluteDirection {
+	var steps []world.AbsoluteDirection
+	for location := to; location != from; {
+		direction := came[location]
+		steps = append(steps, direction)
+		location = location.MoveAbsolute(direction.Add(world.BACK()), 1)
+	}
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return steps
+}
@@ -0,0 +1,115 @@
+package pathfind
+
+import (
+	"world"
+)
+
+// A Cost tells what it costs to step from a location to its neighbor in the
+// given direction.  It returns false when the step is not allowed.  Costs must
+// be at least 1, otherwise the searches may not find the cheapest paths.
+type Cost func(level world.Level, from world.Location, direction world.AbsoluteDirection) (int, bool)
+
+// Walk allows the steps that Level.IsPassable allows, for a cost of 1.
+func Walk(level world.Level, from world.Location, direction world.AbsoluteDirection) (int, bool) {
+	if level.IsPassable(from, direction) {
+		return 1, true
+	}
+	return 0, false
+}
+
+// ThroughDoors is like Walk, but also allows going through closed doors, which
+// can be opened on the way.  Each closed door costs doorCost on top of the
+// step.  Locked doors stay in the way.
+func ThroughDoors(doorCost int) Cost {
+	return func(level world.Level, from world.Location, direction world.AbsoluteDirection) (int, bool) {
+		if level.IsPassable(from, direction) {
+			return 1, true
+		}
+		// Open the doors on the way, and see whether that makes it passable.
+		slots := [...]world.DoorSlot{
+			{Location: from, In_wall: true, Facing: direction.Add(world.BACK())},
+			{Location: from.MoveAbsolute(direction, 1)},
+		}
+		cost := 1
+		for _, slot := range slots {
+			door, ok := level.GetDoor(slot)
+			if !ok || door.State() != world.DOOR_CLOSED {
+				continue
+			}
+			door, _ = door.Open()
+			level = level.SetDoor(slot, door)
+			cost += doorCost
+		}
+		if cost > 1 && level.IsPassable(from, direction) {
+			return cost, true
+		}
+		return 0, false
+	}
+}
+
+// AvoidCreatures wraps a cost so that steps into locations occupied by a
+// creature are not allowed, except into the given locations.  Usually the
+// exception is the goal: the creature one wants to reach.
+func AvoidCreatures(cost Cost, except ...world.Location) Cost {
+	return func(level world.Level, from world.Location, direction world.AbsoluteDirection) (int, bool) {
+		to := from.MoveAbsolute(direction, 1)
+		if _, ok := level.CreatureLocation.GetCreature(to); ok {
+			allowed := false
+			for _, location := range except {
+				allowed = allowed || location == to
+			}
+			if !allowed {
+				return 0, false
+			}
+		}
+		return cost(level, from, direction)
+	}
+}
+
+// CrowdPenalty wraps a cost so that steps into locations occupied by a
+// creature cost more, instead of being forbidden.  Creatures move, so going
+// around them is not always the best option.
+func CrowdPenalty(cost Cost, penalty int) Cost {
+	return func(level world.Level, from world.Location, direction world.AbsoluteDirection) (int, bool) {
+		step, ok := cost(level, from, direction)
+		if !ok {
+			return step, ok
+		}
+		if _, occupied := level.CreatureLocation.GetCreature(from.MoveAbsolute(direction, 1)); occupied {
+			step += penalty
+		}
+		return step, true
+	}
+}
+
+// The four directions, in the order in which the searches try them.
+var directions = [...]world.AbsoluteDirection{
+	world.EAST(),
+	world.NORTH(),
+	world.WEST(),
+	world.SOUTH(),
+}
+
+// DEFAULT_BUDGET is the number of locations a search expands when its Options
+// do not say.
+const DEFAULT_BUDGET = 4096
+
+// Options tune the searches.  The zero value walks with a default budget.
+type Options struct {
+	Cost   Cost // Walk when nil.
+	Budget int  // Maximum number of locations expanded, DEFAULT_BUDGET when 0.
+}
+
+func (self Options) cost() Cost {
+	if self.Cost == nil {
+		return Walk
+	}
+	return self.Cost
+}
+
+func (self Options) budget() int {
+	if self.Budget <= 0 {
+		return DEFAULT_BUDGET
+	}
+	return self.Budget
+}
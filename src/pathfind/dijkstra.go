@@ -0,0 +1,106 @@
+package pathfind
+
+import (
+	"container/heap"
+	"world"
+)
+
+// A DistanceMap knows, for every location it reached, the cost of the
+// cheapest path to the closest of its goals.  Build it once, and every
+// creature can follow it down to the goals.
+type DistanceMap struct {
+	level    world.Level
+	cost     Cost
+	distance map[world.Location]int
+}
+
+// MakeDistanceMap runs Dijkstra backward from the goals.  When the budget
+// runs out, the locations that were not reached yet are left out of the map.
+func MakeDistanceMap(level world.Level, goals []world.Location, options Options) DistanceMap {
+	result := DistanceMap{
+		level:    level,
+		cost:     options.cost(),
+		distance: make(map[world.Location]int),
+	}
+	budget := options.budget()
+	open := &nodeHeap{}
+	order := 0
+	for _, goal := range goals {
+		result.distance[goal] = 0
+		order++
+		heap.Push(open, node{location: goal, order: order})
+	}
+	for open.Len() > 0 && budget > 0 {
+		current := heap.Pop(open).(node)
+		if current.cost > result.distance[current.location] {
+			continue // Outdated, a cheaper way was found since.
+		}
+		budget--
+		for _, direction := range directions {
+			// The neighbor steps toward the current location, in the
+			// opposite direction.
+			neighbor := current.location.MoveAbsolute(direction, 1)
+			step, ok := result.cost(level, neighbor, direction.Add(world.BACK()))
+			if !ok {
+				continue
+			}
+			neighbor_cost := current.cost + step
+			if known, ok := result.distance[neighbor]; ok && known <= neighbor_cost {
+				continue
+			}
+			result.distance[neighbor] = neighbor_cost
+			order++
+			heap.Push(open, node{
+				location: neighbor,
+				cost:     neighbor_cost,
+				priority: neighbor_cost,
+				order:    order,
+			})
+		}
+	}
+	return result
+}
+
+// Distance returns the cost of the cheapest path from the location to the
+// closest goal, and false if the location was not reached.
+func (self DistanceMap) Distance(location world.Location) (int, bool) {
+	distance, ok := self.distance[location]
+	return distance, ok
+}
+
+// Step returns the first step of the cheapest path from the location to the
+// closest goal.  It returns false on the goals themselves, and on the
+// locations that were not reached.
+func (self DistanceMap) Step(location world.Location) (world.AbsoluteDirection, bool) {
+	distance, ok := self.distance[location]
+	if !ok || distance == 0 {
+		return nil, false
+	}
+	for _, direction := range directions {
+		step, ok := self.cost(self.level, location, direction)
+		if !ok {
+			continue
+		}
+		next, ok := self.distance[location.MoveAbsolute(direction, 1)]
+		if ok && next+step == distance {
+			return direction, true
+		}
+	}
+	return nil, false
+}
+
+// Path returns all the steps from the location to the closest goal.
+func (self DistanceMap) Path(location world.Location) ([]world.AbsoluteDirection, bool) {
+	if _, ok := self.distance[location]; !ok {
+		return nil, false
+	}
+	var steps []world.AbsoluteDirection
+	for {
+		direction, ok := self.Step(location)
+		if !ok {
+			return steps, true
+		}
+		steps = append(steps, direction)
+		location = location.MoveAbsolute(direction, 1)
+	}
+}
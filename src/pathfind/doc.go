@@ -0,0 +1,14 @@
+// pathfind project doc.go
+
+/*
+pathfind finds paths on the grid of a world.Level.
+
+FindPath runs A* from one location to another.  DistanceMap runs Dijkstra from
+one or more goals, and then tells every location how to reach the closest
+goal, which suits many monsters chasing the same player.
+
+Both return steps as absolute directions, ready to be fed to
+ia.ActionMoveAbsolute.  What a step costs, and which steps are allowed at all,
+is decided by a Cost function.
+*/
+package pathfind
@@ -0,0 +1,244 @@
+package pathfind
+
+import (
+	"testing"
+	"world"
+)
+
+// makeLevel builds a level from a map drawn with characters.  The first row
+// is the northernmost one, and the top-left character is at (0, 0), so y goes
+// down to negative values.  '#' is rock, anything else is a floor.  'M' also
+// places a creature with an actor.  The locations of the other letters are
+// returned.
+func makeLevel(rows ...string) (world.Level, map[rune]world.Location) {
+	level := world.MakeLevel(0)
+	marks := make(map[rune]world.Location)
+	for row, line := range rows {
+		for column, char := range line {
+			location := world.Location{X: world.Coord(column), Y: world.Coord(-row)}
+			if char == '#' {
+				continue
+			}
+			level.Floors = level.Floors.Set(location.X, location.Y, world.MakeFloor(0, world.EAST(), true))
+			switch char {
+			case '.':
+			case 'M':
+				level = addCreature(level, location)
+			default:
+				marks[char] = location
+			}
+		}
+	}
+	return level, marks
+}
+
+func addCreature(level world.Level, location world.Location) world.Level {
+	creatures, creatureID := level.Creatures.Add(world.MakeCreature())
+	actors, actorID := level.Actors.Add(world.MakeActor())
+	level.Creatures = creatures
+	level.Actors = actors
+	level.CreatureActor, _ = level.CreatureActor.Add(creatureID, actorID)
+	level.CreatureLocation, _ = level.CreatureLocation.Add(creatureID, location)
+	return level
+}
+
+// addWall blocks the edge between the location and its neighbor in the given
+// direction.
+func addWall(level world.Level, location world.Location, direction world.AbsoluteDirection) world.Level {
+	index := direction.Add(world.BACK()).Value()
+	level.Walls[index] = level.Walls[index].Set(location.X, location.Y, world.MakeWall(0, false))
+	return level
+}
+
+// walk follows the steps from a location, checking that each one is allowed.
+func walk(test *testing.T, level world.Level, from world.Location, steps []world.AbsoluteDirection) world.Location {
+	for _, direction := range steps {
+		if !level.IsPassable(from, direction) {
+			test.Fatalf("step %v from %v is not passable", direction.Value(), from)
+		}
+		from = from.MoveAbsolute(direction, 1)
+	}
+	return from
+}
+
+func TestFindPathCorridor(test *testing.T) {
+	level, marks := makeLevel(
+		"a...#",
+		"###.#",
+		"###.b",
+	)
+	steps, ok := FindPath(level, marks['a'], marks['b'], Options{})
+	if !ok {
+		test.Fatal("no path found")
+	}
+	if len(steps) != 6 {
+		test.Errorf("path has %v steps, expected 6", len(steps))
+	}
+	if end := walk(test, level, marks['a'], steps); end != marks['b'] {
+		test.Errorf("path ends at %v instead of %v", end, marks['b'])
+	}
+}
+
+func TestFindPathSameLocation(test *testing.T) {
+	level, marks := makeLevel("a")
+	steps, ok := FindPath(level, marks['a'], marks['a'], Options{})
+	if !ok || len(steps) != 0 {
+		test.Errorf("expected an empty path, got %v %v", steps, ok)
+	}
+}
+
+func TestFindPathAroundWall(test *testing.T) {
+	level, marks := makeLevel(
+		"a.b",
+		"...",
+	)
+	level = addWall(level, world.Location{X: 1, Y: 0}, world.EAST())
+	steps, ok := FindPath(level, marks['a'], marks['b'], Options{})
+	if !ok {
+		test.Fatal("no path found")
+	}
+	// Down, two steps east, up.
+	if len(steps) != 4 {
+		test.Errorf("path has %v steps, expected 4", len(steps))
+	}
+	walk(test, level, marks['a'], steps)
+}
+
+func TestFindPathUnreachable(test *testing.T) {
+	level, marks := makeLevel("a#b")
+	if steps, ok := FindPath(level, marks['a'], marks['b'], Options{}); ok {
+		test.Errorf("found a path through rock: %v", steps)
+	}
+}
+
+func TestFindPathBudget(test *testing.T) {
+	level, marks := makeLevel("a.........b")
+	if _, ok := FindPath(level, marks['a'], marks['b'], Options{Budget: 5}); ok {
+		test.Error("found a path beyond the budget")
+	}
+	if _, ok := FindPath(level, marks['a'], marks['b'], Options{Budget: 10}); !ok {
+		test.Error("did not find a path within the budget")
+	}
+}
+
+func TestFindPathThroughDoors(test *testing.T) {
+	level, marks := makeLevel(
+		"a.b",
+		"...",
+	)
+	slot := world.DoorSlot{
+		Location: world.Location{X: 1, Y: 0},
+		In_wall:  true,
+		Facing:   world.WEST(),
+	}
+	level = level.SetDoor(slot, world.MakeDoor(0, world.DOOR_CLOSED, world.WEST()))
+
+	// Walkers go around.
+	steps, ok := FindPath(level, marks['a'], marks['b'], Options{})
+	if !ok || len(steps) != 4 {
+		test.Errorf("walking: got %v steps, expected 4", len(steps))
+	}
+	// A cheap door is worth opening.
+	steps, ok = FindPath(level, marks['a'], marks['b'], Options{Cost: ThroughDoors(1)})
+	if !ok || len(steps) != 2 {
+		test.Errorf("cheap door: got %v steps, expected 2", len(steps))
+	}
+	// An expensive one is not.
+	steps, ok = FindPath(level, marks['a'], marks['b'], Options{Cost: ThroughDoors(5)})
+	if !ok || len(steps) != 4 {
+		test.Errorf("expensive door: got %v steps, expected 4", len(steps))
+	}
+	// Locked doors cannot be opened on the way.
+	door, _ := level.GetDoor(slot)
+	door, _ = door.Lock()
+	level = level.SetDoor(slot, door)
+	steps, ok = FindPath(level, marks['a'], marks['b'], Options{Cost: ThroughDoors(1)})
+	if !ok || len(steps) != 4 {
+		test.Errorf("locked door: got %v steps, expected 4", len(steps))
+	}
+}
+
+func TestFindPathAvoidCreatures(test *testing.T) {
+	level, marks := makeLevel(
+		"aMb",
+		"...",
+	)
+	steps, ok := FindPath(level, marks['a'], marks['b'], Options{})
+	if !ok || len(steps) != 2 {
+		test.Errorf("ignoring creatures: got %v steps, expected 2", len(steps))
+	}
+	cost := AvoidCreatures(Walk)
+	steps, ok = FindPath(level, marks['a'], marks['b'], Options{Cost: cost})
+	if !ok || len(steps) != 4 {
+		test.Errorf("avoiding creatures: got %v steps, expected 4", len(steps))
+	}
+	// Reaching a creature is allowed when it is the goal.
+	monster := world.Location{X: 1, Y: 0}
+	steps, ok = FindPath(level, marks['a'], monster, Options{Cost: AvoidCreatures(Walk, monster)})
+	if !ok || len(steps) != 1 {
+		test.Errorf("reaching a creature: got %v steps, expected 1", len(steps))
+	}
+	steps, ok = FindPath(level, marks['a'], marks['b'], Options{Cost: CrowdPenalty(Walk, 1)})
+	if !ok || len(steps) != 2 {
+		test.Errorf("small crowd penalty: got %v steps, expected 2", len(steps))
+	}
+	steps, ok = FindPath(level, marks['a'], marks['b'], Options{Cost: CrowdPenalty(Walk, 3)})
+	if !ok || len(steps) != 4 {
+		test.Errorf("large crowd penalty: got %v steps, expected 4", len(steps))
+	}
+}
+
+func TestDistanceMap(test *testing.T) {
+	level, marks := makeLevel(
+		"a...#....",
+		".##.#.##.",
+		".#..#..#.",
+		".#.###.##",
+		"...#b..#c",
+	)
+	level = addWall(level, world.Location{X: 2, Y: -2}, world.EAST())
+	goals := []world.Location{marks['a'], marks['b']}
+	distances := MakeDistanceMap(level, goals, Options{})
+	level.Floors.ForEach(func(location world.Location, building world.Building) {
+		// The distance to the closest goal is the shortest of the A* paths.
+		best, reachable := -1, false
+		for _, goal := range goals {
+			if steps, ok := FindPath(level, location, goal, Options{}); ok {
+				if !reachable || len(steps) < best {
+					best = len(steps)
+				}
+				reachable = true
+			}
+		}
+		distance, ok := distances.Distance(location)
+		if ok != reachable || (ok && distance != best) {
+			test.Errorf("%v: distance %v %v, expected %v %v", location, distance, ok, best, reachable)
+			return
+		}
+		if !ok {
+			return
+		}
+		steps, _ := distances.Path(location)
+		if len(steps) != distance {
+			test.Errorf("%v: path of %v steps for a distance of %v", location, len(steps), distance)
+		}
+		end := walk(test, level, location, steps)
+		if end != marks['a'] && end != marks['b'] {
+			test.Errorf("%v: path ends at %v, not at a goal", location, end)
+		}
+	})
+	if _, ok := distances.Distance(marks['c']); ok {
+		test.Error("c should be unreachable")
+	}
+}
+
+func TestDistanceMapBudget(test *testing.T) {
+	level, marks := makeLevel("a.........b")
+	distances := MakeDistanceMap(level, []world.Location{marks['a']}, Options{Budget: 3})
+	if _, ok := distances.Distance(marks['b']); ok {
+		test.Error("b reached beyond the budget")
+	}
+	if distance, ok := distances.Distance(world.Location{X: 2, Y: 0}); !ok || distance != 2 {
+		test.Errorf("distance %v %v, expected 2", distance, ok)
+	}
+}
@@ -0,0 +1,11 @@
+// pmap project doc.go
+
+/*
+pmap implements persistent maps: maps that are never modified in place.
+Setting or deleting a key returns a new map that shares most of its memory
+with the old one.  Both remain valid.
+
+The maps are hash array mapped tries (HAMT).  Updates copy one node per level
+of the trie, that is O(log n) nodes, instead of the whole map.
+*/
+package pmap
@@ -0,0 +1,263 @@
+package pmap
+
+import (
+	"math/bits"
+)
+
+// A Key can be used in a Map.  Keys must be comparable with ==, and two equal
+// keys must have the same hash.
+type Key interface {
+	Hash() uint64
+}
+
+// Each level of the trie consumes bitsPerLevel bits of the hash.
+const (
+	bitsPerLevel = 5
+	levelMask    = 1<<bitsPerLevel - 1
+	maxShift     = 64
+)
+
+// An entry is either a key/value pair, or a sub-node.
+type entry struct {
+	hash  uint64
+	key   Key
+	value interface{}
+	child *node
+}
+
+// A node holds up to 32 entries.  Only the entries in use are stored; bitmap
+// tells which ones they are.  When the whole hash is consumed, the node is a
+// collision node: it has no bitmap and holds all the keys sharing that hash.
+type node struct {
+	bitmap  uint32
+	entries []entry
+}
+
+// Map is a persistent map.  The zero value is an empty map, ready to use.
+// Maps are values: copying one is cheap and never shares mutations, since
+// there are none.
+type Map struct {
+	root *node
+	size int
+}
+
+func index(bitmap uint32, bit uint32) int {
+	return bits.OnesCount32(bitmap & (bit - 1))
+}
+
+func chunk(hash uint64, shift uint) uint32 {
+	return 1 << ((hash >> shift) & levelMask)
+}
+
+// Len returns the number of keys in the map.
+func (m Map) Len() int {
+	return m.size
+}
+
+// Get returns the value associated to key, if any.
+func (m Map) Get(key Key) (interface{}, bool) {
+	if m.root == nil {
+		return nil, false
+	}
+	hash := key.Hash()
+	n := m.root
+	for shift := uint(0); ; shift += bitsPerLevel {
+		if shift >= maxShift {
+			for _, e := range n.entries {
+				if e.key == key {
+					return e.value, true
+				}
+			}
+			return nil, false
+		}
+		bit := chunk(hash, shift)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+		e := n.entries[index(n.bitmap, bit)]
+		if e.child == nil {
+			if e.key == key {
+				return e.value, true
+			}
+			return nil, false
+		}
+		n = e.child
+	}
+}
+
+// Set returns a new map in which key is associated to value.
+func (m Map) Set(key Key, value interface{}) Map {
+	root := m.root
+	if root == nil {
+		root = &node{}
+	}
+	e := entry{hash: key.Hash(), key: key, value: value}
+	root, added := root.set(e, 0)
+	m.root = root
+	if added {
+		m.size++
+	}
+	return m
+}
+
+// set returns a copy of the node in which the entry is set, and whether a new
+// key was added (as opposed to an existing one being replaced).
+func (n *node) set(e entry, shift uint) (*node, bool) {
+	if shift >= maxShift {
+		result := &node{entries: make([]entry, len(n.entries), len(n.entries)+1)}
+		copy(result.entries, n.entries)
+		for i := range result.entries {
+			if result.entries[i].key == e.key {
+				result.entries[i] = e
+				return result, false
+			}
+		}
+		result.entries = append(result.entries, e)
+		return result, true
+	}
+	bit := chunk(e.hash, shift)
+	i := index(n.bitmap, bit)
+	if n.bitmap&bit == 0 {
+		// Free slot, insert there.
+		result := &node{
+			bitmap:  n.bitmap | bit,
+			entries: make([]entry, len(n.entries)+1),
+		}
+		copy(result.entries, n.entries[:i])
+		result.entries[i] = e
+		copy(result.entries[i+1:], n.entries[i:])
+		return result, true
+	}
+	result := &node{
+		bitmap:  n.bitmap,
+		entries: make([]entry, len(n.entries)),
+	}
+	copy(result.entries, n.entries)
+	old := n.entries[i]
+	added := true
+	switch {
+	case old.child != nil:
+		result.entries[i].child, added = old.child.set(e, shift+bitsPerLevel)
+	case old.key == e.key:
+		result.entries[i] = e
+		added = false
+	default:
+		// Two different keys want the same slot: push both one level down.
+		child := &node{}
+		child, _ = child.set(old, shift+bitsPerLevel)
+		child, _ = child.set(e, shift+bitsPerLevel)
+		result.entries[i] = entry{child: child}
+	}
+	return result, added
+}
+
+// Delete returns a new map without key.  Deleting a key that is not there
+// returns the map itself.
+func (m Map) Delete(key Key) Map {
+	if m.root == nil {
+		return m
+	}
+	root, removed := m.root.remove(key, key.Hash(), 0)
+	if !removed {
+		return m
+	}
+	m.root = root
+	m.size--
+	return m
+}
+
+// remove returns a copy of the node without the key, and whether the key was
+// there at all.  The returned node is nil when it would be empty.
+func (n *node) remove(key Key, hash uint64, shift uint) (*node, bool) {
+	if shift >= maxShift {
+		for i, e := range n.entries {
+			if e.key == key {
+				if len(n.entries) == 1 {
+					return nil, true
+				}
+				result := &node{entries: make([]entry, 0, len(n.entries)-1)}
+				result.entries = append(result.entries, n.entries[:i]...)
+				result.entries = append(result.entries, n.entries[i+1:]...)
+				return result, true
+			}
+		}
+		return n, false
+	}
+	bit := chunk(hash, shift)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := index(n.bitmap, bit)
+	e := n.entries[i]
+	if e.child != nil {
+		child, removed := e.child.remove(key, hash, shift+bitsPerLevel)
+		if !removed {
+			return n, false
+		}
+		result := &node{
+			bitmap:  n.bitmap,
+			entries: make([]entry, len(n.entries)),
+		}
+		copy(result.entries, n.entries)
+		switch {
+		case child != nil && shift+bitsPerLevel < maxShift &&
+			len(child.entries) == 1 && child.entries[0].child == nil:
+			// Pull a lonely key back up, to keep the trie shallow.
+			result.entries[i] = child.entries[0]
+		case child != nil:
+			result.entries[i].child = child
+		default:
+			return result.without(bit, i), true
+		}
+		return result, true
+	}
+	if e.key != key {
+		return n, false
+	}
+	return n.without(bit, i), true
+}
+
+// without returns a copy of the node without its i-th entry, or nil if the
+// node would be empty.
+func (n *node) without(bit uint32, i int) *node {
+	if len(n.entries) == 1 {
+		return nil
+	}
+	result := &node{
+		bitmap:  n.bitmap &^ bit,
+		entries: make([]entry, 0, len(n.entries)-1),
+	}
+	result.entries = append(result.entries, n.entries[:i]...)
+	result.entries = append(result.entries, n.entries[i+1:]...)
+	return result
+}
+
+// ForEach calls f on each key/value pair of the map.  The order is given by
+// the hashes of the keys, not by the order of insertion, so it is the same
+// for two maps holding the same keys (unless some of their hashes are equal).
+func (m Map) ForEach(f func(key Key, value interface{})) {
+	if m.root != nil {
+		m.root.forEach(f)
+	}
+}
+
+func (n *node) forEach(f func(key Key, value interface{})) {
+	for _, e := range n.entries {
+		if e.child != nil {
+			e.child.forEach(f)
+		} else {
+			f(e.key, e.value)
+		}
+	}
+}
+
+// Hash64 mixes the bits of an integer, so that keys made of small integers
+// spread well over the trie.  It is the finalizer of MurmurHash3.
+func Hash64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
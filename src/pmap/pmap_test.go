@@ -0,0 +1,150 @@
+package pmap
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+type intKey int
+
+func (key intKey) Hash() uint64 {
+	return Hash64(uint64(key))
+}
+
+// badKey has a terrible hash, to exercise collision nodes.
+type badKey int
+
+func (key badKey) Hash() uint64 {
+	return uint64(key % 3)
+}
+
+// check compares a Map with a reference Go map.
+func check(test *testing.T, m Map, ref map[Key]int) {
+	if m.Len() != len(ref) {
+		test.Fatalf("Len is %v, expected %v.", m.Len(), len(ref))
+	}
+	for key, value := range ref {
+		got, ok := m.Get(key)
+		if !ok || got.(int) != value {
+			test.Fatalf("Get(%v) returned %v, %v instead of %v.", key, got, ok, value)
+		}
+	}
+	seen := 0
+	m.ForEach(func(key Key, value interface{}) {
+		if ref[key] != value.(int) {
+			test.Fatalf("ForEach gave %v=%v, expected %v.", key, value, ref[key])
+		}
+		seen++
+	})
+	if seen != len(ref) {
+		test.Fatalf("ForEach visited %v keys, expected %v.", seen, len(ref))
+	}
+}
+
+func testRandom(test *testing.T, makeKey func(int) Key) {
+	random := rand.New(rand.NewSource(1))
+	var m Map
+	ref := make(map[Key]int)
+	for i := 0; i < 5000; i++ {
+		key := makeKey(random.Intn(500))
+		if random.Intn(3) == 0 {
+			m = m.Delete(key)
+			delete(ref, key)
+		} else {
+			m = m.Set(key, i)
+			ref[key] = i
+		}
+		if i%500 == 0 {
+			check(test, m, ref)
+		}
+	}
+	check(test, m, ref)
+	for key := range ref {
+		m = m.Delete(key)
+	}
+	if m.Len() != 0 || m.root != nil {
+		test.Errorf("Map not empty after deleting everything: %v.", m.Len())
+	}
+}
+
+func TestRandom(test *testing.T) {
+	testRandom(test, func(i int) Key { return intKey(i) })
+}
+
+func TestCollisions(test *testing.T) {
+	testRandom(test, func(i int) Key { return badKey(i) })
+}
+
+func TestPersistence(test *testing.T) {
+	var m0 Map
+	for i := 0; i < 100; i++ {
+		m0 = m0.Set(intKey(i), i)
+	}
+	m1 := m0.Set(intKey(5), -5).Delete(intKey(6)).Set(intKey(1000), 1000)
+	ref0 := make(map[Key]int)
+	for i := 0; i < 100; i++ {
+		ref0[intKey(i)] = i
+	}
+	check(test, m0, ref0)
+	ref0[intKey(5)] = -5
+	delete(ref0, intKey(6))
+	ref0[intKey(1000)] = 1000
+	check(test, m1, ref0)
+}
+
+func TestDeleteMissing(test *testing.T) {
+	var m Map
+	m = m.Set(intKey(1), 1)
+	if m.Delete(intKey(2)).root != m.root {
+		test.Error("Deleting a missing key should return the same map.")
+	}
+}
+
+// The cost of one Set should grow like log(n), where a Go map copied before
+// each update grows like n.
+func BenchmarkSet(b *testing.B) {
+	for _, size := range []int{100, 10000, 1000000} {
+		var m Map
+		for i := 0; i < size; i++ {
+			m = m.Set(intKey(i), i)
+		}
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m.Set(intKey(i%size), i)
+			}
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, size := range []int{100, 10000, 1000000} {
+		var m Map
+		for i := 0; i < size; i++ {
+			m = m.Set(intKey(i), i)
+		}
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m.Get(intKey(i % size))
+			}
+		})
+	}
+}
+
+func BenchmarkCopyGoMap(b *testing.B) {
+	for _, size := range []int{100, 10000} {
+		m := make(map[int]int, size)
+		for i := 0; i < size; i++ {
+			m[i] = i
+		}
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dst := make(map[int]int, len(m))
+				for key, value := range m {
+					dst[key] = value
+				}
+				dst[i%size] = i
+			}
+		})
+	}
+}
@@ -93,3 +93,85 @@ func WallInstNorm(programs glw.Programs) glw.Renderer {
 	}
 	return quadInstNorm(programs, vertexData)
 }
+
+// doorPanel creates a door panel standing in the plane at the given x,
+// smaller than a wall so that the frame shows around it.
+// At rest (non rotated), the door faces a player looking in the +x direction.
+func doorPanel(programs glw.Programs, x gl.GLfloat) glw.Renderer {
+	// Horizontal coordinates.
+	const p = .35 // Plus sign.
+	const m = -p  // Minus sign.
+	// Vertical coordinates.
+	const P = .85 // Plus sign.
+	const M = 0   // Minus sign.
+
+	vertexData := []glw.VertexXyzNorUv{
+		// position xyz, normal xyz, uv
+		glw.VertexXyzNorUv{x, p, M, -1, 0, 0, 0, 0},
+		glw.VertexXyzNorUv{x, m, M, -1, 0, 0, 1, 0},
+		glw.VertexXyzNorUv{x, p, P, -1, 0, 0, 0, 1},
+		glw.VertexXyzNorUv{x, m, P, -1, 0, 0, 1, 1},
+	}
+	return quadInstNorm(programs, vertexData)
+}
+
+// Creates the mesh of a door that stands in a wall.  It is placed like a wall.
+func DoorInstNorm(programs glw.Programs) glw.Renderer {
+	return doorPanel(programs, .5)
+}
+
+// Creates the mesh of a door that stands in the middle of a tile.  Only one
+// side is drawn; draw it a second time, turned around, for the other side.
+func DoorCenterInstNorm(programs glw.Programs) glw.Renderer {
+	return doorPanel(programs, 0)
+}
+
+// Creates the mesh of an item lying on the floor: a small square slightly above
+// the floor.
+func ItemInstNorm(programs glw.Programs) glw.Renderer {
+	const p = .15  // Plus sign.
+	const m = -p   // Minus sign.
+	const z = .005 // Above the floor.
+	vertexData := []glw.VertexXyzNorUv{
+		// position xyz, normal xyz, uv
+		glw.VertexXyzNorUv{m, m, z, 0, 0, 1, 1, 0},
+		glw.VertexXyzNorUv{p, m, z, 0, 0, 1, 1, 1},
+		glw.VertexXyzNorUv{m, p, z, 0, 0, 1, 0, 0},
+		glw.VertexXyzNorUv{p, p, z, 0, 0, 1, 0, 1},
+	}
+	return quadInstNorm(programs, vertexData)
+}
+
+// Creates the mesh of a prop: a small panel standing around its origin.  Like
+// doors in the middle of tiles, only one side is drawn.
+func PropInstNorm(programs glw.Programs) glw.Renderer {
+	// Horizontal coordinates.
+	const p = .1 // Plus sign.
+	const m = -p // Minus sign.
+	// Vertical coordinates.
+	const P = .15 // Plus sign.
+	const M = -P  // Minus sign.
+
+	vertexData := []glw.VertexXyzNorUv{
+		// position xyz, normal xyz, uv
+		glw.VertexXyzNorUv{0, p, M, -1, 0, 0, 0, 0},
+		glw.VertexXyzNorUv{0, m, M, -1, 0, 0, 1, 0},
+		glw.VertexXyzNorUv{0, p, P, -1, 0, 0, 0, 1},
+		glw.VertexXyzNorUv{0, m, P, -1, 0, 0, 1, 1},
+	}
+	return quadInstNorm(programs, vertexData)
+}
+
+// Creates the mesh of an arrow lying flat slightly above the floor, for maps.
+// At rest (non rotated), it points in the +x direction.
+func ArrowInstNorm(programs glw.Programs) glw.Renderer {
+	const z = .01 // Above the floor.
+	vertexData := []glw.VertexXyzNorUv{
+		// position xyz, normal xyz, uv
+		glw.VertexXyzNorUv{-.3, .3, z, 0, 0, 1, 0, 1},
+		glw.VertexXyzNorUv{-.1, 0, z, 0, 0, 1, .2, .5},
+		glw.VertexXyzNorUv{.4, 0, z, 0, 0, 1, .7, .5},
+		glw.VertexXyzNorUv{-.3, -.3, z, 0, 0, 1, 0, 0},
+	}
+	return quadInstNorm(programs, vertexData)
+}
@@ -2,11 +2,18 @@ package world
 
 import (
 	"fmt"
+	"pmap"
+	"sort"
 )
 
 // ActorID is used as a unique identifier for an Actor.
 type ActorID uint64
 
+// Hash allows actor identifiers to be used as keys of persistent maps.
+func (actorID ActorID) Hash() uint64 {
+	return pmap.Hash64(uint64(actorID))
+}
+
 // An Actor is anything that can be at the origin of an Action (see the IA
 // package for Actions).  It can be a creature, a trap, a mechanism, etc.
 // An Actor is not aware of its unique identifier, you have to keep track of it
@@ -20,7 +27,7 @@ func MakeActor() Actor {
 
 // An Actors object holds a collection of Actor objects s identified by an
 // ActorID.
-// It contains a map of Actors indexed by their unique identifier.
+// It contains a persistent map of Actors indexed by their unique identifier.
 // It also manages unique identifiers.  Use the Add method to get a new unique
 // identifier for an Actor.
 type Actors struct {
@@ -28,71 +35,151 @@ type Actors struct {
 	// Do not use.
 	// It starts at 0 and increases each time the Add method is called.
 	NextIDprivate ActorID
-	// ContentPrivate is exported only so that it can be encoded by gob.
-	// Do not use.  Use the Actors.Content() method instead.
-	ContentPrivate map[ActorID]Actor
+	// content is never modified in place, updating it does not copy it.
+	content pmap.Map
 }
 
 // MakeActors creates and returns an empty collection of Actors.
 func MakeActors() Actors {
-	return Actors{
-		ContentPrivate: make(map[ActorID]Actor),
-	}
+	return Actors{}
 }
 
-// Content returns a copy of the private map[ActorID]Actor.
+// Content returns a copy of the content as a map[ActorID]Actor.
 func (actors Actors) Content() map[ActorID]Actor {
-	contentCopy := make(map[ActorID]Actor)
-	for key, value := range actors.ContentPrivate {
-		contentCopy[key] = value
-	}
+	contentCopy := make(map[ActorID]Actor, actors.Len())
+	actors.ForEach(func(actorID ActorID, actor Actor) {
+		contentCopy[actorID] = actor
+	})
 	return contentCopy
 }
 
-// Copy returns a deep-copy of the Actors receiver.
+// Ids returns the identifiers of the Actors, sorted, for when the order in
+// which they are processed matters.
+func (actors Actors) Ids() []ActorID {
+	ids := make([]ActorID, 0, actors.Len())
+	actors.ForEach(func(actorID ActorID, actor Actor) {
+		ids = append(ids, actorID)
+	})
+	sort.Sort(actorIDs(ids))
+	return ids
+}
+
+type actorIDs []ActorID
+
+func (ids actorIDs) Len() int           { return len(ids) }
+func (ids actorIDs) Less(i, j int) bool { return ids[i] < ids[j] }
+func (ids actorIDs) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
+
+// Copy returns a copy of the Actors receiver.  Since Actors is never modified
+// in place, a copy is the value itself.
 func (actors Actors) Copy() Actors {
-	newActors := Actors{
-		NextIDprivate:  actors.NextIDprivate,
-		ContentPrivate: make(map[ActorID]Actor),
-	}
-	for key, value := range actors.ContentPrivate {
-		newActors.ContentPrivate[key] = value
+	return actors
+}
+
+// Get returns the Actor with the given ActorID, if any.
+func (actors Actors) Get(actorID ActorID) (Actor, bool) {
+	actor, ok := actors.content.Get(actorID)
+	if !ok {
+		return Actor{}, false
 	}
-	return newActors
+	return actor.(Actor), true
+}
+
+// Len returns the number of Actors.
+func (actors Actors) Len() int {
+	return actors.content.Len()
+}
+
+// ForEach calls f for each Actor.
+func (actors Actors) ForEach(f func(actorID ActorID, actor Actor)) {
+	actors.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(ActorID), value.(Actor))
+	})
 }
 
 // Replace returns a new Actors object in which the Actor actor is given the
 // ActorID actorID.  There must be an existing Actor with this ID.  If not,
 // this method panics.
 func (actors Actors) Replace(actorID ActorID, actor Actor) Actors {
-	_, ok := actors.ContentPrivate[actorID]
+	_, ok := actors.content.Get(actorID)
 	if !ok {
 		panic(fmt.Sprintf("cannot replace inexistent Actor ID=%v", actorID))
 	}
-	newActors := actors.Copy()
-	newActors.ContentPrivate[actorID] = actor
-	return newActors
+	actors.content = actors.content.Set(actorID, actor)
+	return actors
+}
+
+// Insert returns a new Actors object in which the Actor actor is given the
+// ActorID actorID.  It is used to welcome an Actor coming from another Level,
+// who keeps its identifier.  There must not be any existing Actor with this
+// ID.  If there is, this method panics.
+func (actors Actors) Insert(actorID ActorID, actor Actor) Actors {
+	_, ok := actors.content.Get(actorID)
+	if ok {
+		panic(fmt.Sprintf("cannot insert already existing Actor ID=%v", actorID))
+	}
+	actors.content = actors.content.Set(actorID, actor)
+	return actors
+}
+
+// release gives back an identifier, if it is the last one handed out.
+func (actors Actors) release(actorID ActorID) Actors {
+	if actorID+1 == actors.NextIDprivate {
+		actors.NextIDprivate = actorID
+	}
+	return actors
+}
+
+// reserve makes sure that Add never gives out actorID, for when it was given to
+// an Actor with Insert.
+func (actors Actors) reserve(actorID ActorID) Actors {
+	if actorID >= actors.NextIDprivate {
+		actors.NextIDprivate = actorID + 1
+	}
+	return actors
 }
 
 // Add returns a new Actors object to which the given Actor actor is added.
 // The method also returns the ActorID that was given to actor.
 func (actors Actors) Add(actor Actor) (Actors, ActorID) {
 	actorID := actors.NextIDprivate
-	newActors := actors.Copy()
-	newActors.ContentPrivate[actorID] = actor
-	newActors.NextIDprivate++
-	return newActors, actorID
+	actors.content = actors.content.Set(actorID, actor)
+	actors.NextIDprivate++
+	return actors, actorID
 }
 
 // Delete returns a new Actors object from which the entry corresponding to
 // the provided actorID is deleted.  If actorID does not exist, this method
 // panics.
 func (actors Actors) Delete(actorID ActorID) Actors {
-	_, ok := actors.ContentPrivate[actorID]
+	_, ok := actors.content.Get(actorID)
 	if !ok {
 		panic(fmt.Sprintf("cannot remove inexistent Actor ID %v", actorID))
 	}
-	newActors := actors.Copy()
-	delete(newActors.ContentPrivate, actorID)
-	return newActors
+	actors.content = actors.content.Delete(actorID)
+	return actors
+}
+
+// actorsGob is what Actors looks like to gob.
+type actorsGob struct {
+	NextIDprivate  ActorID
+	ContentPrivate map[ActorID]Actor
+}
+
+// GobEncode encodes Actors as a plain map.
+func (actors Actors) GobEncode() ([]byte, error) {
+	return gobEncode(actorsGob{actors.NextIDprivate, actors.Content()})
+}
+
+// GobDecode decodes Actors encoded by GobEncode.
+func (actors *Actors) GobDecode(data []byte) error {
+	var decoded actorsGob
+	if err := gobDecode(data, &decoded); err != nil {
+		return err
+	}
+	*actors = Actors{NextIDprivate: decoded.NextIDprivate}
+	for actorID, actor := range decoded.ContentPrivate {
+		*actors = actors.Insert(actorID, actor)
+	}
+	return nil
 }
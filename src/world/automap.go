@@ -0,0 +1,179 @@
+package world
+
+import (
+	"pmap"
+)
+
+// The automap is what the player remembers of the levels: the tiles they saw,
+// and the walls they saw the face of.  It remembers where the player looked,
+// not what was there.  Maps drawn from it show the seen parts of the levels
+// as they are now, doors, stairs and all.
+
+type Seen uint8
+
+const (
+	SEEN_TILE       = Seen(1 << iota) // The floor or the rock, and what stands in the tile.
+	SEEN_WALL_EAST                    // The wall of the tile facing east.
+	SEEN_WALL_NORTH                   // The wall of the tile facing north.
+	SEEN_WALL_WEST                    // The wall of the tile facing west.
+	SEEN_WALL_SOUTH                   // The wall of the tile facing south.
+)
+
+// SeenWall returns the flag of the wall of a tile that faces the given way.
+func SeenWall(facing AbsoluteDirection) Seen {
+	return SEEN_WALL_EAST << uint(facing.Value())
+}
+
+// Hash allows level locations to be used as keys of persistent maps.  Without
+// it, they would use the hash of their Location and ignore their Level.
+func (self LevelLocation) Hash() uint64 {
+	return self.Location.Hash() ^ pmap.Hash64(uint64(self.Level))
+}
+
+type Automap struct {
+	// The content is a persistent map, updating it does not copy it.
+	content pmap.Map
+}
+
+func MakeAutomap() Automap {
+	return Automap{}
+}
+
+// Get tells what was seen of the tile.  Nothing was seen of the tiles that
+// are not in the automap.
+func (self Automap) Get(location LevelLocation) Seen {
+	seen, ok := self.content.Get(location)
+	if !ok {
+		return 0
+	}
+	return seen.(Seen)
+}
+
+// See adds to what was seen of the tile.
+func (self Automap) See(location LevelLocation, seen Seen) Automap {
+	before := self.Get(location)
+	if before|seen == before {
+		return self
+	}
+	self.content = self.content.Set(location, before|seen)
+	return self
+}
+
+func (self Automap) Len() int {
+	return self.content.Len()
+}
+
+// ForEach calls f for each tile of which something was seen.
+func (self Automap) ForEach(f func(location LevelLocation, seen Seen)) {
+	self.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(LevelLocation), value.(Seen))
+	})
+}
+
+// ForEachInLevel calls f for each tile of the level of which something was
+// seen.
+func (self Automap) ForEachInLevel(level_id LevelId, f func(location Location, seen Seen)) {
+	self.ForEach(func(location LevelLocation, seen Seen) {
+		if location.Level == level_id {
+			f(location.Location, seen)
+		}
+	})
+}
+
+// automapGob is what Automap looks like to gob.
+type automapGob struct {
+	Content map[LevelLocation]Seen
+}
+
+func (self Automap) GobEncode() ([]byte, error) {
+	content := make(map[LevelLocation]Seen, self.Len())
+	self.ForEach(func(location LevelLocation, seen Seen) {
+		content[location] = seen
+	})
+	return gobEncode(automapGob{content})
+}
+
+func (self *Automap) GobDecode(data []byte) error {
+	var decoded automapGob
+	if err := gobDecode(data, &decoded); err != nil {
+		return err
+	}
+	*self = Automap{}
+	for location, seen := range decoded.Content {
+		self.content = self.content.Set(location, seen)
+	}
+	return nil
+}
+
+// Sight tells what someone standing at the position sees of the level, up to
+// `radius` tiles ahead.  The walls of a visible tile are seen when they face
+// the viewer, or show their edge.
+func (self Level) Sight(position Position, radius int) map[Location]Seen {
+	sight := make(map[Location]Seen)
+	for _, location := range self.FOV(position, radius) {
+		seen := SEEN_TILE
+		for i := range self.Walls {
+			facing := absoluteDirection{i}
+			if _, ok := self.Walls[i].Get(location.X, location.Y); !ok {
+				continue
+			}
+			dx, dy := facing.DxDy()
+			if (position.X-location.X)*dx+(position.Y-location.Y)*dy >= 0 {
+				seen |= SeenWall(facing)
+			}
+		}
+		sight[location] = seen
+	}
+	return sight
+}
+
+// Explore adds what the actor sees from where it stands, up to `radius`
+// tiles ahead, to the automap of the World.
+func (world World) Explore(actor_id ActorID, radius int) World {
+	position, ok := world.ActorPosition(actor_id)
+	if !ok {
+		return world
+	}
+	level := world.Levels[position.Level]
+	automap := world.Automap
+	for location, seen := range level.Sight(position.Position, radius) {
+		automap = automap.See(location.ToLevelLocation(position.Level), seen)
+	}
+	world.Automap = automap
+	return world
+}
+
+// Explored returns the buildings of the level that the automap shows: those
+// of the seen tiles, and the seen walls.  Nothing else is kept.
+func (self Level) Explored(level_id LevelId, automap Automap) Level {
+	explored := MakeLevel(level_id)
+	explored.Name = self.Name
+	automap.ForEachInLevel(level_id, func(location Location, seen Seen) {
+		x, y := location.X, location.Y
+		layers := [...]struct {
+			from Buildings
+			to   *Buildings
+		}{
+			{self.Floors, &explored.Floors},
+			{self.Ceilings, &explored.Ceilings},
+			{self.Columns, &explored.Columns},
+			{self.Doors, &explored.Doors},
+		}
+		if seen&SEEN_TILE != 0 {
+			for _, layer := range layers {
+				if building, ok := layer.from.Get(x, y); ok {
+					*layer.to = layer.to.Set(x, y, building)
+				}
+			}
+		}
+		for i := range self.Walls {
+			if seen&SeenWall(absoluteDirection{i}) == 0 {
+				continue
+			}
+			if building, ok := self.Walls[i].Get(x, y); ok {
+				explored.Walls[i] = explored.Walls[i].Set(x, y, building)
+			}
+		}
+	})
+	return explored
+}
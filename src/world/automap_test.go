@@ -0,0 +1,56 @@
+package world
+
+import (
+	"testing"
+)
+
+// Exploring marks what the player sees and nothing else: not what is behind
+// them, beyond the radius, or behind a closed door, and no other level.
+func TestExplore(test *testing.T) {
+	w := MakeWorld()
+	level := roomLevel(6, 3)
+	level.Creatures, level.Actors = w.Levels[0].Creatures, w.Levels[0].Actors
+	level.CreatureActor, level.CreatureLocation = w.Levels[0].CreatureActor, w.Levels[0].CreatureLocation
+	level = level.SetDoor(DoorSlot{Location{2, 0}, true, WEST()}, MakeDoor(6, DOOR_CLOSED, NORTH()))
+	w = w.SetLevel(0, level).SetLevel(1, roomLevel(6, 3))
+	player, _ := level.CreatureActor.GetCreature(w.Player_id)
+	w, err := w.MoveCreature(player, LevelPosition{0, Position{Location{1, 1}, EAST()}})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if problems := w.Validate(); len(problems) != 0 {
+		test.Fatal(problems)
+	}
+	const radius = 3
+	w = w.Explore(w.Player_id, radius)
+	visible := make(map[Location]bool)
+	for _, location := range level.FOV(Position{Location{1, 1}, EAST()}, radius) {
+		visible[location] = true
+	}
+	w.Automap.ForEach(func(location LevelLocation, seen Seen) {
+		if location.Level != 0 || !visible[location.Location] {
+			test.Error("Explored the hidden", location)
+		}
+	})
+	for location := range visible {
+		if w.Automap.Get(location.ToLevelLocation(0))&SEEN_TILE == 0 {
+			test.Error("Did not explore", location)
+		}
+	}
+	for _, hidden := range []Location{{0, 1}, {3, 0}, {5, 1}} {
+		if w.Automap.Get(hidden.ToLevelLocation(0)) != 0 {
+			test.Error("Explored", hidden)
+		}
+	}
+	// The door faces the player from one side only.
+	if w.Automap.Get(LevelLocation{0, Location{2, 0}})&SeenWall(WEST()) == 0 {
+		test.Error("The door was not seen.")
+	}
+	if w.Automap.Get(LevelLocation{0, Location{3, 0}})&SeenWall(EAST()) != 0 {
+		test.Error("The back of the door was seen.")
+	}
+	// Nobody explores for the missing.
+	if explored := w.Explore(w.Player_id+100, radius); explored.Automap.Len() != w.Automap.Len() {
+		test.Error("A missing actor explored", explored.Automap.Len()-w.Automap.Len(), "tiles.")
+	}
+}
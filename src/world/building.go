@@ -2,6 +2,7 @@ package world
 
 import (
 	"encoding/gob"
+	"pmap"
 )
 
 func init() {
@@ -12,6 +13,10 @@ func init() {
 	gob.Register(MakeOrientedBuilding(0, EAST()))
 	gob.Register(MakeFloor(0, EAST(), false))
 	gob.Register(MakeWall(0, false))
+	gob.Register(MakeDoor(0, DOOR_CLOSED, EAST()))
+	gob.Register(MakeStairs(0, EAST(), LevelPosition{}))
+	gob.Register(MakeLadder(0, EAST(), LevelLocation{}))
+	gob.Register(MakePit(0, EAST(), false, LevelLocation{}))
 }
 
 type Building interface {
@@ -32,6 +37,12 @@ type OrientedBuilding struct {
 	F AbsoluteDirection
 }
 
+// Passer is implemented by the buildings that may or may not let creatures
+// through.
+type Passer interface {
+	IsPassable() bool
+}
+
 type MaybePassable struct {
 	Passable_ bool
 }
@@ -50,6 +61,30 @@ type Wall struct {
 	MaybePassable
 }
 
+// A Passage is a building that leads to another place of the World, usually
+// on another Level.  Creatures standing on a Passage can take it.
+type Passage interface {
+	Building
+	// Destination returns where a creature standing at `from` arrives when it
+	// takes the passage.
+	Destination(from Position) LevelPosition
+}
+
+// Stairs are floors that lead to another Level.  Whoever takes them arrives
+// at the destination with the destination's facing, as if they had walked
+// down (or up) the steps.
+type Stairs struct {
+	Floor
+	To LevelPosition
+}
+
+// Ladders are floors that lead to another Level.  Climbing a ladder does not
+// change your facing.
+type Ladder struct {
+	Floor
+	To LevelLocation
+}
+
 func MakeBaseBuilding(model ModelId) BaseBuilding {
 	return BaseBuilding{Model_: model}
 }
@@ -73,6 +108,28 @@ func MakeWall(model ModelId, passable bool) Wall {
 	return wall
 }
 
+func MakeStairs(model ModelId, facing AbsoluteDirection, to LevelPosition) Stairs {
+	var stairs Stairs
+	stairs.Floor = MakeFloor(model, facing, true)
+	stairs.To = to
+	return stairs
+}
+
+func (self Stairs) Destination(from Position) LevelPosition {
+	return self.To
+}
+
+func MakeLadder(model ModelId, facing AbsoluteDirection, to LevelLocation) Ladder {
+	var ladder Ladder
+	ladder.Floor = MakeFloor(model, facing, true)
+	ladder.To = to
+	return ladder
+}
+
+func (self Ladder) Destination(from Position) LevelPosition {
+	return self.To.ToLevelPosition(from.F)
+}
+
 func MakeOrientedBuilding(model ModelId, facing AbsoluteDirection) OrientedBuilding {
 	var result OrientedBuilding
 	result.Model_ = model
@@ -84,34 +141,70 @@ func (building OrientedBuilding) Facing() AbsoluteDirection {
 	return building.F
 }
 
-type Buildings map[Location]Building
+// Buildings holds the buildings of one layer of a level (floors, ceilings,
+// etc.), indexed by their location.  It is a persistent map: updating it
+// returns a new Buildings and leaves the old one alone, without copying it
+// entirely.
+type Buildings struct {
+	content pmap.Map
+}
 
 func MakeBuildings() Buildings {
-	return make(Buildings)
+	return Buildings{}
 }
 
-// Making copies is required to produce updated version of maps.
+// Copy is kept for symmetry with the other collections.  Buildings is never
+// modified in place, so a copy is the value itself.
 func (src Buildings) Copy() Buildings {
-	dst := make(Buildings, len(src))
-	for key, value := range src {
-		dst[key] = value
-	}
-	return dst
+	return src
 }
 
 func (src Buildings) Set(x, y Coord, value Building) Buildings {
-	dst := src.Copy()
-	dst[Location{x, y}] = value
-	return dst
+	src.content = src.content.Set(Location{x, y}, value)
+	return src
 }
 
 func (src Buildings) Get(x, y Coord) (Building, bool) {
-	building, ok := src[Location{x, y}]
-	return building, ok
+	building, ok := src.content.Get(Location{x, y})
+	if !ok {
+		return nil, false
+	}
+	return building.(Building), true
 }
 
 func (src Buildings) Delete(x, y Coord) Buildings {
-	dst := src.Copy()
-	delete(dst, Location{x, y})
-	return dst
+	src.content = src.content.Delete(Location{x, y})
+	return src
+}
+
+func (src Buildings) Len() int {
+	return src.content.Len()
+}
+
+// ForEach calls f for each building.
+func (src Buildings) ForEach(f func(location Location, building Building)) {
+	src.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(Location), value.(Building))
+	})
+}
+
+// GobEncode encodes Buildings as a plain map.
+func (src Buildings) GobEncode() ([]byte, error) {
+	content := make(map[Location]Building, src.Len())
+	src.ForEach(func(location Location, building Building) {
+		content[location] = building
+	})
+	return gobEncode(content)
+}
+
+func (dst *Buildings) GobDecode(data []byte) error {
+	var content map[Location]Building
+	if err := gobDecode(data, &content); err != nil {
+		return err
+	}
+	*dst = MakeBuildings()
+	for location, building := range content {
+		*dst = dst.Set(location.X, location.Y, building)
+	}
+	return nil
 }
@@ -0,0 +1,95 @@
+package world
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLevelGob(test *testing.T) {
+	w := MakeWorld()
+	level := w.Levels[0]
+	level.Name = "test"
+	level.Floors = level.Floors.Set(0, 0, MakeFloor(1, NORTH(), true))
+	level.Floors = level.Floors.Set(-3, 7, MakeStairs(1, WEST(), Location{2, 3}.ToPosition(EAST()).ToLevelPosition(1)))
+	level.Walls[2] = level.Walls[2].Set(0, 0, MakeWall(2, false))
+	level.Columns = level.Columns.Set(1, 1, MakeOrientedBuilding(3, SOUTH()))
+	creatures, creatureID := level.Creatures.Add(MakeCreature())
+	actors, actorID := level.Actors.Add(MakeActor())
+	level.Creatures, level.Actors = creatures, actors
+	level.CreatureActor, _ = level.CreatureActor.Add(creatureID, actorID)
+	level.CreatureLocation, _ = level.CreatureLocation.Add(creatureID, Location{5, 5})
+	w = w.SetLevel(0, level)
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(w); err != nil {
+		test.Fatal(err)
+	}
+	var decoded World
+	if err := gob.NewDecoder(&buffer).Decode(&decoded); err != nil {
+		test.Fatal(err)
+	}
+	// The tries may be shaped differently, compare their content.
+	var before, after bytes.Buffer
+	EncodeLevel(&before, w.Levels[0])
+	EncodeLevel(&after, decoded.Levels[0])
+	if before.String() != after.String() {
+		test.Errorf("Level changed by gob:\n%v\n%v", before.String(), after.String())
+	}
+	got, ok := decoded.ActorPosition(actorID)
+	if !ok || got.Location != (Location{5, 5}) {
+		test.Errorf("Actor %v at %v, %v after gob.", actorID, got, ok)
+	}
+	if !reflect.DeepEqual(decoded.Levels[0].Creatures.Next_id, level.Creatures.Next_id) ||
+		decoded.Levels[0].Actors.NextIDprivate != level.Actors.NextIDprivate {
+		test.Error("Identifier counters changed by gob.")
+	}
+}
+
+// Placing one floor must not cost more in a big level than in a small one,
+// apart from a logarithmic factor.
+func TestIsPassable(test *testing.T) {
+	level := MakeLevel(0)
+	level.Floors = level.Floors.Set(1, 0, MakeFloor(0, EAST(), true))
+	if !level.IsPassable(Location{}, EAST()) {
+		test.Error("The floor is not passable.")
+	}
+	// A building that does not know whether it is passable blocks the way.
+	level.Doors = level.Doors.Set(1, 0, MakeBaseBuilding(1))
+	if level.IsPassable(Location{}, EAST()) {
+		test.Error("A building that is not a Passer let the creature through.")
+	}
+}
+
+func BenchmarkBuildingsSet(b *testing.B) {
+	for _, side := range []Coord{10, 100, 1000} {
+		buildings := MakeBuildings()
+		floor := MakeFloor(0, EAST(), true)
+		for x := Coord(0); x < side; x++ {
+			for y := Coord(0); y < side; y++ {
+				buildings = buildings.Set(x, y, floor)
+			}
+		}
+		b.Run(fmt.Sprintf("%vx%v", side, side), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				buildings.Set(Coord(i)%side, Coord(i/7)%side, floor)
+			}
+		})
+	}
+}
+
+func BenchmarkCreatureLocationMove(b *testing.B) {
+	for _, n := range []int{10, 1000, 100000} {
+		locations := MakeCreatureLocation()
+		for i := 0; i < n; i++ {
+			locations, _ = locations.Add(CreatureId(i), Location{Coord(i), 0})
+		}
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				locations.Move(CreatureId(i%n), Location{Coord(i % n), 1})
+			}
+		})
+	}
+}
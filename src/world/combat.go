@@ -0,0 +1,187 @@
+package world
+
+import (
+	"fmt"
+)
+
+// Faction tells who fights whom.  Creatures of different factions are hostile
+// to each other, except neutral creatures, which are hostile to nobody.
+type Faction uint8
+
+const (
+	FACTION_NEUTRAL = Faction(iota)
+	FACTION_PLAYER
+	FACTION_MONSTERS
+)
+
+var faction_text = map[Faction]string{
+	FACTION_NEUTRAL:  "neutral",
+	FACTION_PLAYER:   "player",
+	FACTION_MONSTERS: "monsters",
+}
+
+func (self Faction) String() string {
+	return faction_text[self]
+}
+
+func (self Faction) IsHostile(other Faction) bool {
+	return self != other && self != FACTION_NEUTRAL && other != FACTION_NEUTRAL
+}
+
+type DamageType int
+
+const (
+	DAMAGE_BLUNT = DamageType(iota)
+	DAMAGE_SLASH
+	DAMAGE_PIERCE
+	DAMAGE_FIRE
+	DAMAGE_COLD
+	DAMAGE_TYPES // Number of damage types.
+)
+
+var damage_type_text = map[DamageType]string{
+	DAMAGE_BLUNT:  "blunt",
+	DAMAGE_SLASH:  "slashing",
+	DAMAGE_PIERCE: "piercing",
+	DAMAGE_FIRE:   "fire",
+	DAMAGE_COLD:   "cold",
+}
+
+func (self DamageType) String() string {
+	return damage_type_text[self]
+}
+
+// Resistances are percentages of damage ignored, by damage type.  Negative
+// resistances are weaknesses.
+type Resistances [DAMAGE_TYPES]int
+
+// Apply reduces the damage according to the resistance to its type.  Damage
+// never becomes negative: resisting more than everything does not heal.
+func (self Resistances) Apply(damage int, damage_type DamageType) int {
+	damage = damage * (100 - self[damage_type]) / 100
+	if damage < 0 {
+		return 0
+	}
+	return damage
+}
+
+// A Weapon is what makes an item hurt.  Items that are not weapons have a zero
+// Weapon, and fight like bare hands.
+type Weapon struct {
+	Dice  int // Number of dice rolled for the damage.
+	Sides int // Sides of these dice.
+	Type  DamageType
+}
+
+// Bare hands are used when nothing is held.
+var BARE_HANDS = Weapon{Dice: 1, Sides: 3, Type: DAMAGE_BLUNT}
+
+func (self Weapon) IsWeapon() bool {
+	return self.Dice > 0 && self.Sides > 0
+}
+
+// MeleeResult tells what happened during a melee attack, so that it can be
+// shown to the player.
+type MeleeResult struct {
+	Attacker CreatureId
+	Defender CreatureId
+	Roll     int // The d20 to-hit roll, bonuses included.
+	Target   int // The roll needed to hit.
+	Hit      bool
+	Damage   int // Damage dealt, resistances applied.
+	Type     DamageType
+	Killed   bool
+}
+
+func (self MeleeResult) String() string {
+	if !self.Hit {
+		return fmt.Sprintf(
+			"creature %v misses creature %v (%v against %v)",
+			self.Attacker, self.Defender, self.Roll, self.Target,
+		)
+	}
+	text := fmt.Sprintf(
+		"creature %v hits creature %v for %v %v damage",
+		self.Attacker, self.Defender, self.Damage, self.Type,
+	)
+	if self.Killed {
+		text += ", killing it"
+	}
+	return text
+}
+
+// attributeBonus turns an attribute into a bonus to rolls: +1 for every two
+// points above average, -1 for every two points below.
+func attributeBonus(attribute int) int {
+	return (attribute - average_attribute) / 2
+}
+
+// ResolveMelee rolls a melee attack.  The attacker hits if a d20 plus its
+// dexterity bonus reaches 10 plus the dexterity bonus of the defender.  The
+// damage is the roll of the weapon plus the strength bonus of the attacker,
+// at least 1, reduced by the resistances of the defender.  The damage is not
+// applied, and Killed is left to the caller.
+func ResolveMelee(
+	rng Rng,
+	attacker Creature,
+	weapon Weapon,
+	defender Creature,
+) (Rng, MeleeResult) {
+	var result MeleeResult
+	if !weapon.IsWeapon() {
+		weapon = BARE_HANDS
+	}
+	result.Type = weapon.Type
+	var roll int
+	rng, roll = rng.Roll(1, 20)
+	result.Roll = roll + attributeBonus(attacker.Stats.Attributes.Dexterity)
+	result.Target = 10 + attributeBonus(defender.Stats.Attributes.Dexterity)
+	result.Hit = result.Roll >= result.Target
+	if !result.Hit {
+		return rng, result
+	}
+	var damage int
+	rng, damage = rng.Roll(weapon.Dice, weapon.Sides)
+	damage += attributeBonus(attacker.Stats.Attributes.Strength)
+	if damage < 1 {
+		damage = 1
+	}
+	result.Damage = defender.Stats.Resistances.Apply(damage, weapon.Type)
+	return rng, result
+}
+
+// Hurt computes the change to a creature of the level that takes damage, and
+// tells whether the creature dies.
+func Hurt(level_id LevelId, creature_id CreatureId, creature Creature, damage int) (Delta, bool) {
+	if damage == 0 {
+		return nil, false
+	}
+	wounded := creature.Damage(damage)
+	delta := DeltaCreatureStats{
+		Level:    level_id,
+		Creature: creature_id,
+		Before:   creature.Stats,
+		After:    wounded.Stats,
+	}
+	if !wounded.IsDead() {
+		return delta, false
+	}
+	return Combine(delta, DeltaCreatureDied{
+		Level:    level_id,
+		Creature: creature_id,
+	}), true
+}
+
+// Wielded returns the weapon held by a creature of the level, bare hands if
+// it holds nothing.
+func (self Level) Wielded(creature_id CreatureId) Weapon {
+	item_id := self.Inventories.Get(creature_id).Equipped[EQUIP_HAND]
+	if item_id == NO_ITEM {
+		return BARE_HANDS
+	}
+	item, ok := self.Items.Get(item_id)
+	if !ok || !item.Weapon.IsWeapon() {
+		return BARE_HANDS
+	}
+	return item.Weapon
+}
@@ -0,0 +1,72 @@
+package world
+
+import (
+	"testing"
+)
+
+// What a blow of 10 fire damage does through each resistance.
+var resisted = map[int]int{
+	0:   10,
+	50:  5,
+	-50: 15,
+	100: 0,
+	150: 0,
+}
+
+func TestResistancesApply(test *testing.T) {
+	for resistance, expected := range resisted {
+		var resistances Resistances
+		resistances[DAMAGE_FIRE] = resistance
+		if damage := resistances.Apply(10, DAMAGE_FIRE); damage != expected {
+			test.Errorf("A resistance of %v lets %v damage through.", resistance, damage)
+		}
+		if damage := resistances.Apply(10, DAMAGE_COLD); damage != 10 {
+			test.Errorf("A resistance to fire lets %v cold damage through.", damage)
+		}
+	}
+}
+
+// Melee attacks reduce their damage by the resistance of the defender, and
+// hurting a creature never heals it.
+func TestResolveMeleeResisted(test *testing.T) {
+	attacker := MakeCreature()
+	attacker.Stats.Attributes.Dexterity = 100 // Never misses.
+	torch := Weapon{Dice: 10, Sides: 1, Type: DAMAGE_FIRE}
+	for resistance, expected := range resisted {
+		defender := MakeCreature()
+		defender.Stats.Resistances[DAMAGE_FIRE] = resistance
+		_, result := ResolveMelee(MakeRng(1), attacker, torch, defender)
+		if !result.Hit || result.Damage != expected || result.Type != DAMAGE_FIRE {
+			test.Errorf("Against a resistance of %v: %v.", resistance, result)
+		}
+		delta, died := Hurt(0, 0, defender, result.Damage)
+		if died {
+			test.Errorf("A resistance of %v kills.", resistance)
+		}
+		if expected == 0 {
+			if delta != nil {
+				test.Errorf("A resistance of %v still changes the defender: %v.", resistance, delta)
+			}
+			continue
+		}
+		stats, ok := delta.(DeltaCreatureStats)
+		if !ok || stats.After.Hp.Current != defender.Stats.Hp.Current-expected {
+			test.Errorf("A resistance of %v hurts with %v.", resistance, delta)
+		}
+	}
+}
+
+// A blow that empties the hit points kills.
+func TestHurtKills(test *testing.T) {
+	defender := MakeCreature()
+	defender.Stats.Resistances[DAMAGE_FIRE] = -100
+	damage := defender.Stats.Resistances.Apply(defender.Stats.Hp.Current/2, DAMAGE_FIRE)
+	delta, died := Hurt(0, 0, defender, damage)
+	deltas, ok := delta.(Deltas)
+	if !died || !ok || len(deltas) != 2 {
+		test.Fatal("The weakness did not kill:", delta)
+	}
+	if _, ok := deltas[1].(DeltaCreatureDied); !ok {
+		test.Error("The defender does not die:", deltas)
+	}
+}
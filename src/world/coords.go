@@ -3,6 +3,7 @@ package world
 import (
 	"encoding/gob"
 	"fmt"
+	"pmap"
 )
 
 func init() {
@@ -142,11 +143,52 @@ type Location struct {
 	X, Y Coord
 }
 
+// Hash allows locations to be used as keys of persistent maps.
+func (self Location) Hash() uint64 {
+	return pmap.Hash64(uint64(uint32(self.X))<<32 | uint64(uint32(self.Y)))
+}
+
 type Position struct {
 	Location
 	F AbsoluteDirection
 }
 
+// A LevelLocation is a Location qualified with the Level it belongs to.  A
+// Location alone is only meaningful once you know which Level you are looking
+// at; a LevelLocation is meaningful anywhere in the World.
+type LevelLocation struct {
+	Level LevelId
+	Location
+}
+
+// A LevelPosition is a Position qualified with the Level it belongs to.
+type LevelPosition struct {
+	Level LevelId
+	Position
+}
+
+func (self Location) ToLevelLocation(level_id LevelId) LevelLocation {
+	return LevelLocation{Level: level_id, Location: self}
+}
+
+func (self Position) ToLevelPosition(level_id LevelId) LevelPosition {
+	return LevelPosition{Level: level_id, Position: self}
+}
+
+func (self LevelLocation) ToLevelPosition(facing AbsoluteDirection) LevelPosition {
+	return LevelPosition{
+		Level:    self.Level,
+		Position: self.Location.ToPosition(facing),
+	}
+}
+
+func (self LevelPosition) ToLevelLocation() LevelLocation {
+	return LevelLocation{
+		Level:    self.Level,
+		Location: self.Position.ToLocation(),
+	}
+}
+
 func (self Location) ToPosition(facing AbsoluteDirection) Position {
 	var position Position
 	position.X = self.X
@@ -1,16 +1,28 @@
 package world
 
+import (
+	"pmap"
+)
+
 // Each creature in the world is identified with a unique ID.
 // A creature does not know its own ID.  This is to avoid inconsistencies.
 // Indeed, creatures are contained in a map[CreatureId]Creature.
 type CreatureId uint64
 
+// Hash allows creature identifiers to be used as keys of persistent maps.
+func (self CreatureId) Hash() uint64 {
+	return pmap.Hash64(uint64(self))
+}
+
 type Creature struct {
-	F AbsoluteDirection
+	F       AbsoluteDirection
+	Stats   Stats
+	Faction Faction
+	Light   Light // The lantern it carries, if it is on.
 }
 
 func MakeCreature() Creature {
-	return Creature{F: EAST()}
+	return Creature{F: EAST(), Stats: MakeStats(MakeAttributes())}
 }
 
 // Implement Facer interface.
@@ -20,22 +32,18 @@ func (self Creature) Facing() AbsoluteDirection {
 
 type Creatures struct {
 	Next_id CreatureId
-	Content map[CreatureId]Creature
+	// The content is a persistent map, updating it does not copy it.
+	content pmap.Map
 }
 
 func MakeCreatures() Creatures {
-	return Creatures{Content: make(map[CreatureId]Creature)}
+	return Creatures{}
 }
 
+// Copy is kept for symmetry with the other collections.  Creatures is never
+// modified in place, so a copy is the value itself.
 func (self Creatures) Copy() Creatures {
-	result := Creatures{
-		Next_id: self.Next_id,
-		Content: make(map[CreatureId]Creature),
-	}
-	for key, value := range self.Content {
-		result.Content[key] = value
-	}
-	return result
+	return self
 }
 
 func (self Creatures) Spawn() (Creatures, CreatureId, Creature) {
@@ -54,12 +62,56 @@ func (self Creatures) Add(creature Creature) (Creatures, CreatureId) {
 }
 
 func (self Creatures) Get(creature_id CreatureId) (Creature, bool) {
-	creature, ok := self.Content[creature_id]
-	return creature, ok
+	creature, ok := self.content.Get(creature_id)
+	if !ok {
+		return Creature{}, false
+	}
+	return creature.(Creature), true
 }
 
 func (self Creatures) Set(creature_id CreatureId, creature Creature) Creatures {
-	result := self.Copy()
-	result.Content[creature_id] = creature
-	return result
+	self.content = self.content.Set(creature_id, creature)
+	return self
+}
+
+func (self Creatures) Delete(creature_id CreatureId) Creatures {
+	self.content = self.content.Delete(creature_id)
+	return self
+}
+
+func (self Creatures) Len() int {
+	return self.content.Len()
+}
+
+// ForEach calls f for each creature.
+func (self Creatures) ForEach(f func(creature_id CreatureId, creature Creature)) {
+	self.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(CreatureId), value.(Creature))
+	})
+}
+
+// creaturesGob is what Creatures looks like to gob.
+type creaturesGob struct {
+	Next_id CreatureId
+	Content map[CreatureId]Creature
+}
+
+func (self Creatures) GobEncode() ([]byte, error) {
+	content := make(map[CreatureId]Creature, self.Len())
+	self.ForEach(func(creature_id CreatureId, creature Creature) {
+		content[creature_id] = creature
+	})
+	return gobEncode(creaturesGob{self.Next_id, content})
+}
+
+func (self *Creatures) GobDecode(data []byte) error {
+	var decoded creaturesGob
+	if err := gobDecode(data, &decoded); err != nil {
+		return err
+	}
+	*self = Creatures{Next_id: decoded.Next_id}
+	for creature_id, creature := range decoded.Content {
+		*self = self.Set(creature_id, creature)
+	}
+	return nil
 }
@@ -1,5 +1,9 @@
 package world
 
+import (
+	"pmap"
+)
+
 // Each creature has at most one actor.
 // Each actor has at most one creature.
 
@@ -24,101 +28,128 @@ func (self CreatureActorError) Error() string {
 }
 
 type CreatureActor struct {
-	// Upper case for debugging and for Gob, not so that you use it.
-	Ca map[CreatureId]ActorID
-	Ac map[ActorID]CreatureId
+	// Both are persistent maps, updating them does not copy them.
+	ca pmap.Map // CreatureId -> ActorID
+	ac pmap.Map // ActorID -> CreatureId
 }
 
 func MakeCreatureActor() CreatureActor {
-	const CAPACITY = 0
-	return CreatureActor{
-		Ca: make(map[CreatureId]ActorID, CAPACITY),
-		Ac: make(map[ActorID]CreatureId, CAPACITY),
-	}
+	return CreatureActor{}
 }
 
 func (self CreatureActor) IsSane() error {
-	if len(self.Ca) != len(self.Ac) {
+	if self.ca.Len() != self.ac.Len() {
 		return CA_INSANE_LENGTH
 	}
-	for Ca_c, Ca_l := range self.Ca {
-		Ac_c, ok := self.Ac[Ca_l]
-		if !ok {
-			return CA_INSANE_BIJECTION
+	var err error
+	self.ca.ForEach(func(creature pmap.Key, actor interface{}) {
+		back, ok := self.ac.Get(actor.(ActorID))
+		if !ok || back != creature {
+			err = CA_INSANE_BIJECTION
 		}
-		if Ac_c != Ca_c {
-			return CA_INSANE_BIJECTION
+	})
+	self.ac.ForEach(func(actor pmap.Key, creature interface{}) {
+		back, ok := self.ca.Get(creature.(CreatureId))
+		if !ok || back != actor {
+			err = CA_INSANE_BIJECTION
 		}
-	}
-	for Ac_l, Ac_c := range self.Ac {
-		Ca_l, ok := self.Ca[Ac_c]
-		if !ok {
-			return CA_INSANE_BIJECTION
-		}
-		if Ca_l != Ac_l {
-			return CA_INSANE_BIJECTION
-		}
-	}
-	return nil
+	})
+	return err
 }
 
 func (self CreatureActor) GetCreature(actor_id ActorID) (CreatureId, bool) {
-	creature, ok := self.Ac[actor_id]
-	return creature, ok
+	creature, ok := self.ac.Get(actor_id)
+	if !ok {
+		return 0, false
+	}
+	return creature.(CreatureId), true
 }
 
 func (self CreatureActor) GetActor(creature_id CreatureId) (ActorID, bool) {
-	actor_id, ok := self.Ca[creature_id]
-	return actor_id, ok
+	actor_id, ok := self.ca.Get(creature_id)
+	if !ok {
+		return 0, false
+	}
+	return actor_id.(ActorID), true
+}
+
+func (self CreatureActor) Len() int {
+	return self.ca.Len()
+}
+
+// ForEach calls f for each creature and its actor.
+func (self CreatureActor) ForEach(f func(creature_id CreatureId, actor_id ActorID)) {
+	self.ca.ForEach(func(creature pmap.Key, actor interface{}) {
+		f(creature.(CreatureId), actor.(ActorID))
+	})
 }
 
+// Copy is kept for symmetry with the other collections.  CreatureActor is
+// never modified in place, so a copy is the value itself.
 func (self CreatureActor) Copy() CreatureActor {
-	n_items := len(self.Ca)
-	result := CreatureActor{
-		Ca: make(map[CreatureId]ActorID, n_items),
-		Ac: make(map[ActorID]CreatureId, n_items),
-	}
-	for c, a := range self.Ca {
-		result.Ca[c] = a
-		result.Ac[a] = c
-	}
-	return result
+	return self
 }
 
 func (self CreatureActor) Add(creature_id CreatureId, actor_id ActorID) (CreatureActor, error) {
 	// First make sure that the creature or actor aren't already taken.
-	_, ok := self.Ca[creature_id]
+	_, ok := self.ca.Get(creature_id)
 	if ok {
 		return self, CA_CREATURE_ALREADY_IN
 	}
-	_, ok = self.Ac[actor_id]
+	_, ok = self.ac.Get(actor_id)
 	if ok {
 		return self, CA_ACTOR_ALREADY_IN
 	}
-	result := self.Copy()
-	result.Ca[creature_id] = actor_id
-	result.Ac[actor_id] = creature_id
+	result := self
+	result.ca = result.ca.Set(creature_id, actor_id)
+	result.ac = result.ac.Set(actor_id, creature_id)
 	return result, nil
 }
 
 func (self CreatureActor) RemoveCreature(creature_id CreatureId) (CreatureActor, bool) {
-	result := self.Copy()
-	actor_id, ok := result.Ca[creature_id]
+	actor_id, ok := self.GetActor(creature_id)
 	if !ok {
 		return self, false
 	}
-	delete(result.Ca, creature_id)
-	delete(result.Ac, actor_id)
+	result := self
+	result.ca = result.ca.Delete(creature_id)
+	result.ac = result.ac.Delete(actor_id)
 	return result, true
 }
 
 func (self CreatureActor) RemoveActor(actor_id ActorID) (CreatureActor, bool) {
-	result := self.Copy()
-	creature_id, ok := result.Ac[actor_id]
+	creature_id, ok := self.GetCreature(actor_id)
 	if !ok {
 		return self, false
 	}
-	delete(result.Ca, creature_id)
-	delete(result.Ac, actor_id)
+	result := self
+	result.ca = result.ca.Delete(creature_id)
+	result.ac = result.ac.Delete(actor_id)
 	return result, true
 }
+
+// GobEncode encodes the creature to actor map only, the other one can be
+// deduced from it.
+func (self CreatureActor) GobEncode() ([]byte, error) {
+	ca := make(map[CreatureId]ActorID, self.Len())
+	self.ForEach(func(creature_id CreatureId, actor_id ActorID) {
+		ca[creature_id] = actor_id
+	})
+	return gobEncode(ca)
+}
+
+func (self *CreatureActor) GobDecode(data []byte) error {
+	var ca map[CreatureId]ActorID
+	if err := gobDecode(data, &ca); err != nil {
+		return err
+	}
+	*self = MakeCreatureActor()
+	for creature_id, actor_id := range ca {
+		var err error
+		*self, err = self.Add(creature_id, actor_id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
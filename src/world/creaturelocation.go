@@ -1,5 +1,9 @@
 package world
 
+import (
+	"pmap"
+)
+
 // Each creature has at most one location.
 // Each location has at most one creature.
 
@@ -30,106 +34,108 @@ func (self CreatureLocationError) Error() string {
 }
 
 type CreatureLocation struct {
-	Cl map[CreatureId]Location
-	Lc map[Location]CreatureId
+	// Both are persistent maps, updating them does not copy them.
+	cl pmap.Map // CreatureId -> Location
+	lc pmap.Map // Location -> CreatureId
 }
 
 func MakeCreatureLocation() CreatureLocation {
-	const CAPACITY = 0
-	return CreatureLocation{
-		Cl: make(map[CreatureId]Location, CAPACITY),
-		Lc: make(map[Location]CreatureId, CAPACITY),
-	}
+	return CreatureLocation{}
 }
 
 func (self CreatureLocation) IsSane() error {
-	if len(self.Cl) != len(self.Lc) {
+	if self.cl.Len() != self.lc.Len() {
 		return CL_INSANE_LENGTH
 	}
-	for Cl_c, Cl_l := range self.Cl {
-		Lc_c, ok := self.Lc[Cl_l]
-		if !ok {
-			return CL_INSANE_BIJECTION
+	var err error
+	self.cl.ForEach(func(creature pmap.Key, location interface{}) {
+		back, ok := self.lc.Get(location.(Location))
+		if !ok || back != creature {
+			err = CL_INSANE_BIJECTION
 		}
-		if Lc_c != Cl_c {
-			return CL_INSANE_BIJECTION
+	})
+	self.lc.ForEach(func(location pmap.Key, creature interface{}) {
+		back, ok := self.cl.Get(creature.(CreatureId))
+		if !ok || back != location {
+			err = CL_INSANE_BIJECTION
 		}
-	}
-	for Lc_l, Lc_c := range self.Lc {
-		Cl_l, ok := self.Cl[Lc_c]
-		if !ok {
-			return CL_INSANE_BIJECTION
-		}
-		if Cl_l != Lc_l {
-			return CL_INSANE_BIJECTION
-		}
-	}
-	return nil
+	})
+	return err
 }
 
 func (self CreatureLocation) GetCreature(loc Location) (CreatureId, bool) {
-	creature, ok := self.Lc[loc]
-	return creature, ok
+	creature, ok := self.lc.Get(loc)
+	if !ok {
+		return 0, false
+	}
+	return creature.(CreatureId), true
 }
 
 func (self CreatureLocation) GetLocation(creature_id CreatureId) (Location, bool) {
-	location, ok := self.Cl[creature_id]
-	return location, ok
+	location, ok := self.cl.Get(creature_id)
+	if !ok {
+		return Location{}, false
+	}
+	return location.(Location), true
+}
+
+func (self CreatureLocation) Len() int {
+	return self.cl.Len()
+}
+
+// ForEach calls f for each creature and its location.
+func (self CreatureLocation) ForEach(f func(creature_id CreatureId, location Location)) {
+	self.cl.ForEach(func(creature pmap.Key, location interface{}) {
+		f(creature.(CreatureId), location.(Location))
+	})
 }
 
+// Copy is kept for symmetry with the other collections.  CreatureLocation is
+// never modified in place, so a copy is the value itself.
 func (self CreatureLocation) Copy() CreatureLocation {
-	n_items := len(self.Cl)
-	result := CreatureLocation{
-		Cl: make(map[CreatureId]Location, n_items),
-		Lc: make(map[Location]CreatureId, n_items),
-	}
-	for c, l := range self.Cl {
-		result.Cl[c] = l
-		result.Lc[l] = c
-	}
-	return result
+	return self
 }
 
 func (self CreatureLocation) Add(creature_id CreatureId, location Location) (CreatureLocation, error) {
 	// First make sure that the creature or location aren't already taken.
-	_, ok := self.Cl[creature_id]
+	_, ok := self.cl.Get(creature_id)
 	if ok {
 		return self, CL_CREATURE_ALREADY_IN
 	}
-	_, ok = self.Lc[location]
+	_, ok = self.lc.Get(location)
 	if ok {
 		return self, CL_LOCATION_ALREADY_IN
 	}
-	result := self.Copy()
-	result.Cl[creature_id] = location
-	result.Lc[location] = creature_id
+	result := self
+	result.cl = result.cl.Set(creature_id, location)
+	result.lc = result.lc.Set(location, creature_id)
 	return result, nil
 }
 
 func (self CreatureLocation) RemoveCreature(creature_id CreatureId) (CreatureLocation, bool) {
-	result := self.Copy()
-	location, ok := result.Cl[creature_id]
+	location, ok := self.GetLocation(creature_id)
 	if !ok {
 		return self, false
 	}
-	delete(result.Cl, creature_id)
-	delete(result.Lc, location)
+	result := self
+	result.cl = result.cl.Delete(creature_id)
+	result.lc = result.lc.Delete(location)
 	return result, true
 }
 
 func (self CreatureLocation) RemoveLocation(location Location) (CreatureLocation, bool) {
-	result := self.Copy()
-	creature_id, ok := result.Lc[location]
+	creature_id, ok := self.GetCreature(location)
 	if !ok {
 		return self, false
 	}
-	delete(result.Cl, creature_id)
-	delete(result.Lc, location)
+	result := self
+	result.cl = result.cl.Delete(creature_id)
+	result.lc = result.lc.Delete(location)
 	return result, true
 }
 
 func (self CreatureLocation) Move(creature_id CreatureId, location Location) (CreatureLocation, error) {
-	crt_location, ok := self.Cl[creature_id]
+	crt_location, ok := self.GetLocation(creature_id)
 	if !ok {
 		// We do not know that creature so we cannot move it.  Add it first.
 		return self, CL_NOT_FOUND
@@ -141,14 +147,39 @@ func (self CreatureLocation) Move(creature_id CreatureId, location Location) (Cr
 		// logical error from the programmer.
 		return self, CL_NOOP
 	}
-	_, ok = self.Lc[location]
+	_, ok = self.lc.Get(location)
 	if ok {
 		// There already is a creature there, cannot move.
 		return self, CL_OCCUPIED
 	}
-	result := self.Copy()
-	result.Cl[creature_id] = location
-	result.Lc[location] = creature_id
-	delete(result.Lc, crt_location)
+	result := self
+	result.cl = result.cl.Set(creature_id, location)
+	result.lc = result.lc.Delete(crt_location).Set(location, creature_id)
 	return result, nil
 }
+
+// GobEncode encodes the creature to location map only, the other one can be
+// deduced from it.
+func (self CreatureLocation) GobEncode() ([]byte, error) {
+	cl := make(map[CreatureId]Location, self.Len())
+	self.ForEach(func(creature_id CreatureId, location Location) {
+		cl[creature_id] = location
+	})
+	return gobEncode(cl)
+}
+
+func (self *CreatureLocation) GobDecode(data []byte) error {
+	var cl map[CreatureId]Location
+	if err := gobDecode(data, &cl); err != nil {
+		return err
+	}
+	*self = MakeCreatureLocation()
+	for creature_id, location := range cl {
+		var err error
+		*self, err = self.Add(creature_id, location)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,856 @@
+package world
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// A Delta is a change to the World: a creature moved, a door opened, an item
+// picked up...  Actions do not modify the World themselves, they compute the
+// Deltas that describe their effect.  The Deltas can then be looked at, sent
+// over the network, saved for a replay, and applied.
+//
+// Applying a Delta checks that the World is in the state the Delta expects:
+// moving a creature from a tile fails if the creature is not there.  A Delta
+// never checks the rules of the game though, this is the job of the actions.
+type Delta interface {
+	Apply(World) (World, error)
+	String() string
+}
+
+// Deltas that can be undone implement Reversible.  Applying a Delta and then
+// its reverse leaves the World as it was.
+type Reversible interface {
+	Delta
+	Reverse() Delta
+}
+
+func init() {
+	gob.Register(Deltas{})
+	gob.Register(DeltaRng{})
+	gob.Register(DeltaCreatureMoved{})
+	gob.Register(DeltaCreatureTurned{})
+	gob.Register(DeltaCreatureTravelled{})
+	gob.Register(DeltaCreatureStats{})
+	gob.Register(DeltaCreatureDied{})
+	gob.Register(DeltaBuildingChanged{})
+	gob.Register(DeltaDoorChanged{})
+	gob.Register(DeltaItemMoved{})
+	gob.Register(DeltaItemTravelled{})
+	gob.Register(DeltaMechanismChanged{})
+	gob.Register(DeltaTriggerSwitched{})
+	gob.Register(DeltaProjectileLaunched{})
+	gob.Register(DeltaProjectileMoved{})
+	gob.Register(DeltaProjectileGone{})
+	gob.Register(DeltaLightChanged{})
+	gob.Register(DeltaFloorEffectChanged{})
+	gob.Register(DeltaLevelAdded{})
+	gob.Register(DeltaCreaturePlaced{})
+	gob.Register(DeltaItemPlaced{})
+	gob.Register(DeltaMechanismPlaced{})
+	gob.Register(DeltaTriggerPlaced{})
+	gob.Register(DeltaTriggerWired{})
+	gob.Register(DeltaLightPlaced{})
+	gob.Register(DeltaPropPlaced{})
+	gob.Register(DeltaFloorEffectPlaced{})
+}
+
+// Deltas is a sequence of Deltas, applied in order.  It is a Delta itself.
+type Deltas []Delta
+
+// Combine joins several Deltas into one.  The nil Deltas are left out and the
+// sequences are flattened.
+func Combine(deltas ...Delta) Delta {
+	combined := Deltas{}
+	for _, delta := range deltas {
+		switch delta := delta.(type) {
+		case nil:
+		case Deltas:
+			combined = append(combined, Combine(delta...).(Deltas)...)
+		default:
+			combined = append(combined, delta)
+		}
+	}
+	return combined
+}
+
+// Apply applies the Deltas one after the other.  Either all of them are
+// applied, or none.
+func (self Deltas) Apply(world World) (World, error) {
+	result := world
+	for _, delta := range self {
+		var err error
+		result, err = delta.Apply(result)
+		if err != nil {
+			return world, err
+		}
+	}
+	return result, nil
+}
+
+func (self Deltas) String() string {
+	return fmt.Sprint([]Delta(self))
+}
+
+// Reverse returns the Delta that undoes the given one, if it can be undone.
+// Sequences can be undone when all their Deltas can.
+func Reverse(delta Delta) (Delta, bool) {
+	switch delta := delta.(type) {
+	case Deltas:
+		reversed := make(Deltas, len(delta))
+		for i, inner := range delta {
+			reverse, ok := Reverse(inner)
+			if !ok {
+				return nil, false
+			}
+			reversed[len(delta)-1-i] = reverse
+		}
+		return reversed, true
+	case Reversible:
+		return delta.Reverse(), true
+	}
+	return nil, false
+}
+
+// WriteDelta encodes a Delta with gob.
+func WriteDelta(w io.Writer, delta Delta) error {
+	return gob.NewEncoder(w).Encode(&delta)
+}
+
+// ReadDelta decodes a Delta written by WriteDelta.
+func ReadDelta(r io.Reader) (Delta, error) {
+	var delta Delta
+	err := gob.NewDecoder(r).Decode(&delta)
+	return delta, err
+}
+
+type DeltaError int
+
+const (
+	DELTA_NO_LEVEL = DeltaError(iota)
+	DELTA_NO_CREATURE
+	DELTA_CREATURE_MOVED
+	DELTA_CREATURE_TURNED
+	DELTA_CREATURE_CHANGED
+	DELTA_BUILDING_CHANGED
+	DELTA_ITEM_MOVED
+	DELTA_SLOT_TAKEN
+	DELTA_RNG_CHANGED
+	DELTA_MECHANISM_CHANGED
+	DELTA_TRIGGER_SWITCHED
+	DELTA_PROJECTILE_CHANGED
+	DELTA_LIGHT_CHANGED
+	DELTA_FLOOR_EFFECT_CHANGED
+	DELTA_ID_TAKEN
+	DELTA_LEVEL_CHANGED
+	DELTA_TRIGGER_CHANGED
+	DELTA_PROP_CHANGED
+	DELTA_UNSETTLED
+)
+
+var delta_error_text = map[DeltaError]string{
+	DELTA_NO_LEVEL:             "level not found",
+	DELTA_NO_CREATURE:          "creature not found",
+	DELTA_CREATURE_MOVED:       "creature not where expected",
+	DELTA_CREATURE_TURNED:      "creature not facing the expected direction",
+	DELTA_CREATURE_CHANGED:     "creature statistics not as expected",
+	DELTA_BUILDING_CHANGED:     "building not as expected",
+	DELTA_ITEM_MOVED:           "item not where expected",
+	DELTA_SLOT_TAKEN:           "equipment slot already taken",
+	DELTA_RNG_CHANGED:          "random number generator not as expected",
+	DELTA_MECHANISM_CHANGED:    "mechanism not as expected",
+	DELTA_TRIGGER_SWITCHED:     "trigger missing or already switched",
+	DELTA_PROJECTILE_CHANGED:   "projectile not as expected",
+	DELTA_LIGHT_CHANGED:        "light not as expected",
+	DELTA_FLOOR_EFFECT_CHANGED: "floor effect not as expected",
+	DELTA_ID_TAKEN:             "identifier already taken",
+	DELTA_LEVEL_CHANGED:        "level not empty",
+	DELTA_TRIGGER_CHANGED:      "trigger not as expected",
+	DELTA_PROP_CHANGED:         "prop not as expected",
+	DELTA_UNSETTLED:            "reactions go on and on",
+}
+
+func (self DeltaError) Error() string {
+	return delta_error_text[self]
+}
+
+// deltaLevel returns the level a Delta applies to.
+func (world World) deltaLevel(level_id LevelId) (Level, error) {
+	level, ok := world.Levels[level_id]
+	if !ok {
+		return level, DELTA_NO_LEVEL
+	}
+	return level, nil
+}
+
+// DeltaLevelAdded adds a new, empty level to the World, or removes it again.
+// Only a level that is still empty can be removed.
+type DeltaLevelAdded struct {
+	Level LevelId
+	Added bool
+}
+
+func (self DeltaLevelAdded) Apply(world World) (World, error) {
+	if self.Added {
+		if _, ok := world.Levels[self.Level]; ok {
+			return world, DELTA_ID_TAKEN
+		}
+		return world.SetLevel(self.Level, MakeLevel(self.Level)), nil
+	}
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	var sum, empty hashSum
+	level.hash(&sum, self.Level)
+	MakeLevel(self.Level).hash(&empty, self.Level)
+	if sum != empty {
+		return world, DELTA_LEVEL_CHANGED
+	}
+	world.Levels = world.Levels.Delete(self.Level)
+	return world, nil
+}
+
+func (self DeltaLevelAdded) Reverse() Delta {
+	return DeltaLevelAdded{self.Level, !self.Added}
+}
+
+func (self DeltaLevelAdded) String() string {
+	if self.Added {
+		return fmt.Sprintf("level %v is added", self.Level)
+	}
+	return fmt.Sprintf("level %v is removed", self.Level)
+}
+
+// DeltaRng records a roll of the dice: the random number generator of one
+// stream of the World changes state.
+type DeltaRng struct {
+	Stream Stream
+	Before Rng
+	After  Rng
+}
+
+func (self DeltaRng) Apply(world World) (World, error) {
+	if self.Stream < 0 || self.Stream >= STREAMS || world.Rng(self.Stream) != self.Before {
+		return world, DELTA_RNG_CHANGED
+	}
+	return world.SetRng(self.Stream, self.After), nil
+}
+
+func (self DeltaRng) Reverse() Delta {
+	return DeltaRng{self.Stream, self.After, self.Before}
+}
+
+func (self DeltaRng) String() string {
+	return fmt.Sprintf("%v dice rolled", self.Stream)
+}
+
+// DeltaCreatureMoved moves a creature within its level.
+type DeltaCreatureMoved struct {
+	Level    LevelId
+	Creature CreatureId
+	From     Location
+	To       Location
+}
+
+func (self DeltaCreatureMoved) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	location, ok := level.CreatureLocation.GetLocation(self.Creature)
+	if !ok {
+		return world, DELTA_NO_CREATURE
+	}
+	if location != self.From {
+		return world, DELTA_CREATURE_MOVED
+	}
+	level.CreatureLocation, err = level.CreatureLocation.Move(self.Creature, self.To)
+	if err != nil {
+		return world, err
+	}
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaCreatureMoved) Reverse() Delta {
+	return DeltaCreatureMoved{self.Level, self.Creature, self.To, self.From}
+}
+
+func (self DeltaCreatureMoved) String() string {
+	return fmt.Sprintf("creature %v moves from %v to %v", self.Creature, self.From, self.To)
+}
+
+// DeltaCreatureTurned changes where a creature faces.
+type DeltaCreatureTurned struct {
+	Level    LevelId
+	Creature CreatureId
+	From     AbsoluteDirection
+	To       AbsoluteDirection
+}
+
+func (self DeltaCreatureTurned) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	creature, ok := level.Creatures.Get(self.Creature)
+	if !ok {
+		return world, DELTA_NO_CREATURE
+	}
+	if creature.F.Value() != self.From.Value() {
+		return world, DELTA_CREATURE_TURNED
+	}
+	creature.F = self.To
+	level.Creatures = level.Creatures.Set(self.Creature, creature)
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaCreatureTurned) Reverse() Delta {
+	return DeltaCreatureTurned{self.Level, self.Creature, self.To, self.From}
+}
+
+func (self DeltaCreatureTurned) String() string {
+	return fmt.Sprintf(
+		"creature %v turns from %v to %v",
+		self.Creature, self.From.Value(), self.To.Value(),
+	)
+}
+
+// DeltaCreatureTravelled moves a creature to another position, possibly in
+// another level, with everything it carries.
+type DeltaCreatureTravelled struct {
+	Creature CreatureId
+	From     LevelPosition
+	To       LevelPosition
+}
+
+func (self DeltaCreatureTravelled) Apply(world World) (World, error) {
+	level_id, ok := world.CreatureLevel(self.Creature)
+	if !ok {
+		return world, DELTA_NO_CREATURE
+	}
+	location, _ := world.Levels[level_id].CreatureLocation.GetLocation(self.Creature)
+	creature, _ := world.Levels[level_id].Creatures.Get(self.Creature)
+	if level_id != self.From.Level || location != self.From.Location {
+		return world, DELTA_CREATURE_MOVED
+	}
+	if creature.F.Value() != self.From.F.Value() {
+		return world, DELTA_CREATURE_TURNED
+	}
+	return world.MoveCreature(self.Creature, self.To)
+}
+
+func (self DeltaCreatureTravelled) Reverse() Delta {
+	return DeltaCreatureTravelled{self.Creature, self.To, self.From}
+}
+
+func (self DeltaCreatureTravelled) String() string {
+	return fmt.Sprintf(
+		"creature %v travels from level %v %v to level %v %v",
+		self.Creature,
+		self.From.Level, self.From.Location,
+		self.To.Level, self.To.Location,
+	)
+}
+
+// DeltaCreatureStats changes the statistics of a creature: damage, healing...
+type DeltaCreatureStats struct {
+	Level    LevelId
+	Creature CreatureId
+	Before   Stats
+	After    Stats
+}
+
+func (self DeltaCreatureStats) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	creature, ok := level.Creatures.Get(self.Creature)
+	if !ok {
+		return world, DELTA_NO_CREATURE
+	}
+	if creature.Stats != self.Before {
+		return world, DELTA_CREATURE_CHANGED
+	}
+	creature.Stats = self.After
+	level.Creatures = level.Creatures.Set(self.Creature, creature)
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaCreatureStats) Reverse() Delta {
+	return DeltaCreatureStats{self.Level, self.Creature, self.After, self.Before}
+}
+
+func (self DeltaCreatureStats) String() string {
+	return fmt.Sprintf(
+		"creature %v goes from %v to %v hit points",
+		self.Creature, self.Before.Hp, self.After.Hp,
+	)
+}
+
+// DeltaCreatureDied removes a dead creature from its level.  What it carried
+// falls on the ground.  Death cannot be reversed.
+type DeltaCreatureDied struct {
+	Level    LevelId
+	Creature CreatureId
+}
+
+func (self DeltaCreatureDied) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	if _, ok := level.Creatures.Get(self.Creature); !ok {
+		return world, DELTA_NO_CREATURE
+	}
+	travellers := world.Travellers.leave(level, self.Creature)
+	level, err = level.KillCreature(self.Creature)
+	if err != nil {
+		return world, err
+	}
+	world.Travellers = travellers
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaCreatureDied) String() string {
+	return fmt.Sprintf("creature %v dies", self.Creature)
+}
+
+// DeltaCreaturePlaced puts a new creature in a level, along with its actor,
+// or takes it away again.  This is how the editor places monsters.  Only a
+// creature that is still as it was placed can be taken away: on the same tile,
+// unharmed and carrying nothing.  Taking it away gives back its identifiers
+// when no other was handed out since, so that placing a creature and taking it
+// away leaves the level as it was.  The other Placed Deltas do the same.
+type DeltaCreaturePlaced struct {
+	Level    LevelId
+	Creature CreatureId
+	Actor    ActorID
+	Location Location
+	Value    Creature
+	Placed   bool
+}
+
+func (self DeltaCreaturePlaced) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	if self.Placed {
+		_, creature_taken := level.Creatures.Get(self.Creature)
+		_, actor_taken := level.Actors.Get(self.Actor)
+		if creature_taken || actor_taken {
+			return world, DELTA_ID_TAKEN
+		}
+		if level.CreatureLocation, err = level.CreatureLocation.Add(self.Creature, self.Location); err != nil {
+			return world, err
+		}
+		if level.CreatureActor, err = level.CreatureActor.Add(self.Creature, self.Actor); err != nil {
+			return world, err
+		}
+		level.Creatures = level.Creatures.Set(self.Creature, self.Value)
+		if self.Creature >= level.Creatures.Next_id {
+			level.Creatures.Next_id = self.Creature + 1
+		}
+		level.Actors = level.Actors.reserve(self.Actor).Insert(self.Actor, MakeActor())
+		return world.SetLevel(self.Level, level), nil
+	}
+	creature, ok := level.Creatures.Get(self.Creature)
+	if !ok {
+		return world, DELTA_NO_CREATURE
+	}
+	location, _ := level.CreatureLocation.GetLocation(self.Creature)
+	actor_id, _ := level.CreatureActor.GetActor(self.Creature)
+	if location != self.Location || actor_id != self.Actor {
+		return world, DELTA_CREATURE_MOVED
+	}
+	if creature != self.Value || !level.Inventories.Get(self.Creature).IsEmpty() {
+		return world, DELTA_CREATURE_CHANGED
+	}
+	level.Creatures = level.Creatures.Delete(self.Creature)
+	if self.Creature+1 == level.Creatures.Next_id {
+		level.Creatures.Next_id = self.Creature
+	}
+	level.Actors = level.Actors.Delete(self.Actor).release(self.Actor)
+	level.CreatureActor, _ = level.CreatureActor.RemoveCreature(self.Creature)
+	level.CreatureLocation, _ = level.CreatureLocation.RemoveCreature(self.Creature)
+	if index := level.ActorSchedule.PosActorID(self.Actor); index != -1 {
+		level.ActorSchedule, _ = level.ActorSchedule.Remove(level.ActorSchedule.Actor_times[index])
+	}
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaCreaturePlaced) Reverse() Delta {
+	reverse := self
+	reverse.Placed = !self.Placed
+	return reverse
+}
+
+func (self DeltaCreaturePlaced) String() string {
+	if self.Placed {
+		return fmt.Sprintf("creature %v is placed at %v", self.Creature, self.Location)
+	}
+	return fmt.Sprintf("creature %v is taken away from %v", self.Creature, self.Location)
+}
+
+// A Layer is one of the collections of Buildings of a Level.
+type Layer int
+
+const (
+	LAYER_FLOORS = Layer(iota)
+	LAYER_CEILINGS
+	LAYER_COLUMNS
+	LAYER_DOORS
+	LAYER_WALLS_EAST // The walls come last, sorted by facing.
+	LAYER_WALLS_NORTH
+	LAYER_WALLS_WEST
+	LAYER_WALLS_SOUTH
+)
+
+// WallLayer returns the layer holding the walls with the given facing.
+func WallLayer(facing AbsoluteDirection) Layer {
+	return LAYER_WALLS_EAST + Layer(facing.Value())
+}
+
+// buildings returns the collection of Buildings of the level for a layer.
+func (self *Level) buildings(layer Layer) *Buildings {
+	switch layer {
+	case LAYER_FLOORS:
+		return &self.Floors
+	case LAYER_CEILINGS:
+		return &self.Ceilings
+	case LAYER_COLUMNS:
+		return &self.Columns
+	case LAYER_DOORS:
+		return &self.Doors
+	}
+	return &self.Walls[layer-LAYER_WALLS_EAST]
+}
+
+// DeltaBuildingChanged puts, replaces or removes a building.  A nil Before
+// means there was no building, a nil After that there is none anymore.
+type DeltaBuildingChanged struct {
+	Level    LevelId
+	Layer    Layer
+	Location Location
+	Before   Building
+	After    Building
+}
+
+func (self DeltaBuildingChanged) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	buildings := level.buildings(self.Layer)
+	x, y := self.Location.X, self.Location.Y
+	building, _ := buildings.Get(x, y)
+	if building != self.Before {
+		return world, DELTA_BUILDING_CHANGED
+	}
+	if self.After == nil {
+		*buildings = buildings.Delete(x, y)
+	} else {
+		*buildings = buildings.Set(x, y, self.After)
+	}
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaBuildingChanged) Reverse() Delta {
+	return DeltaBuildingChanged{self.Level, self.Layer, self.Location, self.After, self.Before}
+}
+
+func (self DeltaBuildingChanged) String() string {
+	return fmt.Sprintf("building changes at %v", self.Location)
+}
+
+// BuildingDeltas returns the Deltas that change the buildings of a level into
+// those of another version of it.  Only the given locations are compared, in
+// all the layers.
+func BuildingDeltas(level_id LevelId, before, after Level, locations ...Location) Delta {
+	deltas := Deltas{}
+	for _, location := range locations {
+		for layer := LAYER_FLOORS; layer <= LAYER_WALLS_SOUTH; layer++ {
+			was, _ := before.buildings(layer).Get(location.X, location.Y)
+			now, _ := after.buildings(layer).Get(location.X, location.Y)
+			if was != now {
+				deltas = append(deltas, DeltaBuildingChanged{level_id, layer, location, was, now})
+			}
+		}
+	}
+	return deltas
+}
+
+// DeltaDoorChanged opens, closes, locks or unlocks a door.  Both sides of a
+// door in a wall change together.
+type DeltaDoorChanged struct {
+	Level  LevelId
+	Slot   DoorSlot
+	Before Door
+	After  Door
+}
+
+func (self DeltaDoorChanged) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	door, ok := level.GetDoor(self.Slot)
+	if !ok || door != self.Before {
+		return world, DELTA_BUILDING_CHANGED
+	}
+	return world.SetLevel(self.Level, level.SetDoor(self.Slot, self.After)), nil
+}
+
+func (self DeltaDoorChanged) Reverse() Delta {
+	return DeltaDoorChanged{self.Level, self.Slot, self.After, self.Before}
+}
+
+func (self DeltaDoorChanged) String() string {
+	return fmt.Sprintf(
+		"door at %v goes from %v to %v",
+		self.Slot.Location, self.Before.State(), self.After.State(),
+	)
+}
+
+// An ItemPlace is where an item is: on the ground, in the backpack of a
+// creature, equipped by it, or flying.
+type ItemPlace struct {
+	On_ground  bool
+	Location   Location // Where the item lies, when on the ground.
+	In_flight  bool
+	Projectile ActorID    // What carries the item, when in flight.
+	Carrier    CreatureId // Who has the item, when neither on the ground nor flying.
+	Slot       EquipSlot  // EQUIP_NONE for the backpack.
+}
+
+func OnGround(location Location) ItemPlace {
+	return ItemPlace{On_ground: true, Location: location}
+}
+
+func InBackpack(creature_id CreatureId) ItemPlace {
+	return ItemPlace{Carrier: creature_id}
+}
+
+func EquippedBy(creature_id CreatureId, slot EquipSlot) ItemPlace {
+	return ItemPlace{Carrier: creature_id, Slot: slot}
+}
+
+func InFlight(actor_id ActorID) ItemPlace {
+	return ItemPlace{In_flight: true, Projectile: actor_id}
+}
+
+func (self ItemPlace) String() string {
+	switch {
+	case self.On_ground:
+		return fmt.Sprintf("the ground at %v", self.Location)
+	case self.In_flight:
+		return fmt.Sprintf("projectile %v", self.Projectile)
+	case self.Slot == EQUIP_NONE:
+		return fmt.Sprintf("the backpack of creature %v", self.Carrier)
+	}
+	return fmt.Sprintf("the %v of creature %v", self.Slot, self.Carrier)
+}
+
+// ItemPlace finds where an item of the level is.
+func (self Level) ItemPlace(item_id ItemId) (ItemPlace, bool) {
+	if location, ok := self.ItemLocation.GetLocation(item_id); ok {
+		return OnGround(location), true
+	}
+	var place ItemPlace
+	found := false
+	self.Projectiles.ForEach(func(actor_id ActorID, projectile Projectile) {
+		if projectile.Item == item_id {
+			place, found = InFlight(actor_id), true
+		}
+	})
+	self.Inventories.ForEach(func(creature_id CreatureId, inventory Inventory) {
+		if slot, ok := inventory.Slot(item_id); ok {
+			place, found = EquippedBy(creature_id, slot), true
+		}
+	})
+	return place, found
+}
+
+// DeltaItemMoved moves an item from one place to another within a level.
+// Items put on the ground land on top of the pile.  Items put in a backpack
+// go at its end.
+type DeltaItemMoved struct {
+	Level LevelId
+	Item  ItemId
+	From  ItemPlace
+	To    ItemPlace
+}
+
+func (self DeltaItemMoved) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	if place, ok := level.ItemPlace(self.Item); !ok || place != self.From {
+		return world, DELTA_ITEM_MOVED
+	}
+	// Take the item.
+	if self.From.On_ground {
+		level.ItemLocation, err = level.ItemLocation.Remove(self.Item)
+	} else if self.From.In_flight {
+		projectile, _ := level.Projectiles.Get(self.From.Projectile)
+		projectile.Item = NO_ITEM
+		level.Projectiles = level.Projectiles.Set(self.From.Projectile, projectile)
+	} else {
+		var inventory Inventory
+		inventory, err = level.Inventories.Get(self.From.Carrier).Remove(self.Item)
+		level.Inventories = level.Inventories.Set(self.From.Carrier, inventory)
+	}
+	if err != nil {
+		return world, err
+	}
+	// Put it.
+	if self.To.On_ground {
+		level.ItemLocation, err = level.ItemLocation.Add(self.Item, self.To.Location)
+		if err != nil {
+			return world, err
+		}
+		return world.SetLevel(self.Level, level), nil
+	}
+	if self.To.In_flight {
+		projectile, ok := level.Projectiles.Get(self.To.Projectile)
+		if !ok || projectile.Item != NO_ITEM {
+			return world, DELTA_PROJECTILE_CHANGED
+		}
+		projectile.Item = self.Item
+		level.Projectiles = level.Projectiles.Set(self.To.Projectile, projectile)
+		return world.SetLevel(self.Level, level), nil
+	}
+	if _, ok := level.Creatures.Get(self.To.Carrier); !ok {
+		return world, DELTA_NO_CREATURE
+	}
+	inventory := level.Inventories.Get(self.To.Carrier)
+	if self.To.Slot == EQUIP_NONE {
+		inventory = inventory.Carry(self.Item)
+	} else if inventory.Equipped[self.To.Slot] != NO_ITEM {
+		return world, DELTA_SLOT_TAKEN
+	} else {
+		inventory.Equipped[self.To.Slot] = self.Item
+	}
+	level.Inventories = level.Inventories.Set(self.To.Carrier, inventory)
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaItemMoved) Reverse() Delta {
+	return DeltaItemMoved{self.Level, self.Item, self.To, self.From}
+}
+
+func (self DeltaItemMoved) String() string {
+	return fmt.Sprintf("item %v moves from %v to %v", self.Item, self.From, self.To)
+}
+
+// DeltaItemTravelled moves an item lying on the ground to the ground of
+// another place of the World, possibly in another level.  It lands on top of
+// the pile.
+type DeltaItemTravelled struct {
+	Item ItemId
+	From LevelLocation
+	To   LevelLocation
+}
+
+func (self DeltaItemTravelled) Apply(world World) (World, error) {
+	src, err := world.deltaLevel(self.From.Level)
+	if err != nil {
+		return world, err
+	}
+	if place, ok := src.ItemPlace(self.Item); !ok || place != OnGround(self.From.Location) {
+		return world, DELTA_ITEM_MOVED
+	}
+	item, _ := src.Items.Get(self.Item)
+	src.Items = src.Items.Delete(self.Item)
+	src.ItemLocation, err = src.ItemLocation.Remove(self.Item)
+	if err != nil {
+		return world, err
+	}
+	result := world.SetLevel(self.From.Level, src)
+	dst, err := result.deltaLevel(self.To.Level)
+	if err != nil {
+		return world, err
+	}
+	if _, ok := dst.Items.Get(self.Item); ok {
+		return world, DELTA_ITEM_MOVED
+	}
+	dst.Items = dst.Items.Set(self.Item, item)
+	dst.ItemLocation, err = dst.ItemLocation.Add(self.Item, self.To.Location)
+	if err != nil {
+		return world, err
+	}
+	return result.SetLevel(self.To.Level, dst), nil
+}
+
+func (self DeltaItemTravelled) Reverse() Delta {
+	return DeltaItemTravelled{self.Item, self.To, self.From}
+}
+
+func (self DeltaItemTravelled) String() string {
+	return fmt.Sprintf(
+		"item %v travels from level %v %v to level %v %v",
+		self.Item,
+		self.From.Level, self.From.Location,
+		self.To.Level, self.To.Location,
+	)
+}
+
+// DeltaItemPlaced puts a new item on the ground of a level, on top of the
+// pile, or takes it away again from the top of the pile.
+type DeltaItemPlaced struct {
+	Level    LevelId
+	Item     ItemId
+	Location Location
+	Value    Item
+	Placed   bool
+}
+
+func (self DeltaItemPlaced) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	if self.Placed {
+		if _, ok := level.Items.Get(self.Item); ok {
+			return world, DELTA_ID_TAKEN
+		}
+		if level.ItemLocation, err = level.ItemLocation.Add(self.Item, self.Location); err != nil {
+			return world, err
+		}
+		level.Items = level.Items.Set(self.Item, self.Value)
+		if self.Item >= level.Items.Next_id {
+			level.Items.Next_id = self.Item + 1
+		}
+		return world.SetLevel(self.Level, level), nil
+	}
+	item, ok := level.Items.Get(self.Item)
+	top, on_top := level.ItemLocation.Top(self.Location)
+	if !ok || item != self.Value || !on_top || top != self.Item {
+		return world, DELTA_ITEM_MOVED
+	}
+	if level.ItemLocation, err = level.ItemLocation.Remove(self.Item); err != nil {
+		return world, err
+	}
+	level.Items = level.Items.Delete(self.Item)
+	if self.Item+1 == level.Items.Next_id {
+		level.Items.Next_id = self.Item
+	}
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaItemPlaced) Reverse() Delta {
+	reverse := self
+	reverse.Placed = !self.Placed
+	return reverse
+}
+
+func (self DeltaItemPlaced) String() string {
+	if self.Placed {
+		return fmt.Sprintf("item %v is placed at %v", self.Item, self.Location)
+	}
+	return fmt.Sprintf("item %v is taken away from %v", self.Item, self.Location)
+}
@@ -0,0 +1,120 @@
+package world
+
+import (
+	"testing"
+)
+
+// reversibleDeltas returns one Delta of each kind that can be undone, all of
+// them applicable to the sane World.
+func reversibleDeltas(w World) map[string]Delta {
+	level := w.Levels[1]
+	things := findFullThings(level)
+	monster, _ := level.Creatures.Get(things.monster)
+	healed := monster.Stats
+	healed.Hp = healed.Hp.Add(5)
+	rng, _ := w.Rng(STREAM_AI).Next()
+	rock, _ := level.Items.Get(things.rock)
+	launcher, _ := level.Mechanisms.Get(things.launcher)
+	arrow, _ := level.Projectiles.Get(things.arrow)
+	moved_arrow := arrow
+	moved_arrow.Location, moved_arrow.Range = Location{2, 0}, arrow.Range-1
+	var lever_id TriggerId
+	var lever Trigger
+	level.Triggers.ForEach(func(trigger_id TriggerId, trigger Trigger) {
+		lever_id, lever = trigger_id, trigger
+	})
+	var light_id LightId
+	var light LightSource
+	level.Lights.ForEach(func(id LightId, source LightSource) {
+		light_id, light = id, source
+	})
+	moved_light := light
+	moved_light.Anchor.Location = Location{0, 0}
+	var effect_id FloorEffectId
+	var effect FloorEffect
+	level.Effects.ForEach(func(id FloorEffectId, floor_effect FloorEffect) {
+		if floor_effect.Kind == EFFECT_TELEPORTER {
+			effect_id, effect = id, floor_effect
+		}
+	})
+	inactive := effect
+	inactive.Active = false
+	door := MakeDoor(6, DOOR_OPEN, NORTH())
+	closed, _ := door.Close()
+	from := LevelPosition{1, Position{Location{1, 1}, WEST()}}
+	return map[string]Delta{
+		"level added":      DeltaLevelAdded{3, true},
+		"rng":              DeltaRng{STREAM_AI, w.Rng(STREAM_AI), rng},
+		"creature moved":   DeltaCreatureMoved{1, things.monster, Location{1, 1}, Location{1, 0}},
+		"creature turned":  DeltaCreatureTurned{1, things.monster, WEST(), NORTH()},
+		"creature travels": DeltaCreatureTravelled{things.monster, from, LevelPosition{2, Position{Location{5, 5}, EAST()}}},
+		"creature stats":   DeltaCreatureStats{1, things.monster, monster.Stats, healed},
+		"creature placed":  DeltaCreaturePlaced{1, level.Creatures.Next_id, level.Actors.NextIDprivate, Location{0, 0}, MakeCreature(), true},
+		"building changed": DeltaBuildingChanged{1, LAYER_COLUMNS, Location{0, 0}, nil, MakeBaseBuilding(7)},
+		"door changed":     DeltaDoorChanged{1, DoorSlot{Location: Location{2, 0}}, door, closed},
+		"item moved":       DeltaItemMoved{1, things.rock, OnGround(Location{2, 2}), InBackpack(things.monster)},
+		"item travels":     DeltaItemTravelled{things.rock, LevelLocation{1, Location{2, 2}}, LevelLocation{2, Location{5, 5}}},
+		"item placed":      DeltaItemPlaced{1, level.Items.Next_id, Location{2, 2}, rock, true},
+		"effect changed":   DeltaFloorEffectChanged{1, effect_id, effect, inactive},
+		"effect placed":    DeltaFloorEffectPlaced{1, level.Effects.Next_id, MakeSpinner(Location{0, 0}, 2), true},
+		"light changed":    DeltaLightChanged{1, light_id, light, moved_light},
+		"light placed":     DeltaLightPlaced{1, level.Lights.Next_id, moved_light, true},
+		"mechanism change": DeltaMechanismChanged{1, things.launcher, launcher, MakeMechanism(MECHANISM_CRUSHER, launcher.Anchor)},
+		"mechanism placed": DeltaMechanismPlaced{1, level.Actors.NextIDprivate, launcher, true},
+		"projectile moved": DeltaProjectileMoved{1, things.arrow, arrow, moved_arrow},
+		"prop placed":      DeltaPropPlaced{1, level.Props.Next_id, MakeProp(10, Location{0, 0}, ANIMATION_BOB), true},
+		"trigger switched": DeltaTriggerSwitched{1, lever_id, true},
+		"trigger placed":   DeltaTriggerPlaced{1, level.Triggers.Next_id, lever, true},
+		"trigger wired":    DeltaTriggerWired{1, lever_id, lever.Wires, nil},
+		"sequence": Combine(
+			DeltaCreatureTurned{1, things.monster, WEST(), NORTH()},
+			DeltaCreatureMoved{1, things.monster, Location{1, 1}, Location{1, 0}},
+		),
+	}
+}
+
+// Applying a Delta and then its reverse leaves the World as it was, down to
+// the identifiers it hands out next.
+func TestReverse(test *testing.T) {
+	sane := saneWorld(test)
+	for name, delta := range reversibleDeltas(sane) {
+		changed, err := delta.Apply(sane)
+		if err != nil {
+			test.Errorf("%v: %v", name, err)
+			continue
+		}
+		if changed.Hash() == sane.Hash() {
+			test.Errorf("%v: changes nothing.", name)
+		}
+		reverse, ok := Reverse(delta)
+		if !ok {
+			test.Errorf("%v: cannot be undone.", name)
+			continue
+		}
+		restored, err := reverse.Apply(changed)
+		if err != nil {
+			test.Errorf("%v: %v", name, err)
+			continue
+		}
+		if restored.Hash() != sane.Hash() {
+			test.Errorf("%v: undoing it does not give the World back.", name)
+		}
+		if problems := restored.Validate(); len(problems) != 0 {
+			test.Errorf("%v: %v", name, problems)
+		}
+	}
+}
+
+func TestIrreversible(test *testing.T) {
+	things := findFullThings(saneWorld(test).Levels[1])
+	for _, delta := range []Delta{
+		DeltaCreatureDied{1, things.monster},
+		DeltaProjectileLaunched{Level: 1, Actor: things.arrow},
+		DeltaProjectileGone{Level: 1, Actor: things.arrow},
+		Deltas{DeltaLevelAdded{3, true}, DeltaCreatureDied{1, things.monster}},
+	} {
+		if _, ok := Reverse(delta); ok {
+			test.Errorf("%v can be undone.", delta)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package world
+
+// Doors can sit in two kinds of places.  A door in a wall replaces the wall
+// between two tiles; it lives in Level.Walls like any wall.  Since walls have
+// two sides, one for each tile, such a door is made of two Door buildings
+// that are always changed together.  A door in the middle of a tile lives in
+// Level.Doors; it blocks the whole tile when closed.
+
+type DoorState int
+
+const (
+	DOOR_OPEN = DoorState(iota)
+	DOOR_CLOSED
+	DOOR_LOCKED
+	DOOR_BROKEN
+)
+
+var door_state_text = map[DoorState]string{
+	DOOR_OPEN:   "open",
+	DOOR_CLOSED: "closed",
+	DOOR_LOCKED: "locked",
+	DOOR_BROKEN: "broken",
+}
+
+func (self DoorState) String() string {
+	return door_state_text[self]
+}
+
+type DoorError int
+
+const (
+	DOOR_ALREADY_OPEN = DoorError(iota)
+	DOOR_ALREADY_CLOSED
+	DOOR_ALREADY_LOCKED
+	DOOR_NOT_LOCKED
+	DOOR_IS_OPEN
+	DOOR_IS_LOCKED
+	DOOR_IS_BROKEN
+	DOOR_NOT_FOUND
+	DOOR_OBSTRUCTED
+)
+
+var door_error_text = map[DoorError]string{
+	DOOR_ALREADY_OPEN:   "door already open",
+	DOOR_ALREADY_CLOSED: "door already closed",
+	DOOR_ALREADY_LOCKED: "door already locked",
+	DOOR_NOT_LOCKED:     "door not locked",
+	DOOR_IS_OPEN:        "door is open",
+	DOOR_IS_LOCKED:      "door is locked",
+	DOOR_IS_BROKEN:      "door is broken",
+	DOOR_NOT_FOUND:      "no door there",
+	DOOR_OBSTRUCTED:     "something is in the way of the door",
+}
+
+func (self DoorError) Error() string {
+	return door_error_text[self]
+}
+
+type Door struct {
+	BaseBuilding
+	State_ DoorState
+	// Direction in which a door in the middle of a tile is crossed.  Doors in
+	// walls do not use it, the wall gives them their facing.
+	Axis_ AbsoluteDirection
+}
+
+func MakeDoor(model ModelId, state DoorState, axis AbsoluteDirection) Door {
+	var door Door
+	door.Model_ = model
+	door.State_ = state
+	door.Axis_ = axis
+	return door
+}
+
+func (self Door) State() DoorState {
+	return self.State_
+}
+
+func (self Door) Axis() AbsoluteDirection {
+	return self.Axis_
+}
+
+// Open and broken doors let creatures through.
+func (self Door) IsPassable() bool {
+	return self.State_ == DOOR_OPEN || self.State_ == DOOR_BROKEN
+}
+
+func (self Door) Open() (Door, error) {
+	switch self.State_ {
+	case DOOR_OPEN:
+		return self, DOOR_ALREADY_OPEN
+	case DOOR_LOCKED:
+		return self, DOOR_IS_LOCKED
+	case DOOR_BROKEN:
+		return self, DOOR_IS_BROKEN
+	}
+	self.State_ = DOOR_OPEN
+	return self, nil
+}
+
+func (self Door) Close() (Door, error) {
+	switch self.State_ {
+	case DOOR_CLOSED, DOOR_LOCKED:
+		return self, DOOR_ALREADY_CLOSED
+	case DOOR_BROKEN:
+		return self, DOOR_IS_BROKEN
+	}
+	self.State_ = DOOR_CLOSED
+	return self, nil
+}
+
+func (self Door) Lock() (Door, error) {
+	switch self.State_ {
+	case DOOR_OPEN:
+		return self, DOOR_IS_OPEN
+	case DOOR_LOCKED:
+		return self, DOOR_ALREADY_LOCKED
+	case DOOR_BROKEN:
+		return self, DOOR_IS_BROKEN
+	}
+	self.State_ = DOOR_LOCKED
+	return self, nil
+}
+
+func (self Door) Unlock() (Door, error) {
+	switch self.State_ {
+	case DOOR_BROKEN:
+		return self, DOOR_IS_BROKEN
+	case DOOR_OPEN, DOOR_CLOSED:
+		return self, DOOR_NOT_LOCKED
+	}
+	self.State_ = DOOR_CLOSED
+	return self, nil
+}
+
+// Break works on any door.  There is no way back.
+func (self Door) Break() Door {
+	self.State_ = DOOR_BROKEN
+	return self
+}
+
+// A DoorSlot tells where a door is.
+type DoorSlot struct {
+	Location Location
+	// True for doors in walls, false for doors in the middle of tiles.
+	In_wall bool
+	// Facing of the wall, for doors in walls.
+	Facing AbsoluteDirection
+}
+
+// otherSide returns the slot of the other side of a door in a wall.  A wall
+// facing north sits on the southern edge of its tile; its other side is on the
+// northern edge of the tile to the south, and faces south.
+func (self DoorSlot) otherSide() DoorSlot {
+	edge := self.Facing.Add(BACK())
+	return DoorSlot{
+		Location: self.Location.MoveAbsolute(edge, 1),
+		In_wall:  true,
+		Facing:   edge,
+	}
+}
+
+func (self Level) GetDoor(slot DoorSlot) (Door, bool) {
+	var building Building
+	var ok bool
+	if slot.In_wall {
+		building, ok = self.Walls[slot.Facing.Value()].Get(slot.Location.X, slot.Location.Y)
+	} else {
+		building, ok = self.Doors.Get(slot.Location.X, slot.Location.Y)
+	}
+	if !ok {
+		return Door{}, false
+	}
+	door, ok := building.(Door)
+	return door, ok
+}
+
+// SetDoor puts the door in its slot.  Both sides of doors in walls are set.
+func (self Level) SetDoor(slot DoorSlot, door Door) Level {
+	x, y := slot.Location.X, slot.Location.Y
+	if !slot.In_wall {
+		self.Doors = self.Doors.Set(x, y, door)
+		return self
+	}
+	index := slot.Facing.Value()
+	self.Walls[index] = self.Walls[index].Set(x, y, door)
+	other := slot.otherSide()
+	index = other.Facing.Value()
+	self.Walls[index] = self.Walls[index].Set(other.Location.X, other.Location.Y, door)
+	return self
+}
+
+// RemoveDoor removes the door from its slot, both sides for doors in walls.
+func (self Level) RemoveDoor(slot DoorSlot) Level {
+	x, y := slot.Location.X, slot.Location.Y
+	if !slot.In_wall {
+		self.Doors = self.Doors.Delete(x, y)
+		return self
+	}
+	for _, side := range [...]DoorSlot{slot, slot.otherSide()} {
+		if _, ok := self.GetDoor(side); ok {
+			index := side.Facing.Value()
+			self.Walls[index] = self.Walls[index].Delete(side.Location.X, side.Location.Y)
+		}
+	}
+	return self
+}
+
+// FrontDoor finds the door a creature at the given position would handle:
+// the door in the wall it faces, or else the door in the middle of the tile
+// in front of it.
+func (self Level) FrontDoor(position Position) (DoorSlot, Door, bool) {
+	slot := DoorSlot{
+		Location: position.Location,
+		In_wall:  true,
+		Facing:   position.F.Add(BACK()),
+	}
+	if door, ok := self.GetDoor(slot); ok {
+		return slot, door, true
+	}
+	slot = DoorSlot{Location: position.MoveForward(1).Location}
+	if door, ok := self.GetDoor(slot); ok {
+		return slot, door, true
+	}
+	return DoorSlot{}, Door{}, false
+}
@@ -0,0 +1,131 @@
+package world
+
+import (
+	"testing"
+)
+
+func TestDoorTransitions(test *testing.T) {
+	type change func(Door) (Door, error)
+	changes := map[string]change{
+		"open":   Door.Open,
+		"close":  Door.Close,
+		"lock":   Door.Lock,
+		"unlock": Door.Unlock,
+	}
+	// What each change does to a door in each state.
+	expected := map[DoorState]map[string]interface{}{
+		DOOR_OPEN: {
+			"open":   DOOR_ALREADY_OPEN,
+			"close":  DOOR_CLOSED,
+			"lock":   DOOR_IS_OPEN,
+			"unlock": DOOR_NOT_LOCKED,
+		},
+		DOOR_CLOSED: {
+			"open":   DOOR_OPEN,
+			"close":  DOOR_ALREADY_CLOSED,
+			"lock":   DOOR_LOCKED,
+			"unlock": DOOR_NOT_LOCKED,
+		},
+		DOOR_LOCKED: {
+			"open":   DOOR_IS_LOCKED,
+			"close":  DOOR_ALREADY_CLOSED,
+			"lock":   DOOR_ALREADY_LOCKED,
+			"unlock": DOOR_CLOSED,
+		},
+		DOOR_BROKEN: {
+			"open":   DOOR_IS_BROKEN,
+			"close":  DOOR_IS_BROKEN,
+			"lock":   DOOR_IS_BROKEN,
+			"unlock": DOOR_IS_BROKEN,
+		},
+	}
+	for state, outcomes := range expected {
+		for name, outcome := range outcomes {
+			door := MakeDoor(6, state, EAST())
+			changed, err := changes[name](door)
+			switch outcome := outcome.(type) {
+			case DoorState:
+				if err != nil || changed.State() != outcome {
+					test.Errorf("%v a door %v: %v, %v.", name, state, changed.State(), err)
+				}
+			case DoorError:
+				if err != outcome || changed != door {
+					test.Errorf("%v a door %v: %v, %v.", name, state, changed.State(), err)
+				}
+			}
+		}
+		if broken := MakeDoor(6, state, EAST()).Break(); broken.State() != DOOR_BROKEN {
+			test.Errorf("A door %v does not break.", state)
+		}
+	}
+}
+
+func TestDoorIsPassable(test *testing.T) {
+	passable := map[DoorState]bool{
+		DOOR_OPEN:   true,
+		DOOR_CLOSED: false,
+		DOOR_LOCKED: false,
+		DOOR_BROKEN: true,
+	}
+	for state, expected := range passable {
+		if MakeDoor(6, state, EAST()).IsPassable() != expected {
+			test.Errorf("A door %v is not passable: %v.", state, !expected)
+		}
+	}
+}
+
+// Doors block the way through the wall they sit in, both ways, and the way
+// into the tile they sit in, unless they are open or broken.
+func TestLevelIsPassableThroughDoors(test *testing.T) {
+	level := MakeLevel(0)
+	for x := Coord(0); x < 3; x++ {
+		level.Floors = level.Floors.Set(x, 0, MakeFloor(0, EAST(), true))
+	}
+	in_wall := DoorSlot{Location: Location{0, 0}, In_wall: true, Facing: WEST()}
+	in_tile := DoorSlot{Location: Location{2, 0}}
+	for state, passable := range map[DoorState]bool{
+		DOOR_OPEN:   true,
+		DOOR_CLOSED: false,
+		DOOR_LOCKED: false,
+		DOOR_BROKEN: true,
+	} {
+		level := level.SetDoor(in_wall, MakeDoor(6, state, EAST()))
+		if level.IsPassable(Location{0, 0}, EAST()) != passable ||
+			level.IsPassable(Location{1, 0}, WEST()) != passable {
+			test.Errorf("Going through a door %v in a wall: %v.", state, !passable)
+		}
+		if !level.IsPassable(Location{1, 0}, EAST()) {
+			test.Errorf("The door %v in the wall blocks the next tile.", state)
+		}
+		level = level.SetDoor(in_tile, MakeDoor(6, state, EAST()))
+		if level.IsPassable(Location{1, 0}, EAST()) != passable {
+			test.Errorf("Going into a door %v in a tile: %v.", state, !passable)
+		}
+	}
+}
+
+// Doors in walls have two sides that change together.
+func TestDoorSides(test *testing.T) {
+	slot := DoorSlot{Location: Location{0, 0}, In_wall: true, Facing: WEST()}
+	other := DoorSlot{Location: Location{1, 0}, In_wall: true, Facing: EAST()}
+	level := MakeLevel(0).SetDoor(slot, MakeDoor(6, DOOR_CLOSED, EAST()))
+	if door, ok := level.GetDoor(other); !ok || door.State() != DOOR_CLOSED {
+		test.Fatal("The door has no other side.")
+	}
+	opened, _ := MakeDoor(6, DOOR_CLOSED, EAST()).Open()
+	w := World{Levels: MakeLevels().Set(0, level)}
+	w, err := DeltaDoorChanged{0, other, MakeDoor(6, DOOR_CLOSED, EAST()), opened}.Apply(w)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if door, _ := w.Levels[0].GetDoor(slot); door.State() != DOOR_OPEN {
+		test.Error("Opening one side left the other closed.")
+	}
+	if found, _, ok := w.Levels[0].FrontDoor(Position{Location{1, 0}, WEST()}); !ok || found != other {
+		test.Error("The door in front is", found, ok)
+	}
+	level = w.Levels[0].RemoveDoor(slot)
+	if _, ok := level.GetDoor(other); ok {
+		test.Error("The other side was not removed.")
+	}
+}
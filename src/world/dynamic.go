@@ -9,6 +9,15 @@ type Dynamic struct {
 	T0 uint64 // Date of birth
 }
 
+// Phase tells how far into its loop an animation of the given period is at
+// time t, from 0 included to 1 excluded.  Before its birth, it is at 0.
+func (self Dynamic) Phase(t, period uint64) float64 {
+	if t < self.T0 || period == 0 {
+		return 0
+	}
+	return float64((t-self.T0)%period) / float64(period)
+}
+
 func (self Dynamic) ModelMat(t uint64) glm.Matrix4 {
 	const TAU = 1 * 1000000000 // Nanosecond.
 	dt := float64(t - self.T0)
@@ -0,0 +1,269 @@
+package world
+
+import (
+	"fmt"
+	"pmap"
+)
+
+// Floor effects are the tricks hidden in the floor of a level: teleporters
+// that send whoever steps on them somewhere else, and spinners that turn them
+// around without them noticing.  They act on the creatures that enter their
+// tile, never on those already standing there.  Triggers can switch them on
+// and off.
+
+type FloorEffectKind int
+
+const (
+	EFFECT_TELEPORTER = FloorEffectKind(iota)
+	EFFECT_SPINNER
+)
+
+var floor_effect_kind_text = map[FloorEffectKind]string{
+	EFFECT_TELEPORTER: "teleporter",
+	EFFECT_SPINNER:    "spinner",
+}
+
+func (self FloorEffectKind) String() string {
+	return floor_effect_kind_text[self]
+}
+
+type FloorEffect struct {
+	Kind        FloorEffectKind
+	Location    Location
+	Active      bool          // Inactive effects do nothing.
+	To          LevelPosition // Where teleporters send creatures.
+	Keep_facing bool          // Teleported creatures keep their own facing.
+	Turns       int           // Quarter turns to the left given by spinners.
+}
+
+// MakeTeleporter makes an active teleporter.  When keep_facing is set, the
+// facing of the destination is ignored.
+func MakeTeleporter(location Location, to LevelPosition, keep_facing bool) FloorEffect {
+	return FloorEffect{
+		Kind:        EFFECT_TELEPORTER,
+		Location:    location,
+		Active:      true,
+		To:          to,
+		Keep_facing: keep_facing,
+	}
+}
+
+// MakeSpinner makes an active spinner.
+func MakeSpinner(location Location, turns int) FloorEffect {
+	return FloorEffect{
+		Kind:     EFFECT_SPINNER,
+		Location: location,
+		Active:   true,
+		Turns:    turns,
+	}
+}
+
+// Destination returns where a creature entering the tile at `from`, in the
+// given level, ends up.
+func (self FloorEffect) Destination(level_id LevelId, from Position) LevelPosition {
+	switch self.Kind {
+	case EFFECT_TELEPORTER:
+		to := self.To
+		if self.Keep_facing {
+			to.F = from.F
+		}
+		return to
+	case EFFECT_SPINNER:
+		return from.Turn(LEFT(), (self.Turns%4+4)%4).ToLevelPosition(level_id)
+	}
+	return from.ToLevelPosition(level_id)
+}
+
+// Each floor effect in a level is identified with a unique ID.
+type FloorEffectId uint64
+
+// Hash allows floor effect identifiers to be used as keys of persistent maps.
+func (self FloorEffectId) Hash() uint64 {
+	return pmap.Hash64(uint64(self))
+}
+
+type FloorEffects struct {
+	Next_id FloorEffectId
+	// The content is a persistent map, updating it does not copy it.
+	content pmap.Map
+}
+
+func MakeFloorEffects() FloorEffects {
+	return FloorEffects{}
+}
+
+func (self FloorEffects) Add(effect FloorEffect) (FloorEffects, FloorEffectId) {
+	effect_id := self.Next_id
+	effects := self.Set(effect_id, effect)
+	effects.Next_id += 1
+	return effects, effect_id
+}
+
+func (self FloorEffects) Get(effect_id FloorEffectId) (FloorEffect, bool) {
+	effect, ok := self.content.Get(effect_id)
+	if !ok {
+		return FloorEffect{}, false
+	}
+	return effect.(FloorEffect), true
+}
+
+func (self FloorEffects) Set(effect_id FloorEffectId, effect FloorEffect) FloorEffects {
+	self.content = self.content.Set(effect_id, effect)
+	return self
+}
+
+func (self FloorEffects) Delete(effect_id FloorEffectId) FloorEffects {
+	self.content = self.content.Delete(effect_id)
+	return self
+}
+
+func (self FloorEffects) Len() int {
+	return self.content.Len()
+}
+
+// ForEach calls f for each floor effect.
+func (self FloorEffects) ForEach(f func(effect_id FloorEffectId, effect FloorEffect)) {
+	self.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(FloorEffectId), value.(FloorEffect))
+	})
+}
+
+// At finds the floor effect of the given tile.
+func (self FloorEffects) At(location Location) (FloorEffectId, FloorEffect, bool) {
+	var found_id FloorEffectId
+	var found FloorEffect
+	ok := false
+	self.ForEach(func(effect_id FloorEffectId, effect FloorEffect) {
+		if effect.Location == location && (!ok || effect_id < found_id) {
+			found_id, found, ok = effect_id, effect, true
+		}
+	})
+	return found_id, found, ok
+}
+
+// floorEffectsGob is what FloorEffects looks like to gob.
+type floorEffectsGob struct {
+	Next_id FloorEffectId
+	Content map[FloorEffectId]FloorEffect
+}
+
+func (self FloorEffects) GobEncode() ([]byte, error) {
+	content := make(map[FloorEffectId]FloorEffect, self.Len())
+	self.ForEach(func(effect_id FloorEffectId, effect FloorEffect) {
+		content[effect_id] = effect
+	})
+	return gobEncode(floorEffectsGob{self.Next_id, content})
+}
+
+func (self *FloorEffects) GobDecode(data []byte) error {
+	var decoded floorEffectsGob
+	if err := gobDecode(data, &decoded); err != nil {
+		return err
+	}
+	*self = FloorEffects{Next_id: decoded.Next_id}
+	for effect_id, effect := range decoded.Content {
+		*self = self.Set(effect_id, effect)
+	}
+	return nil
+}
+
+// Landing computes where a creature entering a tile of the level ends up,
+// once the floor effect of the tile, if any and active, has acted.  It
+// returns false when nothing happens.  Creatures are not teleported into
+// occupied tiles, nor into levels that do not exist.
+func (world World) Landing(level_id LevelId, from Position) (LevelPosition, bool) {
+	level, ok := world.Levels[level_id]
+	if !ok {
+		return LevelPosition{}, false
+	}
+	_, effect, ok := level.Effects.At(from.Location)
+	if !ok || !effect.Active {
+		return LevelPosition{}, false
+	}
+	to := effect.Destination(level_id, from)
+	if to.Level != level_id || to.Location != from.Location {
+		destination, ok := world.Levels[to.Level]
+		if !ok {
+			return LevelPosition{}, false
+		}
+		if _, ok := destination.CreatureLocation.GetCreature(to.Location); ok {
+			return LevelPosition{}, false
+		}
+	}
+	return to, true
+}
+
+// DeltaFloorEffectChanged changes a floor effect of a level.
+type DeltaFloorEffectChanged struct {
+	Level  LevelId
+	Effect FloorEffectId
+	Before FloorEffect
+	After  FloorEffect
+}
+
+func (self DeltaFloorEffectChanged) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	effect, ok := level.Effects.Get(self.Effect)
+	if !ok || effect != self.Before {
+		return world, DELTA_FLOOR_EFFECT_CHANGED
+	}
+	level.Effects = level.Effects.Set(self.Effect, self.After)
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaFloorEffectChanged) Reverse() Delta {
+	return DeltaFloorEffectChanged{self.Level, self.Effect, self.After, self.Before}
+}
+
+func (self DeltaFloorEffectChanged) String() string {
+	return fmt.Sprintf("%v %v changes", self.After.Kind, self.Effect)
+}
+
+// DeltaFloorEffectPlaced puts a new floor effect in a level, or takes it away
+// again.
+type DeltaFloorEffectPlaced struct {
+	Level  LevelId
+	Effect FloorEffectId
+	Value  FloorEffect
+	Placed bool
+}
+
+func (self DeltaFloorEffectPlaced) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	current, ok := level.Effects.Get(self.Effect)
+	if self.Placed {
+		if ok {
+			return world, DELTA_ID_TAKEN
+		}
+		level.Effects = level.Effects.Set(self.Effect, self.Value)
+		if self.Effect >= level.Effects.Next_id {
+			level.Effects.Next_id = self.Effect + 1
+		}
+		return world.SetLevel(self.Level, level), nil
+	}
+	if !ok || current != self.Value {
+		return world, DELTA_FLOOR_EFFECT_CHANGED
+	}
+	level.Effects = level.Effects.Delete(self.Effect)
+	if self.Effect+1 == level.Effects.Next_id {
+		level.Effects.Next_id = self.Effect
+	}
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaFloorEffectPlaced) Reverse() Delta {
+	return DeltaFloorEffectPlaced{self.Level, self.Effect, self.Value, !self.Placed}
+}
+
+func (self DeltaFloorEffectPlaced) String() string {
+	if self.Placed {
+		return fmt.Sprintf("%v %v is placed", self.Value.Kind, self.Effect)
+	}
+	return fmt.Sprintf("%v %v is taken away", self.Value.Kind, self.Effect)
+}
@@ -0,0 +1,156 @@
+package world
+
+import (
+	"sort"
+)
+
+// Sight on the grid.  Walls do not fill tiles, they sit on the edges between
+// tiles, so the usual shadowcasting algorithms that block whole tiles do not
+// apply directly.  Instead, sight follows the segment joining the centers of
+// two tiles, and checks every edge and tile it crosses:
+//
+// - A wall on either side of an edge blocks sight, even a passable one: fake
+//   walls look like walls.  Doors block sight when closed.
+// - A tile without floor is solid rock: it can be seen, but not through.
+//   Neither can a tile holding a closed door.
+//
+// When the segment goes exactly through a corner, sight passes if it can go
+// around the corner on either side.
+
+// edgeBlocksSight tells whether something stands on the edge between the
+// location and its neighbor in the given direction.
+func (self Level) edgeBlocksSight(location Location, direction AbsoluteDirection) bool {
+	neighbor := location.MoveAbsolute(direction, 1)
+	sides := [...]struct {
+		location Location
+		facing   AbsoluteDirection
+	}{
+		{location, direction.Add(BACK())},
+		{neighbor, direction},
+	}
+	for _, side := range sides {
+		building, ok := self.Walls[side.facing.Value()].Get(side.location.X, side.location.Y)
+		if !ok {
+			continue
+		}
+		if door, ok := building.(Door); ok && door.IsPassable() {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// tileBlocksSight tells whether one cannot see through the tile.
+func (self Level) tileBlocksSight(location Location) bool {
+	if _, ok := self.Floors.Get(location.X, location.Y); !ok {
+		return true
+	}
+	building, ok := self.Doors.Get(location.X, location.Y)
+	if ok {
+		if door, ok := building.(Door); !ok || !door.IsPassable() {
+			return true
+		}
+	}
+	return false
+}
+
+// HasLineOfSight tells whether someone standing in the middle of tile a sees
+// the middle of tile b.  Sight is symmetrical.
+func (self Level) HasLineOfSight(a, b Location) bool {
+	dx, dy := int(b.X-a.X), int(b.Y-a.Y)
+	// Directions in which x and y grow along the segment.
+	x_dir, y_dir := EAST(), NORTH()
+	if dx < 0 {
+		x_dir, dx = WEST(), -dx
+	}
+	if dy < 0 {
+		y_dir, dy = SOUTH(), -dy
+	}
+	current := a
+	// i and j count the edges crossed along x and y.  The segment crosses its
+	// i-th x edge at (2i+1)/(2dx) of its length, and its j-th y edge at
+	// (2j+1)/(2dy); comparing these tells which edge comes first.
+	i, j := 0, 0
+	for i < dx || j < dy {
+		if current != a && self.tileBlocksSight(current) {
+			return false
+		}
+		x_next := (2*i + 1) * dy
+		y_next := (2*j + 1) * dx
+		switch {
+		case j == dy || (i < dx && x_next < y_next):
+			if self.edgeBlocksSight(current, x_dir) {
+				return false
+			}
+			current = current.MoveAbsolute(x_dir, 1)
+			i++
+		case i == dx || y_next < x_next:
+			if self.edgeBlocksSight(current, y_dir) {
+				return false
+			}
+			current = current.MoveAbsolute(y_dir, 1)
+			j++
+		default:
+			// Exactly through a corner.
+			if !self.cornerIsClear(current, x_dir, y_dir) {
+				return false
+			}
+			current = current.MoveAbsolute(x_dir, 1).MoveAbsolute(y_dir, 1)
+			i++
+			j++
+		}
+	}
+	return true
+}
+
+// cornerIsClear tells whether sight goes diagonally from the location to the
+// tile across the corner, around either side of the corner.
+func (self Level) cornerIsClear(location Location, x_dir, y_dir AbsoluteDirection) bool {
+	around := func(first, second AbsoluteDirection) bool {
+		middle := location.MoveAbsolute(first, 1)
+		return !self.edgeBlocksSight(location, first) &&
+			!self.tileBlocksSight(middle) &&
+			!self.edgeBlocksSight(middle, second)
+	}
+	return around(x_dir, y_dir) || around(y_dir, x_dir)
+}
+
+// FOV returns the locations seen by someone standing at the position, up to
+// `radius` tiles ahead.  The field of view widens by one tile on each side for
+// each tile ahead, starting with three tiles: the row of the viewer.  Nobody
+// sees behind them.  The locations are sorted.
+func (self Level) FOV(position Position, radius int) []Location {
+	front_x, front_y := position.F.DxDy()
+	left_x, left_y := position.F.Add(LEFT()).DxDy()
+	var visible []Location
+	for ahead := 0; ahead <= radius; ahead++ {
+		for side := -ahead - 1; side <= ahead+1; side++ {
+			location := Location{
+				position.X + Coord(ahead)*front_x + Coord(side)*left_x,
+				position.Y + Coord(ahead)*front_y + Coord(side)*left_y,
+			}
+			if self.HasLineOfSight(position.Location, location) {
+				visible = append(visible, location)
+			}
+		}
+	}
+	sort.Sort(locationsByXY(visible))
+	return visible
+}
+
+// locationsByXY sorts locations by x, then y.
+type locationsByXY []Location
+
+func (self locationsByXY) Len() int {
+	return len(self)
+}
+func (self locationsByXY) Less(i, j int) bool {
+	if self[i].X != self[j].X {
+		return self[i].X < self[j].X
+	}
+	return self[i].Y < self[j].Y
+}
+func (self locationsByXY) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+}
@@ -0,0 +1,128 @@
+package world
+
+import (
+	"reflect"
+	"testing"
+)
+
+// roomLevel is a level with floors from (0, 0) to (width-1, height-1), and
+// nothing else.
+func roomLevel(width, height Coord) Level {
+	level := MakeLevel(0)
+	for x := Coord(0); x < width; x++ {
+		for y := Coord(0); y < height; y++ {
+			level.Floors = level.Floors.Set(x, y, MakeFloor(0, EAST(), true))
+		}
+	}
+	return level
+}
+
+// sees checks a line of sight both ways, as sight is symmetrical.
+func sees(test *testing.T, level Level, a, b Location) bool {
+	seen := level.HasLineOfSight(a, b)
+	if level.HasLineOfSight(b, a) != seen {
+		test.Errorf("Sight between %v and %v is not symmetrical.", a, b)
+	}
+	return seen
+}
+
+func TestLineOfSightInTheOpen(test *testing.T) {
+	level := roomLevel(4, 3)
+	level.Floors.ForEach(func(a Location, _ Building) {
+		level.Floors.ForEach(func(b Location, _ Building) {
+			if !sees(test, level, a, b) {
+				test.Errorf("%v does not see %v in an empty room.", a, b)
+			}
+		})
+	})
+}
+
+// Walls block sight from both sides of their edge, even the fake ones.
+func TestWallsBlockSight(test *testing.T) {
+	for _, wall := range []Wall{MakeWall(5, false), MakeWall(5, true)} {
+		for _, side := range []DoorSlot{
+			{Location: Location{1, 0}, Facing: WEST()},
+			{Location: Location{2, 0}, Facing: EAST()},
+		} {
+			level := roomLevel(4, 1)
+			level.Walls[side.Facing.Value()] = level.Walls[side.Facing.Value()].Set(side.Location.X, side.Location.Y, wall)
+			if !sees(test, level, Location{0, 0}, Location{1, 0}) {
+				test.Errorf("The wall %v hides the tile before it.", side)
+			}
+			if sees(test, level, Location{0, 0}, Location{2, 0}) || sees(test, level, Location{1, 0}, Location{3, 0}) {
+				test.Errorf("A wall %v, passable %v, does not block sight.", side, wall.IsPassable())
+			}
+		}
+	}
+}
+
+// Doors in walls block sight on their edge when closed, doors in tiles block
+// sight through their tile.  Either way, the door itself can be seen.
+func TestDoorsBlockSight(test *testing.T) {
+	for state, transparent := range map[DoorState]bool{
+		DOOR_OPEN:   true,
+		DOOR_CLOSED: false,
+		DOOR_LOCKED: false,
+		DOOR_BROKEN: true,
+	} {
+		door := MakeDoor(6, state, NORTH())
+		in_wall := roomLevel(4, 1).SetDoor(DoorSlot{Location{1, 0}, true, WEST()}, door)
+		if sees(test, in_wall, Location{0, 0}, Location{2, 0}) != transparent {
+			test.Errorf("Seeing through a door %v in a wall: %v.", state, !transparent)
+		}
+		in_tile := roomLevel(4, 1).SetDoor(DoorSlot{Location: Location{1, 0}}, door)
+		if !sees(test, in_tile, Location{0, 0}, Location{1, 0}) {
+			test.Errorf("A door %v in a tile cannot be seen.", state)
+		}
+		if sees(test, in_tile, Location{0, 0}, Location{2, 0}) != transparent {
+			test.Errorf("Seeing through a door %v in a tile: %v.", state, !transparent)
+		}
+	}
+}
+
+// A tile without floor is solid rock: its face can be seen, not what is
+// behind.
+func TestMissingFloorBlocksSight(test *testing.T) {
+	level := roomLevel(4, 1)
+	level.Floors = level.Floors.Delete(1, 0)
+	if !sees(test, level, Location{0, 0}, Location{1, 0}) {
+		test.Error("The rock cannot be seen.")
+	}
+	if sees(test, level, Location{0, 0}, Location{2, 0}) {
+		test.Error("Seeing through the rock.")
+	}
+}
+
+// Sight through a corner goes around it on either side.
+func TestLineOfSightThroughCorners(test *testing.T) {
+	level := roomLevel(2, 2)
+	level.Floors = level.Floors.Delete(1, 0)
+	if !sees(test, level, Location{0, 0}, Location{1, 1}) {
+		test.Error("One side of the corner does not let sight through.")
+	}
+	level.Walls[WEST().Value()] = level.Walls[WEST().Value()].Set(0, 1, MakeWall(5, false))
+	if sees(test, level, Location{0, 0}, Location{1, 1}) {
+		test.Error("Seeing through a corner blocked on both sides.")
+	}
+}
+
+// The field of view widens ahead, stops at its radius and never looks back.
+// The rock in the middle hides the row behind it, the rock around the room is
+// seen.
+func TestFOV(test *testing.T) {
+	level := roomLevel(5, 5)
+	level.Floors = level.Floors.Delete(2, 2)
+	visible := level.FOV(Position{Location{2, 1}, NORTH()}, 2)
+	expected := []Location{
+		{-1, 3},
+		{0, 2}, {0, 3},
+		{1, 1}, {1, 2},
+		{2, 1}, {2, 2},
+		{3, 1}, {3, 2},
+		{4, 2}, {4, 3},
+		{5, 3},
+	}
+	if !reflect.DeepEqual(visible, expected) {
+		test.Error("Seen", visible)
+	}
+}
@@ -0,0 +1,20 @@
+package world
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// The persistent maps cannot be encoded by gob directly.  The collections
+// using them implement GobEncoder and GobDecoder by converting themselves to
+// plain Go maps, and use these two helpers to do so.
+
+func gobEncode(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(value)
+	return buffer.Bytes(), err
+}
+
+func gobDecode(data []byte, value interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+}
@@ -0,0 +1,110 @@
+package world
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// A hashSum adds up the hashes of the parts of a World.  Adding makes the sum
+// blind to the order of the parts, and persistent maps list their entries in
+// an order that depends on how they were built.
+type hashSum uint64
+
+// add hashes one part, described by a label and values.  The values are
+// printed with their type: the types of the World are plain structs, slices
+// and arrays, what they print is their content.  Unlike %#v, %v prints nil
+// and empty slices alike, as saves do not tell them apart either.
+func (self *hashSum) add(label string, values ...interface{}) {
+	h := fnv.New64a()
+	fmt.Fprint(h, label)
+	for _, value := range values {
+		fmt.Fprintf(h, "\x00%T %v", value, value)
+	}
+	*self += hashSum(h.Sum64())
+}
+
+// Hash returns a 64 bits digest of the content of the World.  Worlds with the
+// same content have the same hash, however their collections were built.
+// Replays compare hashes to check that they rebuild the World they recorded.
+func (world World) Hash() uint64 {
+	var sum hashSum
+	sum.add("player", world.Player_id)
+	sum.add("time", world.Time)
+	sum.add("rngs", world.Rngs)
+	world.Automap.ForEach(func(location LevelLocation, seen Seen) {
+		sum.add("automap", location, seen)
+	})
+	for level_id, level := range world.Levels {
+		level.hash(&sum, level_id)
+	}
+	return uint64(sum)
+}
+
+// hash adds the content of the Level to the sum.  Every part is labelled
+// with the identifier of the Level, so that Levels do not mix.
+func (self Level) hash(sum *hashSum, level_id LevelId) {
+	label := func(part string) string {
+		return fmt.Sprintf("%v %v", level_id, part)
+	}
+	sum.add(label("level"), self.Name, self.Dynamic, self.ActorSchedule)
+	sum.add(label("next"),
+		self.Actors.NextIDprivate,
+		self.Creatures.Next_id,
+		self.Items.Next_id,
+		self.Triggers.Next_id,
+		self.Lights.Next_id,
+		self.Props.Next_id,
+		self.Effects.Next_id,
+	)
+	buildings := func(part string, buildings Buildings) {
+		buildings.ForEach(func(location Location, building Building) {
+			sum.add(label(part), location, building)
+		})
+	}
+	buildings("floor", self.Floors)
+	buildings("ceiling", self.Ceilings)
+	for facing, walls := range self.Walls {
+		buildings(fmt.Sprint("wall ", facing), walls)
+	}
+	buildings("column", self.Columns)
+	buildings("door", self.Doors)
+	self.Actors.ForEach(func(actor_id ActorID, actor Actor) {
+		sum.add(label("actor"), actor_id, actor)
+	})
+	self.Creatures.ForEach(func(creature_id CreatureId, creature Creature) {
+		sum.add(label("creature"), creature_id, creature)
+	})
+	self.CreatureLocation.ForEach(func(creature_id CreatureId, location Location) {
+		sum.add(label("creature location"), creature_id, location)
+	})
+	self.CreatureActor.ForEach(func(creature_id CreatureId, actor_id ActorID) {
+		sum.add(label("creature actor"), creature_id, actor_id)
+	})
+	self.Items.ForEach(func(item_id ItemId, item Item) {
+		sum.add(label("item"), item_id, item)
+	})
+	self.ItemLocation.ForEach(func(item_id ItemId, location Location) {
+		sum.add(label("item location"), item_id, location)
+	})
+	self.Inventories.ForEach(func(creature_id CreatureId, inventory Inventory) {
+		sum.add(label("inventory"), creature_id, inventory)
+	})
+	self.Mechanisms.ForEach(func(actor_id ActorID, mechanism Mechanism) {
+		sum.add(label("mechanism"), actor_id, mechanism)
+	})
+	self.Triggers.ForEach(func(trigger_id TriggerId, trigger Trigger) {
+		sum.add(label("trigger"), trigger_id, trigger)
+	})
+	self.Projectiles.ForEach(func(actor_id ActorID, projectile Projectile) {
+		sum.add(label("projectile"), actor_id, projectile)
+	})
+	self.Lights.ForEach(func(light_id LightId, light LightSource) {
+		sum.add(label("light"), light_id, light)
+	})
+	self.Props.ForEach(func(prop_id PropId, prop Prop) {
+		sum.add(label("prop"), prop_id, prop)
+	})
+	self.Effects.ForEach(func(effect_id FloorEffectId, effect FloorEffect) {
+		sum.add(label("effect"), effect_id, effect)
+	})
+}
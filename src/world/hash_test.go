@@ -0,0 +1,54 @@
+package world
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHashOfSameWorlds(test *testing.T) {
+	if MakeWorld().Hash() != MakeWorld().Hash() {
+		test.Error("Two new worlds hash differently.")
+	}
+	// A save rebuilds every collection from scratch.
+	w := savableWorld()
+	var save bytes.Buffer
+	if err := w.Write(&save); err != nil {
+		test.Fatal(err)
+	}
+	loaded, _, err := Read(&save)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if loaded.Hash() != w.Hash() {
+		test.Error("A save changed the hash.")
+	}
+}
+
+func TestHashOfDifferentWorlds(test *testing.T) {
+	w := savableWorld()
+	later := w.SetTime(w.Time + 1)
+	rolled, _ := w.Roll(STREAM_AI, 1, 6)
+	level := w.Levels[0]
+	level.Ceilings = level.Ceilings.Set(0, 0, MakeOrientedBuilding(1, EAST()))
+	built := w.SetLevel(0, level)
+	// The same floor in another level.
+	here, _ := w.AddLevel()
+	there, level_id := MakeWorld().AddLevel()
+	other := there.Levels[level_id]
+	other.Floors = other.Floors.Set(0, 0, MakeFloor(0, EAST(), true))
+	there = there.SetLevel(level_id, other)
+	hashes := map[uint64]string{}
+	for name, world := range map[string]World{
+		"original": w,
+		"later":    later,
+		"rolled":   rolled,
+		"built":    built,
+		"here":     here,
+		"there":    there,
+	} {
+		if other, ok := hashes[world.Hash()]; ok {
+			test.Errorf("Worlds %v and %v hash the same.", name, other)
+		}
+		hashes[world.Hash()] = name
+	}
+}
@@ -0,0 +1,184 @@
+package world
+
+import (
+	"pmap"
+)
+
+type InventoryError int
+
+const (
+	INV_NOT_CARRIED = InventoryError(iota)
+	INV_CANNOT_EQUIP
+)
+
+var inventory_error_text = map[InventoryError]string{
+	INV_NOT_CARRIED:  "item not carried",
+	INV_CANNOT_EQUIP: "item cannot be equipped",
+}
+
+func (self InventoryError) Error() string {
+	return inventory_error_text[self]
+}
+
+// An Inventory holds the items of a creature: the ones in its backpack, and
+// the ones it wears or wields.  An item is either in the backpack or equipped,
+// not both.
+type Inventory struct {
+	Carried  []ItemId // Never modified in place.  Last picked up last.
+	Equipped [EQUIP_SLOTS]ItemId
+}
+
+func MakeInventory() Inventory {
+	return Inventory{}
+}
+
+func (self Inventory) IsEmpty() bool {
+	return len(self.Carried) == 0 && self.Equipped == [EQUIP_SLOTS]ItemId{}
+}
+
+// Items returns all the items of the inventory, backpack first.
+func (self Inventory) Items() []ItemId {
+	items := make([]ItemId, len(self.Carried), len(self.Carried)+len(self.Equipped))
+	copy(items, self.Carried)
+	for _, item_id := range self.Equipped {
+		if item_id != NO_ITEM {
+			items = append(items, item_id)
+		}
+	}
+	return items
+}
+
+// Last returns the item of the backpack picked up last.
+func (self Inventory) Last() (ItemId, bool) {
+	if len(self.Carried) == 0 {
+		return NO_ITEM, false
+	}
+	return self.Carried[len(self.Carried)-1], true
+}
+
+// Slot tells where the item is in the inventory: in an equipment slot, or in
+// the backpack for EQUIP_NONE.
+func (self Inventory) Slot(item_id ItemId) (EquipSlot, bool) {
+	for slot, equipped := range self.Equipped {
+		if equipped == item_id && item_id != NO_ITEM {
+			return EquipSlot(slot), true
+		}
+	}
+	for _, carried := range self.Carried {
+		if carried == item_id {
+			return EQUIP_NONE, true
+		}
+	}
+	return EQUIP_NONE, false
+}
+
+// Carry puts an item in the backpack.
+func (self Inventory) Carry(item_id ItemId) Inventory {
+	carried := make([]ItemId, len(self.Carried), len(self.Carried)+1)
+	copy(carried, self.Carried)
+	self.Carried = append(carried, item_id)
+	return self
+}
+
+// Remove takes an item out of the inventory, be it in the backpack or
+// equipped.
+func (self Inventory) Remove(item_id ItemId) (Inventory, error) {
+	for slot, equipped := range self.Equipped {
+		if equipped == item_id {
+			self.Equipped[slot] = NO_ITEM
+			return self, nil
+		}
+	}
+	for i, carried := range self.Carried {
+		if carried == item_id {
+			rest := make([]ItemId, 0, len(self.Carried)-1)
+			rest = append(rest, self.Carried[:i]...)
+			self.Carried = append(rest, self.Carried[i+1:]...)
+			return self, nil
+		}
+	}
+	return self, INV_NOT_CARRIED
+}
+
+// Equip moves an item of the backpack to the given slot.  Whatever was in the
+// slot goes back to the backpack.
+func (self Inventory) Equip(item_id ItemId, slot EquipSlot) (Inventory, error) {
+	if slot == EQUIP_NONE {
+		return self, INV_CANNOT_EQUIP
+	}
+	inventory, err := self.Remove(item_id)
+	if err != nil {
+		return self, err
+	}
+	if previous := inventory.Equipped[slot]; previous != NO_ITEM {
+		inventory = inventory.Carry(previous)
+	}
+	inventory.Equipped[slot] = item_id
+	return inventory, nil
+}
+
+// Inventories holds the inventories of the creatures of a level.  Creatures
+// without items have no entry.
+type Inventories struct {
+	content pmap.Map // CreatureId -> Inventory
+}
+
+func MakeInventories() Inventories {
+	return Inventories{}
+}
+
+// Get returns the inventory of the creature, empty if it has none.
+func (self Inventories) Get(creature_id CreatureId) Inventory {
+	inventory, ok := self.content.Get(creature_id)
+	if !ok {
+		return MakeInventory()
+	}
+	return inventory.(Inventory)
+}
+
+// Set replaces the inventory of the creature.  Empty inventories are not
+// stored.
+func (self Inventories) Set(creature_id CreatureId, inventory Inventory) Inventories {
+	if inventory.IsEmpty() {
+		self.content = self.content.Delete(creature_id)
+	} else {
+		self.content = self.content.Set(creature_id, inventory)
+	}
+	return self
+}
+
+func (self Inventories) Delete(creature_id CreatureId) Inventories {
+	self.content = self.content.Delete(creature_id)
+	return self
+}
+
+func (self Inventories) Len() int {
+	return self.content.Len()
+}
+
+// ForEach calls f for each creature carrying items.
+func (self Inventories) ForEach(f func(creature_id CreatureId, inventory Inventory)) {
+	self.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(CreatureId), value.(Inventory))
+	})
+}
+
+func (self Inventories) GobEncode() ([]byte, error) {
+	content := make(map[CreatureId]Inventory, self.Len())
+	self.ForEach(func(creature_id CreatureId, inventory Inventory) {
+		content[creature_id] = inventory
+	})
+	return gobEncode(content)
+}
+
+func (self *Inventories) GobDecode(data []byte) error {
+	var content map[CreatureId]Inventory
+	if err := gobDecode(data, &content); err != nil {
+		return err
+	}
+	*self = MakeInventories()
+	for creature_id, inventory := range content {
+		*self = self.Set(creature_id, inventory)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package world
+
+import (
+	"pmap"
+)
+
+// Items are the objects lying in the dungeon or carried by creatures: swords,
+// keys, apples, rocks...  Like creatures, they do not know their own ID nor
+// where they are.  An item is either on the ground, in which case it is found
+// in the ItemLocation index, or carried by a creature, in which case it is
+// found in the Inventory of that creature.  Never both.
+
+// Each item in the world is identified with a unique ID.
+type ItemId uint64
+
+// NO_ITEM is never given to an item.  It marks the empty equipment slots.
+const NO_ITEM = ItemId(0)
+
+// Hash allows item identifiers to be used as keys of persistent maps.
+func (self ItemId) Hash() uint64 {
+	return pmap.Hash64(uint64(self))
+}
+
+// Creatures wear or wield items in their equipment slots.  An item fits at
+// most one slot.
+type EquipSlot int
+
+const (
+	EQUIP_NONE = EquipSlot(iota) // The item cannot be equipped.
+	EQUIP_HAND
+	EQUIP_OFF_HAND
+	EQUIP_HEAD
+	EQUIP_BODY
+	EQUIP_FEET
+	EQUIP_SLOTS // Number of slots, EQUIP_NONE included.
+)
+
+var equip_slot_text = map[EquipSlot]string{
+	EQUIP_NONE:     "none",
+	EQUIP_HAND:     "hand",
+	EQUIP_OFF_HAND: "offhand",
+	EQUIP_HEAD:     "head",
+	EQUIP_BODY:     "body",
+	EQUIP_FEET:     "feet",
+}
+
+func (self EquipSlot) String() string {
+	return equip_slot_text[self]
+}
+
+type Item struct {
+	Model_ ModelId
+	Name   string
+	Slot   EquipSlot // Where the item can be equipped.
+	Weapon Weapon    // Zero for items that are not weapons.
+}
+
+func MakeItem(model ModelId, name string, slot EquipSlot) Item {
+	return Item{Model_: model, Name: name, Slot: slot}
+}
+
+func (self Item) Model() ModelId {
+	return self.Model_
+}
+
+type Items struct {
+	Next_id ItemId
+	// The content is a persistent map, updating it does not copy it.
+	content pmap.Map
+}
+
+func MakeItems() Items {
+	return Items{}
+}
+
+func (self Items) Add(item Item) (Items, ItemId) {
+	item_id := self.Next_id
+	items := self.Set(item_id, item)
+	items.Next_id += 1
+	return items, item_id
+}
+
+func (self Items) Get(item_id ItemId) (Item, bool) {
+	item, ok := self.content.Get(item_id)
+	if !ok {
+		return Item{}, false
+	}
+	return item.(Item), true
+}
+
+// Set adds or replaces an item, without touching Next_id.  It is used to
+// bring in items that come from another level.
+func (self Items) Set(item_id ItemId, item Item) Items {
+	self.content = self.content.Set(item_id, item)
+	return self
+}
+
+func (self Items) Delete(item_id ItemId) Items {
+	self.content = self.content.Delete(item_id)
+	return self
+}
+
+func (self Items) Len() int {
+	return self.content.Len()
+}
+
+// ForEach calls f for each item.
+func (self Items) ForEach(f func(item_id ItemId, item Item)) {
+	self.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(ItemId), value.(Item))
+	})
+}
+
+// itemsGob is what Items looks like to gob.
+type itemsGob struct {
+	Next_id ItemId
+	Content map[ItemId]Item
+}
+
+func (self Items) GobEncode() ([]byte, error) {
+	content := make(map[ItemId]Item, self.Len())
+	self.ForEach(func(item_id ItemId, item Item) {
+		content[item_id] = item
+	})
+	return gobEncode(itemsGob{self.Next_id, content})
+}
+
+func (self *Items) GobDecode(data []byte) error {
+	var decoded itemsGob
+	if err := gobDecode(data, &decoded); err != nil {
+		return err
+	}
+	*self = Items{Next_id: decoded.Next_id}
+	for item_id, item := range decoded.Content {
+		*self = self.Set(item_id, item)
+	}
+	return nil
+}
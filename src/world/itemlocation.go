@@ -0,0 +1,168 @@
+package world
+
+import (
+	"pmap"
+)
+
+// Each item on the ground has exactly one location.
+// Each location has any number of items, piled up: the last one dropped is on
+// top of the pile.
+
+type ItemLocationError int
+
+const (
+	IL_INSANE_LENGTH = ItemLocationError(iota)
+	IL_INSANE_BIJECTION
+	IL_ITEM_ALREADY_IN
+	IL_NOT_FOUND
+)
+
+var item_location_error_text = map[ItemLocationError]string{
+	IL_INSANE_LENGTH:    "insane because of length mismatch",
+	IL_INSANE_BIJECTION: "insane because of pile mismatch",
+	IL_ITEM_ALREADY_IN:  "item already registered",
+	IL_NOT_FOUND:        "not found",
+}
+
+func (self ItemLocationError) Error() string {
+	return item_location_error_text[self]
+}
+
+type ItemLocation struct {
+	// Both are persistent maps, updating them does not copy them.  The piles
+	// are slices that are never modified in place.
+	il pmap.Map // ItemId -> Location
+	lp pmap.Map // Location -> []ItemId, bottom of the pile first.
+}
+
+func MakeItemLocation() ItemLocation {
+	return ItemLocation{}
+}
+
+func (self ItemLocation) IsSane() error {
+	piled := 0
+	var err error
+	self.lp.ForEach(func(location pmap.Key, pile interface{}) {
+		for _, item_id := range pile.([]ItemId) {
+			back, ok := self.il.Get(item_id)
+			if !ok || back != location {
+				err = IL_INSANE_BIJECTION
+			}
+			piled++
+		}
+	})
+	if err == nil && piled != self.il.Len() {
+		err = IL_INSANE_LENGTH
+	}
+	return err
+}
+
+func (self ItemLocation) GetLocation(item_id ItemId) (Location, bool) {
+	location, ok := self.il.Get(item_id)
+	if !ok {
+		return Location{}, false
+	}
+	return location.(Location), true
+}
+
+// GetItems returns the pile of items at the given location, bottom first.
+// The returned slice must not be modified.
+func (self ItemLocation) GetItems(location Location) []ItemId {
+	pile, ok := self.lp.Get(location)
+	if !ok {
+		return nil
+	}
+	return pile.([]ItemId)
+}
+
+// Top returns the item on top of the pile at the given location.
+func (self ItemLocation) Top(location Location) (ItemId, bool) {
+	pile := self.GetItems(location)
+	if len(pile) == 0 {
+		return NO_ITEM, false
+	}
+	return pile[len(pile)-1], true
+}
+
+func (self ItemLocation) Len() int {
+	return self.il.Len()
+}
+
+// ForEach calls f for each item and its location.
+func (self ItemLocation) ForEach(f func(item_id ItemId, location Location)) {
+	self.il.ForEach(func(item pmap.Key, location interface{}) {
+		f(item.(ItemId), location.(Location))
+	})
+}
+
+// ForEachPile calls f for each location holding items, with its pile, bottom
+// first.  The slice must not be modified.
+func (self ItemLocation) ForEachPile(f func(location Location, pile []ItemId)) {
+	self.lp.ForEach(func(location pmap.Key, pile interface{}) {
+		f(location.(Location), pile.([]ItemId))
+	})
+}
+
+// Add puts the item on top of the pile at the given location.
+func (self ItemLocation) Add(item_id ItemId, location Location) (ItemLocation, error) {
+	if _, ok := self.il.Get(item_id); ok {
+		return self, IL_ITEM_ALREADY_IN
+	}
+	old_pile := self.GetItems(location)
+	pile := make([]ItemId, len(old_pile), len(old_pile)+1)
+	copy(pile, old_pile)
+	pile = append(pile, item_id)
+	result := self
+	result.il = result.il.Set(item_id, location)
+	result.lp = result.lp.Set(location, pile)
+	return result, nil
+}
+
+func (self ItemLocation) Remove(item_id ItemId) (ItemLocation, error) {
+	location, ok := self.GetLocation(item_id)
+	if !ok {
+		return self, IL_NOT_FOUND
+	}
+	old_pile := self.GetItems(location)
+	pile := make([]ItemId, 0, len(old_pile))
+	for _, other := range old_pile {
+		if other != item_id {
+			pile = append(pile, other)
+		}
+	}
+	result := self
+	result.il = result.il.Delete(item_id)
+	if len(pile) == 0 {
+		result.lp = result.lp.Delete(location)
+	} else {
+		result.lp = result.lp.Set(location, pile)
+	}
+	return result, nil
+}
+
+// GobEncode encodes the piles only, the other map can be deduced from them.
+func (self ItemLocation) GobEncode() ([]byte, error) {
+	piles := make(map[Location][]ItemId, self.lp.Len())
+	self.ForEachPile(func(location Location, pile []ItemId) {
+		piles[location] = pile
+	})
+	return gobEncode(piles)
+}
+
+func (self *ItemLocation) GobDecode(data []byte) error {
+	var piles map[Location][]ItemId
+	if err := gobDecode(data, &piles); err != nil {
+		return err
+	}
+	*self = MakeItemLocation()
+	for location, pile := range piles {
+		for _, item_id := range pile {
+			var err error
+			*self, err = self.Add(item_id, location)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,49 +1,112 @@
 package world
 
+import (
+	"fmt"
+	"sort"
+)
+
+// LevelId identifies a Level in the World.
+type LevelId uint16
+
+// Identifiers of creatures and actors are unique in the whole World, not only
+// in their Level.  This way, they can travel from one Level to another and
+// keep their identifier, which matters a lot for the player.  To achieve that,
+// each Level hands out new identifiers from its own range, starting at
+// level_id << levelIdShift.
+const levelIdShift = 48
+
 type Level struct {
+	Name             string
 	Floors           Buildings
 	Ceilings         Buildings
 	Walls            [4]Buildings // Sorted by facing.
 	Columns          Buildings
+	Doors            Buildings // Doors in the middle of tiles.
 	Dynamic          Dynamic
 	Actors           Actors
 	Creatures        Creatures
 	CreatureLocation CreatureLocation
 	CreatureActor    CreatureActor
 	ActorSchedule    ActorSchedule
+	Items            Items
+	ItemLocation     ItemLocation
+	Inventories      Inventories
+	Mechanisms       Mechanisms
+	Triggers         Triggers
+	Projectiles      Projectiles
+	Lights           Lights
+	Props            Props
+	Effects          FloorEffects
 }
 
-func MakeLevel() Level {
-	return Level{
+func MakeLevel(level_id LevelId) Level {
+	level := Level{
 		Floors:           MakeBuildings(),
 		Ceilings:         MakeBuildings(),
 		Columns:          MakeBuildings(),
+		Doors:            MakeBuildings(),
 		Actors:           MakeActors(),
 		Creatures:        MakeCreatures(),
 		CreatureLocation: MakeCreatureLocation(),
 		CreatureActor:    MakeCreatureActor(),
+		ActorSchedule:    MakeActorSchedule(),
+		Items:            MakeItems(),
+		ItemLocation:     MakeItemLocation(),
+		Inventories:      MakeInventories(),
+		Mechanisms:       MakeMechanisms(),
+		Triggers:         MakeTriggers(),
+		Projectiles:      MakeProjectiles(),
+		Lights:           MakeLights(),
+		Props:            MakeProps(),
+		Effects:          MakeFloorEffects(),
 	}
+	for i := range level.Walls {
+		level.Walls[i] = MakeBuildings()
+	}
+	level.Creatures.Next_id = CreatureId(level_id) << levelIdShift
+	level.Actors.NextIDprivate = ActorID(level_id) << levelIdShift
+	level.Items.Next_id = firstItemId(level_id)
+	return level
+}
+
+// firstItemId returns the first identifier handed out by the items of a level.
+// It skips NO_ITEM.
+func firstItemId(level_id LevelId) ItemId {
+	return ItemId(level_id)<<levelIdShift + 1
+}
+
+// isPassable tells whether a building lets creatures through.  Buildings that
+// are not Passers do not.
+func isPassable(building Building) bool {
+	passer, ok := building.(Passer)
+	return ok && passer.IsPassable()
 }
 
 func (level *Level) IsPassable(location Location, direction AbsoluteDirection) bool {
 	wall_passable := true   // By default, no wall is good.
 	floor_passable := false // By default, no floor is bad.
+	door_passable := true   // By default, no door is good.
 	// Western walls face East.
 	wall_facing := direction.Add(BACK())
 	wall_index := wall_facing.Value()
 
 	building, ok := level.Walls[wall_index].Get(location.X, location.Y)
 	if ok {
-		wall_passable = building.(Wall).IsPassable()
+		wall_passable = isPassable(building)
 	}
 
 	new_loc := location.MoveAbsolute(direction, 1)
 	building, ok = level.Floors.Get(new_loc.X, new_loc.Y)
 	if ok {
-		floor_passable = building.(Floor).IsPassable()
+		floor_passable = isPassable(building)
+	}
+
+	building, ok = level.Doors.Get(new_loc.X, new_loc.Y)
+	if ok {
+		door_passable = isPassable(building)
 	}
 
-	return wall_passable && floor_passable
+	return wall_passable && floor_passable && door_passable
 }
 
 func (self Level) ActorLocation(actor_id ActorID) (Location, bool) {
@@ -75,3 +138,149 @@ func (self Level) SetActorSchedule(actor_schedule ActorSchedule) Level {
 	self.ActorSchedule = actor_schedule
 	return self
 }
+
+// A Traveller is everything a Level knows about one of its creatures.  It is
+// what leaves a Level when a creature takes the stairs, and what arrives in
+// the destination Level.
+type Traveller struct {
+	Creature_id CreatureId
+	Creature    Creature
+	Has_actor   bool
+	Actor_id    ActorID
+	Actor       Actor
+	Scheduled   bool
+	Time        uint64 // Next time the actor acts, when Scheduled.
+	Inventory   Inventory
+	Items       map[ItemId]Item // The items of the Inventory.
+}
+
+// TakeCreature removes the creature from all the indexes of the Level and
+// returns it as a Traveller.
+func (self Level) TakeCreature(creature_id CreatureId) (Level, Traveller, error) {
+	creature, ok := self.Creatures.Get(creature_id)
+	if !ok {
+		return self, Traveller{}, fmt.Errorf("creature %v not in level", creature_id)
+	}
+	traveller := Traveller{Creature_id: creature_id, Creature: creature}
+	self.Creatures = self.Creatures.Delete(creature_id)
+	self.CreatureLocation, _ = self.CreatureLocation.RemoveCreature(creature_id)
+	actor_id, ok := self.CreatureActor.GetActor(creature_id)
+	if ok {
+		traveller.Has_actor = true
+		traveller.Actor_id = actor_id
+		traveller.Actor, _ = self.Actors.Get(actor_id)
+		self.CreatureActor, _ = self.CreatureActor.RemoveCreature(creature_id)
+		self.Actors = self.Actors.Delete(actor_id)
+		index := self.ActorSchedule.PosActorID(actor_id)
+		if index != -1 {
+			actor_time := self.ActorSchedule.Actor_times[index]
+			traveller.Scheduled = true
+			traveller.Time = actor_time.Time
+			self.ActorSchedule, _ = self.ActorSchedule.Remove(actor_time)
+		}
+	}
+	traveller.Inventory = self.Inventories.Get(creature_id)
+	traveller.Items = make(map[ItemId]Item)
+	for _, item_id := range traveller.Inventory.Items() {
+		traveller.Items[item_id], _ = self.Items.Get(item_id)
+		self.Items = self.Items.Delete(item_id)
+	}
+	self.Inventories = self.Inventories.Delete(creature_id)
+	return self, traveller, nil
+}
+
+// PutCreature adds a Traveller to all the indexes of the Level, at the given
+// position.  The traveller keeps its identifiers.
+func (self Level) PutCreature(traveller Traveller, position Position) (Level, error) {
+	if _, ok := self.Creatures.Get(traveller.Creature_id); ok {
+		return self, fmt.Errorf("creature %v already in level", traveller.Creature_id)
+	}
+	creature_location, err := self.CreatureLocation.Add(
+		traveller.Creature_id,
+		position.ToLocation(),
+	)
+	if err != nil {
+		return self, err
+	}
+	if traveller.Has_actor {
+		creature_actor, err := self.CreatureActor.Add(
+			traveller.Creature_id,
+			traveller.Actor_id,
+		)
+		if err != nil {
+			return self, err
+		}
+		if _, ok := self.Actors.Get(traveller.Actor_id); ok {
+			return self, fmt.Errorf("actor %v already in level", traveller.Actor_id)
+		}
+		self.CreatureActor = creature_actor
+		self.Actors = self.Actors.Insert(traveller.Actor_id, traveller.Actor)
+		if traveller.Scheduled {
+			self.ActorSchedule = self.ActorSchedule.Add(
+				traveller.Actor_id,
+				traveller.Time,
+			)
+		}
+	}
+	for item_id, item := range traveller.Items {
+		if _, ok := self.Items.Get(item_id); ok {
+			return self, fmt.Errorf("item %v already in level", item_id)
+		}
+		self.Items = self.Items.Set(item_id, item)
+	}
+	self.Inventories = self.Inventories.Set(traveller.Creature_id, traveller.Inventory)
+	creature := traveller.Creature
+	creature.F = position.F
+	self.Creatures = self.Creatures.Set(traveller.Creature_id, creature)
+	self.CreatureLocation = creature_location
+	return self, nil
+}
+
+// Levels holds all the levels of a World, indexed by their identifier.
+type Levels map[LevelId]Level
+
+func MakeLevels() Levels {
+	return make(Levels)
+}
+
+// Making copies is required to produce updated version of maps.
+func (src Levels) Copy() Levels {
+	dst := make(Levels, len(src))
+	for key, value := range src {
+		dst[key] = value
+	}
+	return dst
+}
+
+func (src Levels) Get(level_id LevelId) (Level, bool) {
+	level, ok := src[level_id]
+	return level, ok
+}
+
+func (src Levels) Set(level_id LevelId, level Level) Levels {
+	dst := src.Copy()
+	dst[level_id] = level
+	return dst
+}
+
+func (src Levels) Delete(level_id LevelId) Levels {
+	dst := src.Copy()
+	delete(dst, level_id)
+	return dst
+}
+
+// Ids returns the identifiers of all the levels, sorted.
+func (src Levels) Ids() []LevelId {
+	ids := make([]LevelId, 0, len(src))
+	for level_id := range src {
+		ids = append(ids, level_id)
+	}
+	sort.Sort(levelIds(ids))
+	return ids
+}
+
+type levelIds []LevelId
+
+func (ids levelIds) Len() int           { return len(ids) }
+func (ids levelIds) Less(i, j int) bool { return ids[i] < ids[j] }
+func (ids levelIds) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
@@ -0,0 +1,827 @@
+package world
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// This file implements a plain text format for levels, so that they can be
+// written by hand and kept in version control.  It looks like this:
+//
+//     ; Comments start with a semicolon.
+//     [level]
+//     name Entry hall
+//     origin -1 2
+//     size 4 3
+//     [legend]
+//     > floor 2 E passable
+//     # wall 3 blocked
+//     M creature W actor monsters
+//     [floors]
+//     .>>.
+//     >>>>
+//     .>>.
+//     [walls north]
+//     .##.
+//     ....
+//     ....
+//     [creatures]
+//     ..M.
+//     ....
+//     ....
+//
+// The [level] section gives the name of the level, the coordinates of the
+// top-left character of the grids (origin), and the width and height of the
+// grids (size).  The first row of a grid is the northernmost one, and x grows
+// from left to right.
+//
+// The [legend] section maps each character to a building or a creature.  The
+// character '.' always means "nothing".  Pits are floors that give whether
+// they are open, whether they are hidden, where what falls lands (level, x
+// and y), the dice, sides and type of the damage of the fall, and whether
+// they are passable when closed:
+//
+//     O pit 0 E open visible 1 4 -2 1 6 blunt passable
+//
+// Then come the grids: [floors], [ceilings], [columns], [doors], [creatures],
+// [effects], and one grid for each facing of the walls: [walls east], [walls
+// north], [walls west] and [walls south].  A wall facing north sits on the
+// southern edge of its tile, facing the inside of the tile.  Doors in walls go
+// in the wall grids, on both sides; the [doors] grid holds the doors standing
+// in the middle of tiles.  The [effects] grid holds the teleporters and the
+// spinners, described in the legend like this:
+//
+//     T teleporter 1 4 -2 N on
+//     t teleporter 0 3 3 keep off
+//     S spinner 2 on
+//
+// The teleporters give the level, x, y and facing of their destination, or
+// "keep" when creatures keep their own facing.  The spinners give how many
+// quarter turns to the left they make creatures do.  Missing grids are empty.
+//
+// The creatures and the floor effects of the grids get new identifiers when
+// the text is decoded, the grids are there to write levels by hand.
+// EncodeLevel writes them in the [state] section instead, along with the
+// items, the mechanisms, the triggers, the projectiles, the lights, the props
+// and the schedule of the actors, so that decoding gives back the very same
+// Level.  The [state] section is described in leveltextstate.go.
+
+const (
+	textEmpty   = '.'
+	textComment = ';'
+	textSection = '['
+)
+
+// The sections holding grids, in the order in which they are written.
+var text_grids = [...]string{
+	"floors",
+	"ceilings",
+	"walls east",
+	"walls north",
+	"walls west",
+	"walls south",
+	"columns",
+	"doors",
+	"creatures",
+	"effects",
+}
+
+// The grids that do not hold buildings.
+const (
+	textCreatures = 8
+	textEffects   = 9
+)
+
+var text_facings = [...]string{"E", "N", "W", "S"}
+
+// Characters given to legend entries when their preferred ones are taken.
+const text_glyph_pool = "abcdefghijklmnopqrstuvwxyz" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+	"0123456789" +
+	"!\"$%&'()*+,-/:<=>?@\\]^_`{|}~#"
+
+func facingToText(facing AbsoluteDirection) string {
+	return text_facings[facing.Value()]
+}
+
+func textToFacing(text string) (AbsoluteDirection, error) {
+	for i, name := range text_facings {
+		if name == text {
+			return absoluteDirection{i}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid facing %q", text)
+}
+
+func passableToText(passable bool) string {
+	if passable {
+		return "passable"
+	}
+	return "blocked"
+}
+
+func textToPassable(text string) (bool, error) {
+	switch text {
+	case "passable":
+		return true, nil
+	case "blocked":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected passable or blocked, not %q", text)
+}
+
+// buildingToText returns the legend description of a building.
+func buildingToText(building Building) (string, error) {
+	switch b := building.(type) {
+	case Stairs:
+		return fmt.Sprintf(
+			"stairs %v %v %v %v %v %v %v",
+			b.Model_, facingToText(b.F), passableToText(b.Passable_),
+			b.To.Level, b.To.X, b.To.Y, facingToText(b.To.F),
+		), nil
+	case Ladder:
+		return fmt.Sprintf(
+			"ladder %v %v %v %v %v %v",
+			b.Model_, facingToText(b.F), passableToText(b.Passable_),
+			b.To.Level, b.To.X, b.To.Y,
+		), nil
+	case Pit:
+		state, visibility := "closed", "visible"
+		if b.Open {
+			state = "open"
+		}
+		if b.Hidden {
+			visibility = "hidden"
+		}
+		return fmt.Sprintf(
+			"pit %v %v %v %v %v %v %v %v %v %v %v",
+			b.Model_, facingToText(b.F), state, visibility,
+			b.To.Level, b.To.X, b.To.Y, b.Damage.Dice, b.Damage.Sides,
+			b.Damage.Type, passableToText(b.Passable_),
+		), nil
+	case Floor:
+		return fmt.Sprintf(
+			"floor %v %v %v",
+			b.Model_, facingToText(b.F), passableToText(b.Passable_),
+		), nil
+	case Door:
+		return fmt.Sprintf(
+			"door %v %v %v",
+			b.Model_, b.State_, facingToText(b.Axis_),
+		), nil
+	case Wall:
+		return fmt.Sprintf(
+			"wall %v %v",
+			b.Model_, passableToText(b.Passable_),
+		), nil
+	case OrientedBuilding:
+		return fmt.Sprintf("oriented %v %v", b.Model_, facingToText(b.F)), nil
+	case BaseBuilding:
+		return fmt.Sprintf("base %v", b.Model_), nil
+	}
+	return "", fmt.Errorf("cannot write building of type %T", building)
+}
+
+func activeToText(active bool) string {
+	if active {
+		return "on"
+	}
+	return "off"
+}
+
+// effectToText returns the legend description of a floor effect.
+func effectToText(effect FloorEffect) (string, error) {
+	switch effect.Kind {
+	case EFFECT_TELEPORTER:
+		facing := "keep"
+		if !effect.Keep_facing {
+			facing = facingToText(effect.To.F)
+		}
+		return fmt.Sprintf(
+			"teleporter %v %v %v %v %v",
+			effect.To.Level, effect.To.X, effect.To.Y, facing,
+			activeToText(effect.Active),
+		), nil
+	case EFFECT_SPINNER:
+		return fmt.Sprintf(
+			"spinner %v %v",
+			(effect.Turns%4+4)%4, activeToText(effect.Active),
+		), nil
+	}
+	return "", fmt.Errorf("cannot write floor effect %v", effect.Kind)
+}
+
+// textParser reads the fields of a legend description one at a time, and
+// remembers the first error.
+type textParser struct {
+	fields []string
+	err    error
+}
+
+func (p *textParser) next() string {
+	if len(p.fields) == 0 {
+		if p.err == nil {
+			p.err = fmt.Errorf("missing field")
+		}
+		return ""
+	}
+	field := p.fields[0]
+	p.fields = p.fields[1:]
+	return field
+}
+
+func (p *textParser) int(bits int) int64 {
+	field := p.next()
+	if p.err != nil {
+		return 0
+	}
+	value, err := strconv.ParseInt(field, 10, bits)
+	if err != nil {
+		p.err = err
+	}
+	return value
+}
+
+func (p *textParser) model() ModelId {
+	field := p.next()
+	if p.err != nil {
+		return 0
+	}
+	value, err := strconv.ParseUint(field, 10, 16)
+	if err != nil {
+		p.err = err
+	}
+	return ModelId(value)
+}
+
+func (p *textParser) level() LevelId {
+	field := p.next()
+	if p.err != nil {
+		return 0
+	}
+	value, err := strconv.ParseUint(field, 10, 16)
+	if err != nil {
+		p.err = err
+	}
+	return LevelId(value)
+}
+
+func (p *textParser) coord() Coord {
+	return Coord(p.int(0))
+}
+
+func (p *textParser) facing() AbsoluteDirection {
+	field := p.next()
+	if p.err != nil {
+		return EAST()
+	}
+	facing, err := textToFacing(field)
+	if err != nil {
+		p.err = err
+		return EAST()
+	}
+	return facing
+}
+
+func (p *textParser) doorState() DoorState {
+	field := p.next()
+	if p.err != nil {
+		return DOOR_CLOSED
+	}
+	for state, name := range door_state_text {
+		if name == field {
+			return state
+		}
+	}
+	p.err = fmt.Errorf("invalid door state %q", field)
+	return DOOR_CLOSED
+}
+
+func (p *textParser) faction() Faction {
+	field := p.next()
+	if p.err != nil {
+		return FACTION_NEUTRAL
+	}
+	for faction, name := range faction_text {
+		if name == field {
+			return faction
+		}
+	}
+	p.err = fmt.Errorf("invalid faction %q", field)
+	return FACTION_NEUTRAL
+}
+
+func (p *textParser) damageType() DamageType {
+	field := p.next()
+	if p.err != nil {
+		return DAMAGE_BLUNT
+	}
+	for damage_type, name := range damage_type_text {
+		if name == field {
+			return damage_type
+		}
+	}
+	p.err = fmt.Errorf("invalid damage type %q", field)
+	return DAMAGE_BLUNT
+}
+
+func (p *textParser) passable() bool {
+	field := p.next()
+	if p.err != nil {
+		return false
+	}
+	passable, err := textToPassable(field)
+	if err != nil {
+		p.err = err
+	}
+	return passable
+}
+
+// choice reads a field that must be one of two words, and tells whether it is
+// the first one.
+func (p *textParser) choice(yes, no string) bool {
+	field := p.next()
+	if p.err != nil {
+		return false
+	}
+	switch field {
+	case yes:
+		return true
+	case no:
+		return false
+	}
+	p.err = fmt.Errorf("expected %v or %v, not %q", yes, no, field)
+	return false
+}
+
+func (p *textParser) active() bool {
+	return p.choice("on", "off")
+}
+
+func (p *textParser) done() error {
+	if p.err == nil && len(p.fields) != 0 {
+		p.err = fmt.Errorf("unexpected %q", strings.Join(p.fields, " "))
+	}
+	return p.err
+}
+
+// textToBuilding parses the legend description of a building.
+func textToBuilding(text string) (Building, error) {
+	p := textParser{fields: strings.Fields(text)}
+	var building Building
+	switch kind := p.next(); kind {
+	case "stairs":
+		model, facing, passable := p.model(), p.facing(), p.passable()
+		var to LevelPosition
+		to.Level, to.X, to.Y, to.F = p.level(), p.coord(), p.coord(), p.facing()
+		stairs := MakeStairs(model, facing, to)
+		stairs.Passable_ = passable
+		building = stairs
+	case "ladder":
+		model, facing, passable := p.model(), p.facing(), p.passable()
+		var to LevelLocation
+		to.Level, to.X, to.Y = p.level(), p.coord(), p.coord()
+		ladder := MakeLadder(model, facing, to)
+		ladder.Passable_ = passable
+		building = ladder
+	case "pit":
+		model, facing := p.model(), p.facing()
+		open, hidden := p.choice("open", "closed"), p.choice("hidden", "visible")
+		var to LevelLocation
+		to.Level, to.X, to.Y = p.level(), p.coord(), p.coord()
+		pit := MakePit(model, facing, open, to)
+		pit.Hidden = hidden
+		pit.Damage.Dice, pit.Damage.Sides = int(p.int(0)), int(p.int(0))
+		// The type of the damage and the passability came later.
+		if len(p.fields) != 0 {
+			pit.Damage.Type = p.damageType()
+			pit.Passable_ = p.passable()
+		}
+		building = pit
+	case "floor":
+		building = MakeFloor(p.model(), p.facing(), p.passable())
+	case "door":
+		model, state := p.model(), p.doorState()
+		building = MakeDoor(model, state, p.facing())
+	case "wall":
+		building = MakeWall(p.model(), p.passable())
+	case "oriented":
+		building = MakeOrientedBuilding(p.model(), p.facing())
+	case "base":
+		building = MakeBaseBuilding(p.model())
+	default:
+		return nil, fmt.Errorf("unknown building %q", kind)
+	}
+	return building, p.done()
+}
+
+// textToEffect parses the legend description of a floor effect.  Its location
+// is left for the grid to give.
+func textToEffect(text string) (FloorEffect, error) {
+	p := textParser{fields: strings.Fields(text)}
+	var effect FloorEffect
+	switch kind := p.next(); kind {
+	case "teleporter":
+		var to LevelPosition
+		to.Level, to.X, to.Y = p.level(), p.coord(), p.coord()
+		keep_facing := len(p.fields) != 0 && p.fields[0] == "keep"
+		if keep_facing {
+			p.next()
+			to.F = EAST()
+		} else {
+			to.F = p.facing()
+		}
+		effect = MakeTeleporter(Location{}, to, keep_facing)
+	case "spinner":
+		effect = MakeSpinner(Location{}, int(p.int(0)))
+	default:
+		return effect, fmt.Errorf("unknown floor effect %q", kind)
+	}
+	effect.Active = p.active()
+	return effect, p.done()
+}
+
+// A textSpawn is what the legend knows about a creature.
+type textSpawn struct {
+	Creature  Creature
+	Has_actor bool
+}
+
+func spawnToText(spawn textSpawn) string {
+	actor := "noactor"
+	if spawn.Has_actor {
+		actor = "actor"
+	}
+	return fmt.Sprintf(
+		"creature %v %v %v",
+		facingToText(spawn.Creature.F), actor, spawn.Creature.Faction,
+	)
+}
+
+func textToSpawn(text string) (textSpawn, error) {
+	p := textParser{fields: strings.Fields(text)}
+	var spawn textSpawn
+	p.next() // "creature"
+	spawn.Creature = MakeCreature()
+	spawn.Creature.F = p.facing()
+	switch actor := p.next(); actor {
+	case "actor":
+		spawn.Has_actor = true
+	case "noactor":
+	default:
+		if p.err == nil {
+			p.err = fmt.Errorf("expected actor or noactor, not %q", actor)
+		}
+	}
+	// The faction came later, creatures without one are neutral.
+	if len(p.fields) != 0 {
+		spawn.Creature.Faction = p.faction()
+	}
+	return spawn, p.done()
+}
+
+// preferredGlyphs returns the characters that suit a legend description best,
+// so that the most common things look the same in every level.
+func preferredGlyphs(text string) string {
+	fields := strings.Fields(text)
+	switch fields[0] {
+	case "floor":
+		if fields[3] == "blocked" {
+			return "x"
+		}
+		return map[string]string{"E": ">", "N": "^", "W": "<", "S": "v"}[fields[2]]
+	case "wall":
+		if fields[2] == "passable" {
+			return "%"
+		}
+		return "#"
+	case "oriented":
+		return strings.ToLower(fields[2])
+	case "door":
+		return map[string]string{"open": "'", "closed": "+", "locked": "=", "broken": "_"}[fields[2]]
+	case "stairs", "ladder":
+		return "Hh"
+	case "pit":
+		return "Oo0"
+	case "creature":
+		return "M@"
+	case "teleporter":
+		return "Tt"
+	case "spinner":
+		return "Ss"
+	}
+	return ""
+}
+
+// textLevelLayers returns the buildings of the level in the same order as the
+// text_grids, creatures and floor effects excepted.
+func textLevelLayers(level *Level) []*Buildings {
+	return []*Buildings{
+		&level.Floors,
+		&level.Ceilings,
+		&level.Walls[0],
+		&level.Walls[1],
+		&level.Walls[2],
+		&level.Walls[3],
+		&level.Columns,
+		&level.Doors,
+	}
+}
+
+// EncodeLevel writes the level in the plain text format described above.
+func EncodeLevel(w io.Writer, level Level) error {
+	layers := textLevelLayers(&level)
+	// Describe everything, and find the bounds of the grids.
+	descriptions := make(map[string]bool)
+	texts := make([]map[Location]string, len(text_grids))
+	first := true
+	var min, max Location
+	include := func(location Location) {
+		if first || location.X < min.X {
+			min.X = location.X
+		}
+		if first || location.Y < min.Y {
+			min.Y = location.Y
+		}
+		if first || location.X > max.X {
+			max.X = location.X
+		}
+		if first || location.Y > max.Y {
+			max.Y = location.Y
+		}
+		first = false
+	}
+	var err error
+	for i, layer := range layers {
+		texts[i] = make(map[Location]string)
+		layer.ForEach(func(location Location, building Building) {
+			text, err_text := buildingToText(building)
+			if err_text != nil {
+				err = err_text
+				return
+			}
+			texts[i][location] = text
+			descriptions[text] = true
+			include(location)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// Give a character to each description.
+	sorted := make([]string, 0, len(descriptions))
+	for text := range descriptions {
+		sorted = append(sorted, text)
+	}
+	sort.Strings(sorted)
+	glyphs := make(map[string]byte, len(sorted))
+	used := make(map[byte]bool, len(sorted))
+	for _, text := range sorted {
+		for _, glyph := range []byte(preferredGlyphs(text) + text_glyph_pool) {
+			if !used[glyph] {
+				glyphs[text] = glyph
+				used[glyph] = true
+				break
+			}
+		}
+		if _, ok := glyphs[text]; !ok {
+			return fmt.Errorf("too many different things in the level")
+		}
+	}
+
+	// Write it all.
+	out := bufio.NewWriter(w)
+	width, height := 0, 0
+	if !first {
+		width, height = int(max.X-min.X)+1, int(max.Y-min.Y)+1
+	}
+	fmt.Fprintf(out, "[level]\n")
+	fmt.Fprintf(out, "%v\n", strings.TrimSpace("name "+level.Name))
+	fmt.Fprintf(out, "origin %v %v\n", min.X, max.Y)
+	fmt.Fprintf(out, "size %v %v\n", width, height)
+	fmt.Fprintf(out, "[legend]\n")
+	for _, text := range sorted {
+		fmt.Fprintf(out, "%c %v\n", glyphs[text], text)
+	}
+	row := make([]byte, width)
+	for i, name := range text_grids {
+		if i == textCreatures || i == textEffects {
+			continue // They go to the [state] section.
+		}
+		fmt.Fprintf(out, "[%v]\n", name)
+		for y := max.Y; height > 0 && y >= min.Y; y-- {
+			for x := min.X; x <= max.X; x++ {
+				text, ok := texts[i][Location{x, y}]
+				if ok {
+					row[x-min.X] = glyphs[text]
+				} else {
+					row[x-min.X] = textEmpty
+				}
+			}
+			out.Write(row)
+			out.WriteByte('\n')
+		}
+	}
+	if err := encodeState(out, level); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// DecodeLevel reads a level written in the plain text format described above.
+// The level_id is needed to give identifiers to the creatures.
+func DecodeLevel(r io.Reader, level_id LevelId) (Level, error) {
+	level := MakeLevel(level_id)
+	layers := textLevelLayers(&level)
+	buildings := make(map[byte]Building)
+	spawns := make(map[byte]textSpawn)
+	effects := make(map[byte]FloorEffect)
+	var origin Location
+	var next textNext
+	has_next := false
+	width, height := 0, 0
+	section := ""
+	row := 0
+	scanner := bufio.NewScanner(r)
+	line_nb := 0
+	fail := func(format string, a ...interface{}) (Level, error) {
+		return level, fmt.Errorf("line %v: %v", line_nb, fmt.Sprintf(format, a...))
+	}
+	for scanner.Scan() {
+		line_nb++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if len(line) == 0 || line[0] == textComment {
+			continue
+		}
+		if line[0] == textSection {
+			if !strings.HasSuffix(line, "]") {
+				return fail("unterminated section %q", line)
+			}
+			if isTextGrid(section) && row != height {
+				return fail("section [%v] has %v rows instead of %v", section, row, height)
+			}
+			section = line[1 : len(line)-1]
+			row = 0
+			continue
+		}
+		switch section {
+		case "level":
+			fields := strings.SplitN(line, " ", 2)
+			p := textParser{fields: strings.Fields(line)[1:]}
+			switch fields[0] {
+			case "name":
+				if len(fields) > 1 {
+					level.Name = fields[1]
+				}
+				p.fields = nil
+			case "origin":
+				origin.X, origin.Y = p.coord(), p.coord()
+			case "size":
+				width, height = int(p.int(0)), int(p.int(0))
+				if width < 0 || height < 0 {
+					return fail("negative size")
+				}
+			default:
+				return fail("unknown property %q", fields[0])
+			}
+			if err := p.done(); err != nil {
+				return fail("%v", err)
+			}
+		case "legend":
+			if len(line) < 3 || line[1] != ' ' {
+				return fail("legend entries look like '<character> <description>'")
+			}
+			glyph, text := line[0], line[2:]
+			if glyph == textEmpty {
+				return fail("%q always means nothing", textEmpty)
+			}
+			if _, ok := buildings[glyph]; ok {
+				return fail("%q defined twice", glyph)
+			}
+			if _, ok := spawns[glyph]; ok {
+				return fail("%q defined twice", glyph)
+			}
+			if _, ok := effects[glyph]; ok {
+				return fail("%q defined twice", glyph)
+			}
+			if strings.HasPrefix(text, "creature") {
+				spawn, err := textToSpawn(text)
+				if err != nil {
+					return fail("%v", err)
+				}
+				spawns[glyph] = spawn
+			} else if strings.HasPrefix(text, "teleporter") || strings.HasPrefix(text, "spinner") {
+				effect, err := textToEffect(text)
+				if err != nil {
+					return fail("%v", err)
+				}
+				effects[glyph] = effect
+			} else {
+				building, err := textToBuilding(text)
+				if err != nil {
+					return fail("%v", err)
+				}
+				buildings[glyph] = building
+			}
+		case "state":
+			var err error
+			if strings.HasPrefix(line, "Next ") || line == "Next" {
+				has_next = true
+			}
+			level, err = decodeStateLine(level, &next, line)
+			if err != nil {
+				return fail("%v", err)
+			}
+		default:
+			grid := -1
+			for i, name := range text_grids {
+				if name == section {
+					grid = i
+				}
+			}
+			if grid == -1 {
+				return fail("unknown section [%v]", section)
+			}
+			if len(line) != width {
+				return fail("row of length %v instead of %v", len(line), width)
+			}
+			if row >= height {
+				return fail("more than %v rows", height)
+			}
+			y := origin.Y - Coord(row)
+			for i := 0; i < width; i++ {
+				glyph := line[i]
+				if glyph == textEmpty {
+					continue
+				}
+				x := origin.X + Coord(i)
+				switch grid {
+				case textCreatures:
+					spawn, ok := spawns[glyph]
+					if !ok {
+						return fail("%q is not a creature", glyph)
+					}
+					var err error
+					level, err = level.spawnCreature(spawn, Location{x, y})
+					if err != nil {
+						return fail("%v", err)
+					}
+				case textEffects:
+					effect, ok := effects[glyph]
+					if !ok {
+						return fail("%q is not a floor effect", glyph)
+					}
+					effect.Location = Location{x, y}
+					level.Effects, _ = level.Effects.Add(effect)
+				default:
+					building, ok := buildings[glyph]
+					if !ok {
+						return fail("%q is not a building", glyph)
+					}
+					*layers[grid] = layers[grid].Set(x, y, building)
+				}
+			}
+			row++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return level, err
+	}
+	if isTextGrid(section) && row != height {
+		return fail("section [%v] has %v rows instead of %v", section, row, height)
+	}
+	if has_next {
+		level = level.setNext(next)
+	}
+	return level, nil
+}
+
+// isTextGrid tells whether a section holds a grid.
+func isTextGrid(section string) bool {
+	return section != "" && section != "level" && section != "legend" && section != "state"
+}
+
+// spawnCreature adds a new creature to the level, with an actor if needed.
+func (level Level) spawnCreature(spawn textSpawn, location Location) (Level, error) {
+	creatures, creature_id := level.Creatures.Add(spawn.Creature)
+	creature_location, err := level.CreatureLocation.Add(creature_id, location)
+	if err != nil {
+		return level, err
+	}
+	if spawn.Has_actor {
+		actors, actor_id := level.Actors.Add(MakeActor())
+		creature_actor, err := level.CreatureActor.Add(creature_id, actor_id)
+		if err != nil {
+			return level, err
+		}
+		level.Actors = actors
+		level.CreatureActor = creature_actor
+	}
+	level.Creatures = creatures
+	level.CreatureLocation = creature_location
+	return level, nil
+}
@@ -0,0 +1,153 @@
+package world
+
+import (
+	"bytes"
+	"glm"
+	"strings"
+	"testing"
+)
+
+func levelHash(level Level, level_id LevelId) uint64 {
+	var sum hashSum
+	level.hash(&sum, level_id)
+	return uint64(sum)
+}
+
+// fullLevel is a level with something in every part of it.
+func fullLevel(test *testing.T) Level {
+	level := MakeLevel(1)
+	level.Name = "Everything"
+	level.Dynamic = Dynamic{T0: 77}
+	for x := Coord(0); x < 4; x++ {
+		for y := Coord(0); y < 3; y++ {
+			level.Floors = level.Floors.Set(x, y, MakeFloor(1, EAST(), true))
+			level.Ceilings = level.Ceilings.Set(x, y, MakeOrientedBuilding(2, NORTH()))
+		}
+	}
+	pit := MakePit(3, WEST(), true, LevelLocation{0, Location{1, 1}})
+	pit.Damage = Weapon{Dice: 2, Sides: 4, Type: DAMAGE_FIRE}
+	pit.Hidden = true
+	level.Floors = level.Floors.Set(3, 2, pit)
+	level.Floors = level.Floors.Set(0, 2, MakeStairs(4, SOUTH(), LevelPosition{0, Position{Location{2, 2}, NORTH()}}))
+	level.Floors = level.Floors.Set(1, 2, MakeLadder(4, EAST(), LevelLocation{2, Location{5, 5}}))
+	level.Walls[EAST().Value()] = level.Walls[EAST().Value()].Set(0, 0, MakeWall(5, false))
+	level.Walls[SOUTH().Value()] = level.Walls[SOUTH().Value()].Set(1, 0, MakeDoor(6, DOOR_LOCKED, EAST()))
+	level.Walls[NORTH().Value()] = level.Walls[NORTH().Value()].Set(1, 1, MakeDoor(6, DOOR_LOCKED, EAST()))
+	level.Columns = level.Columns.Set(2, 1, MakeBaseBuilding(7))
+	level.Doors = level.Doors.Set(2, 0, MakeDoor(6, DOOR_OPEN, NORTH()))
+
+	// A wounded monster, carrying a lit lantern and a sword.
+	monster := MakeCreature()
+	monster.F = WEST()
+	monster.Faction = FACTION_MONSTERS
+	monster.Stats.Hp.Current = 15
+	monster.Stats.Resistances[DAMAGE_COLD] = -50
+	monster.Light = MakeLantern()
+	creatures, creature_id := level.Creatures.Add(monster)
+	actors, actor_id := level.Actors.Add(MakeActor())
+	level.Creatures, level.Actors = creatures, actors
+	level.CreatureActor, _ = level.CreatureActor.Add(creature_id, actor_id)
+	level.CreatureLocation, _ = level.CreatureLocation.Add(creature_id, Location{1, 1})
+	level.ActorSchedule = level.ActorSchedule.Add(actor_id, 1000)
+	items, sword := level.Items.Add(MakeItem(8, "Short \"sharp\" sword", EQUIP_HAND))
+	items, rock := items.Add(MakeItem(9, "rock", EQUIP_NONE))
+	items, bread := items.Add(MakeItem(11, "bread", EQUIP_NONE))
+	level.Items = items
+	inventory := MakeInventory()
+	inventory.Carried = []ItemId{bread}
+	inventory.Equipped[EQUIP_HAND] = sword
+	level.Inventories = level.Inventories.Set(creature_id, inventory)
+	level.ItemLocation, _ = level.ItemLocation.Add(rock, Location{2, 2})
+
+	// A launcher, wired to a lever, and the arrow it shot.
+	actors, launcher_id := level.Actors.Add(MakeActor())
+	level.Actors = actors
+	anchor := Anchor{Location{0, 0}, true, WEST()}
+	level.Mechanisms = level.Mechanisms.Set(launcher_id, MakeMechanism(MECHANISM_ARROW_LAUNCHER, anchor))
+	lever := MakeTrigger(TRIGGER_LEVER, Anchor{Location{3, 0}, true, NORTH()})
+	lever.Wires = []Wire{
+		{Target{Kind: TARGET_MECHANISM, Mechanism: launcher_id}, WIRE_TOGGLE},
+		{Target{Kind: TARGET_PIT, Pit: Location{3, 2}}, WIRE_INVERT},
+	}
+	level.Triggers, _ = level.Triggers.Add(lever)
+	actors, arrow_id := level.Actors.Add(MakeActor())
+	level.Actors = actors
+	level.Projectiles = level.Projectiles.Set(arrow_id, MakeProjectile(Location{1, 0}, EAST(), 100, 3, BARE_HANDS))
+
+	level.Lights, _ = level.Lights.Add(LightSource{MakeTorch(), Anchor{Location{1, 1}, false, EAST()}})
+	prop := MakeProp(10, Location{2, 1}, ANIMATION_TRACK)
+	prop.Track = []Keyframe{{0, glm.Vector3{0, 0, .5}, glm.Quat{1, 0, 0, 0}}, {500, glm.Vector3{.25, 0, .5}, glm.Quat{0, 0, 0, 1}}}
+	level.Props, _ = level.Props.Add(prop)
+	level.Effects, _ = level.Effects.Add(MakeTeleporter(Location{0, 1}, LevelPosition{0, Position{Location{1, 1}, SOUTH()}}, false))
+	level.Effects, _ = level.Effects.Add(MakeSpinner(Location{3, 1}, 3))
+	if problems := level.Validate(); len(problems) != 0 {
+		test.Fatal(problems)
+	}
+	return level
+}
+
+func TestLevelTextRoundTrip(test *testing.T) {
+	level := fullLevel(test)
+	var text bytes.Buffer
+	if err := EncodeLevel(&text, level); err != nil {
+		test.Fatal(err)
+	}
+	decoded, err := DecodeLevel(strings.NewReader(text.String()), 1)
+	if err != nil {
+		test.Fatal(err, "\n", text.String())
+	}
+	if levelHash(decoded, 1) != levelHash(level, 1) {
+		var again bytes.Buffer
+		EncodeLevel(&again, decoded)
+		test.Errorf("The level changed through text:\n%v\n%v", text.String(), again.String())
+	}
+}
+
+// Levels written by hand have no [state]: the creatures of the grid get new
+// identifiers.
+func TestLevelTextSpawns(test *testing.T) {
+	text := `[level]
+name Cell
+origin 0 0
+size 2 1
+[legend]
+> floor 1 E passable
+M creature W actor monsters
+O pit 0 E closed visible 0 4 -2 1 6
+[floors]
+>O
+[creatures]
+M.
+`
+	level, err := DecodeLevel(strings.NewReader(text), 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	creature_id, ok := level.CreatureLocation.GetCreature(Location{0, 0})
+	if !ok {
+		test.Fatal("The monster did not spawn.")
+	}
+	if _, ok := level.CreatureActor.GetActor(creature_id); !ok {
+		test.Error("The monster has no actor.")
+	}
+	floor, _ := level.Floors.Get(1, 0)
+	if pit, ok := floor.(Pit); !ok || pit.Damage.Type != DAMAGE_BLUNT || !pit.IsPassable() {
+		test.Error("Old pits changed:", floor)
+	}
+}
+
+func TestLevelTextBadState(test *testing.T) {
+	for _, line := range []string{
+		"Creatures 0 Nope=1",
+		"Creatures 0 Stats.Hp.Current=many",
+		"Inventories 0 Carried.0=5",
+		"Creatures zero",
+		"Weather 0",
+		"CreatureActor 0 1 2",
+	} {
+		text := "[level]\nsize 0 0\n[state]\n" + line + "\n"
+		if _, err := DecodeLevel(strings.NewReader(text), 0); err == nil {
+			test.Errorf("%q decoded.", line)
+		}
+	}
+}
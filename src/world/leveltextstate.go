@@ -0,0 +1,529 @@
+package world
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The [state] section of the text format holds what the grids cannot show:
+// everything that has an identifier, the counters of the identifiers, the
+// schedule of the actors and the birth of the level.  Each line starts with
+// the name of a field of the Level, then the identifier for collections, then
+// the value:
+//
+//     [state]
+//     Next Actors=2 Creatures=1 Items=1048577
+//     Actors 1
+//     Creatures 0 F=W Faction=monsters Stats.Hp.Current=15 Stats.Hp.Max=20
+//     CreatureLocation 0 X=2 Y=-1
+//     CreatureActor 0 1
+//     Items 1048576 Name="Short sword" Slot=hand Weapon.Dice=1 Weapon.Sides=6
+//     Inventories 0 Carried.len=1 Carried.0=1048576
+//
+// Structures are written as Path=value for each of their fields that is not
+// zero, the others are zero.  Paths go down nested structures with their
+// field names and into arrays and slices with indices; slices give their
+// length first, as in Carried.len=1.  Strings are quoted, facings are E, N, W
+// or S, and kinds are written by name, with dashes for spaces.  Values that
+// are not structures, arrays or slices are written alone.
+
+// textNext holds the counters of the identifiers, as the Next line gives them.
+type textNext struct {
+	Actors    ActorID
+	Creatures CreatureId
+	Items     ItemId
+	Triggers  TriggerId
+	Lights    LightId
+	Props     PropId
+	Effects   FloorEffectId
+}
+
+// The kinds written by name.  Their values are maps from the kind to its
+// name.
+var text_kinds = map[reflect.Type]reflect.Value{
+	reflect.TypeOf(Faction(0)):         reflect.ValueOf(faction_text),
+	reflect.TypeOf(DamageType(0)):      reflect.ValueOf(damage_type_text),
+	reflect.TypeOf(DoorState(0)):       reflect.ValueOf(door_state_text),
+	reflect.TypeOf(EquipSlot(0)):       reflect.ValueOf(equip_slot_text),
+	reflect.TypeOf(MechanismKind(0)):   reflect.ValueOf(mechanism_kind_text),
+	reflect.TypeOf(AnimationKind(0)):   reflect.ValueOf(animation_kind_text),
+	reflect.TypeOf(TriggerKind(0)):     reflect.ValueOf(trigger_kind_text),
+	reflect.TypeOf(FloorEffectKind(0)): reflect.ValueOf(floor_effect_kind_text),
+}
+
+var text_facing_type = reflect.TypeOf((*AbsoluteDirection)(nil)).Elem()
+
+func kindName(name string) string {
+	return strings.Replace(name, " ", "-", -1)
+}
+
+// leafToText writes a value that is not a structure, an array or a slice.
+func leafToText(value reflect.Value) (string, error) {
+	if names, ok := text_kinds[value.Type()]; ok {
+		if name := names.MapIndex(value); name.IsValid() {
+			return kindName(name.String()), nil
+		}
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'g', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	case reflect.String:
+		return strconv.Quote(value.String()), nil
+	case reflect.Interface:
+		if value.Type() == text_facing_type && !value.IsNil() {
+			return facingToText(value.Interface().(AbsoluteDirection)), nil
+		}
+	}
+	return "", fmt.Errorf("cannot write %v", value.Type())
+}
+
+// textToLeaf reads into a value that is not a structure, an array or a slice.
+func textToLeaf(text string, value reflect.Value) error {
+	if names, ok := text_kinds[value.Type()]; ok {
+		for _, kind := range names.MapKeys() {
+			if kindName(names.MapIndex(kind).String()) == text {
+				value.Set(kind)
+				return nil
+			}
+		}
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, err := strconv.ParseInt(text, 10, value.Type().Bits())
+		value.SetInt(number)
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, err := strconv.ParseUint(text, 10, value.Type().Bits())
+		value.SetUint(number)
+		return err
+	case reflect.Float32, reflect.Float64:
+		number, err := strconv.ParseFloat(text, value.Type().Bits())
+		value.SetFloat(number)
+		return err
+	case reflect.Bool:
+		truth, err := strconv.ParseBool(text)
+		value.SetBool(truth)
+		return err
+	case reflect.String:
+		unquoted, err := strconv.Unquote(text)
+		value.SetString(unquoted)
+		return err
+	case reflect.Interface:
+		if value.Type() == text_facing_type {
+			facing, err := textToFacing(text)
+			if err == nil {
+				value.Set(reflect.ValueOf(facing))
+			}
+			return err
+		}
+	}
+	return fmt.Errorf("cannot read %v", value.Type())
+}
+
+func isComposite(value reflect.Value) bool {
+	kind := value.Kind()
+	return kind == reflect.Struct || kind == reflect.Array || kind == reflect.Slice
+}
+
+// valueToFields appends the Path=value fields of the leaves of a value that
+// are not zero.
+func valueToFields(path string, value reflect.Value, fields []string) ([]string, error) {
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				return fields, fmt.Errorf("cannot write the hidden field %v of %v", field.Name, value.Type())
+			}
+			var err error
+			fields, err = valueToFields(join(field.Name), value.Field(i), fields)
+			if err != nil {
+				return fields, err
+			}
+		}
+		return fields, nil
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.Len() > 0 {
+			fields = append(fields, fmt.Sprintf("%v=%v", join("len"), value.Len()))
+		}
+		for i := 0; i < value.Len(); i++ {
+			var err error
+			fields, err = valueToFields(join(strconv.Itoa(i)), value.Index(i), fields)
+			if err != nil {
+				return fields, err
+			}
+		}
+		return fields, nil
+	}
+	if value.IsZero() {
+		return fields, nil
+	}
+	text, err := leafToText(value)
+	return append(fields, path+"="+text), err
+}
+
+// fieldToValue reads one Path=value field into a value.
+func fieldToValue(field string, value reflect.Value) error {
+	equal := strings.IndexByte(field, '=')
+	if equal <= 0 {
+		return fmt.Errorf("expected Path=value, not %q", field)
+	}
+	path, text := strings.Split(field[:equal], "."), field[equal+1:]
+	for i, name := range path {
+		switch value.Kind() {
+		case reflect.Struct:
+			found, ok := value.Type().FieldByName(name)
+			if !ok || found.PkgPath != "" || len(found.Index) != 1 {
+				return fmt.Errorf("%v has no field %v", value.Type(), name)
+			}
+			value = value.Field(found.Index[0])
+		case reflect.Slice, reflect.Array:
+			if name == "len" && value.Kind() == reflect.Slice && i == len(path)-1 {
+				length, err := strconv.Atoi(text)
+				if err != nil || length < 0 {
+					return fmt.Errorf("invalid length %q", text)
+				}
+				value.Set(reflect.MakeSlice(value.Type(), length, length))
+				return nil
+			}
+			index, err := strconv.Atoi(name)
+			if err != nil || index < 0 || index >= value.Len() {
+				return fmt.Errorf("index %v out of %v", name, field[:equal])
+			}
+			value = value.Index(index)
+		default:
+			return fmt.Errorf("%v has no field %v", value.Type(), name)
+		}
+	}
+	if isComposite(value) {
+		return fmt.Errorf("%v is not a single value", field[:equal])
+	}
+	if err := textToLeaf(text, value); err != nil {
+		return fmt.Errorf("%v: %v", field[:equal], err)
+	}
+	return nil
+}
+
+// stateLine writes a line of the [state] section.  The key is nil for the
+// fields of the Level that are not collections.
+func stateLine(name string, key interface{}, value interface{}) (string, error) {
+	fields := []string{name}
+	if key != nil {
+		fields = append(fields, fmt.Sprint(key))
+	}
+	reflected := reflect.ValueOf(value)
+	if !isComposite(reflected) {
+		text, err := leafToText(reflected)
+		return strings.Join(append(fields, text), " "), err
+	}
+	fields, err := valueToFields("", reflected, fields)
+	return strings.Join(fields, " "), err
+}
+
+// textTokens splits a line at its spaces, but not at those within quotes.
+func textTokens(line string) ([]string, error) {
+	var tokens []string
+	token := ""
+	for len(line) > 0 {
+		switch line[0] {
+		case ' ', '\t':
+			if token != "" {
+				tokens = append(tokens, token)
+				token = ""
+			}
+			line = line[1:]
+		case '"':
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, err
+			}
+			token += quoted
+			line = line[len(quoted):]
+		default:
+			token += line[:1]
+			line = line[1:]
+		}
+	}
+	if token != "" {
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// tokensToValue reads the value of a line of the [state] section.
+func tokensToValue(tokens []string, target interface{}) error {
+	value := reflect.ValueOf(target).Elem()
+	if !isComposite(value) {
+		if len(tokens) != 1 {
+			return fmt.Errorf("expected a single value")
+		}
+		return textToLeaf(tokens[0], value)
+	}
+	for _, token := range tokens {
+		if err := fieldToValue(token, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A textEntry is an entry of a collection, to be sorted by identifier.
+type textEntry struct {
+	key   uint64
+	value interface{}
+}
+
+type textEntries []textEntry
+
+func (self textEntries) Len() int           { return len(self) }
+func (self textEntries) Less(i, j int) bool { return self[i].key < self[j].key }
+func (self textEntries) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// encodeState writes the [state] section.
+func encodeState(out io.Writer, level Level) error {
+	var lines []string
+	var err error
+	add := func(name string, key interface{}, value interface{}) {
+		if err != nil {
+			return
+		}
+		var line string
+		line, err = stateLine(name, key, value)
+		lines = append(lines, line)
+	}
+	add("Next", nil, textNext{
+		Actors:    level.Actors.NextIDprivate,
+		Creatures: level.Creatures.Next_id,
+		Items:     level.Items.Next_id,
+		Triggers:  level.Triggers.Next_id,
+		Lights:    level.Lights.Next_id,
+		Props:     level.Props.Next_id,
+		Effects:   level.Effects.Next_id,
+	})
+	add("Dynamic", nil, level.Dynamic)
+	add("ActorSchedule", nil, level.ActorSchedule)
+	collection := func(name string, each func(func(key uint64, value interface{}))) {
+		var entries textEntries
+		each(func(key uint64, value interface{}) {
+			entries = append(entries, textEntry{key, value})
+		})
+		sort.Sort(entries)
+		for _, entry := range entries {
+			add(name, entry.key, entry.value)
+		}
+	}
+	collection("Actors", func(f func(uint64, interface{})) {
+		level.Actors.ForEach(func(id ActorID, actor Actor) { f(uint64(id), actor) })
+	})
+	collection("Creatures", func(f func(uint64, interface{})) {
+		level.Creatures.ForEach(func(id CreatureId, creature Creature) { f(uint64(id), creature) })
+	})
+	collection("CreatureLocation", func(f func(uint64, interface{})) {
+		level.CreatureLocation.ForEach(func(id CreatureId, location Location) { f(uint64(id), location) })
+	})
+	collection("CreatureActor", func(f func(uint64, interface{})) {
+		level.CreatureActor.ForEach(func(id CreatureId, actor_id ActorID) { f(uint64(id), actor_id) })
+	})
+	collection("Items", func(f func(uint64, interface{})) {
+		level.Items.ForEach(func(id ItemId, item Item) { f(uint64(id), item) })
+	})
+	collection("ItemLocation", func(f func(uint64, interface{})) {
+		level.ItemLocation.ForEach(func(id ItemId, location Location) { f(uint64(id), location) })
+	})
+	collection("Inventories", func(f func(uint64, interface{})) {
+		level.Inventories.ForEach(func(id CreatureId, inventory Inventory) { f(uint64(id), inventory) })
+	})
+	collection("Mechanisms", func(f func(uint64, interface{})) {
+		level.Mechanisms.ForEach(func(id ActorID, mechanism Mechanism) { f(uint64(id), mechanism) })
+	})
+	collection("Triggers", func(f func(uint64, interface{})) {
+		level.Triggers.ForEach(func(id TriggerId, trigger Trigger) { f(uint64(id), trigger) })
+	})
+	collection("Projectiles", func(f func(uint64, interface{})) {
+		level.Projectiles.ForEach(func(id ActorID, projectile Projectile) { f(uint64(id), projectile) })
+	})
+	collection("Lights", func(f func(uint64, interface{})) {
+		level.Lights.ForEach(func(id LightId, light LightSource) { f(uint64(id), light) })
+	})
+	collection("Props", func(f func(uint64, interface{})) {
+		level.Props.ForEach(func(id PropId, prop Prop) { f(uint64(id), prop) })
+	})
+	collection("Effects", func(f func(uint64, interface{})) {
+		level.Effects.ForEach(func(id FloorEffectId, effect FloorEffect) { f(uint64(id), effect) })
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "[state]\n")
+	for _, line := range lines {
+		fmt.Fprintf(out, "%v\n", line)
+	}
+	return nil
+}
+
+// decodeStateLine reads a line of the [state] section into the level.  The
+// counters are read into next, they are set once all is read.
+func decodeStateLine(level Level, next *textNext, line string) (Level, error) {
+	tokens, err := textTokens(line)
+	if err != nil {
+		return level, err
+	}
+	name, tokens := tokens[0], tokens[1:]
+	switch name {
+	case "Next":
+		return level, tokensToValue(tokens, next)
+	case "Dynamic":
+		level.Dynamic = Dynamic{}
+		return level, tokensToValue(tokens, &level.Dynamic)
+	case "ActorSchedule":
+		level.ActorSchedule = ActorSchedule{}
+		return level, tokensToValue(tokens, &level.ActorSchedule)
+	}
+	if len(tokens) == 0 {
+		return level, fmt.Errorf("%v without identifier", name)
+	}
+	key, err := strconv.ParseUint(tokens[0], 10, 64)
+	if err != nil {
+		return level, err
+	}
+	tokens = tokens[1:]
+	twice := fmt.Errorf("%v %v defined twice", name, key)
+	switch name {
+	case "Actors":
+		var actor Actor
+		if err := tokensToValue(tokens, &actor); err != nil {
+			return level, err
+		}
+		if _, ok := level.Actors.Get(ActorID(key)); ok {
+			return level, twice
+		}
+		level.Actors = level.Actors.Insert(ActorID(key), actor)
+	case "Creatures":
+		var creature Creature
+		if err := tokensToValue(tokens, &creature); err != nil {
+			return level, err
+		}
+		if _, ok := level.Creatures.Get(CreatureId(key)); ok {
+			return level, twice
+		}
+		level.Creatures = level.Creatures.Set(CreatureId(key), creature)
+	case "CreatureLocation":
+		var location Location
+		if err := tokensToValue(tokens, &location); err != nil {
+			return level, err
+		}
+		level.CreatureLocation, err = level.CreatureLocation.Add(CreatureId(key), location)
+	case "CreatureActor":
+		var actor_id ActorID
+		if err := tokensToValue(tokens, &actor_id); err != nil {
+			return level, err
+		}
+		level.CreatureActor, err = level.CreatureActor.Add(CreatureId(key), actor_id)
+	case "Items":
+		var item Item
+		if err := tokensToValue(tokens, &item); err != nil {
+			return level, err
+		}
+		if _, ok := level.Items.Get(ItemId(key)); ok {
+			return level, twice
+		}
+		level.Items = level.Items.Set(ItemId(key), item)
+	case "ItemLocation":
+		var location Location
+		if err := tokensToValue(tokens, &location); err != nil {
+			return level, err
+		}
+		level.ItemLocation, err = level.ItemLocation.Add(ItemId(key), location)
+	case "Inventories":
+		var inventory Inventory
+		if err := tokensToValue(tokens, &inventory); err != nil {
+			return level, err
+		}
+		level.Inventories = level.Inventories.Set(CreatureId(key), inventory)
+	case "Mechanisms":
+		var mechanism Mechanism
+		if err := tokensToValue(tokens, &mechanism); err != nil {
+			return level, err
+		}
+		if _, ok := level.Mechanisms.Get(ActorID(key)); ok {
+			return level, twice
+		}
+		level.Mechanisms = level.Mechanisms.Set(ActorID(key), mechanism)
+	case "Triggers":
+		var trigger Trigger
+		if err := tokensToValue(tokens, &trigger); err != nil {
+			return level, err
+		}
+		if _, ok := level.Triggers.Get(TriggerId(key)); ok {
+			return level, twice
+		}
+		level.Triggers = level.Triggers.Set(TriggerId(key), trigger)
+	case "Projectiles":
+		var projectile Projectile
+		if err := tokensToValue(tokens, &projectile); err != nil {
+			return level, err
+		}
+		if _, ok := level.Projectiles.Get(ActorID(key)); ok {
+			return level, twice
+		}
+		level.Projectiles = level.Projectiles.Set(ActorID(key), projectile)
+	case "Lights":
+		var light LightSource
+		if err := tokensToValue(tokens, &light); err != nil {
+			return level, err
+		}
+		if _, ok := level.Lights.Get(LightId(key)); ok {
+			return level, twice
+		}
+		level.Lights = level.Lights.Set(LightId(key), light)
+	case "Props":
+		var prop Prop
+		if err := tokensToValue(tokens, &prop); err != nil {
+			return level, err
+		}
+		if _, ok := level.Props.Get(PropId(key)); ok {
+			return level, twice
+		}
+		level.Props = level.Props.Set(PropId(key), prop)
+	case "Effects":
+		var effect FloorEffect
+		if err := tokensToValue(tokens, &effect); err != nil {
+			return level, err
+		}
+		if _, ok := level.Effects.Get(FloorEffectId(key)); ok {
+			return level, twice
+		}
+		level.Effects = level.Effects.Set(FloorEffectId(key), effect)
+	default:
+		return level, fmt.Errorf("unknown state %q", name)
+	}
+	return level, err
+}
+
+// setNext sets the counters of the identifiers read from the [state] section.
+func (level Level) setNext(next textNext) Level {
+	level.Actors.NextIDprivate = next.Actors
+	level.Creatures.Next_id = next.Creatures
+	level.Items.Next_id = next.Items
+	level.Triggers.Next_id = next.Triggers
+	level.Lights.Next_id = next.Lights
+	level.Props.Next_id = next.Props
+	level.Effects.Next_id = next.Effects
+	return level
+}
@@ -0,0 +1,298 @@
+package world
+
+import (
+	"fmt"
+	"glm"
+	"math"
+	"pmap"
+)
+
+// Lights are part of the level: torches on the walls, braziers on the floors,
+// and lanterns carried by creatures.  The renderer collects them each frame.
+// Torches and braziers are light sources of their own, kept by the level.
+// Lanterns are part of the creature that carries them, and follow it from
+// level to level.
+
+type Light struct {
+	Color     glm.Vector3
+	Intensity float64
+	Radius    float64 // Beyond that distance it does not shine, 0 for no limit.
+	Flicker   float64 // From 0 for a steady light to 1 for a wild flame.
+	Period    uint64  // Nanoseconds, how slowly it flickers.
+	On        bool
+}
+
+// MakeTorch makes the light of a torch, or of a brazier.
+func MakeTorch() Light {
+	return Light{
+		Color:     glm.Vector3{1, .6, .25},
+		Intensity: 1,
+		Radius:    5,
+		Flicker:   .3,
+		Period:    700000000,
+		On:        true,
+	}
+}
+
+// MakeLantern makes the light of a lantern, steadier and dimmer than a torch.
+func MakeLantern() Light {
+	return Light{
+		Color:     glm.Vector3{1, .85, .6},
+		Intensity: .4,
+		Radius:    3,
+		Flicker:   .05,
+		Period:    1500000000,
+		On:        true,
+	}
+}
+
+// Brightness is the intensity of the light at the given time.  The phase
+// keeps neighboring lights from flickering together.
+func (self Light) Brightness(time uint64, phase float64) float64 {
+	if !self.On {
+		return 0
+	}
+	if self.Period == 0 || self.Flicker == 0 {
+		return self.Intensity
+	}
+	// Two waves that never quite line up look less regular than one.
+	angle := 2*math.Pi*float64(time)/float64(self.Period) + phase
+	wave := .5 + .25*math.Sin(angle) + .25*math.Sin(2.71*angle+phase)
+	return self.Intensity * (1 - self.Flicker*wave)
+}
+
+// Each light source in a level is identified with a unique ID.
+type LightId uint64
+
+// Hash allows light identifiers to be used as keys of persistent maps.
+func (self LightId) Hash() uint64 {
+	return pmap.Hash64(uint64(self))
+}
+
+// A LightSource is a light fixed in a level.  Anchored on a wall it is a
+// torch, anchored in a tile it is a brazier.
+type LightSource struct {
+	Light  Light
+	Anchor Anchor
+}
+
+// Point returns where the light source shines from.  Torches stick out of
+// their wall a little.
+func (self LightSource) Point() glm.Vector3 {
+	if self.Anchor.On_wall {
+		x, y := offset(self.Anchor.Location, self.Anchor.Facing.Add(BACK()), .4)
+		return glm.Vector3{x, y, .7}
+	}
+	return glm.Vector3{float64(self.Anchor.X), float64(self.Anchor.Y), .3}
+}
+
+type Lights struct {
+	Next_id LightId
+	// The content is a persistent map, updating it does not copy it.
+	content pmap.Map
+}
+
+func MakeLights() Lights {
+	return Lights{}
+}
+
+func (self Lights) Add(light LightSource) (Lights, LightId) {
+	light_id := self.Next_id
+	lights := self.Set(light_id, light)
+	lights.Next_id += 1
+	return lights, light_id
+}
+
+func (self Lights) Get(light_id LightId) (LightSource, bool) {
+	light, ok := self.content.Get(light_id)
+	if !ok {
+		return LightSource{}, false
+	}
+	return light.(LightSource), true
+}
+
+func (self Lights) Set(light_id LightId, light LightSource) Lights {
+	self.content = self.content.Set(light_id, light)
+	return self
+}
+
+func (self Lights) Delete(light_id LightId) Lights {
+	self.content = self.content.Delete(light_id)
+	return self
+}
+
+func (self Lights) Len() int {
+	return self.content.Len()
+}
+
+// ForEach calls f for each light source.
+func (self Lights) ForEach(f func(light_id LightId, light LightSource)) {
+	self.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(LightId), value.(LightSource))
+	})
+}
+
+// At finds the light source anchored at the given place.
+func (self Lights) At(anchor Anchor) (LightId, LightSource, bool) {
+	var found_id LightId
+	var found LightSource
+	ok := false
+	self.ForEach(func(light_id LightId, light LightSource) {
+		if light.Anchor == anchor && (!ok || light_id < found_id) {
+			found_id, found, ok = light_id, light, true
+		}
+	})
+	return found_id, found, ok
+}
+
+// lightsGob is what Lights looks like to gob.
+type lightsGob struct {
+	Next_id LightId
+	Content map[LightId]LightSource
+}
+
+func (self Lights) GobEncode() ([]byte, error) {
+	content := make(map[LightId]LightSource, self.Len())
+	self.ForEach(func(light_id LightId, light LightSource) {
+		content[light_id] = light
+	})
+	return gobEncode(lightsGob{self.Next_id, content})
+}
+
+func (self *Lights) GobDecode(data []byte) error {
+	var decoded lightsGob
+	if err := gobDecode(data, &decoded); err != nil {
+		return err
+	}
+	*self = Lights{Next_id: decoded.Next_id}
+	for light_id, light := range decoded.Content {
+		*self = self.Set(light_id, light)
+	}
+	return nil
+}
+
+// A Glow is a light as the renderer sees it, at a given time.
+type Glow struct {
+	Point  glm.Vector3
+	Color  glm.Vector3 // Already multiplied by the brightness.
+	Radius float64
+}
+
+func glow(light Light, point glm.Vector3, time uint64, phase float64) (Glow, bool) {
+	brightness := light.Brightness(time, phase)
+	if brightness <= 0 {
+		return Glow{}, false
+	}
+	color := glm.Vector3{
+		light.Color[0] * brightness,
+		light.Color[1] * brightness,
+		light.Color[2] * brightness,
+	}
+	return Glow{Point: point, Color: color, Radius: light.Radius}, true
+}
+
+// Glows returns the lights of the level that shine at the given time: its
+// light sources and the lanterns of its creatures.
+func (self Level) Glows(time uint64) []Glow {
+	var glows []Glow
+	self.Lights.ForEach(func(light_id LightId, light LightSource) {
+		if glow, ok := glow(light.Light, light.Point(), time, float64(light_id)); ok {
+			glows = append(glows, glow)
+		}
+	})
+	self.CreatureLocation.ForEach(func(creature_id CreatureId, location Location) {
+		creature, ok := self.Creatures.Get(creature_id)
+		if !ok {
+			return
+		}
+		point := glm.Vector3{float64(location.X), float64(location.Y), .6}
+		if glow, ok := glow(creature.Light, point, time, float64(creature_id)); ok {
+			glows = append(glows, glow)
+		}
+	})
+	return glows
+}
+
+// offset returns the point at the given distance from the center of a tile,
+// in the given direction.
+func offset(location Location, direction AbsoluteDirection, distance float64) (float64, float64) {
+	ahead := location.MoveAbsolute(direction, 1)
+	x := float64(location.X) + distance*float64(ahead.X-location.X)
+	y := float64(location.Y) + distance*float64(ahead.Y-location.Y)
+	return x, y
+}
+
+// DeltaLightChanged changes a light source of a level.
+type DeltaLightChanged struct {
+	Level  LevelId
+	Light  LightId
+	Before LightSource
+	After  LightSource
+}
+
+func (self DeltaLightChanged) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	light, ok := level.Lights.Get(self.Light)
+	if !ok || light != self.Before {
+		return world, DELTA_LIGHT_CHANGED
+	}
+	level.Lights = level.Lights.Set(self.Light, self.After)
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaLightChanged) Reverse() Delta {
+	return DeltaLightChanged{self.Level, self.Light, self.After, self.Before}
+}
+
+func (self DeltaLightChanged) String() string {
+	return fmt.Sprintf("light %v changes", self.Light)
+}
+
+// DeltaLightPlaced puts a new light source in a level, or takes it away
+// again.
+type DeltaLightPlaced struct {
+	Level  LevelId
+	Light  LightId
+	Value  LightSource
+	Placed bool
+}
+
+func (self DeltaLightPlaced) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	current, ok := level.Lights.Get(self.Light)
+	if self.Placed {
+		if ok {
+			return world, DELTA_ID_TAKEN
+		}
+		level.Lights = level.Lights.Set(self.Light, self.Value)
+		if self.Light >= level.Lights.Next_id {
+			level.Lights.Next_id = self.Light + 1
+		}
+		return world.SetLevel(self.Level, level), nil
+	}
+	if !ok || current != self.Value {
+		return world, DELTA_LIGHT_CHANGED
+	}
+	level.Lights = level.Lights.Delete(self.Light)
+	if self.Light+1 == level.Lights.Next_id {
+		level.Lights.Next_id = self.Light
+	}
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaLightPlaced) Reverse() Delta {
+	return DeltaLightPlaced{self.Level, self.Light, self.Value, !self.Placed}
+}
+
+func (self DeltaLightPlaced) String() string {
+	if self.Placed {
+		return fmt.Sprintf("light %v is placed", self.Light)
+	}
+	return fmt.Sprintf("light %v is taken away", self.Light)
+}
@@ -0,0 +1,75 @@
+package world
+
+import (
+	"glm"
+	"testing"
+)
+
+// Flickering lights stay between their intensity and what the flicker takes
+// away from it.  Steady lights do not change, and lights that are off do not
+// shine at all.
+func TestBrightness(test *testing.T) {
+	torch := MakeTorch()
+	steady := torch
+	steady.Flicker = 0
+	off := torch
+	off.On = false
+	changed := false
+	for time := uint64(0); time < 2*torch.Period; time += torch.Period / 50 {
+		brightness := torch.Brightness(time, 0)
+		if brightness < torch.Intensity*(1-torch.Flicker) || brightness > torch.Intensity {
+			test.Fatalf("The torch shines %v at %v.", brightness, time)
+		}
+		changed = changed || brightness != torch.Brightness(0, 0)
+		if steady.Brightness(time, 0) != steady.Intensity {
+			test.Fatalf("The steady light shines %v at %v.", steady.Brightness(time, 0), time)
+		}
+		if off.Brightness(time, 0) != 0 {
+			test.Fatalf("The light that is off shines at %v.", time)
+		}
+	}
+	if !changed {
+		test.Error("The torch does not flicker.")
+	}
+	if torch.Brightness(0, 0) == torch.Brightness(0, 1) {
+		test.Error("Two torches flicker together.")
+	}
+}
+
+// The level glows with its light sources that are on, and with the lanterns of
+// its creatures.
+func TestGlows(test *testing.T) {
+	level := roomLevel(3, 3)
+	steady := MakeTorch()
+	steady.Flicker = 0
+	torch := LightSource{steady, Anchor{Location{0, 0}, true, EAST()}}
+	level.Lights, _ = level.Lights.Add(torch)
+	brazier := LightSource{MakeTorch(), Anchor{Location: Location{1, 1}}}
+	brazier.Light.On = false
+	level.Lights, _ = level.Lights.Add(brazier)
+	for _, light := range []Light{MakeLantern(), {}} {
+		creature := MakeCreature()
+		creature.Light = light
+		var creature_id CreatureId
+		level.Creatures, creature_id = level.Creatures.Add(creature)
+		level.CreatureLocation, _ = level.CreatureLocation.Add(creature_id, Location{2, Coord(level.Creatures.Len())})
+	}
+	glows := level.Glows(0)
+	if len(glows) != 2 {
+		test.Fatal("The level glows with", glows)
+	}
+	for _, glow := range glows {
+		switch glow.Radius {
+		case steady.Radius:
+			if glow.Point != torch.Point() || glow.Color != steady.Color {
+				test.Error("The torch glows with", glow)
+			}
+		case MakeLantern().Radius:
+			if glow.Point != (glm.Vector3{2, 1, .6}) {
+				test.Error("The lantern glows with", glow)
+			}
+		default:
+			test.Error("Something else glows:", glow)
+		}
+	}
+}
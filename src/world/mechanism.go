@@ -0,0 +1,245 @@
+package world
+
+import (
+	"fmt"
+	"pmap"
+)
+
+// Mechanisms are actors that are not creatures: arrow launchers, crushers,
+// gates that open and close on their own...  They do not move, they are
+// anchored to a tile or to a wall.  Like creatures, they take turns through
+// the ActorSchedule of their level, and they act through actions.  A mechanism
+// does not know its own actor identifier.
+
+type MechanismKind int
+
+const (
+	// Shoots an arrow at the first creature in the direction it faces.
+	MECHANISM_ARROW_LAUNCHER = MechanismKind(iota)
+	// Hurts whoever stands on its tile.
+	MECHANISM_CRUSHER
+	// Opens and closes the door it is anchored to.
+	MECHANISM_TIMED_GATE
+)
+
+var mechanism_kind_text = map[MechanismKind]string{
+	MECHANISM_ARROW_LAUNCHER: "arrow launcher",
+	MECHANISM_CRUSHER:        "crusher",
+	MECHANISM_TIMED_GATE:     "timed gate",
+}
+
+func (self MechanismKind) String() string {
+	return mechanism_kind_text[self]
+}
+
+// An Anchor is where a mechanism is fixed: the middle of a tile, or one of its
+// walls.  Anchors in walls work like door slots: the wall facing north sits
+// on the southern edge of the tile.  Anchors in tiles have a facing too.
+type Anchor struct {
+	Location
+	On_wall bool
+	Facing  AbsoluteDirection
+}
+
+// DoorSlot returns the slot of the door a mechanism anchored there can handle.
+func (self Anchor) DoorSlot() DoorSlot {
+	return DoorSlot{
+		Location: self.Location,
+		In_wall:  self.On_wall,
+		Facing:   self.Facing,
+	}
+}
+
+type Mechanism struct {
+	Kind   MechanismKind
+	Anchor Anchor
+	Period uint64 // Nanoseconds between two turns.
+	Active bool   // Inactive mechanisms wait instead of acting.
+	Weapon Weapon // How launchers and crushers hurt.
+	Range  int    // How many tiles an arrow flies.
+}
+
+// MakeMechanism makes an active mechanism with the usual settings of its kind.
+func MakeMechanism(kind MechanismKind, anchor Anchor) Mechanism {
+	mechanism := Mechanism{Kind: kind, Anchor: anchor, Active: true}
+	switch kind {
+	case MECHANISM_ARROW_LAUNCHER:
+		mechanism.Period = 1000000000
+		mechanism.Weapon = Weapon{Dice: 1, Sides: 6, Type: DAMAGE_PIERCE}
+		mechanism.Range = 5
+	case MECHANISM_CRUSHER:
+		mechanism.Period = 2000000000
+		mechanism.Weapon = Weapon{Dice: 2, Sides: 6, Type: DAMAGE_BLUNT}
+	case MECHANISM_TIMED_GATE:
+		mechanism.Period = 3000000000
+	}
+	return mechanism
+}
+
+// Mechanisms holds the mechanisms of a level, indexed by the identifier of
+// their actor.
+type Mechanisms struct {
+	// The content is a persistent map, updating it does not copy it.
+	content pmap.Map
+}
+
+func MakeMechanisms() Mechanisms {
+	return Mechanisms{}
+}
+
+func (self Mechanisms) Get(actor_id ActorID) (Mechanism, bool) {
+	mechanism, ok := self.content.Get(actor_id)
+	if !ok {
+		return Mechanism{}, false
+	}
+	return mechanism.(Mechanism), true
+}
+
+func (self Mechanisms) Set(actor_id ActorID, mechanism Mechanism) Mechanisms {
+	self.content = self.content.Set(actor_id, mechanism)
+	return self
+}
+
+func (self Mechanisms) Delete(actor_id ActorID) Mechanisms {
+	self.content = self.content.Delete(actor_id)
+	return self
+}
+
+func (self Mechanisms) Len() int {
+	return self.content.Len()
+}
+
+// ForEach calls f for each mechanism.
+func (self Mechanisms) ForEach(f func(actor_id ActorID, mechanism Mechanism)) {
+	self.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(ActorID), value.(Mechanism))
+	})
+}
+
+func (self Mechanisms) GobEncode() ([]byte, error) {
+	content := make(map[ActorID]Mechanism, self.Len())
+	self.ForEach(func(actor_id ActorID, mechanism Mechanism) {
+		content[actor_id] = mechanism
+	})
+	return gobEncode(content)
+}
+
+func (self *Mechanisms) GobDecode(data []byte) error {
+	var content map[ActorID]Mechanism
+	if err := gobDecode(data, &content); err != nil {
+		return err
+	}
+	*self = MakeMechanisms()
+	for actor_id, mechanism := range content {
+		*self = self.Set(actor_id, mechanism)
+	}
+	return nil
+}
+
+// AddMechanism gives an actor to the mechanism and puts it in the level.  It is
+// not scheduled yet.
+func (self Level) AddMechanism(mechanism Mechanism) (Level, ActorID) {
+	actors, actor_id := self.Actors.Add(MakeActor())
+	self.Actors = actors
+	self.Mechanisms = self.Mechanisms.Set(actor_id, mechanism)
+	return self, actor_id
+}
+
+// RemoveMechanism removes a mechanism from the level, along with its actor,
+// its place in the schedule and the wires leading to it.
+func (self Level) RemoveMechanism(actor_id ActorID) (Level, error) {
+	if _, ok := self.Mechanisms.Get(actor_id); !ok {
+		return self, fmt.Errorf("actor %v is not a mechanism", actor_id)
+	}
+	self.Mechanisms = self.Mechanisms.Delete(actor_id)
+	self.Actors = self.Actors.Delete(actor_id)
+	if index := self.ActorSchedule.PosActorID(actor_id); index != -1 {
+		self.ActorSchedule, _ = self.ActorSchedule.Remove(self.ActorSchedule.Actor_times[index])
+	}
+	target := MechanismTarget(actor_id)
+	self.Triggers.ForEach(func(trigger_id TriggerId, trigger Trigger) {
+		self.Triggers = self.Triggers.Set(trigger_id, trigger.Disconnect(target))
+	})
+	return self, nil
+}
+
+// ResolveTrap rolls the attack of a mechanism.  Mechanisms have no attributes,
+// they attack like an average creature would.
+func ResolveTrap(rng Rng, weapon Weapon, defender Creature) (Rng, MeleeResult) {
+	return ResolveMelee(rng, MakeCreature(), weapon, defender)
+}
+
+// DeltaMechanismChanged changes the settings of a mechanism.
+type DeltaMechanismChanged struct {
+	Level  LevelId
+	Actor  ActorID
+	Before Mechanism
+	After  Mechanism
+}
+
+func (self DeltaMechanismChanged) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	mechanism, ok := level.Mechanisms.Get(self.Actor)
+	if !ok || mechanism != self.Before {
+		return world, DELTA_MECHANISM_CHANGED
+	}
+	level.Mechanisms = level.Mechanisms.Set(self.Actor, self.After)
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaMechanismChanged) Reverse() Delta {
+	return DeltaMechanismChanged{self.Level, self.Actor, self.After, self.Before}
+}
+
+func (self DeltaMechanismChanged) String() string {
+	return fmt.Sprintf("%v %v changes", self.After.Kind, self.Actor)
+}
+
+// DeltaMechanismPlaced puts a new mechanism in a level, along with its actor,
+// or takes it away again.  Taking it away also takes it out of the schedule,
+// but not the wires leading to it: see DeltaTriggerWired for that.
+type DeltaMechanismPlaced struct {
+	Level  LevelId
+	Actor  ActorID
+	Value  Mechanism
+	Placed bool
+}
+
+func (self DeltaMechanismPlaced) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	if self.Placed {
+		if _, ok := level.Actors.Get(self.Actor); ok {
+			return world, DELTA_ID_TAKEN
+		}
+		level.Actors = level.Actors.reserve(self.Actor).Insert(self.Actor, MakeActor())
+		level.Mechanisms = level.Mechanisms.Set(self.Actor, self.Value)
+		return world.SetLevel(self.Level, level), nil
+	}
+	mechanism, ok := level.Mechanisms.Get(self.Actor)
+	if !ok || mechanism != self.Value {
+		return world, DELTA_MECHANISM_CHANGED
+	}
+	level.Mechanisms = level.Mechanisms.Delete(self.Actor)
+	level.Actors = level.Actors.Delete(self.Actor).release(self.Actor)
+	if index := level.ActorSchedule.PosActorID(self.Actor); index != -1 {
+		level.ActorSchedule, _ = level.ActorSchedule.Remove(level.ActorSchedule.Actor_times[index])
+	}
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaMechanismPlaced) Reverse() Delta {
+	return DeltaMechanismPlaced{self.Level, self.Actor, self.Value, !self.Placed}
+}
+
+func (self DeltaMechanismPlaced) String() string {
+	if self.Placed {
+		return fmt.Sprintf("%v %v is placed", self.Value.Kind, self.Actor)
+	}
+	return fmt.Sprintf("%v %v is taken away", self.Value.Kind, self.Actor)
+}
@@ -0,0 +1,116 @@
+package world
+
+// Pits are floors that can open under the feet of whoever stands on them.
+// Closed, they are plain floors.  Open, whatever enters them falls: creatures
+// land below, hurt, and items land below too.  Hidden pits look like plain
+// floors even when open, until someone finds out the hard way.
+//
+// Falling is not an action, it is how the World reacts when something ends up
+// on an open pit, whoever moved it there.  React computes it.
+
+type Pit struct {
+	Floor
+	Open   bool
+	Hidden bool
+	To     LevelLocation // Where what falls lands.
+	Damage Weapon        // What the fall does to creatures.
+}
+
+// MakePit makes a visible pit that hurts like a fall of one level.
+func MakePit(model ModelId, facing AbsoluteDirection, open bool, to LevelLocation) Pit {
+	var pit Pit
+	pit.Floor = MakeFloor(model, facing, true)
+	pit.Open = open
+	pit.To = to
+	pit.Damage = Weapon{Dice: 1, Sides: 6, Type: DAMAGE_BLUNT}
+	return pit
+}
+
+// IsGaping tells whether the pit shows as a hole.
+func (self Pit) IsGaping() bool {
+	return self.Open && !self.Hidden
+}
+
+// OpenPit finds the open pit at the given location.
+func (self Level) OpenPit(location Location) (Pit, bool) {
+	building, ok := self.Floors.Get(location.X, location.Y)
+	if !ok {
+		return Pit{}, false
+	}
+	pit, ok := building.(Pit)
+	if !ok || !pit.Open {
+		return Pit{}, false
+	}
+	return pit, true
+}
+
+// ResolveFall rolls the damage a creature takes when it falls into a pit.
+func ResolveFall(rng Rng, pit Pit, creature Creature) (Rng, int) {
+	if !pit.Damage.IsWeapon() {
+		return rng, 0
+	}
+	var damage int
+	rng, damage = rng.Roll(pit.Damage.Dice, pit.Damage.Sides)
+	return rng, creature.Stats.Resistances.Apply(damage, pit.Damage.Type)
+}
+
+// fall computes what falls into the open pits at the given places: the
+// creatures first, then the items lying on the ground.  Creatures do not fall
+// onto other creatures, they hold on to the edge until the way is clear and
+// something happens on their tile.  It returns the World after the fall, along
+// with the Deltas that lead there and the places where the World may react to
+// them.
+func (world World) fall(sites []LevelLocation) (World, []Delta, []LevelLocation, error) {
+	var deltas []Delta
+	var landed []LevelLocation
+	for _, site := range sortSites(sites) {
+		for _, delta := range world.fallsAt(site.Level, site.Location) {
+			var delta_sites []LevelLocation
+			var err error
+			if world, delta_sites, err = world.applyAt(delta); err != nil {
+				return world, nil, nil, err
+			}
+			deltas = append(deltas, delta)
+			landed = append(landed, delta_sites...)
+		}
+	}
+	return world, deltas, landed, nil
+}
+
+// fallsAt computes what falls into the pit at the given location.  The
+// Deltas are applied one after the other.  Pits leading to themselves swallow
+// nothing.
+func (world World) fallsAt(level_id LevelId, location Location) []Delta {
+	level := world.Levels[level_id]
+	pit, ok := level.OpenPit(location)
+	if !ok || pit.To == location.ToLevelLocation(level_id) {
+		return nil
+	}
+	below, ok := world.Levels[pit.To.Level]
+	if !ok {
+		return nil
+	}
+	var deltas []Delta
+	creature_id, ok := level.CreatureLocation.GetCreature(location)
+	_, blocked := below.CreatureLocation.GetCreature(pit.To.Location)
+	if ok && !blocked {
+		creature, _ := level.Creatures.Get(creature_id)
+		from := location.ToPosition(creature.F).ToLevelPosition(level_id)
+		rng, damage := ResolveFall(world.Rng(STREAM_COMBAT), pit, creature)
+		hurt, _ := Hurt(pit.To.Level, creature_id, creature, damage)
+		deltas = append(deltas, Combine(
+			DeltaCreatureTravelled{creature_id, from, pit.To.ToLevelPosition(creature.F)},
+			DeltaRng{Stream: STREAM_COMBAT, Before: world.Rng(STREAM_COMBAT), After: rng},
+			hurt,
+		))
+	}
+	// The bottom of the pile falls first, so that the pile keeps its order.
+	for _, item_id := range level.ItemLocation.GetItems(location) {
+		deltas = append(deltas, DeltaItemTravelled{
+			Item: item_id,
+			From: location.ToLevelLocation(level_id),
+			To:   pit.To,
+		})
+	}
+	return deltas
+}
@@ -0,0 +1,33 @@
+package world
+
+import (
+	"testing"
+)
+
+// Only what moves reacts: a monster left on an open pit by the editor stays
+// there while the player falls into another pit.
+func TestFallWhereThingsMoved(test *testing.T) {
+	world, below := MakeWorld().AddLevel()
+	level := world.Levels[0]
+	level.Floors = level.Floors.Set(1, 0, MakePit(0, EAST(), true, LevelLocation{below, Location{0, 0}}))
+	level.Floors = level.Floors.Set(5, 5, MakePit(0, EAST(), true, LevelLocation{below, Location{3, 3}}))
+	creatures, monster_id := level.Creatures.Add(MakeCreature())
+	level.Creatures = creatures
+	level.CreatureLocation, _ = level.CreatureLocation.Add(monster_id, Location{5, 5})
+	world = world.SetLevel(0, level)
+
+	player_id, _ := level.CreatureActor.GetCreature(world.Player_id)
+	delta, err := world.React(DeltaCreatureMoved{0, player_id, Location{0, 0}, Location{1, 0}})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if world, err = delta.Apply(world); err != nil {
+		test.Fatal(err)
+	}
+	if location, ok := world.ActorLocation(world.Player_id); !ok || location != (LevelLocation{below, Location{0, 0}}) {
+		test.Error("The player did not fall:", location)
+	}
+	if level_id, _ := world.CreatureLevel(monster_id); level_id != 0 {
+		test.Error("The monster fell too.")
+	}
+}
@@ -0,0 +1,215 @@
+package world
+
+import (
+	"fmt"
+	"pmap"
+)
+
+// Projectiles are the things that fly: arrows, fireballs, thrown items...
+// Like mechanisms, they are actors without a creature.  Each of their turns,
+// they cross one tile in the direction they fly.  They stop at the obstacles
+// a creature would stop at, and hit the first creature on their way.  Once
+// stopped, they disappear, and the item they carry, if any, falls on the
+// ground.
+
+type Projectile struct {
+	Location  Location // The tile being crossed.
+	Direction AbsoluteDirection
+	Period    uint64 // Nanoseconds to cross a tile.
+	Range     int    // How many more tiles it can enter.
+	Weapon    Weapon // How it hurts whoever it hits.
+	Item      ItemId // What lands when it stops, NO_ITEM for nothing.
+}
+
+// MakeProjectile makes a projectile that carries no item.
+func MakeProjectile(
+	location Location,
+	direction AbsoluteDirection,
+	period uint64,
+	flight_range int,
+	weapon Weapon,
+) Projectile {
+	return Projectile{
+		Location:  location,
+		Direction: direction,
+		Period:    period,
+		Range:     flight_range,
+		Weapon:    weapon,
+		Item:      NO_ITEM,
+	}
+}
+
+// Projectiles holds the projectiles of a level, indexed by the identifier of
+// their actor.
+type Projectiles struct {
+	// The content is a persistent map, updating it does not copy it.
+	content pmap.Map
+}
+
+func MakeProjectiles() Projectiles {
+	return Projectiles{}
+}
+
+func (self Projectiles) Get(actor_id ActorID) (Projectile, bool) {
+	projectile, ok := self.content.Get(actor_id)
+	if !ok {
+		return Projectile{}, false
+	}
+	return projectile.(Projectile), true
+}
+
+func (self Projectiles) Set(actor_id ActorID, projectile Projectile) Projectiles {
+	self.content = self.content.Set(actor_id, projectile)
+	return self
+}
+
+func (self Projectiles) Delete(actor_id ActorID) Projectiles {
+	self.content = self.content.Delete(actor_id)
+	return self
+}
+
+func (self Projectiles) Len() int {
+	return self.content.Len()
+}
+
+// ForEach calls f for each projectile.
+func (self Projectiles) ForEach(f func(actor_id ActorID, projectile Projectile)) {
+	self.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(ActorID), value.(Projectile))
+	})
+}
+
+func (self Projectiles) GobEncode() ([]byte, error) {
+	content := make(map[ActorID]Projectile, self.Len())
+	self.ForEach(func(actor_id ActorID, projectile Projectile) {
+		content[actor_id] = projectile
+	})
+	return gobEncode(content)
+}
+
+func (self *Projectiles) GobDecode(data []byte) error {
+	var content map[ActorID]Projectile
+	if err := gobDecode(data, &content); err != nil {
+		return err
+	}
+	*self = MakeProjectiles()
+	for actor_id, projectile := range content {
+		*self = self.Set(actor_id, projectile)
+	}
+	return nil
+}
+
+// ProjectilePoint tells where a projectile is drawn at the given time.  A
+// projectile enters its tile through one edge right after its turn, and
+// reaches the opposite edge right before its next turn.  Between the two, it
+// goes at constant speed.
+func (self Level) ProjectilePoint(actor_id ActorID, time uint64) (float64, float64, bool) {
+	projectile, ok := self.Projectiles.Get(actor_id)
+	if !ok {
+		return 0, 0, false
+	}
+	progress := .5
+	if index := self.ActorSchedule.PosActorID(actor_id); index != -1 && projectile.Period != 0 {
+		next := self.ActorSchedule.Actor_times[index].Time
+		left := 0.
+		if next > time {
+			left = float64(next-time) / float64(projectile.Period)
+		}
+		if left > 1 {
+			left = 1
+		}
+		progress = 1 - left
+	}
+	x, y := offset(projectile.Location, projectile.Direction, progress-.5)
+	return x, y, true
+}
+
+// DeltaProjectileLaunched puts a new projectile in a level, and schedules its
+// first turn.  The actor of the projectile must be the one the level gives
+// next, so that the Delta gives the same result each time it is applied.
+type DeltaProjectileLaunched struct {
+	Level      LevelId
+	Actor      ActorID
+	Projectile Projectile
+	Time       uint64 // When it takes its first turn.
+}
+
+func (self DeltaProjectileLaunched) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	if level.Actors.NextIDprivate != self.Actor || self.Projectile.Item != NO_ITEM {
+		return world, DELTA_PROJECTILE_CHANGED
+	}
+	level.Actors, _ = level.Actors.Add(MakeActor())
+	level.Projectiles = level.Projectiles.Set(self.Actor, self.Projectile)
+	level.ActorSchedule = level.ActorSchedule.Add(self.Actor, self.Time)
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaProjectileLaunched) String() string {
+	return fmt.Sprintf("projectile %v flies from %v", self.Actor, self.Projectile.Location)
+}
+
+// DeltaProjectileMoved changes a projectile in flight.
+type DeltaProjectileMoved struct {
+	Level  LevelId
+	Actor  ActorID
+	Before Projectile
+	After  Projectile
+}
+
+func (self DeltaProjectileMoved) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	projectile, ok := level.Projectiles.Get(self.Actor)
+	if !ok || projectile != self.Before {
+		return world, DELTA_PROJECTILE_CHANGED
+	}
+	level.Projectiles = level.Projectiles.Set(self.Actor, self.After)
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaProjectileMoved) Reverse() Delta {
+	return DeltaProjectileMoved{self.Level, self.Actor, self.After, self.Before}
+}
+
+func (self DeltaProjectileMoved) String() string {
+	return fmt.Sprintf(
+		"projectile %v moves from %v to %v",
+		self.Actor, self.Before.Location, self.After.Location,
+	)
+}
+
+// DeltaProjectileGone removes a projectile from its level, along with its
+// actor and its place in the schedule.  The item it carries must have landed
+// first.
+type DeltaProjectileGone struct {
+	Level      LevelId
+	Actor      ActorID
+	Projectile Projectile
+}
+
+func (self DeltaProjectileGone) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	projectile, ok := level.Projectiles.Get(self.Actor)
+	if !ok || projectile != self.Projectile || projectile.Item != NO_ITEM {
+		return world, DELTA_PROJECTILE_CHANGED
+	}
+	level.Projectiles = level.Projectiles.Delete(self.Actor)
+	level.Actors = level.Actors.Delete(self.Actor)
+	if index := level.ActorSchedule.PosActorID(self.Actor); index != -1 {
+		level.ActorSchedule, _ = level.ActorSchedule.Remove(level.ActorSchedule.Actor_times[index])
+	}
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaProjectileGone) String() string {
+	return fmt.Sprintf("projectile %v stops at %v", self.Actor, self.Projectile.Location)
+}
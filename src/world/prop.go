@@ -0,0 +1,289 @@
+package world
+
+import (
+	"fmt"
+	"glm"
+	"math"
+	"pmap"
+	"reflect"
+)
+
+// Props are the things of a level that move on their own but do nothing:
+// spinning crystals, bobbing keys, swinging chains...  They are purely
+// decorative, no creature ever bumps into them.  Their animation is a function
+// of the time of the World, so it needs no update and survives saves.
+
+type AnimationKind int
+
+const (
+	ANIMATION_STILL = AnimationKind(iota)
+	ANIMATION_SPIN  // Turns around the vertical axis once per period.
+	ANIMATION_BOB   // Goes up and down by Amplitude.
+	ANIMATION_SWING // Hangs from its origin and swings by Amplitude degrees.
+	ANIMATION_TRACK // Follows its keyframes.
+	ANIMATION_KINDS // Number of kinds of animations.
+)
+
+var animation_kind_text = map[AnimationKind]string{
+	ANIMATION_STILL: "still",
+	ANIMATION_SPIN:  "spin",
+	ANIMATION_BOB:   "bob",
+	ANIMATION_SWING: "swing",
+	ANIMATION_TRACK: "track",
+}
+
+func (self AnimationKind) String() string {
+	return animation_kind_text[self]
+}
+
+// A Keyframe is where a prop following a track is at a given time of the loop.
+// Between two keyframes, the prop moves smoothly from one to the other.
+type Keyframe struct {
+	Time        uint64 // Nanoseconds since the start of the loop.
+	Translation glm.Vector3
+	Rotation    glm.Quat
+}
+
+type Prop struct {
+	Dynamic            // The animation starts at birth.
+	Model     ModelId  // How the renderer draws it.
+	Location  Location // The tile it stands in.
+	Height    float64  // Of its origin above the floor.
+	Facing    AbsoluteDirection
+	Animation AnimationKind
+	Period    uint64     // Nanoseconds, the length of a loop.
+	Amplitude float64    // Of bobbing and swinging.
+	Track     []Keyframe // Sorted by time, never modified in place.
+}
+
+// MakeProp makes a prop with the usual settings of its kind of animation.
+// Props following a track hop around their tile.
+func MakeProp(model ModelId, location Location, animation AnimationKind) Prop {
+	prop := Prop{
+		Model:     model,
+		Location:  location,
+		Height:    .5,
+		Facing:    EAST(),
+		Animation: animation,
+		Period:    2000000000,
+	}
+	switch animation {
+	case ANIMATION_SPIN:
+		prop.Period = 4000000000
+	case ANIMATION_BOB:
+		prop.Amplitude = .1
+	case ANIMATION_SWING:
+		prop.Height = 1
+		prop.Period = 3000000000
+		prop.Amplitude = 30
+	case ANIMATION_TRACK:
+		up := glm.Vector3{0, 0, 1}
+		prop.Track = []Keyframe{
+			{0, glm.Vector3{.2, .2, 0}, up.Quat(0)},
+			{500000000, glm.Vector3{-.2, .2, .2}, up.Quat(90)},
+			{1000000000, glm.Vector3{-.2, -.2, 0}, up.Quat(180)},
+			{1500000000, glm.Vector3{.2, -.2, .2}, up.Quat(270)},
+		}
+	}
+	return prop
+}
+
+// Animate returns the transform of the prop relative to its origin at time t.
+func (self Prop) Animate(t uint64) glm.Matrix4 {
+	phase := self.Phase(t, self.Period)
+	switch self.Animation {
+	case ANIMATION_SPIN:
+		return glm.RotZ(360 * phase)
+	case ANIMATION_BOB:
+		z := self.Amplitude * math.Sin(2*math.Pi*phase)
+		return glm.Vector3{0, 0, z}.Translation()
+	case ANIMATION_SWING:
+		return glm.RotX(self.Amplitude * math.Sin(2*math.Pi*phase))
+	case ANIMATION_TRACK:
+		translation, rotation := self.keyframe(uint64(phase * float64(self.Period)))
+		return translation.Translation().Mult(rotation.Matrix())
+	}
+	return glm.IDENTITY4
+}
+
+// keyframe interpolates the track at the given time of the loop.  After the
+// last keyframe, the prop goes back to the first one.
+func (self Prop) keyframe(time uint64) (glm.Vector3, glm.Quat) {
+	if len(self.Track) == 0 {
+		return glm.Vector3{}, glm.Vector3{0, 0, 1}.Quat(0)
+	}
+	count := len(self.Track)
+	next := 0
+	for next < count && self.Track[next].Time <= time {
+		next++
+	}
+	previous := self.Track[(next+count-1)%count]
+	following := self.Track[next%count]
+	start, end := int64(previous.Time), int64(following.Time)
+	if next == 0 {
+		start -= int64(self.Period) // The last keyframe of the previous loop.
+	}
+	if next == count {
+		end += int64(self.Period) // The first keyframe of the next loop.
+	}
+	progress := 0.
+	if end > start {
+		progress = glm.InterpSmooth(float64(int64(time)-start) / float64(end-start))
+	}
+	return glm.InterpolateTranslation(previous.Translation, following.Translation, progress),
+		glm.InterpolateRotation(previous.Rotation, following.Rotation, progress)
+}
+
+// ModelMat returns the transform of the prop in the level at time t.
+func (self Prop) ModelMat(t uint64) glm.Matrix4 {
+	position := glm.Vector3{float64(self.Location.X), float64(self.Location.Y), self.Height}.Translation()
+	facing := glm.RotZ(float64(90 * self.Facing.Value()))
+	return position.Mult(facing).Mult(self.Animate(t))
+}
+
+// Each prop in a level is identified with a unique ID.
+type PropId uint64
+
+// Hash allows prop identifiers to be used as keys of persistent maps.
+func (self PropId) Hash() uint64 {
+	return pmap.Hash64(uint64(self))
+}
+
+type Props struct {
+	Next_id PropId
+	// The content is a persistent map, updating it does not copy it.
+	content pmap.Map
+}
+
+func MakeProps() Props {
+	return Props{}
+}
+
+func (self Props) Add(prop Prop) (Props, PropId) {
+	prop_id := self.Next_id
+	props := self.Set(prop_id, prop)
+	props.Next_id += 1
+	return props, prop_id
+}
+
+func (self Props) Get(prop_id PropId) (Prop, bool) {
+	prop, ok := self.content.Get(prop_id)
+	if !ok {
+		return Prop{}, false
+	}
+	return prop.(Prop), true
+}
+
+func (self Props) Set(prop_id PropId, prop Prop) Props {
+	self.content = self.content.Set(prop_id, prop)
+	return self
+}
+
+func (self Props) Delete(prop_id PropId) Props {
+	self.content = self.content.Delete(prop_id)
+	return self
+}
+
+func (self Props) Len() int {
+	return self.content.Len()
+}
+
+// ForEach calls f for each prop.
+func (self Props) ForEach(f func(prop_id PropId, prop Prop)) {
+	self.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(PropId), value.(Prop))
+	})
+}
+
+// At finds the prop standing in the given tile.
+func (self Props) At(location Location) (PropId, Prop, bool) {
+	var found_id PropId
+	var found Prop
+	ok := false
+	self.ForEach(func(prop_id PropId, prop Prop) {
+		if prop.Location == location && (!ok || prop_id < found_id) {
+			found_id, found, ok = prop_id, prop, true
+		}
+	})
+	return found_id, found, ok
+}
+
+// propsGob is what Props looks like to gob.
+type propsGob struct {
+	Next_id PropId
+	Content map[PropId]Prop
+}
+
+func (self Props) GobEncode() ([]byte, error) {
+	content := make(map[PropId]Prop, self.Len())
+	self.ForEach(func(prop_id PropId, prop Prop) {
+		content[prop_id] = prop
+	})
+	return gobEncode(propsGob{self.Next_id, content})
+}
+
+func (self *Props) GobDecode(data []byte) error {
+	var decoded propsGob
+	if err := gobDecode(data, &decoded); err != nil {
+		return err
+	}
+	*self = Props{Next_id: decoded.Next_id}
+	for prop_id, prop := range decoded.Content {
+		*self = self.Set(prop_id, prop)
+	}
+	return nil
+}
+
+// DeltaPropPlaced puts a new prop in a level, or takes it away again.
+type DeltaPropPlaced struct {
+	Level  LevelId
+	Prop   PropId
+	Value  Prop
+	Placed bool
+}
+
+func (self DeltaPropPlaced) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	current, ok := level.Props.Get(self.Prop)
+	if self.Placed {
+		if ok {
+			return world, DELTA_ID_TAKEN
+		}
+		level.Props = level.Props.Set(self.Prop, self.Value)
+		if self.Prop >= level.Props.Next_id {
+			level.Props.Next_id = self.Prop + 1
+		}
+		return world.SetLevel(self.Level, level), nil
+	}
+	if !ok || !sameProp(current, self.Value) {
+		return world, DELTA_PROP_CHANGED
+	}
+	level.Props = level.Props.Delete(self.Prop)
+	if self.Prop+1 == level.Props.Next_id {
+		level.Props.Next_id = self.Prop
+	}
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaPropPlaced) Reverse() Delta {
+	return DeltaPropPlaced{self.Level, self.Prop, self.Value, !self.Placed}
+}
+
+func (self DeltaPropPlaced) String() string {
+	if self.Placed {
+		return fmt.Sprintf("prop %v is placed", self.Prop)
+	}
+	return fmt.Sprintf("prop %v is taken away", self.Prop)
+}
+
+// sameProp tells whether two props are the same.  A prop without a track may
+// have a nil or an empty slice.
+func sameProp(a, b Prop) bool {
+	if len(a.Track) == 0 && len(b.Track) == 0 {
+		a.Track, b.Track = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
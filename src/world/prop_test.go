@@ -0,0 +1,100 @@
+package world
+
+import (
+	"glm"
+	"testing"
+)
+
+func TestPhase(test *testing.T) {
+	dynamic := Dynamic{T0: 1000}
+	for _, phase := range []struct {
+		t, period uint64
+		expected  float64
+	}{
+		{1000, 400, 0},
+		{1100, 400, .25},
+		{1399, 400, .9975},
+		{1400, 400, 0},  // A new loop starts.
+		{2400, 400, .5}, // Three loops later.
+		{999, 400, 0},   // Not born yet.
+		{0, 400, 0},
+		{1100, 0, 0}, // No loop.
+	} {
+		if actual := dynamic.Phase(phase.t, phase.period); actual != phase.expected {
+			test.Errorf("At %v with a period of %v: %v instead of %v.", phase.t, phase.period, actual, phase.expected)
+		}
+	}
+}
+
+// near tells whether two translations are the same, rounding errors aside.
+func near(a, b glm.Vector3) bool {
+	return a.Sub(b).Norm() < 1e-9
+}
+
+// Tracks go through their keyframes smoothly, and from the last one back to
+// the first one.
+func TestKeyframe(test *testing.T) {
+	prop := MakeProp(10, Location{}, ANIMATION_TRACK)
+	up := glm.Vector3{0, 0, 1}
+	for _, frame := range []struct {
+		time        uint64
+		translation glm.Vector3
+		angle       float64 // Around the vertical.
+	}{
+		{0, glm.Vector3{.2, .2, 0}, 0},
+		{500000000, glm.Vector3{-.2, .2, .2}, 90},
+		{1500000000, glm.Vector3{.2, -.2, .2}, 270},
+		// Halfway between two keyframes, smoothing does not show.
+		{250000000, glm.Vector3{0, .2, .1}, 45},
+		// After the last keyframe, on the way back to the first one.
+		{1750000000, glm.Vector3{.2, 0, .1}, 315},
+	} {
+		translation, rotation := prop.keyframe(frame.time)
+		if !near(translation, frame.translation) {
+			test.Errorf("At %v, the prop is at %v.", frame.time, translation)
+		}
+		x := rotation.Rotate3(glm.Vector3{1, 0, 0})
+		if !near(x, up.Quat(frame.angle).Rotate3(glm.Vector3{1, 0, 0})) {
+			test.Errorf("At %v, the prop turns x to %v.", frame.time, x)
+		}
+	}
+	// Smoothing slows down near the keyframes.
+	early, _ := prop.keyframe(50000000)
+	if progress := (.2 - early[0]) / .4; progress <= 0 || progress >= .1 {
+		test.Error("Early in the move, the prop went", progress, "of the way.")
+	}
+}
+
+// Before the first keyframe of a loop, the prop is still on its way from the
+// last keyframe of the loop before.
+func TestKeyframeBeforeTheFirst(test *testing.T) {
+	prop := MakeProp(10, Location{}, ANIMATION_TRACK)
+	prop.Track = []Keyframe{
+		{500000000, glm.Vector3{0, 0, 0}, glm.Quat{1, 0, 0, 0}},
+		{1500000000, glm.Vector3{1, 0, 0}, glm.Quat{1, 0, 0, 0}},
+	}
+	if translation, _ := prop.keyframe(0); !near(translation, glm.Vector3{.5, 0, 0}) {
+		test.Error("At the start of the loop, the prop is at", translation)
+	}
+	prop.Track = nil
+	if translation, rotation := prop.keyframe(0); translation != (glm.Vector3{}) || rotation != (glm.Quat{1, 0, 0, 0}) {
+		test.Error("Without a track, the prop moves to", translation, rotation)
+	}
+}
+
+// Animations without a period stay still, and so do props before their
+// birth.
+func TestAnimateStill(test *testing.T) {
+	for _, animation := range []AnimationKind{ANIMATION_SPIN, ANIMATION_BOB, ANIMATION_SWING, ANIMATION_TRACK} {
+		prop := MakeProp(10, Location{}, animation)
+		prop.T0 = 5000
+		rest := prop.Animate(prop.T0)
+		if prop.Animate(0) != rest {
+			test.Errorf("A prop %v moves before its birth.", animation)
+		}
+		prop.Period = 0
+		if prop.Animate(prop.T0+123456789) != rest {
+			test.Errorf("A prop %v without period moves.", animation)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package world
+
+// Rng is a pseudo random number generator small enough to live in the World.
+// Like everything else in the World it is a value: drawing a number returns
+// the number and the next state of the generator, so that the same World
+// always rolls the same dice.
+//
+// This is SplitMix64.  Its zero value is a valid generator.
+type Rng struct {
+	State uint64
+}
+
+func MakeRng(seed uint64) Rng {
+	return Rng{State: seed}
+}
+
+// Next returns 64 random bits.
+func (self Rng) Next() (Rng, uint64) {
+	self.State += 0x9e3779b97f4a7c15
+	z := self.State
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return self, z ^ (z >> 31)
+}
+
+// Intn returns a number in [0, n).  n must be positive.
+func (self Rng) Intn(n int) (Rng, int) {
+	if n <= 0 {
+		panic("Rng.Intn needs a positive bound")
+	}
+	// Reject the values that would make the low numbers more likely.
+	bound := uint64(n)
+	limit := -bound % bound // 2^64 mod n.
+	for {
+		var value uint64
+		self, value = self.Next()
+		if value >= limit {
+			return self, int(value % bound)
+		}
+	}
+}
+
+// Roll returns the sum of `dice` dice with `sides` sides each.
+func (self Rng) Roll(dice, sides int) (Rng, int) {
+	total := 0
+	for i := 0; i < dice; i++ {
+		var value int
+		self, value = self.Intn(sides)
+		total += value + 1
+	}
+	return self, total
+}
+
+// Each subsystem of the World draws its random numbers from its own stream,
+// so that adding a roll to one of them does not change what the others draw:
+// a new decision of the monsters does not reshuffle the loot.
+type Stream int
+
+const (
+	STREAM_COMBAT = Stream(iota) // Attacks, traps and falls.
+	STREAM_AI                    // Decisions of the actors.
+	STREAM_LOOT                  // What is found, and where.
+	STREAM_LEVELS                // Levels made while playing.
+	STREAMS                      // Number of streams.
+)
+
+var stream_text = map[Stream]string{
+	STREAM_COMBAT: "combat",
+	STREAM_AI:     "ai",
+	STREAM_LOOT:   "loot",
+	STREAM_LEVELS: "levels",
+}
+
+func (self Stream) String() string {
+	return stream_text[self]
+}
+
+// Rngs holds the generator of each stream.
+type Rngs [STREAMS]Rng
+
+// MakeRngs seeds all the streams from a single seed.  The state of each stream
+// is drawn from a generator seeded with the seed, so the streams start at
+// unrelated places of the sequence, and never catch up with one another in
+// practice.
+func MakeRngs(seed uint64) Rngs {
+	var rngs Rngs
+	rng := MakeRng(seed)
+	for stream := range rngs {
+		var state uint64
+		rng, state = rng.Next()
+		rngs[stream] = MakeRng(state)
+	}
+	return rngs
+}
+
+// Rng returns the generator of the stream.
+func (world World) Rng(stream Stream) Rng {
+	return world.Rngs[stream]
+}
+
+// Intn draws a number in [0, n) from the stream.  n must be positive.
+func (world World) Intn(stream Stream, n int) (World, int) {
+	rng, value := world.Rngs[stream].Intn(n)
+	return world.SetRng(stream, rng), value
+}
+
+// Roll rolls dice with the generator of the stream.
+func (world World) Roll(stream Stream, dice, sides int) (World, int) {
+	rng, total := world.Rngs[stream].Roll(dice, sides)
+	return world.SetRng(stream, rng), total
+}
+
+// Reseed starts all the streams again from the given seed.
+func (world World) Reseed(seed uint64) World {
+	world.Rngs = MakeRngs(seed)
+	return world
+}
@@ -0,0 +1,290 @@
+package world
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A save file starts with SAVE_MAGIC, followed by a gob stream containing a
+// SaveHeader and then the payload: the gob encoding of the World, as a slice
+// of bytes.  Keeping the payload as opaque bytes allows the header to be read
+// without decoding the World, and allows migrations to work on old payloads
+// whose Go types do not exist anymore.
+//
+// Files written before the header existed are pure gob encodings of the World.
+// They have no magic and are considered to be version 0.
+const SAVE_MAGIC = "DAGGOR\x00SAVE"
+
+// SAVE_VERSION is the version of the format written by this code.  Increase it
+// each time the World changes in a way that breaks gob decoding, and register
+// a Migration from the previous version.
+const SAVE_VERSION = 7
+
+// SAVE_EXTENSION is the extension given to the files of the save slots.
+const SAVE_EXTENSION = ".sav"
+
+// QUICKSAVE_SLOT is the name of the slot used by the quick save and quick load
+// commands.
+const QUICKSAVE_SLOT = "quicksave"
+
+// SaveDir is the directory containing the files of the save slots.
+var SaveDir = "."
+
+type SaveHeader struct {
+	Version    uint32
+	Time       uint64    // Game time, nanoseconds.
+	Level_name string    // Name of the level the player is in.
+	Timestamp  time.Time // Real time at which the save was made.
+}
+
+type SaveErrorKind int
+
+const (
+	SAVE_MISSING = SaveErrorKind(iota)
+	SAVE_CORRUPT
+	SAVE_TOO_NEW
+	SAVE_TOO_OLD
+	SAVE_BAD_SLOT
+	SAVE_INVALID
+)
+
+var save_error_text = map[SaveErrorKind]string{
+	SAVE_MISSING:  "save missing",
+	SAVE_CORRUPT:  "save corrupt",
+	SAVE_TOO_NEW:  "save too new",
+	SAVE_TOO_OLD:  "save too old, no migration available",
+	SAVE_BAD_SLOT: "invalid slot name",
+	SAVE_INVALID:  "save inconsistent",
+}
+
+// SaveError is returned by the functions reading and writing saves.  Its Kind
+// tells what went wrong, Err holds the underlying error when there is one.
+type SaveError struct {
+	Kind SaveErrorKind
+	Err  error
+}
+
+func (self SaveError) Error() string {
+	if self.Err == nil {
+		return save_error_text[self.Kind]
+	}
+	return fmt.Sprintf("%v: %v", save_error_text[self.Kind], self.Err)
+}
+
+// A Migration upgrades the payload of a save from one version to the next.
+type Migration func(payload []byte) ([]byte, error)
+
+// migrations is indexed by the version a Migration upgrades from.
+var migrations = make(map[uint32]Migration)
+
+// RegisterMigration registers the Migration upgrading payloads of version
+// `from` to version `from + 1`.  It is meant to be called from init functions.
+func RegisterMigration(from uint32, migration Migration) {
+	if _, ok := migrations[from]; ok {
+		panic(fmt.Sprintf("migration from version %v already registered", from))
+	}
+	migrations[from] = migration
+}
+
+func (world World) header() SaveHeader {
+	header := SaveHeader{
+		Version:   SAVE_VERSION,
+		Time:      world.Time,
+		Timestamp: time.Now(),
+	}
+	if level_id, ok := world.PlayerLevel(); ok {
+		header.Level_name = world.Levels[level_id].Name
+	}
+	return header
+}
+
+// Write writes a save of the World, header included.
+func (world World) Write(w io.Writer) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(world); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, SAVE_MAGIC); err != nil {
+		return err
+	}
+	encoder := gob.NewEncoder(w)
+	if err := encoder.Encode(world.header()); err != nil {
+		return err
+	}
+	return encoder.Encode(payload.Bytes())
+}
+
+// readRaw reads the header and the payload of a save, without interpreting
+// the payload.
+func readRaw(r io.Reader, with_payload bool) (SaveHeader, []byte, error) {
+	var header SaveHeader
+	var payload []byte
+	reader := bufio.NewReader(r)
+	magic, err := reader.Peek(len(SAVE_MAGIC))
+	if err != nil && err != io.EOF {
+		return header, nil, SaveError{SAVE_CORRUPT, err}
+	}
+	if string(magic) != SAVE_MAGIC {
+		// Legacy save, without header.
+		if with_payload {
+			payload, err = io.ReadAll(reader)
+			if err != nil {
+				return header, nil, SaveError{SAVE_CORRUPT, err}
+			}
+		}
+		return header, payload, nil
+	}
+	if _, err := reader.Discard(len(SAVE_MAGIC)); err != nil {
+		return header, nil, SaveError{SAVE_CORRUPT, err}
+	}
+	decoder := gob.NewDecoder(reader)
+	if err := decoder.Decode(&header); err != nil {
+		return header, nil, SaveError{SAVE_CORRUPT, err}
+	}
+	if with_payload {
+		if err := decoder.Decode(&payload); err != nil {
+			return header, nil, SaveError{SAVE_CORRUPT, err}
+		}
+	}
+	return header, payload, nil
+}
+
+// ReadHeader reads only the header of a save.  Legacy saves have an empty
+// header of version 0.
+func ReadHeader(r io.Reader) (SaveHeader, error) {
+	header, _, err := readRaw(r, false)
+	return header, err
+}
+
+// Read reads a save written by World.Write, or by any former version of the
+// game for which migrations are registered.
+func Read(r io.Reader) (World, SaveHeader, error) {
+	var world World
+	header, payload, err := readRaw(r, true)
+	if err != nil {
+		return world, header, err
+	}
+	if header.Version > SAVE_VERSION {
+		return world, header, SaveError{
+			SAVE_TOO_NEW,
+			fmt.Errorf("version %v, expected at most %v", header.Version, SAVE_VERSION),
+		}
+	}
+	for version := header.Version; version < SAVE_VERSION; version++ {
+		migration, ok := migrations[version]
+		if !ok {
+			return world, header, SaveError{
+				SAVE_TOO_OLD,
+				fmt.Errorf("version %v", version),
+			}
+		}
+		payload, err = migration(payload)
+		if err != nil {
+			return world, header, SaveError{
+				SAVE_CORRUPT,
+				fmt.Errorf("migration from version %v: %v", version, err),
+			}
+		}
+	}
+	decoder := gob.NewDecoder(bytes.NewReader(payload))
+	if err := decoder.Decode(&world); err != nil {
+		return world, header, SaveError{SAVE_CORRUPT, err}
+	}
+	// The world decoded fine, but may still be nonsense.  It is returned
+	// anyway, the caller decides what to do with it.
+	if problems := world.Validate(); len(problems) != 0 {
+		return world, header, SaveError{SAVE_INVALID, problems}
+	}
+	return world, header, nil
+}
+
+// SaveFile writes a save of the World to the file at the given path.  The
+// file is first written under a temporary name, so that a failure does not
+// destroy an existing save.
+func (world World) SaveFile(path string) (err error) {
+	tmp_path := path + ".tmp"
+	f, err := os.Create(tmp_path)
+	if err != nil {
+		return err
+	}
+	err = world.Write(f)
+	if err_close := f.Close(); err == nil {
+		err = err_close
+	}
+	if err != nil {
+		os.Remove(tmp_path)
+		return err
+	}
+	return os.Rename(tmp_path, path)
+}
+
+// LoadFile reads a save from the file at the given path.
+func LoadFile(path string) (World, SaveHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return World{}, SaveHeader{}, SaveError{SAVE_MISSING, err}
+		}
+		return World{}, SaveHeader{}, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// SlotPath returns the path of the file of a save slot.  Slot names are plain
+// names, not paths.
+func SlotPath(slot string) (string, error) {
+	if slot == "" || strings.ContainsAny(slot, `/\`) || slot == "." || slot == ".." {
+		return "", SaveError{SAVE_BAD_SLOT, fmt.Errorf("%q", slot)}
+	}
+	return filepath.Join(SaveDir, slot+SAVE_EXTENSION), nil
+}
+
+func (world World) SaveSlot(slot string) error {
+	path, err := SlotPath(slot)
+	if err != nil {
+		return err
+	}
+	return world.SaveFile(path)
+}
+
+func LoadSlot(slot string) (World, SaveHeader, error) {
+	path, err := SlotPath(slot)
+	if err != nil {
+		return World{}, SaveHeader{}, err
+	}
+	return LoadFile(path)
+}
+
+// Slots returns the headers of all the save slots found in SaveDir, indexed
+// by slot name.  Slots whose header cannot be read are not listed.
+func Slots() (map[string]SaveHeader, error) {
+	paths, err := filepath.Glob(filepath.Join(SaveDir, "*"+SAVE_EXTENSION))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	slots := make(map[string]SaveHeader, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		header, err := ReadHeader(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		slot := strings.TrimSuffix(filepath.Base(path), SAVE_EXTENSION)
+		slots[slot] = header
+	}
+	return slots, nil
+}
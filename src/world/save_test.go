@@ -0,0 +1,140 @@
+package world
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// saveOfVersion writes a save with a header of the given version around the
+// payload, as the game of that version did.
+func saveOfVersion(test *testing.T, version uint32, payload []byte) []byte {
+	var save bytes.Buffer
+	io.WriteString(&save, SAVE_MAGIC)
+	encoder := gob.NewEncoder(&save)
+	if err := encoder.Encode(SaveHeader{Version: version, Level_name: "old"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := encoder.Encode(payload); err != nil {
+		test.Fatal(err)
+	}
+	return save.Bytes()
+}
+
+// saveErrorKind returns the kind of a SaveError, and fails the test for
+// other errors.
+func saveErrorKind(test *testing.T, err error) SaveErrorKind {
+	save_error, ok := err.(SaveError)
+	if !ok {
+		test.Fatalf("%v is not a SaveError.", err)
+	}
+	return save_error.Kind
+}
+
+func TestSaveRoundTrip(test *testing.T) {
+	w := savableWorld()
+	var save bytes.Buffer
+	if err := w.Write(&save); err != nil {
+		test.Fatal(err)
+	}
+	loaded, header, err := Read(&save)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if header.Version != SAVE_VERSION || loaded.Player_id != w.Player_id {
+		test.Error("Read back", header, loaded.Player_id)
+	}
+}
+
+func TestSaveCorrupt(test *testing.T) {
+	var good bytes.Buffer
+	if err := savableWorld().Write(&good); err != nil {
+		test.Fatal(err)
+	}
+	for name, save := range map[string][]byte{
+		"truncated": good.Bytes()[:good.Len()/2],
+		"no header": []byte(SAVE_MAGIC),
+		"garbage":   append([]byte(SAVE_MAGIC), "garbage"...),
+		"legacy":    []byte("garbage"),
+		"payload":   saveOfVersion(test, SAVE_VERSION, []byte("garbage")),
+	} {
+		_, _, err := Read(bytes.NewReader(save))
+		if err == nil || saveErrorKind(test, err) != SAVE_CORRUPT {
+			test.Errorf("A %v save reads with %v.", name, err)
+		}
+	}
+}
+
+func TestSaveTooNew(test *testing.T) {
+	save := saveOfVersion(test, SAVE_VERSION+1, nil)
+	_, header, err := Read(bytes.NewReader(save))
+	if err == nil || saveErrorKind(test, err) != SAVE_TOO_NEW {
+		test.Error("A save from the future reads with", err)
+	}
+	if header.Version != SAVE_VERSION+1 {
+		test.Error("The header reads as", header)
+	}
+}
+
+func TestSaveTooOld(test *testing.T) {
+	migration := migrations[0]
+	delete(migrations, 0)
+	defer func() { migrations[0] = migration }()
+	_, _, err := Read(bytes.NewReader(payloadV0(test)))
+	if err == nil || saveErrorKind(test, err) != SAVE_TOO_OLD {
+		test.Error("A save without migration reads with", err)
+	}
+}
+
+func TestSaveMissing(test *testing.T) {
+	_, _, err := LoadFile(filepath.Join(test.TempDir(), "nowhere"+SAVE_EXTENSION))
+	if err == nil || saveErrorKind(test, err) != SAVE_MISSING {
+		test.Error("A missing save loads with", err)
+	}
+}
+
+func TestSaveInvalid(test *testing.T) {
+	w := savableWorld()
+	w.Player_id++
+	var save bytes.Buffer
+	if err := w.Write(&save); err != nil {
+		test.Fatal(err)
+	}
+	loaded, _, err := Read(&save)
+	if err == nil || saveErrorKind(test, err) != SAVE_INVALID {
+		test.Error("A world without player reads with", err)
+	}
+	if loaded.Player_id != w.Player_id {
+		test.Error("The invalid world is not returned.")
+	}
+}
+
+func TestSaveBadSlot(test *testing.T) {
+	for _, slot := range []string{"", ".", "..", "a/b", `a\b`} {
+		_, err := SlotPath(slot)
+		if err == nil || saveErrorKind(test, err) != SAVE_BAD_SLOT {
+			test.Errorf("Slot %q gives %v.", slot, err)
+		}
+	}
+}
+
+func TestSaveSlots(test *testing.T) {
+	dir := SaveDir
+	SaveDir = test.TempDir()
+	defer func() { SaveDir = dir }()
+	if err := savableWorld().SaveSlot("first"); err != nil {
+		test.Fatal(err)
+	}
+	slots, err := Slots()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if header, ok := slots["first"]; !ok || header.Version != SAVE_VERSION || len(slots) != 1 {
+		test.Error("Found the slots", slots)
+	}
+	if _, _, err := LoadSlot("first"); err != nil {
+		test.Error(err)
+	}
+}
@@ -0,0 +1,287 @@
+package world
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Migrations decode old payloads into copies of the World of their time, and
+// encode them again as the next version.  The Worlds up to version 1 are
+// frozen, and so are their levels.  From version 2 on, the levels are decoded
+// into the live Level type: renaming or retyping one of its fields breaks the
+// old saves, and the saves kept in testdata catch that.  Never change the
+// types below: add new ones along with new migrations instead.
+
+func init() {
+	RegisterMigration(0, migrateSingleLevel)
+	RegisterMigration(1, migratePersistentMaps)
+	RegisterMigration(2, migrateItems)
+	RegisterMigration(3, migrateCreatureStats)
+	RegisterMigration(4, migrateRngSeed)
+	RegisterMigration(5, migrateRngStreams)
+	RegisterMigration(6, migrateTravellers)
+}
+
+// Version 1: collections were plain Go maps.
+type levelV1 struct {
+	Name     string
+	Floors   map[Location]Building
+	Ceilings map[Location]Building
+	Walls    [4]map[Location]Building
+	Columns  map[Location]Building
+	Dynamic  Dynamic
+	Actors   struct {
+		NextIDprivate  ActorID
+		ContentPrivate map[ActorID]Actor
+	}
+	Creatures struct {
+		Next_id CreatureId
+		Content map[CreatureId]Creature
+	}
+	CreatureLocation struct {
+		Cl map[CreatureId]Location
+		Lc map[Location]CreatureId
+	}
+	CreatureActor struct {
+		Ca map[CreatureId]ActorID
+		Ac map[ActorID]CreatureId
+	}
+	ActorSchedule ActorSchedule
+}
+
+type worldV1 struct {
+	Player_id ActorID
+	Levels    map[LevelId]levelV1
+	Time      uint64
+}
+
+// Version 0: raw gob of a World holding a single Level, without header.
+type worldV0 struct {
+	Player_id ActorID
+	Level     levelV1
+	Time      uint64
+}
+
+// migrateSingleLevel turns the single Level of version 0 into Level 0 of the
+// World.
+func migrateSingleLevel(payload []byte) ([]byte, error) {
+	var old worldV0
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&old); err != nil {
+		return nil, err
+	}
+	world := worldV1{
+		Player_id: old.Player_id,
+		Levels:    map[LevelId]levelV1{0: old.Level},
+		Time:      old.Time,
+	}
+	var result bytes.Buffer
+	err := gob.NewEncoder(&result).Encode(world)
+	return result.Bytes(), err
+}
+
+func buildingsFromV1(old map[Location]Building) Buildings {
+	buildings := MakeBuildings()
+	for location, building := range old {
+		buildings = buildings.Set(location.X, location.Y, building)
+	}
+	return buildings
+}
+
+// migratePersistentMaps moves the content of the plain maps of version 1 into
+// the persistent maps of version 2.
+func migratePersistentMaps(payload []byte) ([]byte, error) {
+	var old worldV1
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&old); err != nil {
+		return nil, err
+	}
+	world := worldV2{
+		Player_id: old.Player_id,
+		Levels:    MakeLevels(),
+		Time:      old.Time,
+	}
+	for level_id, old_level := range old.Levels {
+		level := MakeLevel(level_id)
+		level.Name = old_level.Name
+		level.Floors = buildingsFromV1(old_level.Floors)
+		level.Ceilings = buildingsFromV1(old_level.Ceilings)
+		for i := range level.Walls {
+			level.Walls[i] = buildingsFromV1(old_level.Walls[i])
+		}
+		level.Columns = buildingsFromV1(old_level.Columns)
+		level.Dynamic = old_level.Dynamic
+		level.Actors.NextIDprivate = old_level.Actors.NextIDprivate
+		for actor_id, actor := range old_level.Actors.ContentPrivate {
+			level.Actors = level.Actors.Insert(actor_id, actor)
+		}
+		level.Creatures.Next_id = old_level.Creatures.Next_id
+		for creature_id, creature := range old_level.Creatures.Content {
+			level.Creatures = level.Creatures.Set(creature_id, creature)
+		}
+		for creature_id, location := range old_level.CreatureLocation.Cl {
+			var err error
+			level.CreatureLocation, err = level.CreatureLocation.Add(creature_id, location)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for creature_id, actor_id := range old_level.CreatureActor.Ca {
+			var err error
+			level.CreatureActor, err = level.CreatureActor.Add(creature_id, actor_id)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if old_level.ActorSchedule.Actor_times != nil {
+			level.ActorSchedule = old_level.ActorSchedule
+		}
+		world.Levels = world.Levels.Set(level_id, level)
+	}
+	var result bytes.Buffer
+	err := gob.NewEncoder(&result).Encode(world)
+	return result.Bytes(), err
+}
+
+// Versions 2 to 4: the World had no generator.  Levels are not frozen: since
+// version 2 they only gained fields, which gob leaves to their zero values,
+// and the migrations below fill them.
+type worldV2 struct {
+	Player_id ActorID
+	Levels    Levels
+	Time      uint64
+}
+
+// Version 4.  The World got a single random number generator, and later an
+// automap, without a new version: saves of version 4 may have them or not.
+type worldV4 struct {
+	Player_id ActorID
+	Levels    Levels
+	Time      uint64
+	Rng       Rng
+	Automap   Automap
+}
+
+// Version 5: the World always has its generator.
+type worldV5 struct {
+	Player_id ActorID
+	Levels    Levels
+	Time      uint64
+	Rng       Rng
+	Automap   Automap
+}
+
+// Version 6: one generator per stream.
+type worldV6 struct {
+	Player_id ActorID
+	Levels    Levels
+	Time      uint64
+	Rngs      [4]Rng
+	Automap   Automap
+}
+
+// Version 7: the World knows where the creatures and actors that left their
+// level are.
+type worldV7 struct {
+	Player_id  ActorID
+	Levels     Levels
+	Time       uint64
+	Rngs       [4]Rng
+	Automap    Automap
+	Travellers Travellers
+}
+
+// migrateItems sets the counter of the items of each level, which version 2
+// did not have.
+func migrateItems(payload []byte) ([]byte, error) {
+	var world worldV2
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&world); err != nil {
+		return nil, err
+	}
+	for level_id, level := range world.Levels {
+		level.Items.Next_id = firstItemId(level_id)
+		world.Levels = world.Levels.Set(level_id, level)
+	}
+	var result bytes.Buffer
+	err := gob.NewEncoder(&result).Encode(world)
+	return result.Bytes(), err
+}
+
+// migrateCreatureStats gives statistics to the creatures of version 3, which
+// had none and would otherwise be dead.
+func migrateCreatureStats(payload []byte) ([]byte, error) {
+	var world worldV2
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&world); err != nil {
+		return nil, err
+	}
+	for level_id, level := range world.Levels {
+		level.Creatures.ForEach(func(creature_id CreatureId, creature Creature) {
+			creature.Stats = MakeStats(MakeAttributes())
+			level.Creatures = level.Creatures.Set(creature_id, creature)
+		})
+		world.Levels = world.Levels.Set(level_id, level)
+	}
+	var result bytes.Buffer
+	err := gob.NewEncoder(&result).Encode(world)
+	return result.Bytes(), err
+}
+
+// migrateRngSeed seeds the generator of the saves of version 4 that had none,
+// the way MakeWorld does.  Without it, they would all roll the same numbers
+// from the zero state.  A generator that happens to be at the zero state is
+// seeded again, which does no harm.
+func migrateRngSeed(payload []byte) ([]byte, error) {
+	var old worldV4
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&old); err != nil {
+		return nil, err
+	}
+	world := worldV5(old)
+	if world.Rng == (Rng{}) {
+		world.Rng = MakeRng(world_seed)
+	}
+	var result bytes.Buffer
+	err := gob.NewEncoder(&result).Encode(world)
+	return result.Bytes(), err
+}
+
+// migrateRngStreams splits the single generator of version 5 into streams.
+// Combat keeps the old generator, which was only used for combat, and the
+// other streams are seeded from it.
+func migrateRngStreams(payload []byte) ([]byte, error) {
+	var old worldV5
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&old); err != nil {
+		return nil, err
+	}
+	world := worldV6{
+		Player_id: old.Player_id,
+		Levels:    old.Levels,
+		Time:      old.Time,
+		Rngs:      MakeRngs(old.Rng.State),
+		Automap:   old.Automap,
+	}
+	world.Rngs[STREAM_COMBAT] = old.Rng
+	var result bytes.Buffer
+	err := gob.NewEncoder(&result).Encode(world)
+	return result.Bytes(), err
+}
+
+// migrateTravellers looks once into all the levels of version 6 for the
+// creatures and actors that are not in the level they were made in.
+func migrateTravellers(payload []byte) ([]byte, error) {
+	var old worldV6
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&old); err != nil {
+		return nil, err
+	}
+	world := worldV7{
+		Player_id:  old.Player_id,
+		Levels:     old.Levels,
+		Time:       old.Time,
+		Rngs:       old.Rngs,
+		Automap:    old.Automap,
+		Travellers: MakeTravellers(),
+	}
+	for level_id, level := range world.Levels {
+		world.Travellers = world.Travellers.index(level_id, level)
+	}
+	var result bytes.Buffer
+	err := gob.NewEncoder(&result).Encode(world)
+	return result.Bytes(), err
+}
@@ -0,0 +1,296 @@
+package world
+
+import (
+	"bytes"
+	"encoding/gob"
+	"path/filepath"
+	"testing"
+)
+
+// payloadV0 is a save of version 0: a single Level where the player stands on
+// a floor, with a wall behind.
+func payloadV0(test *testing.T) []byte {
+	creature := Creature{F: NORTH(), Faction: FACTION_PLAYER}
+	old := worldV0{Player_id: 3, Time: 42}
+	old.Level.Name = "cellar"
+	old.Level.Floors = map[Location]Building{{1, 2}: MakeFloor(0, EAST(), true)}
+	old.Level.Walls[EAST().Value()] = map[Location]Building{{1, 2}: MakeWall(1, false)}
+	old.Level.Actors.NextIDprivate = 4
+	old.Level.Actors.ContentPrivate = map[ActorID]Actor{3: MakeActor()}
+	old.Level.Creatures.Next_id = 1
+	old.Level.Creatures.Content = map[CreatureId]Creature{0: creature}
+	old.Level.CreatureLocation.Cl = map[CreatureId]Location{0: {1, 2}}
+	old.Level.CreatureLocation.Lc = map[Location]CreatureId{{1, 2}: 0}
+	old.Level.CreatureActor.Ca = map[CreatureId]ActorID{0: 3}
+	old.Level.CreatureActor.Ac = map[ActorID]CreatureId{3: 0}
+	return encodePayload(test, old)
+}
+
+func encodePayload(test *testing.T, world interface{}) []byte {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(world); err != nil {
+		test.Fatal(err)
+	}
+	return payload.Bytes()
+}
+
+// A save of version 0 goes through every migration up to SAVE_VERSION.
+func TestMigrationsFromVersion0(test *testing.T) {
+	loaded, header, err := Read(bytes.NewReader(payloadV0(test)))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if header.Version != 0 {
+		test.Errorf("Read version %v.", header.Version)
+	}
+	if loaded.Player_id != 3 || loaded.Time != 42 {
+		test.Errorf("Lost the player or the time: %v, %v.", loaded.Player_id, loaded.Time)
+	}
+	level, ok := loaded.Levels[0]
+	if !ok || level.Name != "cellar" {
+		test.Fatal("Lost the level.")
+	}
+	if _, ok := level.Walls[EAST().Value()].Get(1, 2); !ok {
+		test.Error("Lost the wall.")
+	}
+	position, ok := loaded.ActorPosition(3)
+	if !ok || position.Location != (Location{1, 2}) || position.F != NORTH() {
+		test.Error("Lost the player:", position, ok)
+	}
+	if level.Items.Next_id != firstItemId(0) {
+		test.Error("Items count from", level.Items.Next_id)
+	}
+	creature, _ := level.Creatures.Get(0)
+	if creature.Stats != MakeStats(MakeAttributes()) {
+		test.Error("The creature has no statistics:", creature.Stats)
+	}
+	for stream := Stream(0); stream < STREAMS; stream++ {
+		if loaded.Rng(stream) == (Rng{}) {
+			test.Errorf("Stream %v was not seeded.", stream)
+		}
+	}
+}
+
+// Saves of version 4 written once the World had its generator keep it.
+func TestMigrationKeepsTheGeneratorOfVersion4(test *testing.T) {
+	w := savableWorld()
+	old := worldV4{Player_id: w.Player_id, Levels: w.Levels, Time: w.Time, Rng: MakeRng(7)}
+	payload, err := migrateRngSeed(encodePayload(test, old))
+	if err != nil {
+		test.Fatal(err)
+	}
+	var migrated worldV5
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&migrated); err != nil {
+		test.Fatal(err)
+	}
+	if migrated.Rng != MakeRng(7) {
+		test.Error("The generator changed:", migrated.Rng)
+	}
+}
+
+// Saves of version 6 learn where the travellers are.
+func TestMigrationFindsTheTravellers(test *testing.T) {
+	w := travelledWorld(test)
+	old := worldV6{Player_id: w.Player_id, Levels: w.Levels, Time: w.Time, Rngs: w.Rngs, Automap: w.Automap}
+	payload, err := migrateTravellers(encodePayload(test, old))
+	if err != nil {
+		test.Fatal(err)
+	}
+	var migrated World
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&migrated); err != nil {
+		test.Fatal(err)
+	}
+	if level_id, ok := migrated.PlayerLevel(); !ok || level_id != 1 {
+		test.Error("The player is in level", level_id, ok)
+	}
+	if problems := migrated.Validate(); len(problems) != 0 {
+		test.Error(problems)
+	}
+}
+
+// testdata/version2.sav was written by the game of version 2: an entrance
+// with a door and a monster, and stairs down to a cellar where the player
+// went.  It catches the changes to Level that old saves cannot decode.
+func TestReadStoredVersion2(test *testing.T) {
+	w, header, err := LoadFile(filepath.Join("testdata", "version2.sav"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if header.Version != 2 || header.Level_name != "Cellar" {
+		test.Error("The header reads as", header)
+	}
+	if w.Time != 12345 || w.Levels[0].Name != "Entrance" || w.Levels[1].Name != "Cellar" {
+		test.Error("The World reads at", w.Time, "with levels", w.Levels[0].Name, w.Levels[1].Name)
+	}
+	if position, ok := w.ActorPosition(w.Player_id); !ok ||
+		position != (LevelPosition{1, Position{Location{1, 1}, SOUTH()}}) {
+		test.Error("The player is at", position, ok)
+	}
+	entrance := w.Levels[0]
+	if door, ok := entrance.GetDoor(DoorSlot{Location{1, 0}, true, EAST()}); !ok || door.State() != DOOR_CLOSED {
+		test.Error("The door reads as", door, ok)
+	}
+	if _, ok := entrance.Floors.Get(2, 2); !ok || entrance.Floors.Len() != 9 {
+		test.Error("The floors read as", entrance.Floors.Len())
+	}
+	monster_id, _ := entrance.CreatureLocation.GetCreature(Location{1, 1})
+	monster, ok := entrance.Creatures.Get(monster_id)
+	if !ok || monster.F != WEST() || monster.IsDead() {
+		test.Error("The monster reads as", monster, ok)
+	}
+	if entrance.ActorSchedule.Len() != 1 || entrance.Items.Next_id != firstItemId(0) {
+		test.Error("The monster is not scheduled, or the items are not counted.")
+	}
+	for stream := Stream(0); stream < STREAMS; stream++ {
+		if w.Rng(stream) == (Rng{}) {
+			test.Error("The stream", stream, "is not seeded.")
+		}
+	}
+}
+
+// Every version up to SAVE_VERSION has a migration to the next one.
+func TestMigrationsRegistered(test *testing.T) {
+	for version := uint32(0); version < SAVE_VERSION; version++ {
+		if migrations[version] == nil {
+			test.Errorf("No migration from version %v.", version)
+		}
+	}
+}
+
+// Saves of each version read, whatever the migrations they need.
+func TestReadEachVersion(test *testing.T) {
+	payload := payloadV0(test)
+	for version := uint32(0); version <= SAVE_VERSION; version++ {
+		save := payload
+		if version > 0 {
+			save = saveOfVersion(test, version, payload)
+		}
+		loaded, header, err := Read(bytes.NewReader(save))
+		if err != nil {
+			test.Fatalf("Version %v: %v", version, err)
+		}
+		if header.Version != version {
+			test.Errorf("Version %v read as %v.", version, header.Version)
+		}
+		if position, ok := loaded.ActorPosition(3); !ok || position.Location != (Location{1, 2}) {
+			test.Errorf("Version %v lost the player.", version)
+		}
+		if version < SAVE_VERSION {
+			if payload, err = migrations[version](payload); err != nil {
+				test.Fatalf("Migration from version %v: %v", version, err)
+			}
+		}
+	}
+}
+
+func TestMigrationToVersion1(test *testing.T) {
+	payload, err := migrateSingleLevel(payloadV0(test))
+	if err != nil {
+		test.Fatal(err)
+	}
+	var migrated worldV1
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&migrated); err != nil {
+		test.Fatal(err)
+	}
+	if len(migrated.Levels) != 1 || migrated.Levels[0].Name != "cellar" || migrated.Player_id != 3 {
+		test.Error("The single level did not become level 0:", migrated)
+	}
+}
+
+func TestMigrationToVersion2(test *testing.T) {
+	old := worldV1{Player_id: 3, Levels: map[LevelId]levelV1{}}
+	for level_id := LevelId(0); level_id < 2; level_id++ {
+		var level levelV1
+		level.Floors = map[Location]Building{{1, 2}: MakeFloor(0, EAST(), true)}
+		level.CreatureLocation.Cl = map[CreatureId]Location{7: {1, 2}}
+		level.Creatures.Content = map[CreatureId]Creature{7: {}}
+		old.Levels[level_id] = level
+	}
+	payload, err := migratePersistentMaps(encodePayload(test, old))
+	if err != nil {
+		test.Fatal(err)
+	}
+	var migrated worldV2
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&migrated); err != nil {
+		test.Fatal(err)
+	}
+	for level_id := LevelId(0); level_id < 2; level_id++ {
+		level := migrated.Levels[level_id]
+		if _, ok := level.Floors.Get(1, 2); !ok {
+			test.Errorf("Level %v lost its floor.", level_id)
+		}
+		if location, ok := level.CreatureLocation.GetLocation(7); !ok || location != (Location{1, 2}) {
+			test.Errorf("Level %v lost its creature.", level_id)
+		}
+	}
+}
+
+func TestMigrationToVersion3(test *testing.T) {
+	levels := MakeLevels().Set(0, Level{}).Set(2, Level{})
+	payload, err := migrateItems(encodePayload(test, worldV2{Levels: levels}))
+	if err != nil {
+		test.Fatal(err)
+	}
+	var migrated worldV2
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&migrated); err != nil {
+		test.Fatal(err)
+	}
+	for level_id, level := range migrated.Levels {
+		if level.Items.Next_id != firstItemId(level_id) {
+			test.Errorf("Items of level %v count from %v.", level_id, level.Items.Next_id)
+		}
+	}
+}
+
+func TestMigrationToVersion4(test *testing.T) {
+	level := MakeLevel(0)
+	level.Creatures = level.Creatures.Set(0, Creature{Faction: FACTION_MONSTERS})
+	old := worldV2{Levels: MakeLevels().Set(0, level)}
+	payload, err := migrateCreatureStats(encodePayload(test, old))
+	if err != nil {
+		test.Fatal(err)
+	}
+	var migrated worldV2
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&migrated); err != nil {
+		test.Fatal(err)
+	}
+	creature, _ := migrated.Levels[0].Creatures.Get(0)
+	if creature.Stats != MakeStats(MakeAttributes()) || creature.Faction != FACTION_MONSTERS {
+		test.Error("The creature was not given statistics:", creature)
+	}
+}
+
+// Saves of version 4 without generator get the one of MakeWorld.
+func TestMigrationToVersion5(test *testing.T) {
+	payload, err := migrateRngSeed(encodePayload(test, worldV4{Time: 5}))
+	if err != nil {
+		test.Fatal(err)
+	}
+	var migrated worldV5
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&migrated); err != nil {
+		test.Fatal(err)
+	}
+	if migrated.Rng != MakeRng(world_seed) || migrated.Time != 5 {
+		test.Error("The generator was not seeded:", migrated.Rng)
+	}
+}
+
+// Combat keeps rolling where the single generator was.
+func TestMigrationToVersion6(test *testing.T) {
+	payload, err := migrateRngStreams(encodePayload(test, worldV5{Rng: MakeRng(9)}))
+	if err != nil {
+		test.Fatal(err)
+	}
+	var migrated worldV6
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&migrated); err != nil {
+		test.Fatal(err)
+	}
+	if migrated.Rngs[STREAM_COMBAT] != MakeRng(9) {
+		test.Error("Combat lost the generator:", migrated.Rngs)
+	}
+	for stream := Stream(1); stream < STREAMS; stream++ {
+		if migrated.Rngs[stream] == migrated.Rngs[STREAM_COMBAT] || migrated.Rngs[stream] == (Rng{}) {
+			test.Errorf("Stream %v was not seeded apart.", stream)
+		}
+	}
+}
@@ -90,6 +90,12 @@ func (self ActorSchedule) Remove(actor_time ActorTime) (ActorSchedule, bool) {
 	self.Actor_times = append(
 		self.Actor_times[:index],
 		self.Actor_times[index+1:]...)
+	// The stability index of the last actor added can be given back: all the
+	// others are smaller anyway.  This way, taking an actor out and putting it
+	// back leaves the schedule as it was.
+	if actor_time.Stability_index+1 == self.Next_stability_index {
+		self.Next_stability_index = actor_time.Stability_index
+	}
 	return self, true
 }
 
@@ -0,0 +1,176 @@
+package world
+
+import (
+	"fmt"
+)
+
+// Attributes are what a creature is made of.  They do not change often, and
+// most of the other statistics derive from them.
+type Attributes struct {
+	Strength  int
+	Dexterity int
+	Wisdom    int
+	Vitality  int
+}
+
+// Creatures start with average attributes.
+const average_attribute = 10
+
+func MakeAttributes() Attributes {
+	return Attributes{
+		Strength:  average_attribute,
+		Dexterity: average_attribute,
+		Wisdom:    average_attribute,
+		Vitality:  average_attribute,
+	}
+}
+
+// A Gauge is a quantity that goes down and up between 0 and its maximum, like
+// the hit points.
+type Gauge struct {
+	Current int
+	Max     int
+}
+
+func MakeGauge(max int) Gauge {
+	return Gauge{Current: max, Max: max}
+}
+
+// Add changes the current value of the gauge, without leaving [0, Max].
+// Negative amounts take away.
+func (self Gauge) Add(amount int) Gauge {
+	self.Current += amount
+	if self.Current < 0 {
+		self.Current = 0
+	}
+	if self.Current > self.Max {
+		self.Current = self.Max
+	}
+	return self
+}
+
+func (self Gauge) IsEmpty() bool {
+	return self.Current <= 0
+}
+
+func (self Gauge) String() string {
+	return fmt.Sprintf("%v/%v", self.Current, self.Max)
+}
+
+type Stats struct {
+	Attributes  Attributes
+	Hp          Gauge // Hit points.  A creature without any is dead.
+	Stamina     Gauge
+	Mana        Gauge
+	Resistances Resistances
+}
+
+// MakeStats computes the gauges of a creature from its attributes.  All the
+// gauges are full.
+func MakeStats(attributes Attributes) Stats {
+	return Stats{
+		Attributes: attributes,
+		Hp:         MakeGauge(2 * attributes.Vitality),
+		Stamina:    MakeGauge(attributes.Strength + attributes.Vitality),
+		Mana:       MakeGauge(2 * attributes.Wisdom),
+	}
+}
+
+// IsDead tells whether the creature has run out of hit points.  Dead creatures
+// do not stay in the level for long: see Level.DamageCreature.
+func (self Creature) IsDead() bool {
+	return self.Stats.Hp.IsEmpty()
+}
+
+// Damage takes hit points away from the creature.
+func (self Creature) Damage(amount int) Creature {
+	self.Stats.Hp = self.Stats.Hp.Add(-amount)
+	return self
+}
+
+// Heal gives hit points back to the creature, up to its maximum.  The dead
+// cannot be healed.
+func (self Creature) Heal(amount int) Creature {
+	if !self.IsDead() {
+		self.Stats.Hp = self.Stats.Hp.Add(amount)
+	}
+	return self
+}
+
+// DamageCreature hurts a creature of the level.  If the creature dies, it is
+// removed from the level, and whatever it carried falls on the ground.
+func (self Level) DamageCreature(creature_id CreatureId, amount int) (Level, bool, error) {
+	creature, ok := self.Creatures.Get(creature_id)
+	if !ok {
+		return self, false, fmt.Errorf("creature %v not in level", creature_id)
+	}
+	creature = creature.Damage(amount)
+	if !creature.IsDead() {
+		self.Creatures = self.Creatures.Set(creature_id, creature)
+		return self, false, nil
+	}
+	level, err := self.KillCreature(creature_id)
+	return level, true, err
+}
+
+// HealCreature heals a creature of the level.
+func (self Level) HealCreature(creature_id CreatureId, amount int) (Level, error) {
+	creature, ok := self.Creatures.Get(creature_id)
+	if !ok {
+		return self, fmt.Errorf("creature %v not in level", creature_id)
+	}
+	self.Creatures = self.Creatures.Set(creature_id, creature.Heal(amount))
+	return self, nil
+}
+
+// KillCreature removes a creature from the level, along with its actor, its
+// location and its place in the schedule.  Its items are dropped where it
+// stood.
+func (self Level) KillCreature(creature_id CreatureId) (Level, error) {
+	location, ok := self.CreatureLocation.GetLocation(creature_id)
+	if !ok {
+		return self, fmt.Errorf("creature %v has no location", creature_id)
+	}
+	level, traveller, err := self.TakeCreature(creature_id)
+	if err != nil {
+		return self, err
+	}
+	for _, item_id := range traveller.Inventory.Items() {
+		level.Items = level.Items.Set(item_id, traveller.Items[item_id])
+		level.ItemLocation, err = level.ItemLocation.Add(item_id, location)
+		if err != nil {
+			return self, err
+		}
+	}
+	return level, nil
+}
+
+// DamageCreature hurts a creature, wherever it is in the World.
+func (world World) DamageCreature(creature_id CreatureId, amount int) (World, bool, error) {
+	level_id, ok := world.CreatureLevel(creature_id)
+	if !ok {
+		return world, false, fmt.Errorf("creature %v not in any level", creature_id)
+	}
+	travellers := world.Travellers.leave(world.Levels[level_id], creature_id)
+	level, died, err := world.Levels[level_id].DamageCreature(creature_id, amount)
+	if err != nil {
+		return world, false, err
+	}
+	if died {
+		world.Travellers = travellers
+	}
+	return world.SetLevel(level_id, level), died, nil
+}
+
+// HealCreature heals a creature, wherever it is in the World.
+func (world World) HealCreature(creature_id CreatureId, amount int) (World, error) {
+	level_id, ok := world.CreatureLevel(creature_id)
+	if !ok {
+		return world, fmt.Errorf("creature %v not in any level", creature_id)
+	}
+	level, err := world.Levels[level_id].HealCreature(creature_id, amount)
+	if err != nil {
+		return world, err
+	}
+	return world.SetLevel(level_id, level), nil
+}
@@ -0,0 +1,94 @@
+package world
+
+import (
+	"testing"
+)
+
+func TestGauge(test *testing.T) {
+	gauge := MakeGauge(10)
+	if gauge.Add(-25).Current != 0 || gauge.Add(5).Current != 10 || gauge.Add(-3).Current != 7 {
+		test.Error("The gauge leaves its bounds.")
+	}
+	if !gauge.Add(-10).IsEmpty() || gauge.Add(-9).IsEmpty() {
+		test.Error("The gauge is empty at the wrong time.")
+	}
+}
+
+func TestDamage(test *testing.T) {
+	w := saneWorld(test)
+	things := findFullThings(w.Levels[1])
+	w, died, err := w.DamageCreature(things.monster, 5)
+	if err != nil || died {
+		test.Fatal("A scratch killed the monster:", died, err)
+	}
+	creature, _ := w.Levels[1].Creatures.Get(things.monster)
+	if creature.Stats.Hp.Current != 10 {
+		test.Error("The monster has", creature.Stats.Hp)
+	}
+	w, err = w.HealCreature(things.monster, 100)
+	creature, _ = w.Levels[1].Creatures.Get(things.monster)
+	if err != nil || creature.Stats.Hp.Current != creature.Stats.Hp.Max {
+		test.Error("The monster healed to", creature.Stats.Hp, err)
+	}
+	if _, _, err := w.DamageCreature(things.monster+1, 5); err == nil {
+		test.Error("Hurt a creature that does not exist.")
+	}
+}
+
+// The dead leave every index of their level, and what they carried falls on
+// the ground.
+func TestDeath(test *testing.T) {
+	w := saneWorld(test)
+	things := findFullThings(w.Levels[1])
+	w, died, err := w.DamageCreature(things.monster, 15)
+	if err != nil || !died {
+		test.Fatal("The monster survived:", died, err)
+	}
+	level := w.Levels[1]
+	if _, ok := level.Creatures.Get(things.monster); ok {
+		test.Error("The monster is still in the creatures.")
+	}
+	if _, ok := level.CreatureLocation.GetLocation(things.monster); ok {
+		test.Error("The monster is still located.")
+	}
+	if _, ok := level.CreatureActor.GetActor(things.monster); ok {
+		test.Error("The monster still has an actor.")
+	}
+	if level.ActorSchedule.PosActorID(things.actor) != -1 {
+		test.Error("The actor of the monster is still scheduled.")
+	}
+	if _, ok := level.Actors.Get(things.actor); ok {
+		test.Error("The actor of the monster is still there.")
+	}
+	if !level.Inventories.Get(things.monster).IsEmpty() {
+		test.Error("The monster still carries things.")
+	}
+	if place, _ := level.ItemPlace(things.sword); place != OnGround(Location{1, 1}) {
+		test.Error("The sword is", place)
+	}
+	if problems := w.Validate(); len(problems) != 0 {
+		test.Error(problems)
+	}
+	if _, err := w.HealCreature(things.monster, 5); err == nil {
+		test.Error("Healed the dead.")
+	}
+}
+
+// Death as a Delta does the same.
+func TestDeltaCreatureDied(test *testing.T) {
+	w := saneWorld(test)
+	things := findFullThings(w.Levels[1])
+	w, err := DeltaCreatureDied{1, things.monster}.Apply(w)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, ok := w.CreatureLevel(things.monster); ok {
+		test.Error("The monster is still in the World.")
+	}
+	if problems := w.Validate(); len(problems) != 0 {
+		test.Error(problems)
+	}
+	if _, err := (DeltaCreatureDied{1, things.monster}).Apply(w); err != DELTA_NO_CREATURE {
+		test.Error("The monster died twice:", err)
+	}
+}
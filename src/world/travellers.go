@@ -0,0 +1,136 @@
+package world
+
+import (
+	"pmap"
+)
+
+// The identifiers of creatures and actors tell in which Level they were made,
+// see levelIdShift, and most of them never leave it.  Travellers remembers
+// where the others are: the creatures and actors that are not in the Level
+// they were made in.  Together, they tell in which Level any creature or actor
+// is without looking into all the Levels.
+type Travellers struct {
+	// Both are persistent maps, updating them does not copy them.
+	creatures pmap.Map // CreatureId to LevelId.
+	actors    pmap.Map // ActorID to LevelId.
+}
+
+func MakeTravellers() Travellers {
+	return Travellers{}
+}
+
+// birthLevel returns the Level in which an identifier was allocated.
+func birthLevel(id uint64) LevelId {
+	return LevelId(id >> levelIdShift)
+}
+
+// creatureLevel returns the Level in which the creature should be.
+func (self Travellers) creatureLevel(creature_id CreatureId) LevelId {
+	if level_id, ok := self.creatures.Get(creature_id); ok {
+		return level_id.(LevelId)
+	}
+	return birthLevel(uint64(creature_id))
+}
+
+// actorLevel returns the Level in which the actor should be.
+func (self Travellers) actorLevel(actor_id ActorID) LevelId {
+	if level_id, ok := self.actors.Get(actor_id); ok {
+		return level_id.(LevelId)
+	}
+	return birthLevel(uint64(actor_id))
+}
+
+// placeCreature records that the creature is in the given Level.
+func (self Travellers) placeCreature(creature_id CreatureId, level_id LevelId) Travellers {
+	if level_id == birthLevel(uint64(creature_id)) {
+		return self.forgetCreature(creature_id)
+	}
+	self.creatures = self.creatures.Set(creature_id, level_id)
+	return self
+}
+
+// placeActor records that the actor is in the given Level.
+func (self Travellers) placeActor(actor_id ActorID, level_id LevelId) Travellers {
+	if level_id == birthLevel(uint64(actor_id)) {
+		return self.forgetActor(actor_id)
+	}
+	self.actors = self.actors.Set(actor_id, level_id)
+	return self
+}
+
+// forgetCreature is for creatures that are not in the World anymore.
+func (self Travellers) forgetCreature(creature_id CreatureId) Travellers {
+	self.creatures = self.creatures.Delete(creature_id)
+	return self
+}
+
+// forgetActor is for actors that are not in the World anymore.
+func (self Travellers) forgetActor(actor_id ActorID) Travellers {
+	self.actors = self.actors.Delete(actor_id)
+	return self
+}
+
+// leave forgets a creature of the Level, and its actor.
+func (self Travellers) leave(level Level, creature_id CreatureId) Travellers {
+	if actor_id, ok := level.CreatureActor.GetActor(creature_id); ok {
+		self = self.forgetActor(actor_id)
+	}
+	return self.forgetCreature(creature_id)
+}
+
+// index records the creatures and actors of a whole Level.
+func (self Travellers) index(level_id LevelId, level Level) Travellers {
+	level.Creatures.ForEach(func(creature_id CreatureId, creature Creature) {
+		self = self.placeCreature(creature_id, level_id)
+	})
+	level.Actors.ForEach(func(actor_id ActorID, actor Actor) {
+		self = self.placeActor(actor_id, level_id)
+	})
+	return self
+}
+
+// unindex forgets the creatures and actors of a whole Level.
+func (self Travellers) unindex(level Level) Travellers {
+	level.Creatures.ForEach(func(creature_id CreatureId, creature Creature) {
+		self = self.forgetCreature(creature_id)
+	})
+	level.Actors.ForEach(func(actor_id ActorID, actor Actor) {
+		self = self.forgetActor(actor_id)
+	})
+	return self
+}
+
+// travellersGob is what Travellers look like to gob.
+type travellersGob struct {
+	Creatures map[CreatureId]LevelId
+	Actors    map[ActorID]LevelId
+}
+
+func (self Travellers) GobEncode() ([]byte, error) {
+	encoded := travellersGob{
+		Creatures: make(map[CreatureId]LevelId, self.creatures.Len()),
+		Actors:    make(map[ActorID]LevelId, self.actors.Len()),
+	}
+	self.creatures.ForEach(func(key pmap.Key, value interface{}) {
+		encoded.Creatures[key.(CreatureId)] = value.(LevelId)
+	})
+	self.actors.ForEach(func(key pmap.Key, value interface{}) {
+		encoded.Actors[key.(ActorID)] = value.(LevelId)
+	})
+	return gobEncode(encoded)
+}
+
+func (self *Travellers) GobDecode(data []byte) error {
+	var decoded travellersGob
+	if err := gobDecode(data, &decoded); err != nil {
+		return err
+	}
+	*self = Travellers{}
+	for creature_id, level_id := range decoded.Creatures {
+		self.creatures = self.creatures.Set(creature_id, level_id)
+	}
+	for actor_id, level_id := range decoded.Actors {
+		self.actors = self.actors.Set(actor_id, level_id)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package world
+
+import (
+	"bytes"
+	"testing"
+)
+
+// travelledWorld is a World of two levels where the player went down to the
+// second one.
+func travelledWorld(test *testing.T) World {
+	w, level_id := savableWorld().AddLevel()
+	level := w.Levels[level_id]
+	level.Floors = level.Floors.Set(3, 4, MakeFloor(0, EAST(), true))
+	w = w.SetLevel(level_id, level)
+	creature_id, _ := w.Levels[0].CreatureActor.GetCreature(w.Player_id)
+	w, err := w.MoveCreature(creature_id, LevelPosition{level_id, Position{Location{3, 4}, SOUTH()}})
+	if err != nil {
+		test.Fatal(err)
+	}
+	return w
+}
+
+func TestTravellers(test *testing.T) {
+	w := travelledWorld(test)
+	if level_id, ok := w.PlayerLevel(); !ok || level_id != 1 {
+		test.Error("The player is in level", level_id, ok)
+	}
+	creature_id, _ := w.Levels[1].CreatureActor.GetCreature(w.Player_id)
+	if level_id, ok := w.CreatureLevel(creature_id); !ok || level_id != 1 {
+		test.Error("The creature of the player is in level", level_id, ok)
+	}
+	if problems := w.Validate(); len(problems) != 0 {
+		test.Error(problems)
+	}
+
+	var save bytes.Buffer
+	if err := w.Write(&save); err != nil {
+		test.Fatal(err)
+	}
+	loaded, _, err := Read(&save)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if level_id, ok := loaded.PlayerLevel(); !ok || level_id != 1 {
+		test.Error("After a save, the player is in level", level_id, ok)
+	}
+
+	w, err = w.MoveCreature(creature_id, LevelPosition{0, Position{}})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if w.Travellers.creatures.Len() != 0 || w.Travellers.actors.Len() != 0 {
+		test.Error("The player came back and is still a traveller.")
+	}
+}
+
+// The dead do not travel anymore.
+func TestTravellersDie(test *testing.T) {
+	w := travelledWorld(test)
+	creature_id, _ := w.Levels[1].CreatureActor.GetCreature(w.Player_id)
+	w, err := DeltaCreatureDied{1, creature_id}.Apply(w)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if w.Travellers.creatures.Len() != 0 || w.Travellers.actors.Len() != 0 {
+		test.Error("The dead player is still a traveller.")
+	}
+}
+
+func TestValidateTravellers(test *testing.T) {
+	w := travelledWorld(test)
+	w.Travellers = MakeTravellers()
+	problems := w.Validate()
+	kinds := map[ProblemKind]bool{}
+	for _, problem := range problems {
+		kinds[problem.Kind] = true
+	}
+	if !kinds[PB_CREATURE_LEVEL_UNKNOWN] || !kinds[PB_ACTOR_LEVEL_UNKNOWN] {
+		test.Error("Lost travellers were not found:", problems)
+	}
+	if _, ok := w.PlayerLevel(); ok {
+		test.Error("Found the player without the index.")
+	}
+}
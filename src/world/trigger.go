@@ -0,0 +1,728 @@
+package world
+
+import (
+	"fmt"
+	"pmap"
+	"sort"
+)
+
+// Triggers are the things that set off mechanisms: pressure plates on the
+// floor, and levers on the walls.  A trigger is either on or off.  Pressure
+// plates are on while something lies on them, be it a creature or an item.
+// Levers switch when someone uses them.
+//
+// Triggers are connected to their targets with wires.  Each time a trigger
+// switches, it sends its new state down its wires, and the targets react:
+// doors open or close, mechanisms start or stop, lights go on or off, floor
+// effects work or not, pits open or close.
+
+// Each trigger in a level is identified with a unique ID.
+type TriggerId uint64
+
+// Hash allows trigger identifiers to be used as keys of persistent maps.
+func (self TriggerId) Hash() uint64 {
+	return pmap.Hash64(uint64(self))
+}
+
+type TriggerKind int
+
+const (
+	TRIGGER_PLATE = TriggerKind(iota) // Anchored to a tile.
+	TRIGGER_LEVER                     // Anchored to a wall.
+)
+
+var trigger_kind_text = map[TriggerKind]string{
+	TRIGGER_PLATE: "pressure plate",
+	TRIGGER_LEVER: "lever",
+}
+
+func (self TriggerKind) String() string {
+	return trigger_kind_text[self]
+}
+
+// What a target does with the state sent by a trigger.
+type WireEffect int
+
+const (
+	WIRE_FOLLOW = WireEffect(iota) // On opens or starts, off closes or stops.
+	WIRE_INVERT                    // On closes or stops, off opens or starts.
+	WIRE_TOGGLE                    // On flips the target, off does nothing.
+)
+
+type TargetKind int
+
+const (
+	TARGET_DOOR = TargetKind(iota)
+	TARGET_MECHANISM
+	TARGET_LIGHT
+	TARGET_FLOOR_EFFECT
+	TARGET_PIT
+)
+
+// A Target is what a wire is connected to.  Only the fields relevant to its
+// Kind are set.
+type Target struct {
+	Kind      TargetKind
+	Door      DoorSlot
+	Mechanism ActorID
+	Light     LightId
+	Effect    FloorEffectId
+	Pit       Location
+}
+
+func DoorTarget(slot DoorSlot) Target {
+	return Target{Kind: TARGET_DOOR, Door: slot}
+}
+
+func MechanismTarget(actor_id ActorID) Target {
+	return Target{Kind: TARGET_MECHANISM, Mechanism: actor_id}
+}
+
+func LightTarget(light_id LightId) Target {
+	return Target{Kind: TARGET_LIGHT, Light: light_id}
+}
+
+func FloorEffectTarget(effect_id FloorEffectId) Target {
+	return Target{Kind: TARGET_FLOOR_EFFECT, Effect: effect_id}
+}
+
+func PitTarget(location Location) Target {
+	return Target{Kind: TARGET_PIT, Pit: location}
+}
+
+type Wire struct {
+	Target Target
+	Effect WireEffect
+}
+
+type Trigger struct {
+	Kind   TriggerKind
+	Anchor Anchor
+	On     bool
+	Wires  []Wire // Never modified in place.
+}
+
+func MakeTrigger(kind TriggerKind, anchor Anchor) Trigger {
+	return Trigger{Kind: kind, Anchor: anchor}
+}
+
+// Connect adds a wire from the trigger to a target.
+func (self Trigger) Connect(target Target, effect WireEffect) Trigger {
+	wires := make([]Wire, len(self.Wires), len(self.Wires)+1)
+	copy(wires, self.Wires)
+	self.Wires = append(wires, Wire{target, effect})
+	return self
+}
+
+// Disconnect removes the wires from the trigger to a target.
+func (self Trigger) Disconnect(target Target) Trigger {
+	var wires []Wire
+	for _, wire := range self.Wires {
+		if wire.Target != target {
+			wires = append(wires, wire)
+		}
+	}
+	self.Wires = wires
+	return self
+}
+
+type Triggers struct {
+	Next_id TriggerId
+	// The content is a persistent map, updating it does not copy it.
+	content pmap.Map
+	// The identifiers of the triggers anchored at each location, sorted.  The
+	// slices are never modified in place.
+	at pmap.Map
+}
+
+func MakeTriggers() Triggers {
+	return Triggers{}
+}
+
+func (self Triggers) Add(trigger Trigger) (Triggers, TriggerId) {
+	trigger_id := self.Next_id
+	triggers := self.Set(trigger_id, trigger)
+	triggers.Next_id += 1
+	return triggers, trigger_id
+}
+
+func (self Triggers) Get(trigger_id TriggerId) (Trigger, bool) {
+	trigger, ok := self.content.Get(trigger_id)
+	if !ok {
+		return Trigger{}, false
+	}
+	return trigger.(Trigger), true
+}
+
+func (self Triggers) Set(trigger_id TriggerId, trigger Trigger) Triggers {
+	self = self.Delete(trigger_id)
+	self.content = self.content.Set(trigger_id, trigger)
+	location := trigger.Anchor.Location
+	old := self.AtLocation(location)
+	ids := make([]TriggerId, len(old), len(old)+1)
+	copy(ids, old)
+	ids = append(ids, trigger_id)
+	sort.Sort(triggerIds(ids))
+	self.at = self.at.Set(location, ids)
+	return self
+}
+
+func (self Triggers) Delete(trigger_id TriggerId) Triggers {
+	trigger, ok := self.Get(trigger_id)
+	if !ok {
+		return self
+	}
+	self.content = self.content.Delete(trigger_id)
+	location := trigger.Anchor.Location
+	var ids []TriggerId
+	for _, id := range self.AtLocation(location) {
+		if id != trigger_id {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		self.at = self.at.Delete(location)
+	} else {
+		self.at = self.at.Set(location, ids)
+	}
+	return self
+}
+
+func (self Triggers) Len() int {
+	return self.content.Len()
+}
+
+// ForEach calls f for each trigger.
+func (self Triggers) ForEach(f func(trigger_id TriggerId, trigger Trigger)) {
+	self.content.ForEach(func(key pmap.Key, value interface{}) {
+		f(key.(TriggerId), value.(Trigger))
+	})
+}
+
+// Ids returns the identifiers of the triggers, sorted.  Triggers are processed
+// in that order, so that the same World always reacts the same way.
+func (self Triggers) Ids() []TriggerId {
+	ids := make([]TriggerId, 0, self.Len())
+	self.ForEach(func(trigger_id TriggerId, trigger Trigger) {
+		ids = append(ids, trigger_id)
+	})
+	sort.Sort(triggerIds(ids))
+	return ids
+}
+
+// AtLocation returns the identifiers of the triggers anchored at a location,
+// on its floor or on its walls, sorted.
+func (self Triggers) AtLocation(location Location) []TriggerId {
+	ids, ok := self.at.Get(location)
+	if !ok {
+		return nil
+	}
+	return ids.([]TriggerId)
+}
+
+// At finds the trigger anchored at the given place.
+func (self Triggers) At(anchor Anchor) (TriggerId, Trigger, bool) {
+	for _, trigger_id := range self.AtLocation(anchor.Location) {
+		trigger, _ := self.Get(trigger_id)
+		if trigger.Anchor == anchor {
+			return trigger_id, trigger, true
+		}
+	}
+	return 0, Trigger{}, false
+}
+
+type triggerIds []TriggerId
+
+func (self triggerIds) Len() int {
+	return len(self)
+}
+func (self triggerIds) Less(i, j int) bool {
+	return self[i] < self[j]
+}
+func (self triggerIds) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+}
+
+// triggersGob is what Triggers looks like to gob.
+type triggersGob struct {
+	Next_id TriggerId
+	Content map[TriggerId]Trigger
+}
+
+func (self Triggers) GobEncode() ([]byte, error) {
+	content := make(map[TriggerId]Trigger, self.Len())
+	self.ForEach(func(trigger_id TriggerId, trigger Trigger) {
+		content[trigger_id] = trigger
+	})
+	return gobEncode(triggersGob{self.Next_id, content})
+}
+
+func (self *Triggers) GobDecode(data []byte) error {
+	var decoded triggersGob
+	if err := gobDecode(data, &decoded); err != nil {
+		return err
+	}
+	*self = Triggers{Next_id: decoded.Next_id}
+	for trigger_id, trigger := range decoded.Content {
+		*self = self.Set(trigger_id, trigger)
+	}
+	return nil
+}
+
+// IsPressed tells whether something weighs on the tile.
+func (self Level) IsPressed(location Location) bool {
+	if _, ok := self.CreatureLocation.GetCreature(location); ok {
+		return true
+	}
+	_, ok := self.ItemLocation.Top(location)
+	return ok
+}
+
+// DeltaTriggerSwitched switches a trigger on or off.  It does not affect the
+// targets of the trigger; SwitchTrigger computes that.
+type DeltaTriggerSwitched struct {
+	Level   LevelId
+	Trigger TriggerId
+	On      bool
+}
+
+func (self DeltaTriggerSwitched) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	trigger, ok := level.Triggers.Get(self.Trigger)
+	if !ok || trigger.On == self.On {
+		return world, DELTA_TRIGGER_SWITCHED
+	}
+	trigger.On = self.On
+	level.Triggers = level.Triggers.Set(self.Trigger, trigger)
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaTriggerSwitched) Reverse() Delta {
+	return DeltaTriggerSwitched{self.Level, self.Trigger, !self.On}
+}
+
+func (self DeltaTriggerSwitched) String() string {
+	state := "off"
+	if self.On {
+		state = "on"
+	}
+	return fmt.Sprintf("trigger %v switches %v", self.Trigger, state)
+}
+
+// SwitchTrigger computes the Delta of a trigger switching on or off, along
+// with what its targets do.  Targets that cannot do what they are told, like
+// locked doors or doors blocked by a creature, stay as they are.
+func (world World) SwitchTrigger(level_id LevelId, trigger_id TriggerId, on bool) (Delta, error) {
+	level, ok := world.Levels[level_id]
+	if !ok {
+		return nil, DELTA_NO_LEVEL
+	}
+	trigger, ok := level.Triggers.Get(trigger_id)
+	if !ok {
+		return nil, fmt.Errorf("trigger %v not in level %v", trigger_id, level_id)
+	}
+	if trigger.On == on {
+		return Deltas{}, nil
+	}
+	deltas := []Delta{DeltaTriggerSwitched{level_id, trigger_id, on}}
+	// Each wire acts on the world left by the previous ones, in case several
+	// wires lead to the same target.
+	current, err := deltas[0].Apply(world)
+	if err != nil {
+		return nil, err
+	}
+	for _, wire := range trigger.Wires {
+		delta := current.Levels[level_id].wireDelta(level_id, wire, on)
+		if delta == nil {
+			continue
+		}
+		if current, err = delta.Apply(current); err != nil {
+			return nil, err
+		}
+		deltas = append(deltas, delta)
+	}
+	return Combine(deltas...), nil
+}
+
+// wireDelta computes what the target of a wire does when the trigger sends
+// its state.  It returns nil when the target does nothing.
+func (self Level) wireDelta(level_id LevelId, wire Wire, on bool) Delta {
+	if wire.Effect == WIRE_TOGGLE && !on {
+		return nil
+	}
+	want := on != (wire.Effect == WIRE_INVERT)
+	switch wire.Target.Kind {
+	case TARGET_DOOR:
+		slot := wire.Target.Door
+		door, ok := self.GetDoor(slot)
+		if !ok {
+			return nil
+		}
+		if wire.Effect == WIRE_TOGGLE {
+			want = door.State() == DOOR_CLOSED
+		}
+		var changed Door
+		var err error
+		if want {
+			changed, err = door.Open()
+		} else {
+			changed, err = door.Close()
+		}
+		if err != nil {
+			return nil
+		}
+		if !slot.In_wall && !changed.IsPassable() {
+			if _, ok := self.CreatureLocation.GetCreature(slot.Location); ok {
+				return nil
+			}
+		}
+		return DeltaDoorChanged{level_id, slot, door, changed}
+	case TARGET_MECHANISM:
+		actor_id := wire.Target.Mechanism
+		mechanism, ok := self.Mechanisms.Get(actor_id)
+		if !ok {
+			return nil
+		}
+		changed := mechanism
+		if wire.Effect == WIRE_TOGGLE {
+			changed.Active = !mechanism.Active
+		} else {
+			changed.Active = want
+		}
+		if changed == mechanism {
+			return nil
+		}
+		return DeltaMechanismChanged{level_id, actor_id, mechanism, changed}
+	case TARGET_LIGHT:
+		light_id := wire.Target.Light
+		light, ok := self.Lights.Get(light_id)
+		if !ok {
+			return nil
+		}
+		changed := light
+		if wire.Effect == WIRE_TOGGLE {
+			changed.Light.On = !light.Light.On
+		} else {
+			changed.Light.On = want
+		}
+		if changed == light {
+			return nil
+		}
+		return DeltaLightChanged{level_id, light_id, light, changed}
+	case TARGET_FLOOR_EFFECT:
+		effect_id := wire.Target.Effect
+		effect, ok := self.Effects.Get(effect_id)
+		if !ok {
+			return nil
+		}
+		changed := effect
+		if wire.Effect == WIRE_TOGGLE {
+			changed.Active = !effect.Active
+		} else {
+			changed.Active = want
+		}
+		if changed == effect {
+			return nil
+		}
+		return DeltaFloorEffectChanged{level_id, effect_id, effect, changed}
+	case TARGET_PIT:
+		location := wire.Target.Pit
+		building, _ := self.Floors.Get(location.X, location.Y)
+		pit, ok := building.(Pit)
+		if !ok {
+			return nil
+		}
+		changed := pit
+		if wire.Effect == WIRE_TOGGLE {
+			changed.Open = !pit.Open
+		} else {
+			changed.Open = want
+		}
+		if changed == pit {
+			return nil
+		}
+		return DeltaBuildingChanged{level_id, LAYER_FLOORS, location, pit, changed}
+	}
+	return nil
+}
+
+// The most rounds of reactions React computes.  Reactions may go on forever,
+// like items falling around two pits leading into each other, each opened by
+// a pressure plate under the other.  React fails then.
+const max_reaction_rounds = 16
+
+// React computes how the World reacts to a Delta: what stands on open pits
+// falls, and pressure plates switch on when something lands on them, and off
+// when they are left empty.  Reactions may cause more reactions, so they are
+// computed until the World settles down, or it fails with DELTA_UNSETTLED
+// after max_reaction_rounds rounds.  Only the places where things moved
+// and floors changed can react, see reactionSites.  It returns the Delta
+// followed by the reactions.
+func (world World) React(delta Delta) (Delta, error) {
+	after, sites, err := world.applyAt(delta)
+	if err != nil {
+		return nil, err
+	}
+	deltas := []Delta{delta}
+	for round := 0; len(sites) != 0; round++ {
+		if round == max_reaction_rounds {
+			return nil, DELTA_UNSETTLED
+		}
+		// The pressure plates feel what fell on them in the same round.
+		var fallen, pressed []LevelLocation
+		var reactions []Delta
+		if after, reactions, fallen, err = after.fall(sites); err != nil {
+			return nil, err
+		}
+		deltas = append(deltas, reactions...)
+		if after, reactions, pressed, err = after.press(append(sites, fallen...)); err != nil {
+			return nil, err
+		}
+		deltas = append(deltas, reactions...)
+		sites = append(fallen, pressed...)
+	}
+	if len(deltas) == 1 {
+		return delta, nil
+	}
+	return Combine(deltas...), nil
+}
+
+// applyAt applies a Delta, and returns the places where the World may react
+// to it.
+func (world World) applyAt(delta Delta) (World, []LevelLocation, error) {
+	deltas, ok := delta.(Deltas)
+	if !ok {
+		sites := world.reactionSites(delta)
+		after, err := delta.Apply(world)
+		return after, sites, err
+	}
+	// The World changes between the Deltas of a sequence.
+	after := world
+	var sites []LevelLocation
+	for _, inner := range deltas {
+		var inner_sites []LevelLocation
+		var err error
+		if after, inner_sites, err = after.applyAt(inner); err != nil {
+			return world, nil, err
+		}
+		sites = append(sites, inner_sites...)
+	}
+	return after, sites, nil
+}
+
+// reactionSites returns the places where the World may react to a Delta that
+// is not a sequence: the tiles that creatures and items enter and leave, and
+// the floors that change.  The World is the one the Delta applies to.
+func (world World) reactionSites(delta Delta) []LevelLocation {
+	switch delta := delta.(type) {
+	case DeltaCreatureMoved:
+		return []LevelLocation{delta.From.ToLevelLocation(delta.Level), delta.To.ToLevelLocation(delta.Level)}
+	case DeltaCreatureTravelled:
+		return []LevelLocation{delta.From.ToLevelLocation(), delta.To.ToLevelLocation()}
+	case DeltaCreatureTurned:
+		// A creature holding on to the edge of a pit lets go once the way is
+		// clear, when it turns around.
+		if location, ok := world.Levels[delta.Level].CreatureLocation.GetLocation(delta.Creature); ok {
+			return []LevelLocation{location.ToLevelLocation(delta.Level)}
+		}
+	case DeltaCreaturePlaced:
+		return []LevelLocation{delta.Location.ToLevelLocation(delta.Level)}
+	case DeltaCreatureDied:
+		// What the creature carried falls on its tile.
+		if location, ok := world.Levels[delta.Level].CreatureLocation.GetLocation(delta.Creature); ok {
+			return []LevelLocation{location.ToLevelLocation(delta.Level)}
+		}
+	case DeltaBuildingChanged:
+		if delta.Layer == LAYER_FLOORS {
+			return []LevelLocation{delta.Location.ToLevelLocation(delta.Level)}
+		}
+	case DeltaItemMoved:
+		var sites []LevelLocation
+		for _, place := range [...]ItemPlace{delta.From, delta.To} {
+			if place.On_ground {
+				sites = append(sites, place.Location.ToLevelLocation(delta.Level))
+			}
+		}
+		return sites
+	case DeltaItemTravelled:
+		return []LevelLocation{delta.From, delta.To}
+	case DeltaItemPlaced:
+		return []LevelLocation{delta.Location.ToLevelLocation(delta.Level)}
+	}
+	return nil
+}
+
+// sortSites sorts places by level, then x, then y, and removes the duplicates,
+// so that the World always reacts in the same order.
+func sortSites(sites []LevelLocation) []LevelLocation {
+	sort.Sort(levelLocations(sites))
+	var unique []LevelLocation
+	for i, site := range sites {
+		if i == 0 || site != sites[i-1] {
+			unique = append(unique, site)
+		}
+	}
+	return unique
+}
+
+type levelLocations []LevelLocation
+
+func (self levelLocations) Len() int {
+	return len(self)
+}
+func (self levelLocations) Less(i, j int) bool {
+	a, b := self[i], self[j]
+	if a.Level != b.Level {
+		return a.Level < b.Level
+	}
+	if a.X != b.X {
+		return a.X < b.X
+	}
+	return a.Y < b.Y
+}
+func (self levelLocations) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+}
+
+// press computes how the pressure plates at the given places react to what
+// lies on them.  It returns the World after the reactions, along with the
+// Deltas that lead there and the places where the World may react to them.
+func (world World) press(places []LevelLocation) (World, []Delta, []LevelLocation, error) {
+	var deltas []Delta
+	var sites []LevelLocation
+	for _, place := range sortSites(places) {
+		level_id := place.Level
+		for _, trigger_id := range world.Levels[level_id].Triggers.AtLocation(place.Location) {
+			trigger, _ := world.Levels[level_id].Triggers.Get(trigger_id)
+			if trigger.Kind != TRIGGER_PLATE {
+				continue
+			}
+			pressed := world.Levels[level_id].IsPressed(place.Location)
+			if pressed == trigger.On {
+				continue
+			}
+			reaction, err := world.SwitchTrigger(level_id, trigger_id, pressed)
+			if err != nil {
+				return world, nil, nil, err
+			}
+			var reaction_sites []LevelLocation
+			if world, reaction_sites, err = world.applyAt(reaction); err != nil {
+				return world, nil, nil, err
+			}
+			deltas = append(deltas, reaction)
+			sites = append(sites, reaction_sites...)
+		}
+	}
+	return world, deltas, sites, nil
+}
+
+// FrontLever finds the lever on the wall in front of a position.
+func (self Level) FrontLever(position Position) (TriggerId, Trigger, bool) {
+	anchor := Anchor{
+		Location: position.Location,
+		On_wall:  true,
+		Facing:   position.F.Add(BACK()),
+	}
+	trigger_id, trigger, ok := self.Triggers.At(anchor)
+	if !ok || trigger.Kind != TRIGGER_LEVER {
+		return 0, Trigger{}, false
+	}
+	return trigger_id, trigger, true
+}
+
+// DeltaTriggerPlaced puts a new trigger in a level, or takes it away again.
+// Only a trigger that is still as it was placed can be taken away.
+type DeltaTriggerPlaced struct {
+	Level   LevelId
+	Trigger TriggerId
+	Value   Trigger
+	Placed  bool
+}
+
+func (self DeltaTriggerPlaced) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	current, ok := level.Triggers.Get(self.Trigger)
+	if self.Placed {
+		if ok {
+			return world, DELTA_ID_TAKEN
+		}
+		level.Triggers = level.Triggers.Set(self.Trigger, self.Value)
+		if self.Trigger >= level.Triggers.Next_id {
+			level.Triggers.Next_id = self.Trigger + 1
+		}
+		return world.SetLevel(self.Level, level), nil
+	}
+	if !ok || !sameTrigger(current, self.Value) {
+		return world, DELTA_TRIGGER_CHANGED
+	}
+	level.Triggers = level.Triggers.Delete(self.Trigger)
+	if self.Trigger+1 == level.Triggers.Next_id {
+		level.Triggers.Next_id = self.Trigger
+	}
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaTriggerPlaced) Reverse() Delta {
+	return DeltaTriggerPlaced{self.Level, self.Trigger, self.Value, !self.Placed}
+}
+
+func (self DeltaTriggerPlaced) String() string {
+	if self.Placed {
+		return fmt.Sprintf("%v %v is placed", self.Value.Kind, self.Trigger)
+	}
+	return fmt.Sprintf("%v %v is taken away", self.Value.Kind, self.Trigger)
+}
+
+// DeltaTriggerWired changes the wires of a trigger.
+type DeltaTriggerWired struct {
+	Level   LevelId
+	Trigger TriggerId
+	Before  []Wire
+	After   []Wire
+}
+
+func (self DeltaTriggerWired) Apply(world World) (World, error) {
+	level, err := world.deltaLevel(self.Level)
+	if err != nil {
+		return world, err
+	}
+	trigger, ok := level.Triggers.Get(self.Trigger)
+	if !ok || !sameWires(trigger.Wires, self.Before) {
+		return world, DELTA_TRIGGER_CHANGED
+	}
+	trigger.Wires = self.After
+	level.Triggers = level.Triggers.Set(self.Trigger, trigger)
+	return world.SetLevel(self.Level, level), nil
+}
+
+func (self DeltaTriggerWired) Reverse() Delta {
+	return DeltaTriggerWired{self.Level, self.Trigger, self.After, self.Before}
+}
+
+func (self DeltaTriggerWired) String() string {
+	return fmt.Sprintf("trigger %v goes from %v to %v wires", self.Trigger, len(self.Before), len(self.After))
+}
+
+// sameWires tells whether two triggers have the same wires.  A trigger without
+// wires may have a nil or an empty slice.
+func sameWires(a, b []Wire) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameTrigger(a, b Trigger) bool {
+	return a.Kind == b.Kind && a.Anchor == b.Anchor && a.On == b.On && sameWires(a.Wires, b.Wires)
+}
@@ -0,0 +1,71 @@
+package world
+
+import (
+	"testing"
+)
+
+func TestTriggersAtLocation(test *testing.T) {
+	triggers, plate := MakeTriggers().Add(MakeTrigger(TRIGGER_PLATE, Anchor{Location: Location{1, 0}}))
+	triggers, lever := triggers.Add(MakeTrigger(TRIGGER_LEVER, Anchor{Location{1, 0}, true, NORTH()}))
+	if ids := triggers.AtLocation(Location{1, 0}); len(ids) != 2 || ids[0] != plate || ids[1] != lever {
+		test.Error("Wrong triggers:", ids)
+	}
+	moved, _ := triggers.Get(plate)
+	moved.Anchor.Location = Location{2, 0}
+	triggers = triggers.Set(plate, moved).Delete(lever)
+	if ids := triggers.AtLocation(Location{1, 0}); len(ids) != 0 {
+		test.Error("Triggers left behind:", ids)
+	}
+	if id, _, ok := triggers.At(moved.Anchor); !ok || id != plate {
+		test.Error("The plate did not move.")
+	}
+}
+
+// Only the plates where things moved react: the plate under the player
+// switches on, the plate under an item left by the editor stays off.
+func TestPressWhereThingsMoved(test *testing.T) {
+	world := MakeWorld()
+	level := world.Levels[0]
+	level.Triggers, _ = level.Triggers.Add(MakeTrigger(TRIGGER_PLATE, Anchor{Location: Location{1, 0}}))
+	level.Triggers, _ = level.Triggers.Add(MakeTrigger(TRIGGER_PLATE, Anchor{Location: Location{5, 5}}))
+	items, item_id := level.Items.Add(MakeItem(0, "rock", EQUIP_NONE))
+	level.Items = items
+	level.ItemLocation, _ = level.ItemLocation.Add(item_id, Location{5, 5})
+	world = world.SetLevel(0, level)
+
+	player_id, _ := level.CreatureActor.GetCreature(world.Player_id)
+	delta, err := world.React(DeltaCreatureMoved{0, player_id, Location{0, 0}, Location{1, 0}})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if world, err = delta.Apply(world); err != nil {
+		test.Fatal(err)
+	}
+	triggers := world.Levels[0].Triggers
+	if plate, _ := triggers.Get(0); !plate.On {
+		test.Error("The plate under the player is off.")
+	}
+	if plate, _ := triggers.Get(1); plate.On {
+		test.Error("The plate under the item switched on.")
+	}
+}
+
+// An item falling between two pits leading into each other never settles.
+func TestReactionsThatGoOn(test *testing.T) {
+	world := MakeWorld()
+	level := world.Levels[0]
+	closed := MakePit(0, EAST(), false, LevelLocation{0, Location{3, 0}})
+	open := closed
+	open.Open = true
+	level.Floors = level.Floors.Set(2, 0, closed)
+	level.Floors = level.Floors.Set(3, 0, MakePit(0, EAST(), true, LevelLocation{0, Location{2, 0}}))
+	items, item_id := level.Items.Add(MakeItem(0, "rock", EQUIP_NONE))
+	level.Items = items
+	level.ItemLocation, _ = level.ItemLocation.Add(item_id, Location{2, 0})
+	world = world.SetLevel(0, level)
+
+	_, err := world.React(DeltaBuildingChanged{0, LAYER_FLOORS, Location{2, 0}, closed, open})
+	if err != DELTA_UNSETTLED {
+		test.Error("The reactions settled:", err)
+	}
+}
@@ -0,0 +1,514 @@
+package world
+
+import (
+	"fmt"
+	"pmap"
+	"sort"
+	"strings"
+)
+
+// The indexes of a Level must agree with each other.  Each index checks its
+// own consistency (see CreatureActor.IsSane for example), but only Validate
+// checks them against each other.
+
+type ProblemKind int
+
+const (
+	PB_CREATURE_ACTOR_INSANE = ProblemKind(iota)
+	PB_CREATURE_LOCATION_INSANE
+	PB_LOCATED_CREATURE_MISSING
+	PB_CREATURE_NOT_LOCATED
+	PB_ACTED_CREATURE_MISSING
+	PB_CREATURE_ACTOR_MISSING
+	PB_CREATURE_ID_NOT_ALLOCATED
+	PB_ACTOR_ID_NOT_ALLOCATED
+	PB_SCHEDULED_ACTOR_MISSING
+	PB_ACTOR_SCHEDULED_TWICE
+	PB_CREATURE_WITHOUT_FLOOR
+	PB_NOT_A_FLOOR
+	PB_NOT_A_WALL
+	PB_ACTOR_IN_SEVERAL_LEVELS
+	PB_CREATURE_IN_SEVERAL_LEVELS
+	PB_PLAYER_MISSING
+	PB_PASSAGE_TO_NOWHERE
+	PB_NOT_A_DOOR
+	PB_DOOR_ONE_SIDED
+	PB_ITEM_LOCATION_INSANE
+	PB_LOCATED_ITEM_MISSING
+	PB_CARRIED_ITEM_MISSING
+	PB_CARRIER_MISSING
+	PB_ITEM_IN_SEVERAL_PLACES
+	PB_ITEM_NOWHERE
+	PB_ITEM_ID_NOT_ALLOCATED
+	PB_ITEM_IN_SEVERAL_LEVELS
+	PB_DEAD_CREATURE
+	PB_MECHANISM_ACTOR_MISSING
+	PB_ACTOR_TWO_BODIES
+	PB_WIRE_TO_NOWHERE
+	PB_PROJECTILE_ACTOR_MISSING
+	PB_FLYING_ITEM_MISSING
+	PB_CREATURE_LEVEL_UNKNOWN
+	PB_ACTOR_LEVEL_UNKNOWN
+)
+
+var problem_kind_text = map[ProblemKind]string{
+	PB_CREATURE_ACTOR_INSANE:      "creature/actor index insane",
+	PB_CREATURE_LOCATION_INSANE:   "creature/location index insane",
+	PB_LOCATED_CREATURE_MISSING:   "located creature does not exist",
+	PB_CREATURE_NOT_LOCATED:       "creature has no location",
+	PB_ACTED_CREATURE_MISSING:     "creature of an actor does not exist",
+	PB_CREATURE_ACTOR_MISSING:     "actor of a creature does not exist",
+	PB_CREATURE_ID_NOT_ALLOCATED:  "creature identifier beyond the next one",
+	PB_ACTOR_ID_NOT_ALLOCATED:     "actor identifier beyond the next one",
+	PB_SCHEDULED_ACTOR_MISSING:    "scheduled actor does not exist",
+	PB_ACTOR_SCHEDULED_TWICE:      "actor scheduled more than once",
+	PB_CREATURE_WITHOUT_FLOOR:     "creature stands on no floor",
+	PB_NOT_A_FLOOR:                "building in the floors is not a floor",
+	PB_NOT_A_WALL:                 "building in the walls is not a wall",
+	PB_ACTOR_IN_SEVERAL_LEVELS:    "actor in several levels",
+	PB_CREATURE_IN_SEVERAL_LEVELS: "creature in several levels",
+	PB_PLAYER_MISSING:             "player actor does not exist",
+	PB_PASSAGE_TO_NOWHERE:         "passage leads to an inexistent level",
+	PB_NOT_A_DOOR:                 "building in the doors is not a door",
+	PB_DOOR_ONE_SIDED:             "door in a wall has no other side",
+	PB_ITEM_LOCATION_INSANE:       "item/location index insane",
+	PB_LOCATED_ITEM_MISSING:       "located item does not exist",
+	PB_CARRIED_ITEM_MISSING:       "carried item does not exist",
+	PB_CARRIER_MISSING:            "creature of an inventory does not exist",
+	PB_ITEM_IN_SEVERAL_PLACES:     "item in several places",
+	PB_ITEM_NOWHERE:               "item neither on the ground nor carried",
+	PB_ITEM_ID_NOT_ALLOCATED:      "item identifier beyond the next one",
+	PB_ITEM_IN_SEVERAL_LEVELS:     "item in several levels",
+	PB_DEAD_CREATURE:              "dead creature still in the level",
+	PB_MECHANISM_ACTOR_MISSING:    "actor of a mechanism does not exist",
+	PB_ACTOR_TWO_BODIES:           "actor has several bodies",
+	PB_WIRE_TO_NOWHERE:            "trigger wired to nothing",
+	PB_PROJECTILE_ACTOR_MISSING:   "actor of a projectile does not exist",
+	PB_FLYING_ITEM_MISSING:        "item carried by a projectile does not exist",
+	PB_CREATURE_LEVEL_UNKNOWN:     "creature not in the level the travellers tell",
+	PB_ACTOR_LEVEL_UNKNOWN:        "actor not in the level the travellers tell",
+}
+
+func (self ProblemKind) String() string {
+	return problem_kind_text[self]
+}
+
+// A Problem is an inconsistency found by Validate.  Only the fields relevant
+// to its Kind are set.
+type Problem struct {
+	Kind        ProblemKind
+	Level       LevelId
+	Location    Location
+	Creature_id CreatureId
+	Actor_id    ActorID
+	Item_id     ItemId
+	Err         error // Error returned by an IsSane method.
+}
+
+func (self Problem) String() string {
+	switch self.Kind {
+	case PB_CREATURE_ACTOR_INSANE, PB_CREATURE_LOCATION_INSANE,
+		PB_ITEM_LOCATION_INSANE:
+		return fmt.Sprintf("level %v: %v: %v", self.Level, self.Kind, self.Err)
+	case PB_LOCATED_CREATURE_MISSING, PB_CREATURE_WITHOUT_FLOOR:
+		return fmt.Sprintf("level %v: %v: creature %v at %v",
+			self.Level, self.Kind, self.Creature_id, self.Location)
+	case PB_CREATURE_NOT_LOCATED, PB_CREATURE_ID_NOT_ALLOCATED,
+		PB_CREATURE_IN_SEVERAL_LEVELS, PB_CARRIER_MISSING, PB_DEAD_CREATURE,
+		PB_CREATURE_LEVEL_UNKNOWN:
+		return fmt.Sprintf("level %v: %v: creature %v",
+			self.Level, self.Kind, self.Creature_id)
+	case PB_ACTED_CREATURE_MISSING, PB_CREATURE_ACTOR_MISSING:
+		return fmt.Sprintf("level %v: %v: creature %v, actor %v",
+			self.Level, self.Kind, self.Creature_id, self.Actor_id)
+	case PB_ACTOR_ID_NOT_ALLOCATED, PB_SCHEDULED_ACTOR_MISSING,
+		PB_ACTOR_SCHEDULED_TWICE, PB_ACTOR_IN_SEVERAL_LEVELS, PB_PLAYER_MISSING,
+		PB_MECHANISM_ACTOR_MISSING, PB_ACTOR_TWO_BODIES,
+		PB_PROJECTILE_ACTOR_MISSING, PB_ACTOR_LEVEL_UNKNOWN:
+		return fmt.Sprintf("level %v: %v: actor %v",
+			self.Level, self.Kind, self.Actor_id)
+	case PB_LOCATED_ITEM_MISSING:
+		return fmt.Sprintf("level %v: %v: item %v at %v",
+			self.Level, self.Kind, self.Item_id, self.Location)
+	case PB_CARRIED_ITEM_MISSING:
+		return fmt.Sprintf("level %v: %v: item %v, creature %v",
+			self.Level, self.Kind, self.Item_id, self.Creature_id)
+	case PB_FLYING_ITEM_MISSING:
+		return fmt.Sprintf("level %v: %v: item %v, actor %v",
+			self.Level, self.Kind, self.Item_id, self.Actor_id)
+	case PB_ITEM_IN_SEVERAL_PLACES, PB_ITEM_NOWHERE, PB_ITEM_ID_NOT_ALLOCATED,
+		PB_ITEM_IN_SEVERAL_LEVELS:
+		return fmt.Sprintf("level %v: %v: item %v",
+			self.Level, self.Kind, self.Item_id)
+	}
+	return fmt.Sprintf("level %v: %v: at %v", self.Level, self.Kind, self.Location)
+}
+
+// Problems is the list of problems found by Validate.  It is also an error,
+// so that it can be returned as such.
+type Problems []Problem
+
+func (self Problems) Error() string {
+	lines := make([]string, len(self))
+	for i, problem := range self {
+		lines[i] = problem.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate cross-checks all the indexes of the level, and returns the
+// problems found.  A sane level returns no problem at all.
+func (self Level) Validate() Problems {
+	var problems Problems
+	add := func(problem Problem) {
+		problems = append(problems, problem)
+	}
+	if err := self.CreatureActor.IsSane(); err != nil {
+		add(Problem{Kind: PB_CREATURE_ACTOR_INSANE, Err: err})
+	}
+	if err := self.CreatureLocation.IsSane(); err != nil {
+		add(Problem{Kind: PB_CREATURE_LOCATION_INSANE, Err: err})
+	}
+	self.CreatureLocation.ForEach(func(creature_id CreatureId, location Location) {
+		if _, ok := self.Creatures.Get(creature_id); !ok {
+			add(Problem{
+				Kind:        PB_LOCATED_CREATURE_MISSING,
+				Creature_id: creature_id,
+				Location:    location,
+			})
+		}
+		if _, ok := self.Floors.Get(location.X, location.Y); !ok {
+			add(Problem{
+				Kind:        PB_CREATURE_WITHOUT_FLOOR,
+				Creature_id: creature_id,
+				Location:    location,
+			})
+		}
+	})
+	self.Creatures.ForEach(func(creature_id CreatureId, creature Creature) {
+		if _, ok := self.CreatureLocation.GetLocation(creature_id); !ok {
+			add(Problem{Kind: PB_CREATURE_NOT_LOCATED, Creature_id: creature_id})
+		}
+		next_id := self.Creatures.Next_id
+		if creature_id >= next_id && sameRange(uint64(creature_id), uint64(next_id)) {
+			add(Problem{Kind: PB_CREATURE_ID_NOT_ALLOCATED, Creature_id: creature_id})
+		}
+		if creature.IsDead() {
+			add(Problem{Kind: PB_DEAD_CREATURE, Creature_id: creature_id})
+		}
+	})
+	self.CreatureActor.ForEach(func(creature_id CreatureId, actor_id ActorID) {
+		if _, ok := self.Creatures.Get(creature_id); !ok {
+			add(Problem{
+				Kind:        PB_ACTED_CREATURE_MISSING,
+				Creature_id: creature_id,
+				Actor_id:    actor_id,
+			})
+		}
+		if _, ok := self.Actors.Get(actor_id); !ok {
+			add(Problem{
+				Kind:        PB_CREATURE_ACTOR_MISSING,
+				Creature_id: creature_id,
+				Actor_id:    actor_id,
+			})
+		}
+	})
+	self.Actors.ForEach(func(actor_id ActorID, actor Actor) {
+		next_id := self.Actors.NextIDprivate
+		if actor_id >= next_id && sameRange(uint64(actor_id), uint64(next_id)) {
+			add(Problem{Kind: PB_ACTOR_ID_NOT_ALLOCATED, Actor_id: actor_id})
+		}
+	})
+	self.Mechanisms.ForEach(func(actor_id ActorID, mechanism Mechanism) {
+		if _, ok := self.Actors.Get(actor_id); !ok {
+			add(Problem{Kind: PB_MECHANISM_ACTOR_MISSING, Actor_id: actor_id})
+		}
+		if _, ok := self.CreatureActor.GetCreature(actor_id); ok {
+			add(Problem{Kind: PB_ACTOR_TWO_BODIES, Actor_id: actor_id})
+		}
+	})
+	self.Projectiles.ForEach(func(actor_id ActorID, projectile Projectile) {
+		if _, ok := self.Actors.Get(actor_id); !ok {
+			add(Problem{Kind: PB_PROJECTILE_ACTOR_MISSING, Actor_id: actor_id})
+		}
+		_, creature := self.CreatureActor.GetCreature(actor_id)
+		_, mechanism := self.Mechanisms.Get(actor_id)
+		if creature || mechanism {
+			add(Problem{Kind: PB_ACTOR_TWO_BODIES, Actor_id: actor_id})
+		}
+	})
+	self.Triggers.ForEach(func(trigger_id TriggerId, trigger Trigger) {
+		for _, wire := range trigger.Wires {
+			var ok bool
+			switch wire.Target.Kind {
+			case TARGET_DOOR:
+				_, ok = self.GetDoor(wire.Target.Door)
+			case TARGET_MECHANISM:
+				_, ok = self.Mechanisms.Get(wire.Target.Mechanism)
+			case TARGET_LIGHT:
+				_, ok = self.Lights.Get(wire.Target.Light)
+			case TARGET_FLOOR_EFFECT:
+				_, ok = self.Effects.Get(wire.Target.Effect)
+			case TARGET_PIT:
+				building, _ := self.Floors.Get(wire.Target.Pit.X, wire.Target.Pit.Y)
+				_, ok = building.(Pit)
+			}
+			if !ok {
+				add(Problem{Kind: PB_WIRE_TO_NOWHERE, Location: trigger.Anchor.Location})
+			}
+		}
+	})
+	scheduled := make(map[ActorID]bool, len(self.ActorSchedule.Actor_times))
+	for _, actor_time := range self.ActorSchedule.Actor_times {
+		actor_id := actor_time.Actor_id
+		if _, ok := self.Actors.Get(actor_id); !ok {
+			add(Problem{Kind: PB_SCHEDULED_ACTOR_MISSING, Actor_id: actor_id})
+		}
+		if scheduled[actor_id] {
+			add(Problem{Kind: PB_ACTOR_SCHEDULED_TWICE, Actor_id: actor_id})
+		}
+		scheduled[actor_id] = true
+	}
+	self.Floors.ForEach(func(location Location, building Building) {
+		if _, ok := building.(Passer); !ok {
+			add(Problem{Kind: PB_NOT_A_FLOOR, Location: location})
+		}
+	})
+	for i := range self.Walls {
+		self.Walls[i].ForEach(func(location Location, building Building) {
+			switch building.(type) {
+			case Wall:
+			case Door:
+				slot := DoorSlot{Location: location, In_wall: true, Facing: absoluteDirection{i}}
+				if _, ok := self.GetDoor(slot.otherSide()); !ok {
+					add(Problem{Kind: PB_DOOR_ONE_SIDED, Location: location})
+				}
+			default:
+				add(Problem{Kind: PB_NOT_A_WALL, Location: location})
+			}
+		})
+	}
+	self.Doors.ForEach(func(location Location, building Building) {
+		if _, ok := building.(Door); !ok {
+			add(Problem{Kind: PB_NOT_A_DOOR, Location: location})
+		}
+	})
+	if err := self.ItemLocation.IsSane(); err != nil {
+		add(Problem{Kind: PB_ITEM_LOCATION_INSANE, Err: err})
+	}
+	// Each item must be in exactly one place: on the ground, carried or flying.
+	places := make(map[ItemId]int, self.Items.Len())
+	self.ItemLocation.ForEach(func(item_id ItemId, location Location) {
+		if _, ok := self.Items.Get(item_id); !ok {
+			add(Problem{
+				Kind:     PB_LOCATED_ITEM_MISSING,
+				Item_id:  item_id,
+				Location: location,
+			})
+		}
+		places[item_id]++
+	})
+	self.Inventories.ForEach(func(creature_id CreatureId, inventory Inventory) {
+		if _, ok := self.Creatures.Get(creature_id); !ok {
+			add(Problem{Kind: PB_CARRIER_MISSING, Creature_id: creature_id})
+		}
+		for _, item_id := range inventory.Items() {
+			if _, ok := self.Items.Get(item_id); !ok {
+				add(Problem{
+					Kind:        PB_CARRIED_ITEM_MISSING,
+					Item_id:     item_id,
+					Creature_id: creature_id,
+				})
+			}
+			places[item_id]++
+		}
+	})
+	self.Projectiles.ForEach(func(actor_id ActorID, projectile Projectile) {
+		if projectile.Item == NO_ITEM {
+			return
+		}
+		if _, ok := self.Items.Get(projectile.Item); !ok {
+			add(Problem{
+				Kind:     PB_FLYING_ITEM_MISSING,
+				Item_id:  projectile.Item,
+				Actor_id: actor_id,
+			})
+		}
+		places[projectile.Item]++
+	})
+	self.Items.ForEach(func(item_id ItemId, item Item) {
+		switch places[item_id] {
+		case 0:
+			add(Problem{Kind: PB_ITEM_NOWHERE, Item_id: item_id})
+		case 1:
+		default:
+			add(Problem{Kind: PB_ITEM_IN_SEVERAL_PLACES, Item_id: item_id})
+		}
+		next_id := self.Items.Next_id
+		if item_id >= next_id && sameRange(uint64(item_id), uint64(next_id)) {
+			add(Problem{Kind: PB_ITEM_ID_NOT_ALLOCATED, Item_id: item_id})
+		}
+	})
+	sort.Sort(problemsByKind(problems))
+	return problems
+}
+
+// sameRange tells whether two identifiers were allocated by the same level.
+// Identifiers coming from other levels are not expected to be below the
+// counter of this level.
+func sameRange(a, b uint64) bool {
+	return a>>levelIdShift == b>>levelIdShift
+}
+
+// Validate validates all the levels of the world, and checks that they agree
+// with each other.
+func (self World) Validate() Problems {
+	var problems Problems
+	actor_levels := make(map[ActorID]LevelId)
+	creature_levels := make(map[CreatureId]LevelId)
+	item_levels := make(map[ItemId]LevelId)
+	for _, level_id := range self.Levels.Ids() {
+		level := self.Levels[level_id]
+		for _, problem := range level.Validate() {
+			problem.Level = level_id
+			problems = append(problems, problem)
+		}
+		level.Actors.ForEach(func(actor_id ActorID, actor Actor) {
+			if _, ok := actor_levels[actor_id]; ok {
+				problems = append(problems, Problem{
+					Kind:     PB_ACTOR_IN_SEVERAL_LEVELS,
+					Level:    level_id,
+					Actor_id: actor_id,
+				})
+			}
+			actor_levels[actor_id] = level_id
+		})
+		level.Creatures.ForEach(func(creature_id CreatureId, creature Creature) {
+			if _, ok := creature_levels[creature_id]; ok {
+				problems = append(problems, Problem{
+					Kind:        PB_CREATURE_IN_SEVERAL_LEVELS,
+					Level:       level_id,
+					Creature_id: creature_id,
+				})
+			}
+			creature_levels[creature_id] = level_id
+		})
+		level.Items.ForEach(func(item_id ItemId, item Item) {
+			if _, ok := item_levels[item_id]; ok {
+				problems = append(problems, Problem{
+					Kind:    PB_ITEM_IN_SEVERAL_LEVELS,
+					Level:   level_id,
+					Item_id: item_id,
+				})
+			}
+			item_levels[item_id] = level_id
+		})
+		level.Floors.ForEach(func(location Location, building Building) {
+			var destination LevelId
+			switch building := building.(type) {
+			case Passage:
+				destination = building.Destination(location.ToPosition(EAST())).Level
+			case Pit:
+				destination = building.To.Level
+			default:
+				return
+			}
+			if _, ok := self.Levels[destination]; !ok {
+				problems = append(problems, Problem{
+					Kind:     PB_PASSAGE_TO_NOWHERE,
+					Level:    level_id,
+					Location: location,
+				})
+			}
+		})
+		level.Effects.ForEach(func(effect_id FloorEffectId, effect FloorEffect) {
+			if effect.Kind != EFFECT_TELEPORTER {
+				return
+			}
+			if _, ok := self.Levels[effect.To.Level]; !ok {
+				problems = append(problems, Problem{
+					Kind:     PB_PASSAGE_TO_NOWHERE,
+					Level:    level_id,
+					Location: effect.Location,
+				})
+			}
+		})
+	}
+	// Travellers that are not where the index tells.
+	var lost Problems
+	for creature_id, level_id := range creature_levels {
+		if self.Travellers.creatureLevel(creature_id) != level_id {
+			lost = append(lost, Problem{
+				Kind:        PB_CREATURE_LEVEL_UNKNOWN,
+				Level:       level_id,
+				Creature_id: creature_id,
+			})
+		}
+	}
+	self.Travellers.creatures.ForEach(func(key pmap.Key, value interface{}) {
+		if _, ok := creature_levels[key.(CreatureId)]; !ok {
+			lost = append(lost, Problem{
+				Kind:        PB_CREATURE_LEVEL_UNKNOWN,
+				Level:       value.(LevelId),
+				Creature_id: key.(CreatureId),
+			})
+		}
+	})
+	for actor_id, level_id := range actor_levels {
+		if self.Travellers.actorLevel(actor_id) != level_id {
+			lost = append(lost, Problem{
+				Kind:     PB_ACTOR_LEVEL_UNKNOWN,
+				Level:    level_id,
+				Actor_id: actor_id,
+			})
+		}
+	}
+	self.Travellers.actors.ForEach(func(key pmap.Key, value interface{}) {
+		if _, ok := actor_levels[key.(ActorID)]; !ok {
+			lost = append(lost, Problem{
+				Kind:     PB_ACTOR_LEVEL_UNKNOWN,
+				Level:    value.(LevelId),
+				Actor_id: key.(ActorID),
+			})
+		}
+	})
+	sort.Sort(problemsByKind(lost))
+	problems = append(problems, lost...)
+	if _, ok := actor_levels[self.Player_id]; !ok {
+		problems = append(problems, Problem{
+			Kind:     PB_PLAYER_MISSING,
+			Actor_id: self.Player_id,
+		})
+	}
+	return problems
+}
+
+// problemsByKind sorts problems so that the output of Validate does not
+// depend on the iteration order of maps.
+type problemsByKind Problems
+
+func (self problemsByKind) Len() int {
+	return len(self)
+}
+func (self problemsByKind) Less(i, j int) bool {
+	a, b := self[i], self[j]
+	if a.Kind != b.Kind {
+		return a.Kind < b.Kind
+	}
+	if a.Creature_id != b.Creature_id {
+		return a.Creature_id < b.Creature_id
+	}
+	if a.Actor_id != b.Actor_id {
+		return a.Actor_id < b.Actor_id
+	}
+	if a.Item_id != b.Item_id {
+		return a.Item_id < b.Item_id
+	}
+	if a.Location.X != b.Location.X {
+		return a.Location.X < b.Location.X
+	}
+	return a.Location.Y < b.Location.Y
+}
+func (self problemsByKind) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+}
@@ -0,0 +1,194 @@
+package world
+
+import (
+	"testing"
+)
+
+// saneWorld is a World with the player in level 0, a level 1 full of things
+// and an empty level 2 for its ladder to lead to.  It has no problem at all.
+func saneWorld(test *testing.T) World {
+	w := savableWorld().SetLevel(1, fullLevel(test)).SetLevel(2, MakeLevel(2))
+	if problems := w.Validate(); len(problems) != 0 {
+		test.Fatal(problems)
+	}
+	return w
+}
+
+// The things of the full level that the corruptions below break.
+type fullThings struct {
+	monster  CreatureId
+	actor    ActorID // Of the monster.
+	launcher ActorID
+	arrow    ActorID
+	rock     ItemId // On the ground.
+	sword    ItemId // Equipped by the monster.
+}
+
+func findFullThings(level Level) fullThings {
+	var things fullThings
+	things.monster, _ = level.CreatureLocation.GetCreature(Location{1, 1})
+	things.actor, _ = level.CreatureActor.GetActor(things.monster)
+	level.Mechanisms.ForEach(func(actor_id ActorID, mechanism Mechanism) {
+		things.launcher = actor_id
+	})
+	level.Projectiles.ForEach(func(actor_id ActorID, projectile Projectile) {
+		things.arrow = actor_id
+	})
+	things.rock, _ = level.ItemLocation.Top(Location{2, 2})
+	things.sword = level.Inventories.Get(things.monster).Equipped[EQUIP_HAND]
+	return things
+}
+
+// Each kind of problem, and how to break a sane World to get it.  The levels
+// given are copies of levels 0 and 1 of the World; they are put back after.
+var corruptions = map[ProblemKind]func(w *World, home, full *Level, things fullThings){
+	PB_CREATURE_ACTOR_INSANE: func(w *World, home, full *Level, things fullThings) {
+		full.CreatureActor.ac = full.CreatureActor.ac.Delete(things.actor)
+	},
+	PB_CREATURE_LOCATION_INSANE: func(w *World, home, full *Level, things fullThings) {
+		full.CreatureLocation.lc = full.CreatureLocation.lc.Delete(Location{1, 1})
+	},
+	PB_LOCATED_CREATURE_MISSING: func(w *World, home, full *Level, things fullThings) {
+		full.Creatures = full.Creatures.Delete(things.monster)
+	},
+	PB_CREATURE_NOT_LOCATED: func(w *World, home, full *Level, things fullThings) {
+		full.CreatureLocation, _ = full.CreatureLocation.RemoveCreature(things.monster)
+	},
+	PB_ACTED_CREATURE_MISSING: func(w *World, home, full *Level, things fullThings) {
+		full.Creatures = full.Creatures.Delete(things.monster)
+	},
+	PB_CREATURE_ACTOR_MISSING: func(w *World, home, full *Level, things fullThings) {
+		full.Actors = full.Actors.Delete(things.actor)
+	},
+	PB_CREATURE_ID_NOT_ALLOCATED: func(w *World, home, full *Level, things fullThings) {
+		full.Creatures.Next_id = things.monster
+	},
+	PB_ACTOR_ID_NOT_ALLOCATED: func(w *World, home, full *Level, things fullThings) {
+		full.Actors.NextIDprivate = things.arrow
+	},
+	PB_SCHEDULED_ACTOR_MISSING: func(w *World, home, full *Level, things fullThings) {
+		full.ActorSchedule = full.ActorSchedule.Add(things.arrow+1, 1000)
+	},
+	PB_ACTOR_SCHEDULED_TWICE: func(w *World, home, full *Level, things fullThings) {
+		full.ActorSchedule = full.ActorSchedule.Add(things.actor, 2000)
+	},
+	PB_CREATURE_WITHOUT_FLOOR: func(w *World, home, full *Level, things fullThings) {
+		full.Floors = full.Floors.Delete(1, 1)
+	},
+	PB_NOT_A_FLOOR: func(w *World, home, full *Level, things fullThings) {
+		full.Floors = full.Floors.Set(0, 0, MakeBaseBuilding(1))
+	},
+	PB_NOT_A_WALL: func(w *World, home, full *Level, things fullThings) {
+		full.Walls[WEST().Value()] = full.Walls[WEST().Value()].Set(0, 0, MakeBaseBuilding(1))
+	},
+	PB_ACTOR_IN_SEVERAL_LEVELS: func(w *World, home, full *Level, things fullThings) {
+		home.Actors = home.Actors.Insert(things.launcher, MakeActor())
+	},
+	PB_CREATURE_IN_SEVERAL_LEVELS: func(w *World, home, full *Level, things fullThings) {
+		creature, _ := full.Creatures.Get(things.monster)
+		home.Creatures = home.Creatures.Set(things.monster, creature)
+	},
+	PB_PLAYER_MISSING: func(w *World, home, full *Level, things fullThings) {
+		w.Player_id = things.arrow + 1
+	},
+	PB_PASSAGE_TO_NOWHERE: func(w *World, home, full *Level, things fullThings) {
+		full.Floors = full.Floors.Set(0, 0, MakeStairs(4, SOUTH(), LevelPosition{Level: 9}))
+	},
+	PB_NOT_A_DOOR: func(w *World, home, full *Level, things fullThings) {
+		full.Doors = full.Doors.Set(2, 0, MakeWall(5, false))
+	},
+	PB_DOOR_ONE_SIDED: func(w *World, home, full *Level, things fullThings) {
+		full.Walls[NORTH().Value()] = full.Walls[NORTH().Value()].Delete(1, 1)
+	},
+	PB_ITEM_LOCATION_INSANE: func(w *World, home, full *Level, things fullThings) {
+		full.ItemLocation.lp = full.ItemLocation.lp.Delete(Location{2, 2})
+	},
+	PB_LOCATED_ITEM_MISSING: func(w *World, home, full *Level, things fullThings) {
+		full.Items = full.Items.Delete(things.rock)
+	},
+	PB_CARRIED_ITEM_MISSING: func(w *World, home, full *Level, things fullThings) {
+		full.Items = full.Items.Delete(things.sword)
+	},
+	PB_CARRIER_MISSING: func(w *World, home, full *Level, things fullThings) {
+		full.Inventories = full.Inventories.Set(things.monster+1, full.Inventories.Get(things.monster))
+	},
+	PB_ITEM_IN_SEVERAL_PLACES: func(w *World, home, full *Level, things fullThings) {
+		full.ItemLocation, _ = full.ItemLocation.Add(things.sword, Location{2, 2})
+	},
+	PB_ITEM_NOWHERE: func(w *World, home, full *Level, things fullThings) {
+		full.ItemLocation, _ = full.ItemLocation.Remove(things.rock)
+	},
+	PB_ITEM_ID_NOT_ALLOCATED: func(w *World, home, full *Level, things fullThings) {
+		full.Items.Next_id = things.rock
+	},
+	PB_ITEM_IN_SEVERAL_LEVELS: func(w *World, home, full *Level, things fullThings) {
+		rock, _ := full.Items.Get(things.rock)
+		home.Items = home.Items.Set(things.rock, rock)
+	},
+	PB_DEAD_CREATURE: func(w *World, home, full *Level, things fullThings) {
+		creature, _ := full.Creatures.Get(things.monster)
+		full.Creatures = full.Creatures.Set(things.monster, creature.Damage(1000))
+	},
+	PB_MECHANISM_ACTOR_MISSING: func(w *World, home, full *Level, things fullThings) {
+		full.Actors = full.Actors.Delete(things.launcher)
+	},
+	PB_ACTOR_TWO_BODIES: func(w *World, home, full *Level, things fullThings) {
+		full.Mechanisms = full.Mechanisms.Set(things.actor, MakeMechanism(MECHANISM_CRUSHER, Anchor{}))
+	},
+	PB_WIRE_TO_NOWHERE: func(w *World, home, full *Level, things fullThings) {
+		full.Mechanisms = full.Mechanisms.Delete(things.launcher)
+	},
+	PB_PROJECTILE_ACTOR_MISSING: func(w *World, home, full *Level, things fullThings) {
+		full.Actors = full.Actors.Delete(things.arrow)
+	},
+	PB_FLYING_ITEM_MISSING: func(w *World, home, full *Level, things fullThings) {
+		arrow, _ := full.Projectiles.Get(things.arrow)
+		arrow.Item = things.sword + 100
+		full.Projectiles = full.Projectiles.Set(things.arrow, arrow)
+	},
+	PB_CREATURE_LEVEL_UNKNOWN: func(w *World, home, full *Level, things fullThings) {
+		w.Travellers = w.Travellers.placeCreature(things.monster, 0)
+	},
+	PB_ACTOR_LEVEL_UNKNOWN: func(w *World, home, full *Level, things fullThings) {
+		w.Travellers = w.Travellers.placeActor(things.launcher, 0)
+	},
+}
+
+func TestValidate(test *testing.T) {
+	if len(corruptions) != len(problem_kind_text) {
+		test.Errorf("%v kinds of problems, %v tested.", len(problem_kind_text), len(corruptions))
+	}
+	sane := saneWorld(test)
+	things := findFullThings(sane.Levels[1])
+	for kind, corrupt := range corruptions {
+		w := sane
+		w.Levels = MakeLevels()
+		for level_id, level := range sane.Levels {
+			w.Levels = w.Levels.Set(level_id, level)
+		}
+		home, full := w.Levels[0], w.Levels[1]
+		corrupt(&w, &home, &full, things)
+		w = w.SetLevel(0, home).SetLevel(1, full)
+		problems := w.Validate()
+		found := false
+		for _, problem := range problems {
+			found = found || problem.Kind == kind
+		}
+		if !found {
+			test.Errorf("%v: not found in %v", kind, problems)
+		}
+	}
+}
+
+// Problems tell what is wrong, and where.
+func TestProblemString(test *testing.T) {
+	problem := Problem{Kind: PB_CREATURE_WITHOUT_FLOOR, Level: 2, Creature_id: 5, Location: Location{1, 2}}
+	if text := problem.String(); text != "level 2: creature stands on no floor: creature 5 at {1 2}" {
+		test.Error(text)
+	}
+	for kind := range problem_kind_text {
+		if (Problem{Kind: kind}).String() == "" {
+			test.Error(kind, "has no text.")
+		}
+	}
+}
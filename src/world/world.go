@@ -2,66 +2,43 @@
 package world
 
 import (
-	"encoding/gob"
 	"fmt"
-	"os"
 )
 
 // This should go into a package that knows about models.
 type ModelId uint16
 
 type World struct {
-	Player_id ActorID // Later, there will also be a LevelId too in here.
-	Level     Level   // Later, there will be many.
-	Time      uint64  // Nanoseconds.
+	Player_id  ActorID
+	Levels     Levels
+	Time       uint64     // Nanoseconds.
+	Rngs       Rngs       // One generator per Stream.
+	Automap    Automap    // What the player has seen of the levels.
+	Travellers Travellers // Where the creatures and actors that left their level are.
 }
 
-func Load() (*World, error) {
-	f, err := os.Open("quicksave.sav")
-	defer func(f *os.File) {
-		if err_close := f.Close(); err_close != nil {
-			fmt.Printf("File %v closed with error %v.", f, err_close.Error())
-		}
-	}(f)
-	if err != nil {
-		return nil, err
-	}
-	var world World
-	decoder := gob.NewDecoder(f)
-	err = decoder.Decode(&world)
-	return &world, err
-}
-
-func (world *World) Save() error {
-	f, err := os.Create("quicksave.sav")
-	defer func(f *os.File) {
-		if err_close := f.Close(); err_close != nil {
-			fmt.Printf("File %v closed with error %v.", f, err_close.Error())
-		}
-	}(f)
-	if err != nil {
-		return err
-	}
-	encoder := gob.NewEncoder(f)
-	return encoder.Encode(world)
-}
+// The seed of the worlds made by MakeWorld.  Any value will do, as long as it
+// is always the same.
+const world_seed = 20131103
 
 func MakeWorld() World {
 	var world World
-	world.Level = MakeLevel()
+	const level_id = LevelId(0)
+	level := MakeLevel(level_id)
 
 	// Place the player in the world.
-	level := world.Level
-	creature := Creature{F: EAST()}
+	creature := MakeCreature()
+	creature.Faction = FACTION_PLAYER
+	creature.Light = MakeLantern()
 	actors, actor_id := level.Actors.Add(MakeActor())
 	creatures, creature_id := level.Creatures.Add(creature)
 	level.Actors = actors
 	level.Creatures = creatures
 	level.CreatureActor, _ = level.CreatureActor.Add(creature_id, actor_id)
 	level.CreatureLocation, _ = level.CreatureLocation.Add(creature_id, Location{})
-	level.ActorSchedule = MakeActorSchedule()
-	world.Level = level
+	world.Levels = MakeLevels().Set(level_id, level)
 	world.Player_id = actor_id
+	world.Rngs = MakeRngs(world_seed)
 	return world
 }
 
@@ -70,7 +47,116 @@ func (world World) SetTime(time uint64) World {
 	return world
 }
 
-func (world World) SetActorSchedule(actor_schedule ActorSchedule) World {
-	world.Level = world.Level.SetActorSchedule(actor_schedule)
+func (world World) SetRng(stream Stream, rng Rng) World {
+	world.Rngs[stream] = rng
 	return world
 }
+
+func (world World) SetLevel(level_id LevelId, level Level) World {
+	world.Levels = world.Levels.Set(level_id, level)
+	return world
+}
+
+// ReplaceLevel replaces a whole Level, like with one read from a text file,
+// whose creatures and actors may come from other levels.  Unlike SetLevel, it
+// keeps track of where they are.
+func (world World) ReplaceLevel(level_id LevelId, level Level) World {
+	if old, ok := world.Levels[level_id]; ok {
+		world.Travellers = world.Travellers.unindex(old)
+	}
+	world.Travellers = world.Travellers.index(level_id, level)
+	return world.SetLevel(level_id, level)
+}
+
+func (world World) SetActorSchedule(level_id LevelId, actor_schedule ActorSchedule) World {
+	level := world.Levels[level_id]
+	return world.SetLevel(level_id, level.SetActorSchedule(actor_schedule))
+}
+
+// AddLevel adds an empty Level to the World and returns its identifier.  The
+// identifier is the smallest one not in use.
+func (world World) AddLevel() (World, LevelId) {
+	level_id := LevelId(0)
+	for {
+		if _, ok := world.Levels[level_id]; !ok {
+			break
+		}
+		level_id++
+	}
+	return world.SetLevel(level_id, MakeLevel(level_id)), level_id
+}
+
+// ActorLevel returns the identifier of the Level in which the actor is: the
+// one it was made in, unless it travelled.
+func (world World) ActorLevel(actor_id ActorID) (LevelId, bool) {
+	level_id := world.Travellers.actorLevel(actor_id)
+	if _, ok := world.Levels[level_id].Actors.Get(actor_id); !ok {
+		return 0, false
+	}
+	return level_id, true
+}
+
+// CreatureLevel returns the identifier of the Level in which the creature is:
+// the one it was made in, unless it travelled.
+func (world World) CreatureLevel(creature_id CreatureId) (LevelId, bool) {
+	level_id := world.Travellers.creatureLevel(creature_id)
+	if _, ok := world.Levels[level_id].Creatures.Get(creature_id); !ok {
+		return 0, false
+	}
+	return level_id, true
+}
+
+func (world World) ActorLocation(actor_id ActorID) (LevelLocation, bool) {
+	level_id, ok := world.ActorLevel(actor_id)
+	if !ok {
+		return LevelLocation{}, false
+	}
+	location, ok := world.Levels[level_id].ActorLocation(actor_id)
+	return location.ToLevelLocation(level_id), ok
+}
+
+func (world World) ActorPosition(actor_id ActorID) (LevelPosition, bool) {
+	level_id, ok := world.ActorLevel(actor_id)
+	if !ok {
+		return LevelPosition{}, false
+	}
+	position, ok := world.Levels[level_id].ActorPosition(actor_id)
+	return position.ToLevelPosition(level_id), ok
+}
+
+// PlayerLevel returns the identifier of the Level the player is currently in.
+func (world World) PlayerLevel() (LevelId, bool) {
+	return world.ActorLevel(world.Player_id)
+}
+
+// MoveCreature takes a creature out of its Level and puts it at the given
+// position, which can be in another Level.  The creature keeps its
+// identifier, and so does its actor.
+func (world World) MoveCreature(creature_id CreatureId, destination LevelPosition) (World, error) {
+	src_id, ok := world.CreatureLevel(creature_id)
+	if !ok {
+		return world, fmt.Errorf("creature %v is in no level", creature_id)
+	}
+	dst, ok := world.Levels[destination.Level]
+	if !ok {
+		return world, fmt.Errorf("level %v does not exist", destination.Level)
+	}
+	src, traveller, err := world.Levels[src_id].TakeCreature(creature_id)
+	if err != nil {
+		return world, err
+	}
+	if src_id == destination.Level {
+		dst = src
+	}
+	dst, err = dst.PutCreature(traveller, destination.Position)
+	if err != nil {
+		return world, err
+	}
+	world = world.SetLevel(src_id, src)
+	world = world.SetLevel(destination.Level, dst)
+	world.Travellers = world.Travellers.placeCreature(creature_id, destination.Level)
+	if traveller.Has_actor {
+		world.Travellers = world.Travellers.placeActor(traveller.Actor_id, destination.Level)
+	}
+	return world, nil
+}